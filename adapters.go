@@ -0,0 +1,69 @@
+package personnel_sync
+
+import (
+	"errors"
+
+	"github.com/silinternational/personnel-sync/v6/entraid"
+	"github.com/silinternational/personnel-sync/v6/file"
+	"github.com/silinternational/personnel-sync/v6/google"
+	"github.com/silinternational/personnel-sync/v6/internal"
+	"github.com/silinternational/personnel-sync/v6/ldap"
+	"github.com/silinternational/personnel-sync/v6/okta"
+	"github.com/silinternational/personnel-sync/v6/restapi"
+	"github.com/silinternational/personnel-sync/v6/scim"
+	"github.com/silinternational/personnel-sync/v6/slack"
+	"github.com/silinternational/personnel-sync/v6/sql"
+	"github.com/silinternational/personnel-sync/v6/webhelpdesk"
+)
+
+func newSource(config internal.Config) (internal.Source, error) {
+	switch config.Source.Type {
+	case internal.SourceTypeCSV:
+		return file.NewCSVSource(config.Source)
+	case internal.SourceTypeRestAPI:
+		return restapi.NewRestAPISource(config.Source)
+	case internal.SourceTypeGoogleSheets:
+		return google.NewGoogleSheetsSource(config.Source)
+	case internal.SourceTypeLDAP:
+		return ldap.NewLDAPSource(config.Source)
+	case internal.SourceTypeSQL:
+		return sql.NewSQLSource(config.Source)
+	case internal.SourceTypeSCIM:
+		return scim.NewSCIMSource(config.Source)
+	default:
+		return nil, errors.New("unrecognized source type")
+	}
+}
+
+func newDestination(config internal.Config) (internal.Destination, error) {
+	switch config.Destination.Type {
+	case internal.DestinationTypeEntraID:
+		return entraid.NewEntraIDDestination(config.Destination)
+	case internal.DestinationTypeFile:
+		return file.NewFileDestination(config.Destination)
+	case internal.DestinationTypeGoogleContacts:
+		return google.NewGoogleContactsDestination(config.Destination)
+	case internal.DestinationTypeGoogleGroups:
+		return google.NewGoogleGroupsDestination(config.Destination)
+	case internal.DestinationTypeGoogleSheets:
+		return google.NewGoogleSheetsDestination(config.Destination)
+	case internal.DestinationTypeGoogleUsers:
+		return google.NewGoogleUsersDestination(config.Destination)
+	case internal.DestinationTypeLDAP:
+		return ldap.NewLDAPDestination(config.Destination)
+	case internal.DestinationTypeOkta:
+		return okta.NewOktaDestination(config.Destination)
+	case internal.DestinationTypeRestAPI:
+		return restapi.NewRestAPIDestination(config.Destination)
+	case internal.DestinationTypeSCIM:
+		return scim.NewSCIMDestination(config.Destination)
+	case internal.DestinationTypeSlackUserGroups:
+		return slack.NewSlackUserGroupsDestination(config.Destination)
+	case internal.DestinationTypeSQL:
+		return sql.NewSQLDestination(config.Destination)
+	case internal.DestinationTypeWebHelpDesk:
+		return webhelpdesk.NewWebHelpDeskDestination(config.Destination)
+	default:
+		return nil, errors.New("unrecognized destination type")
+	}
+}
@@ -1,18 +1,247 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	sync "github.com/silinternational/personnel-sync/v6"
 )
 
+// Exit codes
+const (
+	exitOK            = 0
+	exitError         = 1 // any error not listed below
+	exitUsage         = 2
+	exitConfig        = 3 // the config is invalid, or an adapter could not be initialized
+	exitSyncSetFailed = 4 // at least one sync set failed, and at least one succeeded
+	exitAllSetsFailed = 5 // every sync set that was run failed
+	exitPlan          = 6 // a plan could not be written, or a saved plan could not be read or verified
+	exitStopped       = 7 // interrupted, or the Runtime.TimeoutSeconds deadline was reached, before all sync sets ran
+)
+
+const usage = `Usage: %[1]s <command> [flags] [config file]
+
+Commands:
+  validate          check the config file and adapter settings, without network access
+  plan              plan the changes without applying them
+  apply             make the changes, or those in a plan saved with "plan --out"
+  list-source       list the people returned by the source for each sync set
+  list-destination  list the people returned by the destination for each sync set
+  serve-scim        serve the people from the source as a read-only SCIM API, until interrupted
+
+If no command is given, all sync sets are run as configured: %[1]s [config file]
+Run "%[1]s <command> -h" for the flags of each command.
+
+Exit codes:
+  0  success
+  1  unexpected error
+  2  invalid command line
+  3  invalid configuration
+  4  some sync sets failed
+  5  all sync sets failed
+  6  plan could not be written or read
+  7  stopped by a signal or the deadline before all sync sets were run
+`
+
+// stringList is a flag that can be repeated or given a comma-separated list
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
 func main() {
-	configFile := ""
-	if len(os.Args) > 1 {
-		configFile = os.Args[1]
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0])
+	}
+	flag.Parse()
+
+	ctx := stopOnSignal()
+
+	if flag.NArg() == 0 {
+		exit(sync.RunSync(ctx, ""))
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "validate":
+		exit(sync.Results{}, validate(args))
+	case "plan":
+		exit(plan(ctx, args))
+	case "apply":
+		exit(apply(ctx, args))
+	case "list-source":
+		exit(sync.Results{}, list(ctx, command, args, sync.ListSource))
+	case "list-destination":
+		exit(sync.Results{}, list(ctx, command, args, sync.ListDestination))
+	case "serve-scim":
+		exit(sync.Results{}, serveSCIM(args))
+	default:
+		// for compatibility, a single argument is the config file for a full sync
+		if flag.NArg() == 1 && !strings.HasPrefix(command, "-") {
+			exit(sync.RunSync(ctx, command))
+		}
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+// stopOnSignal returns a context that asks the run to stop on an interrupt or SIGTERM. No new sync set or batch of
+// changes is started, and the changes in progress are given the stop margin to finish. A second signal ends the
+// program at once.
+func stopOnSignal() context.Context {
+	ctx, stop := sync.WithStop(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("Stopping, send the signal again to end at once")
+		stop()
+		signal.Stop(signals)
+	}()
+	return ctx
+}
+
+// exit ends the program with an exit code chosen by the results and error
+func exit(results sync.Results, err error) {
+	os.Exit(exitCode(results, err))
+}
+
+// exitCode returns the exit code for the results and error of a command
+func exitCode(results sync.Results, err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, sync.ErrConfig):
+		return exitConfig
+	case errors.Is(err, sync.ErrPlan):
+		return exitPlan
+	case errors.Is(err, sync.ErrSyncSetFailed) && results.AllFailed():
+		return exitAllSetsFailed
+	case errors.Is(err, sync.ErrSyncSetFailed):
+		return exitSyncSetFailed
+	case errors.Is(err, sync.ErrStopped):
+		return exitStopped
+	default:
+		return exitError
 	}
-	if err := sync.RunSync(configFile); err != nil {
-		os.Exit(1)
+}
+
+// newFlagSet returns a FlagSet for a command with the flag that selects the sync sets
+func newFlagSet(command string, options *sync.Options) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] [config file]\n", os.Args[0], command)
+		flags.PrintDefaults()
 	}
-	os.Exit(0)
+
+	flags.Var((*stringList)(&options.Only), "only", "run only the named sync set(s), comma-separated or repeated")
+	return flags
+}
+
+// addVerbosityFlag adds the flag that overrides the verbosity of the changes logged, for the commands that plan them
+func addVerbosityFlag(flags *flag.FlagSet, options *sync.Options) {
+	flags.Func("verbosity", "override Runtime.Verbosity", func(value string) error {
+		verbosity, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid verbosity %q", value)
+		}
+		options.Verbosity = &verbosity
+		return nil
+	})
+}
+
+func addDryRunFlag(flags *flag.FlagSet, options *sync.Options) {
+	flags.BoolFunc("dry-run", "override Runtime.DryRunMode, use --dry-run=false to turn it off", func(value string) error {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid dry-run value %q", value)
+		}
+		options.DryRun = &dryRun
+		return nil
+	})
+}
+
+func validate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	if err := sync.ValidateConfig(flags.Arg(0)); err != nil {
+		log.Println(err)
+		return err
+	}
+	log.Println("Configuration is valid")
+	return nil
+}
+
+func plan(ctx context.Context, args []string) (sync.Results, error) {
+	var options sync.Options
+	flags := newFlagSet("plan", &options)
+	addVerbosityFlag(flags, &options)
+	out := flags.String("out", "", "save the plan in JSON format to this file, to be applied with \"apply --plan\"")
+	_ = flags.Parse(args)
+
+	return sync.PlanSync(ctx, flags.Arg(0), *out, options)
+}
+
+func apply(ctx context.Context, args []string) (sync.Results, error) {
+	var options sync.Options
+	flags := newFlagSet("apply", &options)
+	addVerbosityFlag(flags, &options)
+	addDryRunFlag(flags, &options)
+	planFile := flags.String("plan", "", "apply the changes in this plan file instead of planning them again")
+	_ = flags.Parse(args)
+
+	if *planFile != "" {
+		return sync.ApplyPlan(ctx, flags.Arg(0), *planFile, options)
+	}
+	return sync.RunSyncWithOptions(ctx, flags.Arg(0), options)
+}
+
+func list(
+	ctx context.Context,
+	command string,
+	args []string,
+	listFunc func(context.Context, string, sync.Options, string, io.Writer) error,
+) error {
+	var options sync.Options
+	flags := newFlagSet(command, &options)
+	format := flags.String("format", sync.ListFormatJSON, "output format, json or csv")
+	_ = flags.Parse(args)
+
+	if err := listFunc(ctx, flags.Arg(0), options, *format, os.Stdout); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func serveSCIM(args []string) error {
+	var options sync.Options
+	flags := newFlagSet("serve-scim", &options)
+	_ = flags.Parse(args)
+
+	// the server has no changes in progress, so it is stopped at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return sync.ServeSCIM(ctx, flags.Arg(0), options)
 }
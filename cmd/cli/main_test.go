@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	sync "github.com/silinternational/personnel-sync/v6"
+)
+
+func Test_exitCode(t *testing.T) {
+	someFailed := sync.Results{SyncSets: []sync.SyncSetResult{
+		{Name: "a", Status: sync.StatusSucceeded},
+		{Name: "b", Status: sync.StatusFailed},
+	}}
+	allFailed := sync.Results{SyncSets: []sync.SyncSetResult{
+		{Name: "a", Status: sync.StatusFailed},
+		{Name: "b", Status: sync.StatusSkipped},
+	}}
+	setFailed := fmt.Errorf("%w: b failed", sync.ErrSyncSetFailed)
+	stopped := fmt.Errorf("%w: 1 sync sets were not run", sync.ErrStopped)
+
+	tests := []struct {
+		name    string
+		results sync.Results
+		err     error
+		want    int
+	}{
+		{name: "success", results: someFailed, want: exitOK},
+		{name: "unexpected error", err: errors.New("unexpected"), want: exitError},
+		{name: "config", err: fmt.Errorf("%w: bad", sync.ErrConfig), want: exitConfig},
+		{name: "plan", err: fmt.Errorf("%w: unreadable", sync.ErrPlan), want: exitPlan},
+		{name: "some sync sets failed", results: someFailed, err: setFailed, want: exitSyncSetFailed},
+		{name: "all sync sets failed", results: allFailed, err: setFailed, want: exitAllSetsFailed},
+		{name: "stopped", err: stopped, want: exitStopped},
+		{
+			name:    "failed and stopped",
+			results: someFailed,
+			err:     errors.Join(setFailed, stopped),
+			want:    exitSyncSetFailed,
+		},
+		{
+			name: "sync set failed and plan not written",
+			err:  errors.Join(setFailed, fmt.Errorf("%w: unwritable", sync.ErrPlan)),
+			want: exitPlan,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, exitCode(tt.results, tt.err))
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/aws/aws-lambda-go/lambda"
 
 	sync "github.com/silinternational/personnel-sync/v6"
@@ -14,6 +16,9 @@ func main() {
 	lambda.Start(handler)
 }
 
-func handler(lambdaConfig LambdaConfig) error {
-	return sync.RunSync(lambdaConfig.ConfigPath)
+// handler runs the sync and returns a summary of the results. If any sync set failed, the error is returned
+// instead, so that the invocation is reported as failed. No new sync set or batch of changes is started within
+// Runtime.StopMarginSeconds of the Lambda timeout.
+func handler(ctx context.Context, lambdaConfig LambdaConfig) (sync.Results, error) {
+	return sync.RunSync(ctx, lambdaConfig.ConfigPath)
 }
@@ -0,0 +1,104 @@
+package personnel_sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/silinternational/personnel-sync/v6/alert"
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// loadConfig loads, parses and validates the config file, and applies the options. Any error is logged, and an alert
+// is sent if possible. The error wraps ErrConfig.
+func loadConfig(configFile string, options Options) (internal.Config, error) {
+	rawConfig, err := internal.LoadConfig(configFile)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to load config, error: %s", err)
+		log.Println(msg)
+		return internal.Config{}, fmt.Errorf("%w: unable to load config: %w", ErrConfig, err)
+	}
+
+	config, err := internal.ReadConfig(rawConfig)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to read config, error: %s", err)
+		log.Println(msg)
+		alert.SendEmail(config.Alert, msg)
+		return config, fmt.Errorf("%w: unable to read config: %w", ErrConfig, err)
+	}
+
+	if err := options.applyTo(&config); err != nil {
+		log.Println(err)
+		return config, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+
+	return config, nil
+}
+
+// initError logs an error initializing an adapter or state store, sends an alert, and returns an error wrapping
+// ErrConfig
+func initError(config internal.Config, what string, err error) error {
+	msg := fmt.Sprintf("Unable to initialize %s, error: %s", what, err)
+	log.Println(msg)
+	alert.SendEmail(config.Alert, msg)
+	return fmt.Errorf("%w: unable to initialize %s: %w", ErrConfig, what, err)
+}
+
+// ValidateConfig checks that the config file can be parsed, and that the source, destination, state store, and the
+// source and destination settings of every sync set can be initialized. No network requests are made, and no
+// alerts are sent. The error wraps ErrConfig.
+func ValidateConfig(configFile string) error {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	source, err := newSource(config)
+	if err != nil {
+		return fmt.Errorf("%w: unable to initialize %s source: %w", ErrConfig, config.Source.Type, err)
+	}
+
+	// a config for the SCIM server mode may have no destination
+	var destination internal.Destination
+	if config.Destination.Type != "" {
+		destination, err = newDestination(config)
+		if err != nil {
+			return fmt.Errorf("%w: unable to initialize %s destination: %w", ErrConfig, config.Destination.Type, err)
+		}
+	}
+
+	if _, err := internal.NewStateStore(config.State); err != nil {
+		return fmt.Errorf("%w: unable to initialize %s state store: %w", ErrConfig, config.State.Type, err)
+	}
+
+	var errs []error
+	for _, syncSet := range config.SyncSets {
+		if err := source.ForSet(syncSet.Source); err != nil {
+			errs = append(errs, fmt.Errorf(`invalid source set on syncSet "%s": %w`, syncSet.Name, err))
+		}
+		if destination == nil {
+			continue
+		}
+		if err := destination.ForSet(syncSet.Destination); err != nil {
+			errs = append(errs, fmt.Errorf(`invalid destination set on syncSet "%s": %w`, syncSet.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrConfig, errors.Join(errs...))
+	}
+	return nil
+}
+
+// readConfig loads, parses and validates the config file without sending any alerts. The error wraps ErrConfig.
+func readConfig(configFile string) (internal.Config, error) {
+	rawConfig, err := internal.LoadConfig(configFile)
+	if err != nil {
+		return internal.Config{}, fmt.Errorf("%w: unable to load config: %w", ErrConfig, err)
+	}
+
+	config, err := internal.ReadConfig(rawConfig)
+	if err != nil {
+		return config, fmt.Errorf("%w: invalid config: %w", ErrConfig, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,69 @@
+package personnel_sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestConfig(t *testing.T, syncSets string) string {
+	config := `{
+  "Source": {"Type": "CSV", "ExtraJSON": {"CompareAttribute": "email"}},
+  "Destination": {"Type": "File", "ExtraJSON": {"CompareAttribute": "email"}},
+  "AttributeMap": [{"Source": "email", "Destination": "email", "Required": true}],
+  "SyncSets": ` + syncSets + `
+}`
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	return path
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		syncSets string
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			syncSets: `[
+				{"Name": "one", "Source": {"Files": ["one.csv"]}, "Destination": {"Path": "out1.csv"}},
+				{"Name": "two", "Source": {"Files": ["two.csv"]}, "Destination": {"Path": "out2.csv"}}
+			]`,
+		},
+		{
+			name: "errors in every set",
+			syncSets: `[
+				{"Name": "one", "Source": {}, "Destination": {"Path": "out1.csv", "Format": "XML"}},
+				{"Name": "two", "Source": {"Files": ["two.csv"]}, "Destination": {"Path": "out2.csv"}},
+				{"Name": "three", "Source": {"Files": ["three.csv"]}, "Destination": {}}
+			]`,
+			wantErrs: []string{
+				`invalid source set on syncSet "one": no Files are listed in sync set`,
+				`invalid destination set on syncSet "one": `,
+				`invalid destination set on syncSet "three": invalid Path: `,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(writeTestConfig(t, tt.syncSets))
+			if len(tt.wantErrs) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrConfig)
+			for _, want := range tt.wantErrs {
+				require.ErrorContains(t, err, want)
+			}
+			require.NotContains(t, err.Error(), `syncSet "two"`)
+		})
+	}
+}
+
+func TestValidateConfig_unreadable(t *testing.T) {
+	err := ValidateConfig(filepath.Join(t.TempDir(), "missing.json"))
+	require.ErrorIs(t, err, ErrConfig)
+}
@@ -0,0 +1,320 @@
+package entraid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DefaultGraphURL           = "https://graph.microsoft.com/v1.0"
+	DefaultHttpTimeoutSeconds = 45
+	DefaultBatchSize          = 20
+
+	// MaxBatchSize is the largest number of requests Microsoft Graph accepts in one $batch request
+	MaxBatchSize = 20
+
+	// defaultTokenURL is the token endpoint of the Microsoft identity platform, with a placeholder for the tenant
+	defaultTokenURL = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+
+	// pageSize is the number of users requested at a time, the largest Microsoft Graph allows
+	pageSize = 999
+)
+
+// Client holds the settings for calling Microsoft Graph with an app registration's client credentials
+type Client struct {
+	TenantID           string
+	ClientID           string
+	ClientSecret       string
+	TokenURL           string // default https://login.microsoftonline.com/{TenantID}/oauth2/v2.0/token
+	GraphURL           string // default https://graph.microsoft.com/v1.0
+	HttpTimeoutSeconds int    // default 45
+	BatchSize          int    // number of requests in each $batch request, default and maximum 20
+
+	httpClient *http.Client
+}
+
+// Error is an error response from Microsoft Graph
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("Graph error %d", e.Status)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// HTTPStatus returns the status of the error response
+func (e *Error) HTTPStatus() int {
+	return e.Status
+}
+
+type listResponse struct {
+	Value    []map[string]any `json:"value"`
+	NextLink string           `json:"@odata.nextLink"`
+}
+
+// batchRequest is one request in a $batch request. The URL is relative to the GraphURL.
+type batchRequest struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+type batchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// batchResult is the outcome of one request in a $batch request
+type batchResult struct {
+	Body json.RawMessage
+	Err  error
+}
+
+func (c *Client) validate() error {
+	if c.TenantID == "" && c.TokenURL == "" {
+		return errors.New("TenantID is required")
+	}
+	if c.ClientID == "" {
+		return errors.New("ClientID is required")
+	}
+	if c.ClientSecret == "" {
+		return errors.New("ClientSecret is required")
+	}
+
+	if c.TokenURL == "" {
+		c.TokenURL = fmt.Sprintf(defaultTokenURL, url.PathEscape(c.TenantID))
+	} else if !validURL(c.TokenURL) {
+		return fmt.Errorf("invalid TokenURL %q", c.TokenURL)
+	}
+	if c.GraphURL == "" {
+		c.GraphURL = DefaultGraphURL
+	} else if !validURL(c.GraphURL) {
+		return fmt.Errorf("invalid GraphURL %q", c.GraphURL)
+	}
+	c.GraphURL = strings.TrimSuffix(c.GraphURL, "/")
+
+	if c.HttpTimeoutSeconds <= 0 {
+		c.HttpTimeoutSeconds = DefaultHttpTimeoutSeconds
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.BatchSize > MaxBatchSize {
+		return fmt.Errorf("BatchSize may not be more than %d", MaxBatchSize)
+	}
+	return nil
+}
+
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// list returns all objects at the path, following the @odata.nextLink of each page
+func (c *Client) list(ctx context.Context, path string, query url.Values) ([]map[string]any, error) {
+	var objects []map[string]any
+	query.Set("$top", strconv.Itoa(pageSize))
+	requestURL := c.GraphURL + path + "?" + query.Encode()
+	for requestURL != "" {
+		var page listResponse
+		if err := c.do(ctx, http.MethodGet, requestURL, nil, &page); err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Value...)
+		requestURL = page.NextLink
+	}
+	return objects, nil
+}
+
+// batch sends the requests, at most BatchSize of them, in one $batch request and returns their results in the same
+// order. A request that is throttled, or left out of the response, is sent again in another $batch request, after the
+// delay given in its Retry-After header, up to MaxRetries times.
+func (c *Client) batch(ctx context.Context, requests []batchRequest) ([]batchResult, error) {
+	results := make([]batchResult, len(requests))
+	pending := map[string]int{}
+	for i := range requests {
+		requests[i].ID = strconv.Itoa(i + 1)
+		pending[requests[i].ID] = i
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		body := struct {
+			Requests []batchRequest `json:"requests"`
+		}{}
+		for _, request := range requests {
+			if _, ok := pending[request.ID]; ok {
+				body.Requests = append(body.Requests, request)
+			}
+		}
+
+		var response struct {
+			Responses []batchResponse `json:"responses"`
+		}
+		if err := c.do(ctx, http.MethodPost, c.GraphURL+"/$batch", body, &response); err != nil {
+			return nil, err
+		}
+
+		var delay time.Duration
+		for _, r := range response.Responses {
+			i, ok := pending[r.ID]
+			if !ok {
+				continue
+			}
+			if retryable(r.Status) && attempt < internal.MaxRetries {
+				delay = max(delay, internal.RetryDelay(r.Headers["Retry-After"], attempt))
+				continue
+			}
+			delete(pending, r.ID)
+			if r.Status >= http.StatusBadRequest {
+				results[i].Err = newError(r.Status, r.Body)
+			} else {
+				results[i].Body = r.Body
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if attempt >= internal.MaxRetries {
+			for id, i := range pending {
+				results[i].Err = fmt.Errorf("no response to request %s after %d $batch requests", id, attempt+1)
+			}
+			break
+		}
+		if delay == 0 {
+			// a request was left out of the response, so wait before sending it again
+			delay = internal.Backoff(attempt)
+		}
+		if err := internal.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// do sends a request to the URL and decodes the response into out, if it is not nil. A request is retried if
+// Microsoft Graph responds with 429 Too Many Requests, 503 Service Unavailable, or 504 Gateway Timeout, after the
+// delay given in any Retry-After header.
+func (c *Client) do(ctx context.Context, method, requestURL string, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("unable to encode the request to %s: %w", requestURL, err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if method == http.MethodGet {
+			// allows advanced queries, such as a $filter on the members of a group
+			req.Header.Set("ConsistencyLevel", "eventual")
+		}
+
+		resp, err := c.client().Do(req)
+		if err != nil {
+			return fmt.Errorf("%s %s failed: %w", method, requestURL, err)
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read the response to %s %s: %w", method, requestURL, err)
+		}
+
+		if retryable(resp.StatusCode) && attempt < internal.MaxRetries {
+			if err := internal.Sleep(ctx, internal.RetryDelay(resp.Header.Get("Retry-After"), attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return newError(resp.StatusCode, responseBody)
+		}
+		if out == nil || len(responseBody) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(responseBody, out); err != nil {
+			return fmt.Errorf("unable to decode the response to %s %s: %w", method, requestURL, err)
+		}
+		return nil
+	}
+}
+
+// client returns an http.Client that gets an access token from the TokenURL when it is first used, and again when
+// the token expires
+func (c *Client) client() *http.Client {
+	if c.httpClient == nil {
+		base := &http.Client{Timeout: time.Duration(c.HttpTimeoutSeconds) * time.Second}
+		graphURL, _ := url.Parse(c.GraphURL)
+		config := clientcredentials.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			TokenURL:     c.TokenURL,
+			Scopes:       []string{graphURL.Scheme + "://" + graphURL.Host + "/.default"},
+			AuthStyle:    oauth2.AuthStyleInParams,
+		}
+		c.httpClient = config.Client(context.WithValue(context.Background(), oauth2.HTTPClient, base))
+		c.httpClient.Timeout = base.Timeout
+	}
+	return c.httpClient
+}
+
+func newError(status int, body []byte) *Error {
+	e := &Error{Status: status}
+	var response struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+	}
+	if json.Unmarshal(body, &response) == nil {
+		e.Code = response.Error.Code
+		e.Message = response.Error.Message
+	}
+	if e.Code == "" && e.Message == "" {
+		e.Message = strings.TrimSpace(string(body))
+		if len(e.Message) > 200 {
+			e.Message = e.Message[:200]
+		}
+	}
+	return e
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
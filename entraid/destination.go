@@ -0,0 +1,544 @@
+package entraid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DefaultCompareAttribute = "userPrincipalName"
+
+	// MultiValueSeparator separates the values of a multi-valued property, such as businessPhones
+	MultiValueSeparator = "|"
+)
+
+// boolProperties and multiValuedProperties are the user properties that are not strings
+var (
+	boolProperties        = []string{"accountEnabled"}
+	multiValuedProperties = []string{"businessPhones", "imAddresses", "otherMails", "proxyAddresses"}
+)
+
+// EntraIDDestination updates the users of a Microsoft Entra ID tenant through Microsoft Graph, and optionally manages
+// the members of a group. Users are not created or deleted.
+type EntraIDDestination struct {
+	Client
+
+	// DestinationSyncSet holds the defaults for each sync set
+	DestinationSyncSet
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           DestinationSyncSet         `json:"-"`
+
+	groupID string
+
+	// extraMembersFound holds the ExtraMembers found in the group by ListUsers, in lower case
+	extraMembersFound map[string]bool
+}
+
+// DestinationSyncSet configures a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type DestinationSyncSet struct {
+	Filter           string // an OData filter that selects the users to sync, such as "department eq 'Sales'"
+	CompareAttribute string // the user property that identifies a user, default "userPrincipalName"
+
+	// GroupID or GroupMail identifies a group whose members are synced. People found in the source are added to the
+	// group, and people not found are removed from it. Without a group, users are only updated.
+	GroupID      string
+	GroupMail    string
+	ExtraMembers []string // compare values of users that are always members of the group
+}
+
+// NewEntraIDDestination unmarshals the destinationConfig's ExtraJSON into an EntraIDDestination struct. No requests
+// are made until ListUsers or ApplyChangeSet is called.
+func NewEntraIDDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var e EntraIDDestination
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &e); err != nil {
+		return nil, fmt.Errorf("error reading EntraID destination config: %w", err)
+	}
+
+	if err := e.Client.validate(); err != nil {
+		return nil, fmt.Errorf("invalid EntraID destination config: %w", err)
+	}
+
+	e.DestinationConfig = destinationConfig
+	return &e, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (e *EntraIDDestination) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := e.DestinationSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := syncSet.validate(); err != nil {
+		return err
+	}
+
+	e.SyncSet = syncSet
+	e.groupID = syncSet.GroupID
+	e.extraMembersFound = nil
+	return nil
+}
+
+func (s *DestinationSyncSet) validate() error {
+	if s.CompareAttribute == "" {
+		s.CompareAttribute = DefaultCompareAttribute
+	}
+	if strings.Contains(s.CompareAttribute, ".") {
+		return fmt.Errorf("invalid CompareAttribute %q, must be a user property such as mail", s.CompareAttribute)
+	}
+	if s.GroupID != "" && s.GroupMail != "" {
+		return errors.New("only one of GroupID and GroupMail may be set")
+	}
+	if len(s.ExtraMembers) > 0 && s.GroupID == "" && s.GroupMail == "" {
+		return errors.New("ExtraMembers requires GroupID or GroupMail")
+	}
+	return nil
+}
+
+// ListUsers returns the users that match the Filter and, if a group is set, are members of the group. The ID of each
+// person is the user's id. An attribute of a nested property, such as employeeOrgData.costCenter, is named with a
+// dot between the property names.
+func (e *EntraIDDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	path := "/users"
+	if e.grouped() {
+		groupID, err := e.resolveGroupID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		path = "/groups/" + url.PathEscape(groupID) + "/members/microsoft.graph.user"
+	}
+
+	query := url.Values{"$select": {strings.Join(selectProperties(e.SyncSet.CompareAttribute, desiredAttrs), ",")}}
+	if e.SyncSet.Filter != "" {
+		query.Set("$filter", e.SyncSet.Filter)
+		query.Set("$count", "true")
+	}
+	users, err := e.list(ctx, path, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+
+	e.extraMembersFound = map[string]bool{}
+	people := []internal.Person{}
+	for _, user := range users {
+		compareValue := propertyValue(user, e.SyncSet.CompareAttribute)
+		if compareValue == "" {
+			continue
+		}
+		if e.isExtraMember(compareValue) {
+			e.extraMembersFound[strings.ToLower(compareValue)] = true
+			continue
+		}
+
+		attributes := map[string]string{}
+		for _, attr := range desiredAttrs {
+			attributes[attr] = propertyValue(user, attr)
+		}
+		people = append(people, internal.Person{
+			CompareValue: compareValue,
+			ID:           propertyValue(user, "id"),
+			Attributes:   attributes,
+		})
+	}
+	return people, nil
+}
+
+// ApplyChangeSet updates users and, if a group is set, adds people to and removes people from the group. The
+// ExtraMembers are added to the group if they were not found in it. Requests are sent in $batch requests of up to
+// BatchSize requests each.
+func (e *EntraIDDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	var results internal.ChangeResults
+	if internal.Stopping(ctx) {
+		return results
+	}
+
+	if e.grouped() {
+		if _, err := e.resolveGroupID(ctx); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:   syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to apply changes to group %s: %s", e.groupName(), err),
+			}
+			return results
+		}
+	}
+
+	if e.grouped() && !e.DestinationConfig.DisableAdd {
+		toAdd := changes.Create
+		for _, member := range e.SyncSet.ExtraMembers {
+			if !e.extraMembersFound[strings.ToLower(member)] && !containsPerson(toAdd, member) {
+				toAdd = append(toAdd, internal.Person{CompareValue: member})
+			}
+		}
+		e.addMembers(ctx, toAdd, &results.Created, eventLog)
+	}
+
+	if !e.DestinationConfig.DisableUpdate {
+		e.updateUsers(ctx, changes.Update, &results.Updated, eventLog)
+	}
+
+	if e.grouped() && !e.DestinationConfig.DisableDelete {
+		var toRemove []internal.Person
+		for _, person := range changes.Delete {
+			// Do not remove ExtraMembers
+			if !e.isExtraMember(person.CompareValue) {
+				toRemove = append(toRemove, person)
+			}
+		}
+		e.removeMembers(ctx, toRemove, &results.Deleted, eventLog)
+	}
+
+	return results
+}
+
+// addMembers adds the people's users to the group. A user that is already a member is counted as added.
+func (e *EntraIDDestination) addMembers(
+	ctx context.Context,
+	people []internal.Person,
+	counter *uint64,
+	eventLog chan<- internal.EventLogItem,
+) {
+	people, ids := e.personIDs(ctx, people, "unable to add", eventLog)
+
+	requests := make([]batchRequest, len(ids))
+	for i, id := range ids {
+		requests[i] = batchRequest{
+			Method:  http.MethodPost,
+			URL:     "/groups/" + url.PathEscape(e.groupID) + "/members/$ref",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    map[string]string{"@odata.id": e.GraphURL + "/directoryObjects/" + url.PathEscape(id)},
+		}
+	}
+
+	for i, result := range e.send(ctx, requests) {
+		if result.Err != nil && !alreadyMember(result.Err) {
+			eventLog <- internal.EventLogItem{
+				Level:   syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to add %s to group %s: %s", people[i].CompareValue, e.groupName(), result.Err),
+			}
+			continue
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddMember " + people[i].CompareValue}
+		(*counter)++
+	}
+}
+
+// updateUsers sends a PATCH request for each person, with the changed properties. An empty value is set to null.
+func (e *EntraIDDestination) updateUsers(
+	ctx context.Context,
+	people []internal.Person,
+	counter *uint64,
+	eventLog chan<- internal.EventLogItem,
+) {
+	people, ids := e.personIDs(ctx, people, "unable to update", eventLog)
+
+	requests := make([]batchRequest, len(ids))
+	for i, id := range ids {
+		body := map[string]any{}
+		for _, change := range personChanges(people[i]) {
+			if !strings.EqualFold(change.Attribute, "id") {
+				setProperty(body, change.Attribute, change.New)
+			}
+		}
+		requests[i] = batchRequest{
+			Method:  http.MethodPatch,
+			URL:     "/users/" + url.PathEscape(id),
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    body,
+		}
+	}
+
+	for i, result := range e.send(ctx, requests) {
+		if result.Err != nil {
+			eventLog <- internal.ErrorEvent("unable to update", people[i], result.Err)
+			continue
+		}
+		eventLog <- internal.EventLogItem{
+			Level: syslog.LOG_INFO,
+			Message: fmt.Sprintf("UpdatePerson %s, changed: %s", people[i].CompareValue,
+				strings.Join(people[i].ChangedAttributeNames(), ", ")),
+		}
+		(*counter)++
+	}
+}
+
+// removeMembers removes the people's users from the group. A user that is not a member is counted as removed.
+func (e *EntraIDDestination) removeMembers(
+	ctx context.Context,
+	people []internal.Person,
+	counter *uint64,
+	eventLog chan<- internal.EventLogItem,
+) {
+	people, ids := e.personIDs(ctx, people, "unable to remove", eventLog)
+
+	requests := make([]batchRequest, len(ids))
+	for i, id := range ids {
+		requests[i] = batchRequest{
+			Method: http.MethodDelete,
+			URL:    "/groups/" + url.PathEscape(e.groupID) + "/members/" + url.PathEscape(id) + "/$ref",
+		}
+	}
+
+	for i, result := range e.send(ctx, requests) {
+		if result.Err != nil && !internal.IsStatus(result.Err, http.StatusNotFound) {
+			eventLog <- internal.EventLogItem{
+				Level: syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to remove %s from group %s: %s", people[i].CompareValue, e.groupName(),
+					result.Err),
+			}
+			continue
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "RemoveMember " + people[i].CompareValue}
+		(*counter)++
+	}
+}
+
+// personIDs returns the people whose user was found, with the id of each user. The ID set by ListUsers is used if
+// possible, and other users are found by their compare value. An error is logged for each person not found.
+func (e *EntraIDDestination) personIDs(
+	ctx context.Context,
+	people []internal.Person,
+	action string,
+	eventLog chan<- internal.EventLogItem,
+) ([]internal.Person, []string) {
+	var unknown []internal.Person
+	var requests []batchRequest
+	for _, person := range people {
+		if person.ID == "" {
+			filter := e.SyncSet.CompareAttribute + " eq " + quote(person.CompareValue)
+			query := url.Values{"$filter": {filter}, "$select": {"id"}}
+			requests = append(requests, batchRequest{Method: http.MethodGet, URL: "/users?" + query.Encode()})
+			unknown = append(unknown, person)
+		}
+	}
+
+	found := map[string]string{}
+	for i, result := range e.send(ctx, requests) {
+		var response listResponse
+		err := result.Err
+		if err == nil {
+			err = json.Unmarshal(result.Body, &response)
+		}
+		if err == nil && len(response.Value) != 1 {
+			err = fmt.Errorf("%d users have %s %s", len(response.Value), e.SyncSet.CompareAttribute,
+				unknown[i].CompareValue)
+			if len(response.Value) == 0 {
+				err = errors.New("user not found")
+			}
+		}
+		if err != nil {
+			eventLog <- internal.ErrorEvent(action, unknown[i], err)
+			continue
+		}
+		found[unknown[i].CompareValue] = propertyValue(response.Value[0], "id")
+	}
+
+	var foundPeople []internal.Person
+	var ids []string
+	for _, person := range people {
+		id := person.ID
+		if id == "" {
+			id = found[person.CompareValue]
+		}
+		if id != "" {
+			foundPeople = append(foundPeople, person)
+			ids = append(ids, id)
+		}
+	}
+	return foundPeople, ids
+}
+
+// send sends the requests in $batch requests of up to BatchSize requests each, and returns the results in the same
+// order. No more $batch requests are sent once the run is stopping, so there may be fewer results than requests.
+func (e *EntraIDDestination) send(ctx context.Context, requests []batchRequest) []batchResult {
+	var results []batchResult
+	for batch := range slices.Chunk(requests, e.BatchSize) {
+		if internal.Stopping(ctx) {
+			break
+		}
+		batchResults, err := e.batch(ctx, batch)
+		if err != nil {
+			batchResults = make([]batchResult, len(batch))
+			for i := range batchResults {
+				batchResults[i].Err = err
+			}
+		}
+		results = append(results, batchResults...)
+	}
+	return results
+}
+
+// resolveGroupID finds the id of the group with the GroupMail address, if the GroupID is not set
+func (e *EntraIDDestination) resolveGroupID(ctx context.Context) (string, error) {
+	if e.groupID != "" {
+		return e.groupID, nil
+	}
+
+	query := url.Values{"$filter": {"mail eq " + quote(e.SyncSet.GroupMail)}, "$select": {"id"}}
+	groups, err := e.list(ctx, "/groups", query)
+	if err != nil {
+		return "", fmt.Errorf("unable to find group %s: %w", e.groupName(), err)
+	}
+	if len(groups) != 1 {
+		return "", fmt.Errorf("found %d groups with mail %s", len(groups), e.groupName())
+	}
+	id := propertyValue(groups[0], "id")
+	if id == "" {
+		return "", fmt.Errorf("group %s has no id", e.groupName())
+	}
+	e.groupID = id
+	return id, nil
+}
+
+// UpdatesOnly returns true without a group, since users are then only updated, never created or deleted
+func (e *EntraIDDestination) UpdatesOnly() bool {
+	return !e.grouped()
+}
+
+func (e *EntraIDDestination) grouped() bool {
+	return e.SyncSet.GroupID != "" || e.SyncSet.GroupMail != ""
+}
+
+func (e *EntraIDDestination) groupName() string {
+	if e.SyncSet.GroupMail != "" {
+		return e.SyncSet.GroupMail
+	}
+	return e.SyncSet.GroupID
+}
+
+func (e *EntraIDDestination) isExtraMember(compareValue string) bool {
+	return slices.ContainsFunc(e.SyncSet.ExtraMembers, func(member string) bool {
+		return strings.EqualFold(member, compareValue)
+	})
+}
+
+// selectProperties returns the top-level properties of the attributes, to be used in a $select query parameter
+func selectProperties(compareAttribute string, attributes []string) []string {
+	properties := []string{"id", compareAttribute}
+	for _, attr := range attributes {
+		property, _, _ := strings.Cut(attr, ".")
+		if !slices.ContainsFunc(properties, func(p string) bool { return strings.EqualFold(p, property) }) {
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+// propertyValue returns the value of a property as a string, following the dots in the name of a nested property.
+// Property names are matched ignoring case. The values of a multi-valued property are joined with the
+// MultiValueSeparator.
+func propertyValue(object map[string]any, name string) string {
+	var value any = object
+	for _, part := range strings.Split(name, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = nil
+		for key, v := range m {
+			if strings.EqualFold(key, part) {
+				value = v
+				break
+			}
+		}
+	}
+	return formatValue(value)
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = formatValue(item)
+		}
+		return strings.Join(values, MultiValueSeparator)
+	}
+	return ""
+}
+
+// setProperty sets a property in a PATCH request body, creating the objects of a nested property as needed. An
+// empty value is set to null, or to an empty array for a multi-valued property.
+func setProperty(body map[string]any, name, value string) {
+	parts := strings.Split(name, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := body[part].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			body[part] = next
+		}
+		body = next
+	}
+
+	property := parts[len(parts)-1]
+	switch {
+	case len(parts) == 1 && slices.Contains(multiValuedProperties, property):
+		values := []string{}
+		if value != "" {
+			values = strings.Split(value, MultiValueSeparator)
+		}
+		body[property] = values
+	case value == "":
+		body[property] = nil
+	case len(parts) == 1 && slices.Contains(boolProperties, property):
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			body[property] = value
+		} else {
+			body[property] = b
+		}
+	default:
+		body[property] = value
+	}
+}
+
+// personChanges returns the person's changed attributes or, if there are none listed, all of its attributes
+func personChanges(person internal.Person) []internal.AttributeChange {
+	if len(person.Changes) > 0 {
+		return person.Changes
+	}
+	var changes []internal.AttributeChange
+	for attr, value := range person.Attributes {
+		changes = append(changes, internal.AttributeChange{Attribute: attr, New: value})
+	}
+	return changes
+}
+
+// quote returns a string literal for an OData filter
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// alreadyMember returns true if err is the response to adding a user to a group that it is already a member of
+func alreadyMember(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == http.StatusBadRequest && strings.Contains(e.Message, "already exist")
+}
+
+func containsPerson(people []internal.Person, compareValue string) bool {
+	return slices.ContainsFunc(people, func(p internal.Person) bool {
+		return strings.EqualFold(p.CompareValue, compareValue)
+	})
+}
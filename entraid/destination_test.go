@@ -0,0 +1,367 @@
+package entraid
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestEntraIDDestination(t *testing.T, service *testService, extraJSON, syncSet string) *EntraIDDestination {
+	config := `{"TokenURL": "` + service.TokenURL + `", "GraphURL": "` + service.GraphURL + `/", "ClientID": "` +
+		testClientID + `", "ClientSecret": "` + testClientSecret + `", "BatchSize": 2`
+	if extraJSON != "" {
+		config += ", " + extraJSON
+	}
+	config += "}"
+
+	destination, err := NewEntraIDDestination(internal.DestinationConfig{
+		Type:      internal.DestinationTypeEntraID,
+		ExtraJSON: []byte(config),
+	})
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*EntraIDDestination)
+}
+
+func applyTestChanges(
+	t *testing.T,
+	e *EntraIDDestination,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := e.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+func TestNewEntraIDDestination(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		want       Client
+		wantErrMsg string
+	}{
+		{
+			name:      "defaults",
+			extraJSON: `{"TenantID": "contoso", "ClientID": "a", "ClientSecret": "b"}`,
+			want: Client{
+				TenantID:           "contoso",
+				ClientID:           "a",
+				ClientSecret:       "b",
+				TokenURL:           "https://login.microsoftonline.com/contoso/oauth2/v2.0/token",
+				GraphURL:           DefaultGraphURL,
+				HttpTimeoutSeconds: DefaultHttpTimeoutSeconds,
+				BatchSize:          DefaultBatchSize,
+			},
+		},
+		{
+			name:       "no tenant",
+			extraJSON:  `{"ClientID": "a", "ClientSecret": "b"}`,
+			wantErrMsg: "TenantID is required",
+		},
+		{
+			name:       "no secret",
+			extraJSON:  `{"TenantID": "contoso", "ClientID": "a"}`,
+			wantErrMsg: "ClientSecret is required",
+		},
+		{
+			name:       "invalid GraphURL",
+			extraJSON:  `{"TenantID": "contoso", "ClientID": "a", "ClientSecret": "b", "GraphURL": "graph"}`,
+			wantErrMsg: "invalid GraphURL",
+		},
+		{
+			name:       "large batch",
+			extraJSON:  `{"TenantID": "contoso", "ClientID": "a", "ClientSecret": "b", "BatchSize": 21}`,
+			wantErrMsg: "BatchSize may not be more than 20",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewEntraIDDestination(internal.DestinationConfig{ExtraJSON: []byte(tt.extraJSON)})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, destination.(*EntraIDDestination).Client)
+		})
+	}
+}
+
+func TestEntraIDDestination_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		syncSet    string
+		want       DestinationSyncSet
+		wantErrMsg string
+	}{
+		{
+			name:    "defaults from ExtraJSON",
+			syncSet: `{"GroupMail": "staff@example.org"}`,
+			extraJSON: `{"TenantID": "t", "ClientID": "a", "ClientSecret": "b", "CompareAttribute": "mail",
+				"Filter": "accountEnabled eq true"}`,
+			want: DestinationSyncSet{
+				Filter:           "accountEnabled eq true",
+				CompareAttribute: "mail",
+				GroupMail:        "staff@example.org",
+			},
+		},
+		{
+			name:      "default CompareAttribute",
+			extraJSON: `{"TenantID": "t", "ClientID": "a", "ClientSecret": "b"}`,
+			syncSet:   `{}`,
+			want:      DestinationSyncSet{CompareAttribute: DefaultCompareAttribute},
+		},
+		{
+			name:       "two groups",
+			extraJSON:  `{"TenantID": "t", "ClientID": "a", "ClientSecret": "b"}`,
+			syncSet:    `{"GroupID": "g1", "GroupMail": "staff@example.org"}`,
+			wantErrMsg: "only one of GroupID and GroupMail",
+		},
+		{
+			name:       "ExtraMembers without a group",
+			extraJSON:  `{"TenantID": "t", "ClientID": "a", "ClientSecret": "b"}`,
+			syncSet:    `{"ExtraMembers": ["ann@example.org"]}`,
+			wantErrMsg: "ExtraMembers requires GroupID or GroupMail",
+		},
+		{
+			name:       "nested CompareAttribute",
+			extraJSON:  `{"TenantID": "t", "ClientID": "a", "ClientSecret": "b"}`,
+			syncSet:    `{"CompareAttribute": "employeeOrgData.costCenter"}`,
+			wantErrMsg: "invalid CompareAttribute",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewEntraIDDestination(internal.DestinationConfig{ExtraJSON: []byte(tt.extraJSON)})
+			require.NoError(t, err)
+			err = destination.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, destination.(*EntraIDDestination).SyncSet)
+
+			updatesOnly := tt.want.GroupID == "" && tt.want.GroupMail == ""
+			require.Equal(t, updatesOnly, destination.(internal.UpdateOnlyDestination).UpdatesOnly())
+		})
+	}
+}
+
+func TestEntraIDDestination_ListUsers(t *testing.T) {
+	attributes := []string{"givenName", "businessPhones", "accountEnabled", "employeeOrgData.costCenter"}
+
+	tests := []struct {
+		name    string
+		syncSet string
+		want    []string
+	}{
+		{name: "all users", syncSet: `{}`, want: []string{"ann@example.org", "bob@example.org", "cat@example.org",
+			"dan@example.org"}},
+		{name: "filter", syncSet: `{"Filter": "department eq 'IT'"}`, want: []string{"ann@example.org",
+			"cat@example.org"}},
+		{name: "group", syncSet: `{"GroupMail": "staff@example.org"}`, want: []string{"ann@example.org",
+			"bob@example.org"}},
+		{
+			name:    "group with ExtraMembers",
+			syncSet: `{"GroupID": "g1", "ExtraMembers": ["BOB@example.org"]}`,
+			want:    []string{"ann@example.org"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := startTestService(t, testUsers(), testGroups())
+			e := newTestEntraIDDestination(t, service, "", tt.syncSet)
+
+			people, err := e.ListUsers(context.Background(), attributes)
+			require.NoError(t, err)
+
+			var compareValues []string
+			for _, person := range people {
+				compareValues = append(compareValues, person.CompareValue)
+			}
+			require.Equal(t, tt.want, compareValues)
+			require.Equal(t, internal.Person{
+				CompareValue: "ann@example.org",
+				ID:           "1",
+				Attributes: map[string]string{
+					"givenName":                  "Ann",
+					"businessPhones":             "+1 555 0100",
+					"accountEnabled":             "true",
+					"employeeOrgData.costCenter": "100",
+				},
+			}, people[0])
+			require.Equal(t, 1, service.tokenRequests, "the token is reused")
+		})
+	}
+}
+
+func TestEntraIDDestination_ApplyChangeSet_users(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	service.throttle = 1
+	e := newTestEntraIDDestination(t, service, "", `{}`)
+
+	results, messages := applyTestChanges(t, e, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "eve@example.org"}},
+		Update: []internal.Person{
+			{
+				CompareValue: "ann@example.org",
+				ID:           "1",
+				Attributes:   map[string]string{"givenName": "Anne", "businessPhones": "", "accountEnabled": "false"},
+				Changes: []internal.AttributeChange{
+					{Attribute: "givenName", Old: "Ann", New: "Anne"},
+					{Attribute: "businessPhones", Old: "+1 555 0100", New: ""},
+					{Attribute: "accountEnabled", Old: "true", New: "false"},
+					{Attribute: "employeeOrgData.costCenter", Old: "100", New: "200"},
+				},
+			},
+			{
+				CompareValue: "bob@example.org",
+				Attributes:   map[string]string{"department": ""},
+				Changes:      []internal.AttributeChange{{Attribute: "department", Old: "Sales", New: ""}},
+			},
+			{
+				CompareValue: "fay@example.org",
+				Attributes:   map[string]string{"givenName": "Fay"},
+			},
+		},
+		Delete: []internal.Person{{CompareValue: "cat@example.org", ID: "3"}},
+	})
+
+	require.Equal(t, internal.ChangeResults{Updated: 2}, results, "users are not created or deleted without a group")
+	require.ElementsMatch(t, []string{
+		"UpdatePerson ann@example.org, changed: givenName, businessPhones, accountEnabled, employeeOrgData.costCenter",
+		"UpdatePerson bob@example.org, changed: department",
+		"unable to update fay@example.org: user not found",
+	}, messages)
+
+	ann := service.user("1")
+	require.Equal(t, "Anne", ann["givenName"])
+	require.Equal(t, []any{}, ann["businessPhones"])
+	require.Equal(t, false, ann["accountEnabled"])
+	require.Equal(t, map[string]any{"costCenter": "200"}, ann["employeeOrgData"])
+	require.NotContains(t, service.user("2"), "department")
+	require.Equal(t, 3, service.batches,
+		"one $batch for the lookups, a retry of the throttled lookup, and one for the updates")
+}
+
+func TestEntraIDDestination_ApplyChangeSet_group(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	e := newTestEntraIDDestination(t, service, "",
+		`{"GroupMail": "staff@example.org", "ExtraMembers": ["dan@example.org"]}`)
+
+	_, err := e.ListUsers(context.Background(), []string{"givenName"})
+	require.NoError(t, err)
+
+	results, messages := applyTestChanges(t, e, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "cat@example.org"},
+			{CompareValue: "eve@example.org"},
+		},
+		Delete: []internal.Person{
+			{CompareValue: "bob@example.org", ID: "2"},
+			{CompareValue: "dan@example.org", ID: "4"},
+		},
+	})
+
+	require.Equal(t, internal.ChangeResults{Created: 2, Deleted: 1}, results)
+	require.ElementsMatch(t, []string{
+		"AddMember cat@example.org",
+		"unable to add eve@example.org: user not found",
+		"AddMember dan@example.org",
+		"RemoveMember bob@example.org",
+	}, messages)
+	require.Equal(t, []string{"1", "3", "4"}, service.members("g1"))
+
+	// the next run finds the ExtraMembers in the group, and does not add them again
+	_, err = e.ListUsers(context.Background(), []string{"givenName"})
+	require.NoError(t, err)
+	results, messages = applyTestChanges(t, e, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "ann@example.org", ID: "1"}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 1}, results, "a user already in the group is counted as added")
+	require.Equal(t, []string{"AddMember ann@example.org"}, messages)
+}
+
+func TestEntraIDDestination_ApplyChangeSet_errors(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	e := newTestEntraIDDestination(t, service, `"ClientSecret": "wrong"`, `{"GroupID": "g1"}`)
+
+	results, messages := applyTestChanges(t, e, internal.ChangeSet{
+		Update: []internal.Person{{CompareValue: "ann@example.org", ID: "1", Attributes: map[string]string{"a": "b"}}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Len(t, messages, 1)
+	require.Contains(t, messages[0], "unable to update ann@example.org: ")
+	require.Contains(t, messages[0], "invalid_client")
+
+	e = newTestEntraIDDestination(t, service, "", `{"GroupMail": "missing@example.org"}`)
+	results, messages = applyTestChanges(t, e, internal.ChangeSet{Create: []internal.Person{{CompareValue: "x"}}})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Equal(t, []string{
+		"unable to apply changes to group missing@example.org: found 0 groups with mail missing@example.org",
+	}, messages)
+}
+
+func TestSetProperty(t *testing.T) {
+	body := map[string]any{}
+	setProperty(body, "givenName", "Ann")
+	setProperty(body, "surname", "")
+	setProperty(body, "accountEnabled", "true")
+	setProperty(body, "businessPhones", "+1 555 0100|+1 555 0101")
+	setProperty(body, "otherMails", "")
+	setProperty(body, "employeeOrgData.costCenter", "100")
+	setProperty(body, "employeeOrgData.division", "")
+
+	require.Equal(t, map[string]any{
+		"givenName":       "Ann",
+		"surname":         nil,
+		"accountEnabled":  true,
+		"businessPhones":  []string{"+1 555 0100", "+1 555 0101"},
+		"otherMails":      []string{},
+		"employeeOrgData": map[string]any{"costCenter": "100", "division": nil},
+	}, body)
+}
+
+func TestClient_batch_omitted(t *testing.T) {
+	service := startTestService(t, testUsers(), nil)
+	e := newTestEntraIDDestination(t, service, "", "")
+	requests := []batchRequest{
+		{Method: http.MethodGet, URL: "/users?$filter=id eq '1'"},
+		{Method: http.MethodGet, URL: "/users?$filter=id eq '2'"},
+	}
+
+	// the first request is left out of the first response, and sent again
+	service.omit = 1
+	results, err := e.batch(context.Background(), requests)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.Contains(t, string(results[0].Body), "ann@example.org")
+	require.NoError(t, results[1].Err)
+	require.Equal(t, 2, service.batches)
+
+	// a request that is always left out fails after the retries
+	service.omit = 100
+	results, err = e.batch(context.Background(), requests)
+	require.NoError(t, err)
+	require.EqualError(t, results[0].Err, "no response to request 1 after 4 $batch requests")
+	require.EqualError(t, results[1].Err, "no response to request 2 after 4 $batch requests")
+	require.Equal(t, 2+1+internal.MaxRetries, service.batches)
+}
+
+func TestIsStatus(t *testing.T) {
+	err := newError(http.StatusNotFound, []byte(`{"error": {"code": "Request_ResourceNotFound", "message": "gone"}}`))
+	require.True(t, internal.IsStatus(err, http.StatusNotFound))
+	require.EqualError(t, err, "Graph error 404 (Request_ResourceNotFound): gone")
+}
@@ -0,0 +1,306 @@
+package entraid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v6/internal/testutil"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testAccessToken  = "token"
+)
+
+// testService is an in-process Microsoft Graph with a token endpoint, and simple support for eq filters, paging,
+// $batch requests, and group members. If throttle is set, that many requests in $batch requests are refused with 429
+// Too Many Requests before any succeed. If omit is set, that many requests in $batch requests are left out of the
+// response.
+type testService struct {
+	*testutil.Server
+	TokenURL string
+	GraphURL string
+
+	users         []map[string]any
+	groups        []map[string]any
+	tokenRequests int
+	batches       int
+	throttle      int
+	omit          int
+}
+
+var eqFilter = regexp.MustCompile(`^(\w+) eq '((?:[^']|'')*)'$`)
+
+func startTestService(t *testing.T, users, groups []map[string]any) *testService {
+	s := &testService{users: users, groups: groups}
+	s.Server = testutil.NewServer(t, s.handle)
+	s.TokenURL = s.URL + "/tenant/oauth2/v2.0/token"
+	s.GraphURL = s.URL + "/v1.0"
+	return s
+}
+
+func (s *testService) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/token") {
+		s.token(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "invalid token")
+		return
+	}
+
+	graphPath := strings.TrimPrefix(r.URL.Path, "/v1.0")
+	if graphPath != "/$batch" {
+		s.route(w, r.Method, graphPath, r)
+		return
+	}
+
+	var batch struct {
+		Requests []batchRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil || len(batch.Requests) > MaxBatchSize {
+		writeError(w, http.StatusBadRequest, "BadRequest", "invalid batch")
+		return
+	}
+	s.batches++
+
+	var responses []batchResponse
+	for _, request := range batch.Requests {
+		inner, _ := http.NewRequest(request.Method, s.GraphURL+request.URL, nil)
+		if request.Body != nil {
+			body, _ := json.Marshal(request.Body)
+			inner, _ = http.NewRequest(request.Method, s.GraphURL+request.URL, bytes.NewReader(body))
+		}
+		innerPath := strings.TrimPrefix(inner.URL.Path, "/v1.0")
+
+		if s.omit > 0 {
+			s.omit--
+			continue
+		}
+
+		recorder := httptest.NewRecorder()
+		if s.throttle > 0 {
+			s.throttle--
+			recorder.Header().Set("Retry-After", "0")
+			writeError(recorder, http.StatusTooManyRequests, "TooManyRequests", "slow down")
+		} else {
+			s.route(recorder, request.Method, innerPath, inner)
+		}
+
+		headers := map[string]string{}
+		for name := range recorder.Header() {
+			headers[name] = recorder.Header().Get(name)
+		}
+		responses = append(responses, batchResponse{
+			ID:      request.ID,
+			Status:  recorder.Code,
+			Headers: headers,
+			Body:    recorder.Body.Bytes(),
+		})
+	}
+	slices.Reverse(responses) // responses may be in any order
+	testutil.WriteJSON(w, http.StatusOK, map[string]any{"responses": responses})
+}
+
+func (s *testService) token(w http.ResponseWriter, r *http.Request) {
+	s.tokenRequests++
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" ||
+		r.Form.Get("client_id") != testClientID || r.Form.Get("client_secret") != testClientSecret {
+		testutil.WriteJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	testutil.WriteJSON(w, http.StatusOK, map[string]any{
+		"access_token": testAccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (s *testService) route(w http.ResponseWriter, method, graphPath string, r *http.Request) {
+	parts := strings.Split(strings.Trim(graphPath, "/"), "/")
+	switch {
+	case method == http.MethodGet && graphPath == "/users":
+		s.list(w, r, s.users)
+	case method == http.MethodGet && graphPath == "/groups":
+		s.list(w, r, s.groups)
+	case method == http.MethodGet && len(parts) == 4 && parts[0] == "groups" && parts[3] == "microsoft.graph.user":
+		group := find(s.groups, parts[1])
+		if group == nil {
+			writeError(w, http.StatusNotFound, "Request_ResourceNotFound", "group not found")
+			return
+		}
+		var members []map[string]any
+		for _, id := range group["members"].([]string) {
+			members = append(members, find(s.users, id))
+		}
+		s.list(w, r, members)
+	case method == http.MethodPatch && len(parts) == 2 && parts[0] == "users":
+		user := find(s.users, parts[1])
+		if user == nil {
+			writeError(w, http.StatusNotFound, "Request_ResourceNotFound", "user not found")
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		merge(user, body)
+		w.WriteHeader(http.StatusNoContent)
+	case method == http.MethodPost && len(parts) == 4 && parts[0] == "groups" && parts[3] == "$ref":
+		group := find(s.groups, parts[1])
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); group == nil || err != nil {
+			writeError(w, http.StatusBadRequest, "BadRequest", "invalid request")
+			return
+		}
+		id := path.Base(body["@odata.id"])
+		if find(s.users, id) == nil {
+			writeError(w, http.StatusNotFound, "Request_ResourceNotFound", "user not found")
+			return
+		}
+		if slices.Contains(group["members"].([]string), id) {
+			writeError(w, http.StatusBadRequest, "Request_BadRequest",
+				"One or more added object references already exist for the following modified properties: 'members'.")
+			return
+		}
+		group["members"] = append(group["members"].([]string), id)
+		w.WriteHeader(http.StatusNoContent)
+	case method == http.MethodDelete && len(parts) == 5 && parts[0] == "groups" && parts[4] == "$ref":
+		group := find(s.groups, parts[1])
+		if group == nil || !slices.Contains(group["members"].([]string), parts[3]) {
+			writeError(w, http.StatusNotFound, "Request_ResourceNotFound", "member not found")
+			return
+		}
+		group["members"] = slices.DeleteFunc(group["members"].([]string), func(id string) bool { return id == parts[3] })
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound", "not found: "+method+" "+graphPath)
+	}
+}
+
+// list writes a page of the objects that match the $filter, with the properties in $select
+func (s *testService) list(w http.ResponseWriter, r *http.Request, objects []map[string]any) {
+	query := r.URL.Query()
+	if filter := query.Get("$filter"); filter != "" {
+		match := eqFilter.FindStringSubmatch(filter)
+		if match == nil {
+			writeError(w, http.StatusBadRequest, "BadRequest", "unsupported filter")
+			return
+		}
+		value := strings.ReplaceAll(match[2], "''", "'")
+		var matches []map[string]any
+		for _, object := range objects {
+			if strings.EqualFold(propertyValue(object, match[1]), value) {
+				matches = append(matches, object)
+			}
+		}
+		objects = matches
+	}
+
+	top, _ := strconv.Atoi(query.Get("$top"))
+	skip, _ := strconv.Atoi(query.Get("$skiptoken"))
+	if top <= 0 || top > 2 {
+		top = 2 // small pages, so that paging is tested
+	}
+	end := min(skip+top, len(objects))
+
+	page := []map[string]any{}
+	for _, object := range objects[min(skip, end):end] {
+		selected := map[string]any{}
+		for _, property := range strings.Split(query.Get("$select"), ",") {
+			if value, ok := object[property]; ok {
+				selected[property] = value
+			}
+		}
+		if query.Get("$select") == "" {
+			selected = object
+		}
+		page = append(page, selected)
+	}
+
+	response := map[string]any{"value": page}
+	if end < len(objects) {
+		query.Set("$skiptoken", strconv.Itoa(end))
+		response["@odata.nextLink"] = fmt.Sprintf("%s%s?%s", s.GraphURL, strings.TrimPrefix(r.URL.Path, "/v1.0"),
+			query.Encode())
+	}
+	testutil.WriteJSON(w, http.StatusOK, response)
+}
+
+func (s *testService) user(id string) map[string]any {
+	s.Lock()
+	defer s.Unlock()
+	return find(s.users, id)
+}
+
+func (s *testService) members(groupID string) []string {
+	s.Lock()
+	defer s.Unlock()
+	return slices.Clone(find(s.groups, groupID)["members"].([]string))
+}
+
+func find(objects []map[string]any, id string) map[string]any {
+	for _, object := range objects {
+		if object["id"] == id {
+			return object
+		}
+	}
+	return nil
+}
+
+// merge applies a PATCH request body to an object. A null value removes the property.
+func merge(object, body map[string]any) {
+	for key, value := range body {
+		switch v := value.(type) {
+		case nil:
+			delete(object, key)
+		case map[string]any:
+			nested, ok := object[key].(map[string]any)
+			if !ok {
+				nested = map[string]any{}
+				object[key] = nested
+			}
+			merge(nested, v)
+		default:
+			object[key] = v
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	testutil.WriteJSON(w, status, map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
+
+func testUsers() []map[string]any {
+	return []map[string]any{
+		{
+			"id":                "1",
+			"userPrincipalName": "ann@example.org",
+			"givenName":         "Ann",
+			"department":        "IT",
+			"businessPhones":    []any{"+1 555 0100"},
+			"accountEnabled":    true,
+			"employeeOrgData":   map[string]any{"costCenter": "100"},
+		},
+		{"id": "2", "userPrincipalName": "bob@example.org", "givenName": "Bob", "department": "Sales"},
+		{"id": "3", "userPrincipalName": "cat@example.org", "givenName": "Cat", "department": "IT"},
+		{"id": "4", "userPrincipalName": "dan@example.org", "givenName": "Dan"},
+	}
+}
+
+func testGroups() []map[string]any {
+	return []map[string]any{
+		{"id": "g1", "mail": "staff@example.org", "members": []string{"1", "2"}},
+	}
+}
@@ -0,0 +1,218 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	QuotesStrict = "Strict"
+	QuotesLazy   = "Lazy"
+	QuotesNone   = "None"
+)
+
+// CSV reads people from one or more delimited text files with a header row. The files can be local files or S3
+// objects, named as s3://bucket/key.
+type CSV struct {
+	// CSVSyncSet holds the defaults for each sync set
+	CSVSyncSet
+	Storage
+
+	SourceConfig internal.SourceConfig `json:"-"`
+	SyncSet      CSVSyncSet            `json:"-"`
+}
+
+// CSVSyncSet configures the files read for a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type CSVSyncSet struct {
+	Files            []string
+	CompareAttribute string
+	Delimiter        string // a single character, default ","; "\t" or "tab" for tab-separated files
+	Encoding         string // default "utf-8", or any name listed at https://encoding.spec.whatwg.org/#names-and-labels
+	Quotes           string // "Strict" (default), "Lazy" to allow quotes within unquoted fields, or "None"
+	Comment          string // if set, lines beginning with this character are ignored
+	TrimLeadingSpace bool
+}
+
+// NewCSVSource unmarshals the sourceConfig's ExtraJSON into a CSV struct
+func NewCSVSource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var c CSV
+	if len(sourceConfig.ExtraJSON) > 0 {
+		if err := json.Unmarshal(sourceConfig.ExtraJSON, &c); err != nil {
+			return nil, fmt.Errorf("error reading CSV source config: %w", err)
+		}
+	}
+
+	if err := c.CSVSyncSet.validateFormat(); err != nil {
+		return nil, fmt.Errorf("invalid CSV source config: %w", err)
+	}
+
+	c.SourceConfig = sourceConfig
+	return &c, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (c *CSV) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := c.CSVSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if len(syncSet.Files) == 0 {
+		return errors.New("no Files are listed in sync set")
+	}
+	for _, f := range syncSet.Files {
+		if err := validateName(f); err != nil {
+			return err
+		}
+	}
+	if syncSet.CompareAttribute == "" {
+		return errors.New("CompareAttribute is required")
+	}
+	if err := syncSet.validateFormat(); err != nil {
+		return err
+	}
+
+	c.SyncSet = syncSet
+	return nil
+}
+
+// ListUsers returns a person for each row of each file in the sync set
+func (c *CSV) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	var people []internal.Person
+	for _, name := range c.SyncSet.Files {
+		table, err := c.readFile(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", name, err)
+		}
+		people = append(people, internal.PeopleFromTable(table, desiredAttrs, c.SyncSet.CompareAttribute)...)
+	}
+	return people, nil
+}
+
+func (c *CSV) readFile(ctx context.Context, name string) ([][]string, error) {
+	r, err := c.open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decoded, err := decode(r, c.SyncSet.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return c.SyncSet.parse(decoded)
+}
+
+// decode returns a reader that converts from the named encoding to UTF-8. A byte order mark, if present, is
+// removed, and overrides the named encoding.
+func decode(r io.Reader, encodingName string) (io.Reader, error) {
+	if encodingName == "" {
+		encodingName = "utf-8"
+	}
+	enc, err := htmlindex.Get(encodingName)
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized Encoding %q", encodingName)
+	}
+	return transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder())), nil
+}
+
+// parse reads all rows of delimited text
+func (s CSVSyncSet) parse(r io.Reader) ([][]string, error) {
+	delimiter, _ := s.delimiter()
+	comment, _ := utf8.DecodeRuneInString(s.Comment)
+
+	if s.Quotes == QuotesNone {
+		return splitLines(r, string(delimiter), s.Comment, s.TrimLeadingSpace)
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	if s.Comment != "" {
+		reader.Comment = comment
+	}
+	reader.LazyQuotes = s.Quotes == QuotesLazy
+	reader.TrimLeadingSpace = s.TrimLeadingSpace
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// splitLines reads rows of delimited text in which quotes have no special meaning
+func splitLines(r io.Reader, delimiter, comment string, trimLeadingSpace bool) ([][]string, error) {
+	var table [][]string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || (comment != "" && strings.HasPrefix(line, comment)) {
+			continue
+		}
+
+		row := strings.Split(line, delimiter)
+		if trimLeadingSpace {
+			for i := range row {
+				row[i] = strings.TrimLeft(row[i], " \t")
+			}
+		}
+		table = append(table, row)
+	}
+	return table, scanner.Err()
+}
+
+func (s CSVSyncSet) delimiter() (rune, error) {
+	switch s.Delimiter {
+	case "":
+		return ',', nil
+	case "tab":
+		return '\t', nil
+	}
+
+	d, size := utf8.DecodeRuneInString(s.Delimiter)
+	if size != len(s.Delimiter) || d == utf8.RuneError || d == '"' || d == '\r' || d == '\n' {
+		return 0, fmt.Errorf("invalid Delimiter %q, must be a single character other than a quote or newline",
+			s.Delimiter)
+	}
+	return d, nil
+}
+
+// validateFormat checks the properties that control how files are parsed
+func (s CSVSyncSet) validateFormat() error {
+	delimiter, err := s.delimiter()
+	if err != nil {
+		return err
+	}
+
+	if s.Encoding != "" {
+		if _, err := htmlindex.Get(s.Encoding); err != nil {
+			return fmt.Errorf("unrecognized Encoding %q", s.Encoding)
+		}
+	}
+
+	switch s.Quotes {
+	case "", QuotesStrict, QuotesLazy, QuotesNone:
+	default:
+		return fmt.Errorf("invalid Quotes %q, must be %s, %s or %s", s.Quotes, QuotesStrict, QuotesLazy, QuotesNone)
+	}
+
+	if s.Comment != "" {
+		comment, size := utf8.DecodeRuneInString(s.Comment)
+		if size != len(s.Comment) || comment == delimiter {
+			return fmt.Errorf("invalid Comment %q, must be a single character other than the delimiter", s.Comment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func newTestCSV(t *testing.T, extraJSON string) *CSV {
+	source, err := NewCSVSource(internal.SourceConfig{Type: internal.SourceTypeCSV, ExtraJSON: []byte(extraJSON)})
+	require.NoError(t, err)
+	return source.(*CSV)
+}
+
+func TestCSV_ListUsers(t *testing.T) {
+	tests := []struct {
+		name      string
+		extraJSON string
+		syncSet   map[string]any
+		data      []byte
+		want      []internal.Person
+	}{
+		{
+			name: "comma separated",
+			data: []byte("email,name,title\nann@example.com,Ann,Boss\nbob@example.com,\"Smith, Bob\",\n"),
+			want: []internal.Person{
+				{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+				{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com", "name": "Smith, Bob"}},
+			},
+		},
+		{
+			name:    "tab separated",
+			syncSet: map[string]any{"Delimiter": "tab"},
+			data:    []byte("email\tname\r\nann@example.com\tAnn\r\n"),
+			want: []internal.Person{
+				{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+			},
+		},
+		{
+			name:      "delimiter from ExtraJSON",
+			extraJSON: `{"Delimiter": ";"}`,
+			data:      []byte("email;name\nann@example.com;Ann\n"),
+			want: []internal.Person{
+				{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+			},
+		},
+		{
+			name:    "latin-1",
+			syncSet: map[string]any{"Encoding": "iso-8859-1"},
+			data:    []byte("email,name\nrene@example.com,Ren\xe9\n"),
+			want: []internal.Person{
+				{CompareValue: "rene@example.com", Attributes: map[string]string{"email": "rene@example.com", "name": "René"}},
+			},
+		},
+		{
+			name: "byte order mark",
+			data: []byte("\xef\xbb\xbfemail,name\nann@example.com,Ann\n"),
+			want: []internal.Person{
+				{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+			},
+		},
+		{
+			name:    "lazy quotes",
+			syncSet: map[string]any{"Quotes": QuotesLazy},
+			data:    []byte("email,name\nann@example.com,Ann \"Boss\" Smith\n"),
+			want: []internal.Person{
+				{
+					CompareValue: "ann@example.com",
+					Attributes:   map[string]string{"email": "ann@example.com", "name": "Ann \"Boss\" Smith"},
+				},
+			},
+		},
+		{
+			name:    "no quotes",
+			syncSet: map[string]any{"Quotes": QuotesNone, "Delimiter": "\t", "Comment": "#"},
+			data:    []byte("email\tname\n# a comment\nann@example.com\t\"Ann\n\n"),
+			want: []internal.Person{
+				{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "\"Ann"}},
+			},
+		},
+		{
+			name: "short row",
+			data: []byte("email,name\nann@example.com\n"),
+			want: []internal.Person{
+				{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCSV(t, tt.extraJSON)
+
+			syncSet := map[string]any{"Files": []string{writeTestFile(t, "people.csv", tt.data)}, "CompareAttribute": "email"}
+			for k, v := range tt.syncSet {
+				syncSet[k] = v
+			}
+			syncSetJSON, err := json.Marshal(syncSet)
+			require.NoError(t, err)
+			require.NoError(t, c.ForSet(syncSetJSON))
+
+			got, err := c.ListUsers(context.Background(), []string{"email", "name"})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCSV_ListUsers_multipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.csv")
+	second := filepath.Join(dir, "second.csv")
+	require.NoError(t, os.WriteFile(first, []byte("email\nann@example.com\n"), 0o600))
+	require.NoError(t, os.WriteFile(second, []byte("id,email\n2,bob@example.com\n"), 0o600))
+
+	c := newTestCSV(t, `{"CompareAttribute": "email"}`)
+	require.NoError(t, c.ForSet([]byte(`{"Files": ["`+first+`", "`+second+`"]}`)))
+
+	got, err := c.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}, got)
+
+	require.NoError(t, c.ForSet([]byte(`{"Files": ["`+filepath.Join(dir, "missing.csv")+`"]}`)))
+	_, err = c.ListUsers(context.Background(), []string{"email"})
+	require.ErrorContains(t, err, "missing.csv")
+}
+
+func TestCSV_ListUsers_s3(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte("email\nann@example.com\n"))
+	}))
+	defer server.Close()
+
+	c := newTestCSV(t, `{"AWSRegion": "us-east-1", "AWSAccessKeyID": "id", "AWSSecretAccessKey": "secret",
+		"Endpoint": "`+server.URL+`"}`)
+	require.NoError(t, c.ForSet([]byte(`{"Files": ["s3://bucket/hr/people.csv"], "CompareAttribute": "email"}`)))
+
+	got, err := c.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Equal(t, "/bucket/hr/people.csv", gotPath)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+	}, got)
+}
+
+func TestCSV_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "valid",
+			syncSet: `{"Files": ["people.csv"], "CompareAttribute": "email", "Delimiter": "|", "Encoding": "windows-1252"}`,
+		},
+		{
+			name:       "no files",
+			syncSet:    `{"CompareAttribute": "email"}`,
+			wantErrMsg: "no Files",
+		},
+		{
+			name:       "no compare attribute",
+			syncSet:    `{"Files": ["people.csv"]}`,
+			wantErrMsg: "CompareAttribute is required",
+		},
+		{
+			name:       "long delimiter",
+			syncSet:    `{"Files": ["people.csv"], "CompareAttribute": "email", "Delimiter": "::"}`,
+			wantErrMsg: "invalid Delimiter",
+		},
+		{
+			name:       "unknown encoding",
+			syncSet:    `{"Files": ["people.csv"], "CompareAttribute": "email", "Encoding": "ebcdic"}`,
+			wantErrMsg: "unrecognized Encoding",
+		},
+		{
+			name:       "invalid quotes",
+			syncSet:    `{"Files": ["people.csv"], "CompareAttribute": "email", "Quotes": "Double"}`,
+			wantErrMsg: "invalid Quotes",
+		},
+		{
+			name:       "comment is delimiter",
+			syncSet:    `{"Files": ["people.csv"], "CompareAttribute": "email", "Comment": ","}`,
+			wantErrMsg: "invalid Comment",
+		},
+		{
+			name:       "invalid S3 name",
+			syncSet:    `{"Files": ["s3://bucket"], "CompareAttribute": "email"}`,
+			wantErrMsg: "invalid S3 object name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestCSV(t, "").ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewCSVSource(t *testing.T) {
+	_, err := NewCSVSource(internal.SourceConfig{ExtraJSON: []byte(`{"Quotes": "Double"}`)})
+	require.ErrorContains(t, err, "invalid Quotes")
+}
@@ -0,0 +1,340 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/syslog"
+	"slices"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	FormatCSV       = "CSV"
+	FormatJSONLines = "JSONLines"
+)
+
+// File keeps a list of people in a CSV or JSON Lines file. ListUsers reads the file, and ApplyChangeSet rewrites it.
+// In a CSV file, the columns are in the order of the AttributeMap, followed by any other columns already in the file.
+type File struct {
+	// FileSyncSet holds the defaults for each sync set
+	FileSyncSet
+	Storage
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           FileSyncSet                `json:"-"`
+
+	// columns is the list of attributes requested by the last call to ListUsers
+	columns []string
+}
+
+// FileSyncSet configures the file written for a sync set. Any property not set in the sync set is taken from
+// ExtraJSON.
+type FileSyncSet struct {
+	Path             string
+	Format           string // "CSV" (default) or "JSONLines"
+	CompareAttribute string
+}
+
+// NewFileDestination unmarshals the destinationConfig's ExtraJSON into a File struct
+func NewFileDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var f File
+	if len(destinationConfig.ExtraJSON) > 0 {
+		if err := json.Unmarshal(destinationConfig.ExtraJSON, &f); err != nil {
+			return nil, fmt.Errorf("error reading File destination config: %w", err)
+		}
+	}
+
+	if err := f.FileSyncSet.validateFormat(); err != nil {
+		return nil, fmt.Errorf("invalid File destination config: %w", err)
+	}
+
+	f.DestinationConfig = destinationConfig
+	return &f, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (f *File) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := f.FileSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := validateName(syncSet.Path); err != nil {
+		return fmt.Errorf("invalid Path: %w", err)
+	}
+	if syncSet.CompareAttribute == "" {
+		return errors.New("CompareAttribute is required")
+	}
+	if err := syncSet.validateFormat(); err != nil {
+		return err
+	}
+
+	f.SyncSet = syncSet
+	f.columns = nil
+	return nil
+}
+
+// ListUsers returns a person for each row in the file, or an empty list if the file does not exist
+func (f *File) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	f.columns = desiredAttrs
+
+	people, _, err := f.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range people {
+		attributes := map[string]string{}
+		for _, attr := range desiredAttrs {
+			if value, ok := people[i].Attributes[attr]; ok {
+				attributes[attr] = value
+			}
+		}
+		people[i].Attributes = attributes
+	}
+	return people, nil
+}
+
+// ApplyChangeSet reads the file again, applies the changes, and writes the whole file. Attributes not in the
+// AttributeMap are kept as they were.
+func (f *File) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	if internal.Stopping(ctx) {
+		return internal.ChangeResults{}
+	}
+
+	people, existingColumns, err := f.load(ctx)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to read %s, no changes made: %s", f.SyncSet.Path, err),
+		}
+		return internal.ChangeResults{}
+	}
+
+	var results internal.ChangeResults
+	var messages []string
+
+	index := map[string]int{}
+	for i, person := range people {
+		index[strings.ToLower(person.CompareValue)] = i
+	}
+
+	if !f.DestinationConfig.DisableUpdate {
+		for _, person := range changes.Update {
+			i, ok := index[strings.ToLower(person.CompareValue)]
+			if !ok {
+				eventLog <- internal.EventLogItem{
+					Level:   syslog.LOG_WARNING,
+					Message: fmt.Sprintf("unable to update %s, not found in %s", person.CompareValue, f.SyncSet.Path),
+				}
+				continue
+			}
+			for attr, value := range person.Attributes {
+				people[i].Attributes[attr] = value
+			}
+			results.Updated++
+			messages = append(messages, fmt.Sprintf("UpdatePerson %s, changed: %s", person.CompareValue,
+				strings.Join(person.ChangedAttributeNames(), ", ")))
+		}
+	}
+
+	if !f.DestinationConfig.DisableDelete {
+		deleted := map[int]bool{}
+		for _, person := range changes.Delete {
+			if i, ok := index[strings.ToLower(person.CompareValue)]; ok && !deleted[i] {
+				deleted[i] = true
+				results.Deleted++
+				messages = append(messages, "DeletePerson "+person.CompareValue)
+			}
+		}
+		kept := people[:0]
+		for i, person := range people {
+			if !deleted[i] {
+				kept = append(kept, person)
+			}
+		}
+		people = kept
+	}
+
+	if !f.DestinationConfig.DisableAdd {
+		for _, person := range changes.Create {
+			attributes := make(map[string]string, len(person.Attributes))
+			for attr, value := range person.Attributes {
+				attributes[attr] = value
+			}
+			people = append(people, internal.Person{CompareValue: person.CompareValue, Attributes: attributes})
+			results.Created++
+			messages = append(messages, "AddPerson "+person.CompareValue)
+		}
+	}
+
+	if err := f.save(ctx, people, f.columnOrder(existingColumns, people)); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to write %s, no changes made: %s", f.SyncSet.Path, err),
+		}
+		return internal.ChangeResults{}
+	}
+
+	for _, msg := range messages {
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: msg}
+	}
+	return results
+}
+
+// load returns the people in the file, with all of their attributes, and the columns in a CSV file's header row
+func (f *File) load(ctx context.Context) ([]internal.Person, []string, error) {
+	r, err := f.open(ctx, f.SyncSet.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []internal.Person{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read %s: %w", f.SyncSet.Path, err)
+	}
+	defer r.Close()
+
+	if f.SyncSet.Format == FormatJSONLines {
+		people, err := readJSONLines(r, f.SyncSet.CompareAttribute)
+		return people, nil, err
+	}
+
+	table, err := CSVSyncSet{}.parse(r)
+	if err != nil || len(table) == 0 {
+		return []internal.Person{}, nil, err
+	}
+	return internal.PeopleFromTable(table, table[0], f.SyncSet.CompareAttribute), table[0], nil
+}
+
+func readJSONLines(r io.Reader, compareAttr string) ([]internal.Person, error) {
+	people := []internal.Person{}
+	decoder := json.NewDecoder(r)
+	for {
+		var record map[string]any
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return people, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON on line %d: %w", len(people)+1, err)
+		}
+
+		person := internal.Person{Attributes: make(map[string]string, len(record))}
+		for attr, value := range record {
+			switch v := value.(type) {
+			case nil:
+				person.Attributes[attr] = ""
+			case string:
+				person.Attributes[attr] = v
+			default:
+				person.Attributes[attr] = fmt.Sprint(v)
+			}
+		}
+		person.CompareValue = person.Attributes[compareAttr]
+		people = append(people, person)
+	}
+}
+
+// columnOrder returns the attributes requested by ListUsers, followed by any other columns in the existing file, and
+// then any other attributes of the people being written, in alphabetical order
+func (f *File) columnOrder(existingColumns []string, people []internal.Person) []string {
+	columns := slices.Clone(f.columns)
+	for _, column := range existingColumns {
+		columns = internal.AddStringToSlice(column, columns)
+	}
+
+	var others []string
+	for _, person := range people {
+		for attr := range person.Attributes {
+			if !slices.Contains(columns, attr) {
+				others = internal.AddStringToSlice(attr, others)
+			}
+		}
+	}
+	slices.Sort(others)
+	return append(columns, others...)
+}
+
+func (f *File) save(ctx context.Context, people []internal.Person, columns []string) error {
+	var buf bytes.Buffer
+	var err error
+	if f.SyncSet.Format == FormatJSONLines {
+		err = writeJSONLines(&buf, people, columns)
+	} else {
+		err = writeCSV(&buf, people, columns)
+	}
+	if err != nil {
+		return err
+	}
+	return f.write(ctx, f.SyncSet.Path, buf.Bytes())
+}
+
+func writeCSV(w io.Writer, people []internal.Person, columns []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, person := range people {
+		for i, column := range columns {
+			row[i] = person.Attributes[column]
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONLines writes a JSON object for each person, with the attributes in the order of columns
+func writeJSONLines(w io.Writer, people []internal.Person, columns []string) error {
+	for _, person := range people {
+		var line bytes.Buffer
+		line.WriteByte('{')
+		for _, column := range columns {
+			value, ok := person.Attributes[column]
+			if !ok {
+				continue
+			}
+			if line.Len() > 1 {
+				line.WriteByte(',')
+			}
+			key, _ := json.Marshal(column)
+			val, _ := json.Marshal(value)
+			line.Write(key)
+			line.WriteByte(':')
+			line.Write(val)
+		}
+		line.WriteString("}\n")
+
+		if _, err := w.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s FileSyncSet) validateFormat() error {
+	switch s.Format {
+	case "", FormatCSV, FormatJSONLines:
+		return nil
+	default:
+		return fmt.Errorf("invalid Format %q, must be %s or %s", s.Format, FormatCSV, FormatJSONLines)
+	}
+}
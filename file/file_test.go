@@ -0,0 +1,181 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestFile(t *testing.T, destinationConfig internal.DestinationConfig, syncSet string) *File {
+	destinationConfig.Type = internal.DestinationTypeFile
+	destination, err := NewFileDestination(destinationConfig)
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*File)
+}
+
+func testChangeSet() internal.ChangeSet {
+	return internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "cat@example.com", Attributes: map[string]string{"email": "cat@example.com", "name": "Cat"}},
+		},
+		Update: []internal.Person{{
+			CompareValue: "ann@example.com",
+			Attributes:   map[string]string{"email": "ann@example.com", "name": "Anne"},
+			Changes:      []internal.AttributeChange{{Attribute: "name", Old: "Ann", New: "Anne"}},
+		}},
+		Delete: []internal.Person{
+			{CompareValue: "BOB@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+		},
+	}
+}
+
+func applyTestChangeSet(
+	t *testing.T,
+	f *File,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []internal.EventLogItem) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := f.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var events []internal.EventLogItem
+	for event := range eventLog {
+		events = append(events, event)
+	}
+	return results, events
+}
+
+func TestFile_ApplyChangeSet_csv(t *testing.T) {
+	path := writeTestFile(t, "people.csv",
+		[]byte("id,email,name\n1,ann@example.com,Ann\n2,bob@example.com,\"Smith, Bob\"\n"))
+	f := newTestFile(t, internal.DestinationConfig{}, `{"Path": "`+path+`", "CompareAttribute": "email"}`)
+
+	people, err := f.ListUsers(context.Background(), []string{"name", "email"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com", "name": "Smith, Bob"}},
+	}, people)
+
+	results, events := applyTestChangeSet(t, f, testChangeSet())
+	require.Equal(t, internal.ChangeResults{Created: 1, Updated: 1, Deleted: 1}, results)
+	require.Len(t, events, 3)
+	require.Equal(t, "UpdatePerson ann@example.com, changed: name", events[0].Message)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "name,email,id\nAnne,ann@example.com,1\nCat,cat@example.com,\n", string(data))
+}
+
+func TestFile_ApplyChangeSet_jsonLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.jsonl")
+	config := internal.DestinationConfig{ExtraJSON: []byte(`{"Format": "JSONLines", "CompareAttribute": "email"}`)}
+	f := newTestFile(t, config, `{"Path": "`+path+`"}`)
+
+	people, err := f.ListUsers(context.Background(), []string{"email", "name"})
+	require.NoError(t, err)
+	require.Empty(t, people)
+
+	changes := internal.ChangeSet{Create: []internal.Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"name": "Ann", "email": "ann@example.com"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"name": "Bob \"B\"", "email": "bob@example.com"}},
+	}}
+	results, _ := applyTestChangeSet(t, f, changes)
+	require.Equal(t, internal.ChangeResults{Created: 2}, results)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `{"email":"ann@example.com","name":"Ann"}`+"\n"+
+		`{"email":"bob@example.com","name":"Bob \"B\""}`+"\n", string(data))
+
+	results, _ = applyTestChangeSet(t, f, testChangeSet())
+	require.Equal(t, internal.ChangeResults{Created: 1, Updated: 1, Deleted: 1}, results)
+
+	people, err = f.ListUsers(context.Background(), []string{"email", "name"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Anne"}},
+		{CompareValue: "cat@example.com", Attributes: map[string]string{"email": "cat@example.com", "name": "Cat"}},
+	}, people)
+}
+
+func TestFile_ApplyChangeSet_disabled(t *testing.T) {
+	path := writeTestFile(t, "people.csv", []byte("email,name\nann@example.com,Ann\nbob@example.com,Bob\n"))
+	config := internal.DestinationConfig{DisableAdd: true, DisableUpdate: true, DisableDelete: true}
+	f := newTestFile(t, config, `{"Path": "`+path+`", "CompareAttribute": "email"}`)
+
+	_, err := f.ListUsers(context.Background(), []string{"email", "name"})
+	require.NoError(t, err)
+
+	results, _ := applyTestChangeSet(t, f, testChangeSet())
+	require.Equal(t, internal.ChangeResults{}, results)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "email,name\nann@example.com,Ann\nbob@example.com,Bob\n", string(data))
+}
+
+func TestFile_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "valid",
+			syncSet: `{"Path": "s3://bucket/people.jsonl", "Format": "JSONLines", "CompareAttribute": "email"}`,
+		},
+		{
+			name:       "no path",
+			syncSet:    `{"CompareAttribute": "email"}`,
+			wantErrMsg: "invalid Path",
+		},
+		{
+			name:       "no compare attribute",
+			syncSet:    `{"Path": "people.csv"}`,
+			wantErrMsg: "CompareAttribute is required",
+		},
+		{
+			name:       "invalid format",
+			syncSet:    `{"Path": "people.xml", "Format": "XML", "CompareAttribute": "email"}`,
+			wantErrMsg: "invalid Format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewFileDestination(internal.DestinationConfig{Type: internal.DestinationTypeFile})
+			require.NoError(t, err)
+
+			err = destination.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_writeLocalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.csv")
+	require.NoError(t, writeLocalFile(path, []byte("email\n")))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), info.Mode().Perm(), "a new file should be readable by all")
+
+	require.NoError(t, os.Chmod(path, 0o640))
+	require.NoError(t, writeLocalFile(path, []byte("email\nann@example.com\n")))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), info.Mode().Perm(), "the mode of an existing file should be kept")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "email\nann@example.com\n", string(data))
+}
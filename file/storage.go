@@ -0,0 +1,147 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const s3Prefix = "s3://"
+
+// Storage reads and writes local files, and S3 objects named as s3://bucket/key
+type Storage struct {
+	// AWS settings, only used for files in S3
+	AWSRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	Endpoint           string // optional, for S3-compatible services
+
+	s3Client *s3.Client
+}
+
+// open opens a local file, or an S3 object if name begins with s3://. If the file does not exist, the error wraps
+// fs.ErrNotExist.
+func (s *Storage) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(name, s3Prefix) {
+		return os.Open(name)
+	}
+
+	bucket, key, err := parseS3Name(name)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// write replaces the contents of a local file or S3 object. A local file is replaced by renaming a temporary file,
+// so that it is never left partly written.
+func (s *Storage) write(ctx context.Context, name string, data []byte) error {
+	if !strings.HasPrefix(name, s3Prefix) {
+		return writeLocalFile(name, data)
+	}
+
+	bucket, key, err := parseS3Name(name)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *Storage) client() (*s3.Client, error) {
+	if s.s3Client == nil {
+		client, err := internal.NewS3Client(s.AWSRegion, s.AWSAccessKeyID, s.AWSSecretAccessKey, s.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		s.s3Client = client
+	}
+	return s.s3Client, nil
+}
+
+// writeLocalFile replaces the file through a temporary file, keeping the mode of any existing file
+func writeLocalFile(name string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// validateName checks a file name, which must not be blank, and must include a bucket and key if it is in S3
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("a file name in sync set is blank")
+	}
+	if strings.HasPrefix(name, s3Prefix) {
+		_, _, err := parseS3Name(name)
+		return err
+	}
+	return nil
+}
+
+// parseS3Name returns the bucket and key of an S3 object named as s3://bucket/key
+func parseS3Name(name string) (string, string, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(name, s3Prefix), "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 object name %q, must be %sbucket/key", name, s3Prefix)
+	}
+	return bucket, key, nil
+}
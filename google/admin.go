@@ -1,12 +1,12 @@
 package google
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	"google.golang.org/api/option"
 
-	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
 	admin "google.golang.org/api/admin/directory/v1"
 )
@@ -23,7 +23,7 @@ func initGoogleAdminService(auth GoogleAuth, adminEmail string, scopes ...string
 		return admin.Service{}, fmt.Errorf("unable to parse client secret file to config: %s", err)
 	}
 
-	ctx := context.TODO()
+	ctx := context.Background()
 	config.Subject = adminEmail
 	client := config.Client(ctx)
 
@@ -2,6 +2,7 @@ package google
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -14,7 +15,6 @@ import (
 	"sync"
 	"sync/atomic"
 
-	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/googleapi"
 
@@ -210,10 +210,10 @@ func (g *GoogleContacts) ForSet(syncSetJson json.RawMessage) error {
 }
 
 // ListUsers returns all users (contacts) in the destination
-func (g *GoogleContacts) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+func (g *GoogleContacts) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
 	href := fmt.Sprintf("https://www.google.com/m8/feeds/contacts/%s/full?max-results=%d",
 		g.GoogleConfig.Domain, MaxQuerySize)
-	body, err := g.httpRequest(http.MethodGet, href, "", map[string]string{})
+	body, err := g.httpRequest(ctx, http.MethodGet, href, "", map[string]string{})
 	if err != nil {
 		syncErr := internal.SyncError{
 			Message:   fmt.Errorf("failed to retrieve user list: %w", err),
@@ -239,6 +239,7 @@ func (g *GoogleContacts) ListUsers(desiredAttrs []string) ([]internal.Person, er
 
 // ApplyChangeSet executes all of the configured sync tasks (create, update, and/or delete)
 func (g *GoogleContacts) ApplyChangeSet(
+	ctx context.Context,
 	changes internal.ChangeSet,
 	eventLog chan<- internal.EventLogItem,
 ) internal.ChangeResults {
@@ -252,9 +253,12 @@ func (g *GoogleContacts) ApplyChangeSet(
 		log.Println("Contact creation is disabled.")
 	} else {
 		for _, toCreate := range changes.Create {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go g.addContact(toCreate, &results.Created, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go g.addContact(ctx, toCreate, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -262,9 +266,12 @@ func (g *GoogleContacts) ApplyChangeSet(
 		log.Println("Contact update is disabled.")
 	} else {
 		for _, toUpdate := range changes.Update {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go g.updateContact(toUpdate, &results.Updated, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go g.updateContact(ctx, toUpdate, &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -272,9 +279,12 @@ func (g *GoogleContacts) ApplyChangeSet(
 		log.Println("Contact deletion is disabled.")
 	} else {
 		for _, toUpdate := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go g.deleteContact(toUpdate, &results.Deleted, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go g.deleteContact(ctx, toUpdate, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -283,15 +293,15 @@ func (g *GoogleContacts) ApplyChangeSet(
 	return results
 }
 
-func (g *GoogleContacts) httpRequest(verb, url, body string, headers map[string]string) (string,
+func (g *GoogleContacts) httpRequest(ctx context.Context, verb, url, body string, headers map[string]string) (string,
 	error,
 ) {
 	var req *http.Request
 	var err error
 	if body == "" {
-		req, err = http.NewRequest(verb, url, nil)
+		req, err = http.NewRequestWithContext(ctx, verb, url, nil)
 	} else {
-		req, err = http.NewRequest(verb, url, bytes.NewBuffer([]byte(body)))
+		req, err = http.NewRequestWithContext(ctx, verb, url, bytes.NewBuffer([]byte(body)))
 	}
 	if err != nil {
 		return "", err
@@ -414,6 +424,7 @@ func findPrimaryPhoneNumber(entry Contact) string {
 }
 
 func (g *GoogleContacts) addContact(
+	ctx context.Context,
 	person internal.Person,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -433,7 +444,7 @@ func (g *GoogleContacts) addContact(
 	}
 
 	headers := map[string]string{"Content-Type": "application/atom+xml"}
-	if _, err := g.httpRequest(http.MethodPost, href, body, headers); err != nil {
+	if _, err := g.httpRequest(ctx, http.MethodPost, href, body, headers); err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
 			Message: fmt.Sprintf("unable to insert %s in Google contacts: %s", person.CompareValue, err),
@@ -470,11 +481,75 @@ func (g *GoogleContacts) initGoogleClient() error {
 	return nil
 }
 
-// createBody inserts attributes into an XML request body.
-//
-// WARNING: This updates all fields, even if omitted in the field mapping. A safer implementation would be to
-// merge the data retrieved from Google with the data coming from the source.
+// createBody inserts attributes into an XML request body. All fields are included, even if omitted in the field
+// mapping, so it should only be used as-is for a new contact. See updateBody for an existing contact.
 func (g *GoogleContacts) createBody(person internal.Person) (string, error) {
+	return marshalContact(newContactMarshal(person))
+}
+
+// updateBody creates an XML request body for an update to an existing contact. Only the changed attributes are taken
+// from the person. All other fields, including phone numbers if none of them changed, are kept from the contact.
+func (g *GoogleContacts) updateBody(contact Contact, person internal.Person) (string, error) {
+	existing, _ := g.extractPersonsFromResponse([]Contact{contact})
+
+	attributes := map[string]string{}
+	for key, value := range existing[0].Attributes {
+		if !strings.HasPrefix(key, contactFieldPhoneNumber) {
+			attributes[key] = value
+		}
+	}
+
+	changed := person.ChangedAttributes()
+
+	// let Google fill in fullName from the new givenName and familyName
+	_, givenNameChanged := changed[contactFieldGivenName]
+	_, familyNameChanged := changed[contactFieldFamilyName]
+	if givenNameChanged || familyNameChanged {
+		delete(attributes, contactFieldFullName)
+	}
+
+	phonesChanged := false
+	for key := range changed {
+		if strings.HasPrefix(key, contactFieldPhoneNumber) {
+			phonesChanged = true
+		}
+	}
+
+	if phonesChanged {
+		for key, value := range person.Attributes {
+			if strings.HasPrefix(key, contactFieldPhoneNumber) {
+				attributes[key] = value
+			}
+		}
+	}
+
+	updated := newContactMarshal(internal.Person{Attributes: mergeAttributeMaps(attributes, changed)})
+
+	if !phonesChanged {
+		updated.PhoneNumbers = nil
+		for _, phone := range contact.PhoneNumbers {
+			updated.PhoneNumbers = append(updated.PhoneNumbers, phoneNumberMarshal{
+				Rel:     phone.Rel,
+				Label:   phone.Label,
+				Primary: phone.Primary,
+				Value:   phone.Value,
+			})
+		}
+	}
+
+	return marshalContact(updated)
+}
+
+func marshalContact(contact contactMarshal) (string, error) {
+	output, err := xml.Marshal(&contact)
+
+	// For debug, this can be used to improve XML readability
+	// output, err := xml.MarshalIndent(&contact, "", "  ")
+
+	return string(output), err
+}
+
+func newContactMarshal(person internal.Person) contactMarshal {
 	contact := contactMarshal{
 		XmlNSAtom: "http://www.w3.org/2005/Atom",
 		XmlNSGd:   "http://schemas.google.com/g/2005",
@@ -512,12 +587,7 @@ func (g *GoogleContacts) createBody(person internal.Person) (string, error) {
 
 	contact.PhoneNumbers = getPhonesFromAttributes(person.Attributes)
 
-	output, err := xml.Marshal(&contact)
-
-	// For debug, this can be used to improve XML readability
-	// output, err := xml.MarshalIndent(&contact, "", "  ")
-
-	return string(output), err
+	return contact
 }
 
 func getPhonesFromAttributes(attributes map[string]string) []phoneNumberMarshal {
@@ -556,6 +626,7 @@ func getPhonesFromAttributes(attributes map[string]string) []phoneNumberMarshal
 }
 
 func (g *GoogleContacts) updateContact(
+	ctx context.Context,
 	person internal.Person,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -565,7 +636,7 @@ func (g *GoogleContacts) updateContact(
 
 	url := person.ID
 
-	contact, err := g.getContact(url)
+	contact, err := g.getContact(ctx, url)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -574,7 +645,7 @@ func (g *GoogleContacts) updateContact(
 		return
 	}
 
-	body, err := g.createBody(person)
+	body, err := g.updateBody(contact, person)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level: syslog.LOG_ERR,
@@ -584,7 +655,7 @@ func (g *GoogleContacts) updateContact(
 		return
 	}
 
-	_, err = g.httpRequest(http.MethodPut, url, body, map[string]string{
+	_, err = g.httpRequest(ctx, http.MethodPut, url, body, map[string]string{
 		"If-Match":     contact.Etag,
 		"Content-Type": "application/atom+xml",
 	})
@@ -596,11 +667,17 @@ func (g *GoogleContacts) updateContact(
 		return
 	}
 
+	eventLog <- internal.EventLogItem{
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdateContact %s, changed: %s", person.CompareValue,
+			strings.Join(person.ChangedAttributeNames(), ", ")),
+	}
+
 	atomic.AddUint64(counter, 1)
 }
 
-func (g *GoogleContacts) getContact(url string) (Contact, error) {
-	existingContact, err := g.httpRequest(http.MethodGet, url, "", map[string]string{})
+func (g *GoogleContacts) getContact(ctx context.Context, url string) (Contact, error) {
+	existingContact, err := g.httpRequest(ctx, http.MethodGet, url, "", map[string]string{})
 	if err != nil {
 		return Contact{}, fmt.Errorf("GET failed: %s", err)
 	}
@@ -615,6 +692,7 @@ func (g *GoogleContacts) getContact(url string) (Contact, error) {
 }
 
 func (g *GoogleContacts) deleteContact(
+	ctx context.Context,
 	person internal.Person,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -624,7 +702,7 @@ func (g *GoogleContacts) deleteContact(
 
 	url := person.ID
 
-	contact, err := g.getContact(url)
+	contact, err := g.getContact(ctx, url)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -633,7 +711,7 @@ func (g *GoogleContacts) deleteContact(
 		return
 	}
 
-	_, err = g.httpRequest(http.MethodDelete, url, "", map[string]string{
+	_, err = g.httpRequest(ctx, http.MethodDelete, url, "", map[string]string{
 		"If-Match": contact.Etag,
 	})
 	if err != nil {
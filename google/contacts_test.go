@@ -368,6 +368,77 @@ func TestGoogleContacts_createBody(t *testing.T) {
 	}
 }
 
+func TestGoogleContacts_updateBody(t *testing.T) {
+	contact := Contact{
+		Title:        "Fred Smith",
+		Name:         Name{FullName: "Fred Smith", GivenName: "Fred", FamilyName: "Smith"},
+		Emails:       []Email{{Primary: true, Address: "fred@example.com"}},
+		PhoneNumbers: []PhoneNumber{{Rel: relPhoneMobile, Primary: true, Value: "555-1212"}},
+		Organization: Organization{Name: "Acme, Inc.", Title: "VP of Operations"},
+		Notes:        "these are some notes",
+	}
+
+	tests := []struct {
+		name       string
+		person     internal.Person
+		want       []string
+		wantAbsent []string
+	}{
+		{
+			name: "title changed",
+			person: internal.Person{
+				Attributes: map[string]string{contactFieldTitle: "CEO"},
+				Changes:    []internal.AttributeChange{{Attribute: contactFieldTitle, Old: "VP of Operations", New: "CEO"}},
+			},
+			want: []string{
+				"<gd:orgTitle>CEO</gd:orgTitle>",
+				"<gd:orgName>Acme, Inc.</gd:orgName>",
+				"<gd:fullName>Fred Smith</gd:fullName>",
+				`<atom:content type="text">these are some notes</atom:content>`,
+				`<gd:phoneNumber rel="` + relPhoneMobile + `" primary="true">555-1212</gd:phoneNumber>`,
+			},
+		},
+		{
+			name: "givenName changed",
+			person: internal.Person{
+				Attributes: map[string]string{contactFieldGivenName: "Freddy"},
+				Changes:    []internal.AttributeChange{{Attribute: contactFieldGivenName, Old: "Fred", New: "Freddy"}},
+			},
+			want:       []string{"<gd:givenName>Freddy</gd:givenName>", "<gd:familyName>Smith</gd:familyName>"},
+			wantAbsent: []string{"Fred Smith"},
+		},
+		{
+			name: "phone changed",
+			person: internal.Person{
+				Attributes: map[string]string{contactFieldPhoneNumber: "555-1234"},
+				Changes:    []internal.AttributeChange{{Attribute: contactFieldPhoneNumber, Old: "555-1212", New: "555-1234"}},
+			},
+			want:       []string{`<gd:phoneNumber rel="` + relPhoneWork + `" primary="true">555-1234</gd:phoneNumber>`},
+			wantAbsent: []string{"555-1212"},
+		},
+	}
+	for _, tt := range tests {
+		g := GoogleContacts{}
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := g.updateBody(contact, tt.person)
+			if err != nil {
+				t.Errorf("unexpected error in updateBody: %s", err)
+				return
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("no '%v' in body: \n%v", want, body)
+				}
+			}
+			for _, absent := range tt.wantAbsent {
+				if strings.Contains(body, absent) {
+					t.Errorf("unexpected '%v' in body: \n%v", absent, body)
+				}
+			}
+		})
+	}
+}
+
 func TestGoogleContacts_getPhonesFromAttributes(t *testing.T) {
 	tests := []struct {
 		name       string
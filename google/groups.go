@@ -1,6 +1,7 @@
 package google
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/syslog"
@@ -14,8 +15,6 @@ import (
 	"google.golang.org/api/googleapi"
 
 	"github.com/silinternational/personnel-sync/v6/internal"
-
-	"golang.org/x/net/context"
 )
 
 const (
@@ -91,10 +90,10 @@ func (g *GoogleGroups) ForSet(syncSetJson json.RawMessage) error {
 	return nil
 }
 
-func (g *GoogleGroups) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+func (g *GoogleGroups) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
 	var membersList []*admin.Member
 	membersListCall := g.AdminService.Members.List(g.GroupSyncSet.GroupEmail)
-	err := membersListCall.Pages(context.TODO(), func(members *admin.Members) error {
+	err := membersListCall.Pages(ctx, func(members *admin.Members) error {
 		membersList = append(membersList, members.Members...)
 		return nil
 	})
@@ -131,6 +130,7 @@ func (g *GoogleGroups) ListUsers(desiredAttrs []string) ([]internal.Person, erro
 }
 
 func (g *GoogleGroups) ApplyChangeSet(
+	ctx context.Context,
 	changes internal.ChangeSet,
 	eventLog chan<- internal.EventLogItem,
 ) internal.ChangeResults {
@@ -171,14 +171,20 @@ func (g *GoogleGroups) ApplyChangeSet(
 
 	if !g.GroupSyncSet.DisableAdd {
 		for email, role := range toBeCreated {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go g.addMember(email, role, &results.Created, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go g.addMember(ctx, email, role, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
 	if !g.GroupSyncSet.DisableDelete {
 		for _, dp := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
 			// Do not delete ExtraManagers, ExtraOwners, or ExtraMembers
 			if slices.Contains(g.GroupSyncSet.ExtraManagers, dp.CompareValue) ||
 				slices.Contains(g.GroupSyncSet.ExtraOwners, dp.CompareValue) ||
@@ -186,8 +192,8 @@ func (g *GoogleGroups) ApplyChangeSet(
 				continue
 			}
 			wg.Add(1)
-			go g.removeMember(dp.CompareValue, &results.Deleted, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go g.removeMember(ctx, dp.CompareValue, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -197,6 +203,7 @@ func (g *GoogleGroups) ApplyChangeSet(
 }
 
 func (g *GoogleGroups) addMember(
+	ctx context.Context,
 	email, role string,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -209,7 +216,7 @@ func (g *GoogleGroups) addMember(
 		Email: email,
 	}
 
-	_, err := g.AdminService.Members.Insert(g.GroupSyncSet.GroupEmail, &newMember).Do()
+	_, err := g.AdminService.Members.Insert(g.GroupSyncSet.GroupEmail, &newMember).Context(ctx).Do()
 	if err != nil && !strings.Contains(err.Error(), "409") { // error code 409 is for existing user
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -227,6 +234,7 @@ func (g *GoogleGroups) addMember(
 }
 
 func (g *GoogleGroups) removeMember(
+	ctx context.Context,
 	email string,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -234,7 +242,7 @@ func (g *GoogleGroups) removeMember(
 ) {
 	defer wg.Done()
 
-	err := g.AdminService.Members.Delete(g.GroupSyncSet.GroupEmail, email).Do()
+	err := g.AdminService.Members.Delete(g.GroupSyncSet.GroupEmail, email).Context(ctx).Do()
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
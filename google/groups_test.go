@@ -1,6 +1,7 @@
 package google
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -59,7 +60,7 @@ func TestGoogleGroups_ApplyChangeSet(t *testing.T) {
 				t.Fatalf("Failed to get new googleGroups instance, error: %s", err.Error())
 			}
 			eventLog := make(chan internal.EventLogItem, 50)
-			if got := g.ApplyChangeSet(tt.args.changes, eventLog); !reflect.DeepEqual(got, tt.want) {
+			if got := g.ApplyChangeSet(context.Background(), tt.args.changes, eventLog); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GoogleGroups.ApplyChangeSet() = %v, want %v", got, tt.want)
 			}
 			close(eventLog)
@@ -107,7 +108,7 @@ func TestGoogleGroups_ListUsers(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Failed to get new googleGroups instance, error: %s", err.Error())
 			}
-			got, err := g.ListUsers([]string{})
+			got, err := g.ListUsers(context.Background(), []string{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GoogleGroups.ListUsers() error = %v, wantErr %v", err, tt.wantErr)
 				return
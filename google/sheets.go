@@ -1,11 +1,11 @@
 package google
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/syslog"
 
-	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
@@ -107,14 +107,14 @@ func (g *GoogleSheets) ForSet(syncSetJson json.RawMessage) error {
 	return nil
 }
 
-func (g *GoogleSheets) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+func (g *GoogleSheets) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
 	if g.DestinationConfig.Type != "" {
 		// if this sheet is a destination, don't return the list of users since we don't have logic to do incremental
 		// updates to the sheet
 		return nil, nil
 	}
 
-	sheetData, err := g.readSheet()
+	sheetData, err := g.readSheet(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("googleSheets ListUsers error %w", err)
 	}
@@ -123,38 +123,18 @@ func (g *GoogleSheets) ListUsers(desiredAttrs []string) ([]internal.Person, erro
 }
 
 func getPersonsFromSheetData(sheetData [][]any, desiredAttrs []string, compareAttr string) []internal.Person {
-	header := map[int]string{}
-	if len(sheetData) < 1 {
-		return []internal.Person{}
-	}
-
-	attrMap := make(map[string]bool, len(desiredAttrs))
-	for _, a := range desiredAttrs {
-		attrMap[a] = true
-	}
-
-	p := make([]internal.Person, len(sheetData)-1)
+	table := make([][]string, len(sheetData))
 	for i, row := range sheetData {
-		if i == 0 {
-			for j, cellValue := range row {
-				header[j] = cellValue.(string)
-			}
-			continue
-		}
-		p[i-1].Attributes = map[string]string{}
+		table[i] = make([]string, len(row))
 		for j, cellValue := range row {
-			if attrMap[header[j]] {
-				p[i-1].Attributes[header[j]] = cellValue.(string)
-				if header[j] == compareAttr {
-					p[i-1].CompareValue = cellValue.(string)
-				}
-			}
+			table[i][j] = fmt.Sprintf("%v", cellValue)
 		}
 	}
-	return p
+	return internal.PeopleFromTable(table, desiredAttrs, compareAttr)
 }
 
 func (g *GoogleSheets) ApplyChangeSet(
+	ctx context.Context,
 	changes internal.ChangeSet,
 	eventLog chan<- internal.EventLogItem,
 ) internal.ChangeResults {
@@ -166,7 +146,7 @@ func (g *GoogleSheets) ApplyChangeSet(
 		return internal.ChangeResults{}
 	}
 
-	sheetData, err := g.readSheet()
+	sheetData, err := g.readSheet(ctx)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ALERT,
@@ -175,7 +155,7 @@ func (g *GoogleSheets) ApplyChangeSet(
 		return internal.ChangeResults{}
 	}
 
-	if err := g.clearSheet(sheetData); err != nil {
+	if err := g.clearSheet(ctx, sheetData); err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ALERT,
 			Message: fmt.Sprintf("unable to clear sheet, error: %v", err),
@@ -183,7 +163,7 @@ func (g *GoogleSheets) ApplyChangeSet(
 		return internal.ChangeResults{}
 	}
 
-	if err := g.updateSheet(getHeaderFromSheetData(sheetData), changes.Create); err != nil {
+	if err := g.updateSheet(ctx, getHeaderFromSheetData(sheetData), changes.Create); err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ALERT,
 			Message: fmt.Sprintf("unable to update sheet, error: %v", err),
@@ -194,9 +174,9 @@ func (g *GoogleSheets) ApplyChangeSet(
 	return internal.ChangeResults{Created: uint64(len(changes.Create))}
 }
 
-func (g *GoogleSheets) readSheet() ([][]any, error) {
+func (g *GoogleSheets) readSheet(ctx context.Context) ([][]any, error) {
 	readRange := fmt.Sprintf("%s!A1:ZZ", g.SheetsSyncSet.SheetName)
-	resp, err := g.Service.Spreadsheets.Values.Get(g.SheetsSyncSet.SheetID, readRange).Do()
+	resp, err := g.Service.Spreadsheets.Values.Get(g.SheetsSyncSet.SheetID, readRange).Context(ctx).Do()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve data from sheet '%s', error: %v", g.SheetsSyncSet.SheetName, err)
 	}
@@ -218,7 +198,7 @@ func getHeaderFromSheetData(sheetData [][]any) map[int]string {
 	return header
 }
 
-func (g *GoogleSheets) clearSheet(data [][]any) error {
+func (g *GoogleSheets) clearSheet(ctx context.Context, data [][]any) error {
 	for i, row := range data {
 		if i == 0 {
 			continue
@@ -234,14 +214,14 @@ func (g *GoogleSheets) clearSheet(data [][]any) error {
 	updateRange := fmt.Sprintf("%s!A1", g.SheetsSyncSet.SheetName)
 	_, err := g.Service.Spreadsheets.Values.
 		Update(g.SheetsSyncSet.SheetID, updateRange, v).
-		ValueInputOption("RAW").Do()
+		ValueInputOption("RAW").Context(ctx).Do()
 	if err != nil {
 		return fmt.Errorf("unable to clear sheet, error: %v", err)
 	}
 	return nil
 }
 
-func (g *GoogleSheets) updateSheet(header map[int]string, persons []internal.Person) error {
+func (g *GoogleSheets) updateSheet(ctx context.Context, header map[int]string, persons []internal.Person) error {
 	table := makeSheetDataFromPersons(header, persons)
 	v := &sheets.ValueRange{
 		Values: table,
@@ -250,7 +230,7 @@ func (g *GoogleSheets) updateSheet(header map[int]string, persons []internal.Per
 	updateRange := fmt.Sprintf("%s!A2:ZZ", g.SheetsSyncSet.SheetName)
 	_, err := g.Service.Spreadsheets.Values.
 		Update(g.SheetsSyncSet.SheetID, updateRange, v).
-		ValueInputOption("RAW").Do()
+		ValueInputOption("RAW").Context(ctx).Do()
 	if err != nil {
 		return fmt.Errorf("unable to update sheet, error: %v", err)
 	}
@@ -1,29 +1,90 @@
 package google
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/syslog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/silinternational/personnel-sync/v6/internal"
 
-	"golang.org/x/net/context"
 	admin "google.golang.org/api/admin/directory/v1"
 	"google.golang.org/api/googleapi"
 )
 
+// Hash functions accepted by the Google Directory API for a password hash
+const (
+	HashFunctionMD5   = "MD5"
+	HashFunctionSHA1  = "SHA-1"
+	HashFunctionCrypt = "crypt"
+)
+
+// Destination attributes that are only used to create a user, since Google does not return them
+const (
+	passwordHashAttribute = "passwordHash"
+	hashFunctionAttribute = "hashFunction"
+)
+
+// Actions taken on departed users, who are in the Delete list because they are no longer in the source
+const (
+	DepartedActionSuspend = "Suspend"
+	DepartedActionMove    = "Move"
+	DepartedActionArchive = "Archive"
+	DepartedActionDelete  = "Delete"
+)
+
 type GoogleUsers struct {
 	DestinationConfig internal.DestinationConfig
 	BatchSize         int
 	BatchDelaySeconds int
 	GoogleConfig      GoogleConfig
+	UsersConfig       UsersConfig
+	UsersSyncSet      UsersSyncSet
 	AdminService      admin.Service
+
+	// departedUsers holds the email address, in lower case, of each user found by ListUsers that has already had the
+	// DepartedUsers Action taken
+	departedUsers map[string]bool
+}
+
+// UsersConfig holds the properties in ExtraJSON that are specific to the GoogleUsers destination
+type UsersConfig struct {
+	NewUsers      NewUsersConfig
+	DepartedUsers DepartedUsersConfig
+}
+
+// UsersSyncSet limits the users listed for a sync set. If none of its properties are set, all users are listed.
+type UsersSyncSet struct {
+	OrgUnitPath string           // list only the users in this org unit or below it
+	Domain      string           // list only the users in this domain, instead of all domains of the customer
+	Query       string           // a Directory API search query, such as "isSuspended=false"
+	Filters     internal.Filters // applied to the attributes of each user
+}
+
+// NewUsersConfig configures the users created for people in the Create list
+type NewUsersConfig struct {
+	OrgUnitPath               string // the org unit of new users, default the sync set OrgUnitPath or "/"
+	HashFunction              string // the default for the hashFunction attribute: "MD5", "SHA-1", or "crypt"
+	ChangePasswordAtNextLogin bool   // require new users to change their password at first login
+}
+
+// DepartedUsersConfig configures what is done to the users in the Delete list. If Action is empty, they are not
+// changed.
+type DepartedUsersConfig struct {
+	Action          string   // "Suspend", "Move", "Archive", or "Delete"
+	OrgUnitPath     string   // the org unit departed users are moved to, required for Move
+	DeleteAfterDays int      // if set, departed users are deleted this many days after the Action is taken
+	DateAttribute   string   // a custom schema field, such as "Departure.Date", set to the date the Action is taken
+	ProtectedUsers  []string // email addresses of users that are never changed
 }
 
 func NewGoogleUsersDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
@@ -34,6 +95,22 @@ func NewGoogleUsersDestination(destinationConfig internal.DestinationConfig) (in
 		return &GoogleUsers{}, err
 	}
 
+	err = json.Unmarshal(destinationConfig.ExtraJSON, &googleUsers.UsersConfig)
+	if err != nil {
+		return &GoogleUsers{}, err
+	}
+	if err = googleUsers.UsersConfig.NewUsers.validate(); err != nil {
+		return &GoogleUsers{}, fmt.Errorf("invalid NewUsers config: %w", err)
+	}
+	if err = googleUsers.UsersConfig.DepartedUsers.validate(); err != nil {
+		return &GoogleUsers{}, fmt.Errorf("invalid DepartedUsers config: %w", err)
+	}
+	// Never suspend or delete the user that the sync acts as
+	if email := googleUsers.GoogleConfig.DelegatedAdminEmail; email != "" {
+		departed := &googleUsers.UsersConfig.DepartedUsers
+		departed.ProtectedUsers = append(departed.ProtectedUsers, email)
+	}
+
 	// Defaults
 	if googleUsers.BatchSize <= 0 {
 		googleUsers.BatchSize = DefaultBatchSize
@@ -57,11 +134,58 @@ func NewGoogleUsersDestination(destinationConfig internal.DestinationConfig) (in
 	return &googleUsers, nil
 }
 
+// CreateOnlyAttributes returns the attributes that are only set when a user is created
+func (g *GoogleUsers) CreateOnlyAttributes() []string {
+	return []string{passwordHashAttribute, hashFunctionAttribute}
+}
+
 func (g *GoogleUsers) ForSet(syncSetJson json.RawMessage) error {
-	// sync sets not implemented for this destination
+	var syncSetConfig UsersSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := syncSetConfig.Filters.Validate(); err != nil {
+		return err
+	}
+
+	if path := syncSetConfig.OrgUnitPath; path != "" {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("OrgUnitPath must start with '/': %s", path)
+		}
+		if strings.Contains(path, "'") {
+			return fmt.Errorf("OrgUnitPath cannot contain a quote: %s", path)
+		}
+		// users created outside of the sync set would not be listed, and would be created again on every run
+		if newPath := g.UsersConfig.NewUsers.OrgUnitPath; newPath != "" && !isInOrgUnit(newPath, path) {
+			return fmt.Errorf("NewUsers OrgUnitPath %s is not in the sync set OrgUnitPath %s", newPath, path)
+		}
+	}
+
+	g.UsersSyncSet = syncSetConfig
 	return nil
 }
 
+// query returns the Directory API search query for the OrgUnitPath and Query of the sync set
+func (s UsersSyncSet) query() string {
+	var terms []string
+	if s.OrgUnitPath != "" && s.OrgUnitPath != "/" {
+		terms = append(terms, "orgUnitPath='"+s.OrgUnitPath+"'")
+	}
+	if s.Query != "" {
+		terms = append(terms, s.Query)
+	}
+	return strings.Join(terms, " ")
+}
+
+// isInOrgUnit returns true if the org unit path is the same as parent, or is below it
+func isInOrgUnit(path, parent string) bool {
+	path, parent = strings.ToLower(path), strings.ToLower(strings.TrimSuffix(parent, "/"))
+	return parent == "" || path == parent || strings.HasPrefix(path, parent+"/")
+}
+
 func extractData(user admin.User) internal.Person {
 	attributes := map[string]string{"email": strings.ToLower(user.PrimaryEmail)}
 
@@ -190,12 +314,19 @@ func setStringFromInterface(i any, m map[string]string, key string) {
 	}
 }
 
-func (g *GoogleUsers) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+func (g *GoogleUsers) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
 	var usersList []*admin.User
 	usersListCall := g.AdminService.Users.List()
-	usersListCall.Customer("my_customer") // query all domains in this GSuite
-	usersListCall.Projection("full")      // include custom fields
-	err := usersListCall.Pages(context.TODO(), func(users *admin.Users) error {
+	if g.UsersSyncSet.Domain != "" {
+		usersListCall.Domain(g.UsersSyncSet.Domain)
+	} else {
+		usersListCall.Customer("my_customer") // query all domains in this GSuite
+	}
+	if query := g.UsersSyncSet.query(); query != "" {
+		usersListCall.Query(query)
+	}
+	usersListCall.Projection("full") // include custom fields
+	err := usersListCall.Pages(ctx, func(users *admin.Users) error {
 		usersList = append(usersList, users.Users...)
 		return nil
 	})
@@ -210,16 +341,35 @@ func (g *GoogleUsers) ListUsers(desiredAttrs []string) ([]internal.Person, error
 		return []internal.Person{}, syncErr
 	}
 
+	g.departedUsers = map[string]bool{}
+	departed := g.UsersConfig.DepartedUsers
+	now := time.Now()
 	var people []internal.Person
 	for _, nextUser := range usersList {
-		if nextUser != nil {
-			people = append(people, extractData(*nextUser))
+		if nextUser == nil {
+			continue
 		}
+		person := extractData(*nextUser)
+		if match, err := person.Matches(g.UsersSyncSet.Filters); err != nil {
+			return []internal.Person{}, fmt.Errorf("filter failure: %w", err)
+		} else if !match {
+			continue
+		}
+		if departed.isDeparted(*nextUser) && !departed.isProtected(person.CompareValue) {
+			g.departedUsers[strings.ToLower(nextUser.PrimaryEmail)] = true
+			// Do not list users who have been offboarded and are not yet due for deletion, so that they are not
+			// planned as deletes, and counted against the change limits, on every run
+			if g.departedAction(person, now) == "" {
+				continue
+			}
+		}
+		people = append(people, person)
 	}
 	return people, nil
 }
 
 func (g *GoogleUsers) ApplyChangeSet(
+	ctx context.Context,
 	changes internal.ChangeSet,
 	eventLog chan<- internal.EventLogItem,
 ) internal.ChangeResults {
@@ -229,11 +379,48 @@ func (g *GoogleUsers) ApplyChangeSet(
 	// One minute per batch
 	batchTimer := internal.NewBatchTimer(g.BatchSize, g.BatchDelaySeconds)
 
+	if !g.DestinationConfig.DisableAdd {
+		if query := g.UsersSyncSet.Query; query != "" && len(changes.Create) > 0 {
+			eventLog <- internal.EventLogItem{
+				Level: syslog.LOG_WARNING,
+				Message: fmt.Sprintf("new users are not checked against the sync set Query %q, and are created "+
+					"again on the next run if they do not match it", query),
+			}
+		}
+		for _, toCreate := range changes.Create {
+			if internal.Stopping(ctx) {
+				break
+			}
+			wg.Add(1)
+			go g.createUser(ctx, toCreate, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
+		}
+	}
+
 	if !g.DestinationConfig.DisableUpdate {
 		for _, toUpdate := range changes.Update {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go g.updateUser(toUpdate, &results.Updated, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go g.updateUser(ctx, toUpdate, &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
+		}
+	}
+
+	if !g.DestinationConfig.DisableDelete {
+		now := time.Now()
+		for _, toDelete := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
+			action := g.departedAction(toDelete, now)
+			if action == "" {
+				continue
+			}
+			wg.Add(1)
+			go g.offboardUser(ctx, toDelete, action, now, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -249,6 +436,7 @@ func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, e
 	isOrgModified := false
 
 	phones := getPhoneNumbersFromUser(oldUser)
+	customSchemas := map[string]map[string]string{}
 
 	for key, val := range person.Attributes {
 		switch beforeDelim(key) {
@@ -305,15 +493,22 @@ func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, e
 				continue
 			}
 
-			j, err := json.Marshal(&map[string]string{keys[1]: val})
-			if err != nil {
-				return admin.User{}, fmt.Errorf("error marshaling custom schema, %s", err)
+			if customSchemas[keys[0]] == nil {
+				customSchemas[keys[0]] = map[string]string{}
 			}
+			customSchemas[keys[0]][keys[1]] = val
+		}
+	}
 
-			user.CustomSchemas = map[string]googleapi.RawMessage{
-				keys[0]: j,
-			}
+	for schema, fields := range customSchemas {
+		j, err := json.Marshal(fields)
+		if err != nil {
+			return admin.User{}, fmt.Errorf("error marshaling custom schema, %s", err)
 		}
+		if user.CustomSchemas == nil {
+			user.CustomSchemas = map[string]googleapi.RawMessage{}
+		}
+		user.CustomSchemas[schema] = j
 	}
 
 	user.Phones, err = attributesToUserPhones(phones)
@@ -329,12 +524,223 @@ func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, e
 	return user, nil
 }
 
+// newUserForCreate prepares a new user with the person's attributes, in the org unit given in the NewUsersConfig. The
+// initial password is the person's passwordHash attribute, if set, or else a random password.
+func newUserForCreate(person internal.Person, config NewUsersConfig) (admin.User, error) {
+	user, err := newUserForUpdate(person, admin.User{})
+	if err != nil {
+		return admin.User{}, err
+	}
+
+	if user.Name == nil || user.Name.GivenName == "" || user.Name.FamilyName == "" {
+		return admin.User{}, errors.New("givenName and familyName are required to create a user")
+	}
+
+	user.PrimaryEmail = person.CompareValue
+	user.OrgUnitPath = config.OrgUnitPath
+	if user.OrgUnitPath == "" {
+		user.OrgUnitPath = "/"
+	}
+	user.ChangePasswordAtNextLogin = config.ChangePasswordAtNextLogin
+	if hash := person.Attributes[passwordHashAttribute]; hash != "" {
+		user.HashFunction = person.Attributes[hashFunctionAttribute]
+		if user.HashFunction == "" {
+			user.HashFunction = config.HashFunction
+		}
+		if err := validateHashFunction(user.HashFunction); err != nil {
+			return admin.User{}, err
+		}
+		user.Password = hash
+	} else {
+		user.Password = rand.Text()
+	}
+
+	return user, nil
+}
+
+func (n *NewUsersConfig) validate() error {
+	if n.OrgUnitPath != "" && !strings.HasPrefix(n.OrgUnitPath, "/") {
+		return fmt.Errorf("OrgUnitPath must start with '/': %s", n.OrgUnitPath)
+	}
+
+	if n.HashFunction != "" {
+		return validateHashFunction(n.HashFunction)
+	}
+	return nil
+}
+
+func validateHashFunction(hashFunction string) error {
+	switch hashFunction {
+	case "":
+		return errors.New("hashFunction is required with passwordHash")
+	case HashFunctionMD5, HashFunctionSHA1, HashFunctionCrypt:
+		return nil
+	default:
+		return fmt.Errorf("invalid hashFunction %q, must be %s, %s, or %s", hashFunction,
+			HashFunctionMD5, HashFunctionSHA1, HashFunctionCrypt)
+	}
+}
+
+func (d *DepartedUsersConfig) validate() error {
+	switch d.Action {
+	case "":
+		if d.OrgUnitPath != "" || d.DeleteAfterDays != 0 || d.DateAttribute != "" {
+			return errors.New("Action is required with OrgUnitPath, DeleteAfterDays, or DateAttribute")
+		}
+		return nil
+	case DepartedActionSuspend, DepartedActionArchive:
+	case DepartedActionMove:
+		if d.OrgUnitPath == "" {
+			return errors.New("OrgUnitPath is required to Move departed users")
+		}
+	case DepartedActionDelete:
+		if d.OrgUnitPath != "" || d.DeleteAfterDays != 0 || d.DateAttribute != "" {
+			return errors.New("OrgUnitPath, DeleteAfterDays, and DateAttribute cannot be used to Delete departed users")
+		}
+	default:
+		return fmt.Errorf("invalid Action %q, must be %s, %s, %s, or %s", d.Action,
+			DepartedActionSuspend, DepartedActionMove, DepartedActionArchive, DepartedActionDelete)
+	}
+
+	if d.OrgUnitPath != "" && !strings.HasPrefix(d.OrgUnitPath, "/") {
+		return fmt.Errorf("OrgUnitPath must start with '/': %s", d.OrgUnitPath)
+	}
+	if d.DeleteAfterDays < 0 {
+		return errors.New("DeleteAfterDays cannot be negative")
+	}
+	if d.DeleteAfterDays > 0 && d.DateAttribute == "" {
+		return errors.New("DateAttribute is required with DeleteAfterDays")
+	}
+	if d.DateAttribute != "" && !strings.Contains(strings.Trim(d.DateAttribute, "."), ".") {
+		return fmt.Errorf("DateAttribute must be a custom schema field, such as Departure.Date: %s", d.DateAttribute)
+	}
+	return nil
+}
+
+// isDeparted returns true if the Action, other than Delete, has already been taken on the user
+func (d *DepartedUsersConfig) isDeparted(user admin.User) bool {
+	if d.OrgUnitPath != "" && !strings.EqualFold(user.OrgUnitPath, d.OrgUnitPath) {
+		return false
+	}
+	switch d.Action {
+	case DepartedActionSuspend:
+		return user.Suspended
+	case DepartedActionArchive:
+		return user.Archived
+	case DepartedActionMove:
+		return true
+	}
+	return false
+}
+
+// isProtected returns true if the email address is one of the ProtectedUsers
+func (d *DepartedUsersConfig) isProtected(email string) bool {
+	return slices.ContainsFunc(d.ProtectedUsers, func(protected string) bool {
+		return strings.EqualFold(protected, email)
+	})
+}
+
+// departedAction returns the action to take now on a person in the Delete list, which is the DepartedUsers Action if
+// it has not been taken yet, Delete if the user departed at least DeleteAfterDays ago, or else an empty string.
+func (g *GoogleUsers) departedAction(person internal.Person, now time.Time) string {
+	d := g.UsersConfig.DepartedUsers
+	if d.Action == "" || d.isProtected(person.CompareValue) {
+		return ""
+	}
+	if !g.departedUsers[strings.ToLower(person.CompareValue)] {
+		return d.Action
+	}
+	if d.DeleteAfterDays == 0 {
+		return ""
+	}
+
+	departed, err := time.Parse(time.DateOnly, person.Attributes[d.DateAttribute])
+	if err != nil {
+		// take the Action again to record the date it was taken
+		return d.Action
+	}
+	if now.Before(departed.AddDate(0, 0, d.DeleteAfterDays)) {
+		return ""
+	}
+	return DepartedActionDelete
+}
+
 func beforeDelim(s string) string {
 	split := strings.SplitN(s, delim, 2)
 	return split[0]
 }
 
+func (g *GoogleUsers) createUser(
+	ctx context.Context,
+	person internal.Person,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem,
+) {
+	defer wg.Done()
+
+	email := person.CompareValue
+
+	// users created outside of the sync set Domain would not be listed, and would be created again on every run
+	domain := g.UsersSyncSet.Domain
+	if domain != "" && !strings.HasSuffix(strings.ToLower(email), "@"+strings.ToLower(domain)) {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to create %s in Users: not in the sync set Domain %s", email, domain),
+		}
+		return
+	}
+
+	config := g.UsersConfig.NewUsers
+	if config.OrgUnitPath == "" {
+		config.OrgUnitPath = g.UsersSyncSet.OrgUnitPath
+	}
+
+	// an offboarded user is not listed, so is in the Create list if they return to the source
+	if g.departedUsers[strings.ToLower(email)] {
+		if err := g.reactivateUser(ctx, person, config); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:   syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to reactivate %s in Users: %s", email, err.Error()),
+			}
+			return
+		}
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_INFO,
+			Message: "ReactivateUser " + email,
+		}
+		atomic.AddUint64(counter, 1)
+		return
+	}
+
+	newUser, err := newUserForCreate(person, config)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to prepare %s for creation in Users: %s", email, err.Error()),
+		}
+		return
+	}
+
+	_, err = g.AdminService.Users.Insert(&newUser).Context(ctx).Do()
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to create %s in Users: %s", email, err.Error()),
+		}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: "CreateUser " + email,
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
 func (g *GoogleUsers) updateUser(
+	ctx context.Context,
 	person internal.Person,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -344,7 +750,7 @@ func (g *GoogleUsers) updateUser(
 
 	email := person.Attributes["email"]
 
-	oldUser, err := g.getUser(person.CompareValue)
+	oldUser, err := g.getUser(ctx, person.CompareValue)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -362,7 +768,7 @@ func (g *GoogleUsers) updateUser(
 		return
 	}
 
-	_, err3 := g.AdminService.Users.Update(email, &newUser).Do()
+	_, err3 := g.AdminService.Users.Update(email, &newUser).Context(ctx).Do()
 	if err3 != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -379,9 +785,107 @@ func (g *GoogleUsers) updateUser(
 	atomic.AddUint64(counter, 1)
 }
 
-func (g *GoogleUsers) getUser(email string) (admin.User, error) {
+// offboardUser takes an action on a departed user: deleting the user, or else suspending, moving, or archiving the
+// user and recording the date in the DateAttribute
+func (g *GoogleUsers) offboardUser(
+	ctx context.Context,
+	person internal.Person,
+	action string,
+	now time.Time,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem,
+) {
+	defer wg.Done()
+
+	email := person.CompareValue
+	d := g.UsersConfig.DepartedUsers
+	message := action + "User " + email
+
+	var err error
+	if action == DepartedActionDelete {
+		err = g.AdminService.Users.Delete(email).Context(ctx).Do()
+	} else {
+		user := admin.User{
+			Suspended:   action == DepartedActionSuspend,
+			Archived:    action == DepartedActionArchive,
+			OrgUnitPath: d.OrgUnitPath,
+		}
+		if d.OrgUnitPath != "" {
+			message += ", org unit " + d.OrgUnitPath
+		}
+		if d.DateAttribute != "" {
+			schema, field, _ := strings.Cut(d.DateAttribute, ".")
+			j, _ := json.Marshal(map[string]string{field: now.Format(time.DateOnly)})
+			user.CustomSchemas = map[string]googleapi.RawMessage{schema: j}
+		}
+		_, err = g.AdminService.Users.Update(email, &user).Context(ctx).Do()
+	}
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to %s %s in Users: %s", strings.ToLower(action), email, err.Error()),
+		}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: message,
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
+// reactivateUser reverses the DepartedUsers Action taken on a user who is in the source again. The user is
+// unsuspended or unarchived, moved back to the org unit of new users if they were moved, and updated with the
+// person's attributes, and the DateAttribute is cleared.
+func (g *GoogleUsers) reactivateUser(ctx context.Context, person internal.Person, config NewUsersConfig) error {
+	oldUser, err := g.getUser(ctx, person.CompareValue)
+	if err != nil {
+		return err
+	}
+	user, err := newUserForUpdate(person, oldUser)
+	if err != nil {
+		return err
+	}
+
+	d := g.UsersConfig.DepartedUsers
+	switch d.Action {
+	case DepartedActionSuspend:
+		user.ForceSendFields = append(user.ForceSendFields, "Suspended")
+	case DepartedActionArchive:
+		user.ForceSendFields = append(user.ForceSendFields, "Archived")
+	}
+	if d.OrgUnitPath != "" {
+		user.OrgUnitPath = config.OrgUnitPath
+		if user.OrgUnitPath == "" {
+			user.OrgUnitPath = "/"
+		}
+	}
+	if d.DateAttribute != "" {
+		schema, field, _ := strings.Cut(d.DateAttribute, ".")
+		fields := map[string]any{}
+		if j, ok := user.CustomSchemas[schema]; ok {
+			if err := json.Unmarshal(j, &fields); err != nil {
+				return err
+			}
+		}
+		fields[field] = nil
+		j, _ := json.Marshal(fields)
+		if user.CustomSchemas == nil {
+			user.CustomSchemas = map[string]googleapi.RawMessage{}
+		}
+		user.CustomSchemas[schema] = j
+	}
+
+	_, err = g.AdminService.Users.Update(person.CompareValue, &user).Context(ctx).Do()
+	return err
+}
+
+func (g *GoogleUsers) getUser(ctx context.Context, email string) (admin.User, error) {
 	userCall := g.AdminService.Users.Get(email)
-	user, err := userCall.Do()
+	user, err := userCall.Context(ctx).Do()
 	if err != nil || user == nil {
 		return admin.User{}, err
 	}
@@ -0,0 +1,147 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+	"github.com/silinternational/personnel-sync/v6/internal/testutil"
+)
+
+const testUsersPath = "/admin/directory/v1/users"
+
+// testDirectory is an in-process Google Directory API with the user methods used by GoogleUsers
+type testDirectory struct {
+	*testutil.Server
+	users map[string]admin.User
+}
+
+func startTestDirectory(t *testing.T, users ...admin.User) (*testDirectory, admin.Service) {
+	d := &testDirectory{users: map[string]admin.User{}}
+	for _, u := range users {
+		d.users[u.PrimaryEmail] = u
+	}
+
+	d.Server = testutil.NewServer(t, d.handle)
+
+	service, err := admin.NewService(context.Background(),
+		option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(d.URL+"/"))
+	require.NoError(t, err)
+	return d, *service
+}
+
+func (d *testDirectory) handle(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, testUsersPath), "/")
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		domain := r.URL.Query().Get("domain")
+		users := []admin.User{}
+		for _, email := range slices.Sorted(maps.Keys(d.users)) {
+			if domain == "" || strings.HasSuffix(email, "@"+domain) {
+				users = append(users, d.users[email])
+			}
+		}
+		writeTestJSON(w, map[string]any{"users": users})
+	case r.Method == http.MethodPost && key == "":
+		var u admin.User
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			writeTestError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := d.users[u.PrimaryEmail]; ok {
+			writeTestError(w, http.StatusConflict, "Entity already exists.")
+			return
+		}
+		d.users[u.PrimaryEmail] = u
+		writeTestJSON(w, u)
+	case r.Method == http.MethodGet && key != "":
+		u, ok := d.users[key]
+		if !ok {
+			writeTestError(w, http.StatusNotFound, "Resource Not Found: userKey")
+			return
+		}
+		writeTestJSON(w, u)
+	case r.Method == http.MethodPut && key != "":
+		if _, ok := d.users[key]; !ok {
+			writeTestError(w, http.StatusNotFound, "Resource Not Found: userKey")
+			return
+		}
+		// the update has patch semantics, so only the fields in the request are changed
+		u := d.users[key]
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			writeTestError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		d.users[key] = u
+		writeTestJSON(w, u)
+	case r.Method == http.MethodDelete && key != "":
+		if _, ok := d.users[key]; !ok {
+			writeTestError(w, http.StatusNotFound, "Resource Not Found: userKey")
+			return
+		}
+		delete(d.users, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeTestError(w, http.StatusNotImplemented, "not implemented")
+	}
+}
+
+func (d *testDirectory) user(email string) (admin.User, bool) {
+	d.Lock()
+	defer d.Unlock()
+	u, ok := d.users[email]
+	return u, ok
+}
+
+// listQuery returns the query parameters of the last request to list users
+func (d *testDirectory) listQuery() url.Values {
+	var query url.Values
+	for _, request := range d.Requests() {
+		if request.Method == http.MethodGet && request.Path == testUsersPath {
+			query, _ = url.ParseQuery(request.Query)
+		}
+	}
+	return query
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	testutil.WriteJSON(w, http.StatusOK, v)
+}
+
+func writeTestError(w http.ResponseWriter, status int, message string) {
+	testutil.WriteJSON(w, status, map[string]any{"error": map[string]any{"code": status, "message": message}})
+}
+
+func applyTestUserChanges(
+	t *testing.T,
+	g *GoogleUsers,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := g.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+// withAttributes returns a copy of the person with the given attributes added
+func withAttributes(person internal.Person, attributes map[string]string) internal.Person {
+	person.Attributes = maps.Clone(person.Attributes)
+	maps.Copy(person.Attributes, attributes)
+	return person
+}
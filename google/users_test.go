@@ -1,10 +1,14 @@
 package google
 
 import (
+	"context"
+	"io"
+	"log"
 	"math/rand"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/googleapi"
@@ -73,7 +77,7 @@ func TestGoogleUsers_ListUsers(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			g, err := NewGoogleUsersDestination(tt.fields.DestinationConfig)
 			require.NoErrorf(t, err, "Failed to get new googleUsers instance, error: %s", err.Error())
-			got, err := g.ListUsers([]string{})
+			got, err := g.ListUsers(context.Background(), []string{})
 			require.Equalf(t, tt.wantErr, err != nil, "GoogleUsers.ListUsers() error = %v, wantErr %v", err, tt.wantErr)
 			require.Equalf(t, got, tt.want, "GoogleUsers.ListUsers() = %v, want %v", got, tt.want)
 		})
@@ -140,7 +144,7 @@ func TestGoogleUsers_ApplyChangeSet(t *testing.T) {
 			g, err := NewGoogleUsersDestination(tt.fields.DestinationConfig)
 			require.NoErrorf(t, err, "Failed to get new googleUsers instance, error: %s", err.Error())
 			eventLog := make(chan internal.EventLogItem, 50)
-			got := g.ApplyChangeSet(tt.args.changes, eventLog)
+			got := g.ApplyChangeSet(context.Background(), tt.args.changes, eventLog)
 			require.Equalf(t, tt.want, got, "GoogleUsers.ApplyChangeSet() = %v, want %v", got, tt.want)
 			close(eventLog)
 		})
@@ -200,7 +204,8 @@ func TestGoogleUsers_extractData(t *testing.T) {
 					"value": "manager@example.com",
 				}},
 				CustomSchemas: map[string]googleapi.RawMessage{
-					"Location": []byte(`{"Building":"A building"}`),
+					"Location": []byte(`{"Building":"A building","Floor":"2"}`),
+					"HR":       []byte(`{"Grade":"7"}`),
 				},
 			},
 			want: internal.Person{
@@ -217,6 +222,8 @@ func TestGoogleUsers_extractData(t *testing.T) {
 					"phone" + delim + "work": "555-1212",
 					"manager":                "manager@example.com",
 					"Location.Building":      "A building",
+					"Location.Floor":         "2",
+					"HR.Grade":               "7",
 				},
 			},
 		},
@@ -397,6 +404,214 @@ func Test_newUserForUpdate(t *testing.T) {
 	}
 }
 
+func Test_newUserForCreate(t *testing.T) {
+	person := internal.Person{
+		CompareValue: "email@example.com",
+		Attributes: map[string]string{
+			"email":                      "email@example.com",
+			"familyName":                 "Jones",
+			"givenName":                  "John",
+			"phone" + delim + "work":     "555-1212",
+			"phone" + delim + "mobile~1": "555-3434",
+			"Location.Building":          "A building",
+			"phone" + delim + "home":     "",
+		},
+	}
+	wantPhones := []admin.UserPhone{{Type: "mobile", Value: "555-3434"}, {Type: "work", Value: "555-1212"}}
+
+	tests := []struct {
+		name       string
+		person     internal.Person
+		config     NewUsersConfig
+		want       admin.User
+		wantErrMsg string
+	}{
+		{
+			name:   "random password",
+			person: person,
+			config: NewUsersConfig{OrgUnitPath: "/Staff", ChangePasswordAtNextLogin: true},
+			want: admin.User{
+				PrimaryEmail:              "email@example.com",
+				Name:                      &admin.UserName{FamilyName: "Jones", GivenName: "John"},
+				OrgUnitPath:               "/Staff",
+				ChangePasswordAtNextLogin: true,
+			},
+		},
+		{
+			name:   "password hash",
+			person: withAttributes(person, map[string]string{"passwordHash": "$1$abc", "hashFunction": "crypt"}),
+			config: NewUsersConfig{OrgUnitPath: "/", HashFunction: HashFunctionSHA1},
+			want: admin.User{
+				PrimaryEmail: "email@example.com",
+				Name:         &admin.UserName{FamilyName: "Jones", GivenName: "John"},
+				OrgUnitPath:  "/",
+				Password:     "$1$abc",
+				HashFunction: HashFunctionCrypt,
+			},
+		},
+		{
+			name:   "default HashFunction",
+			person: withAttributes(person, map[string]string{"passwordHash": "abc123"}),
+			config: NewUsersConfig{OrgUnitPath: "/", HashFunction: HashFunctionSHA1},
+			want: admin.User{
+				PrimaryEmail: "email@example.com",
+				Name:         &admin.UserName{FamilyName: "Jones", GivenName: "John"},
+				OrgUnitPath:  "/",
+				Password:     "abc123",
+				HashFunction: HashFunctionSHA1,
+			},
+		},
+		{
+			name:       "no HashFunction",
+			person:     withAttributes(person, map[string]string{"passwordHash": "abc123"}),
+			config:     NewUsersConfig{OrgUnitPath: "/"},
+			wantErrMsg: "hashFunction is required with passwordHash",
+		},
+		{
+			name:       "invalid hashFunction",
+			person:     withAttributes(person, map[string]string{"passwordHash": "abc123", "hashFunction": "SHA-256"}),
+			wantErrMsg: `invalid hashFunction "SHA-256", must be MD5, SHA-1, or crypt`,
+		},
+		{
+			name: "no name",
+			person: internal.Person{
+				CompareValue: "email@example.com",
+				Attributes:   map[string]string{"email": "email@example.com", "givenName": "John"},
+			},
+			wantErrMsg: "givenName and familyName are required to create a user",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newUserForCreate(tt.person, tt.config)
+			if tt.wantErrMsg != "" {
+				require.EqualError(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			phones := got.Phones.([]admin.UserPhone)
+			require.ElementsMatch(t, wantPhones, phones)
+			require.Equal(t, map[string]googleapi.RawMessage{
+				"Location": []byte(`{"Building":"A building"}`),
+			}, got.CustomSchemas)
+
+			if tt.want.Password == "" {
+				require.Len(t, got.Password, 26, "a random password should be set")
+				tt.want.Password = got.Password
+			}
+			got.Phones, got.CustomSchemas = nil, nil
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewUsersConfig_validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     NewUsersConfig
+		want       NewUsersConfig
+		wantErrMsg string
+	}{
+		{
+			name:   "defaults",
+			config: NewUsersConfig{},
+			want:   NewUsersConfig{},
+		},
+		{
+			name:   "HashFunction",
+			config: NewUsersConfig{OrgUnitPath: "/Staff", HashFunction: HashFunctionCrypt},
+			want:   NewUsersConfig{OrgUnitPath: "/Staff", HashFunction: HashFunctionCrypt},
+		},
+		{
+			name:       "relative OrgUnitPath",
+			config:     NewUsersConfig{OrgUnitPath: "Staff"},
+			wantErrMsg: "OrgUnitPath must start with '/': Staff",
+		},
+		{
+			name:       "invalid HashFunction",
+			config:     NewUsersConfig{HashFunction: "SHA-256"},
+			wantErrMsg: `invalid hashFunction "SHA-256", must be MD5, SHA-1, or crypt`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.wantErrMsg != "" {
+				require.EqualError(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, tt.config)
+		})
+	}
+}
+
+func TestGoogleUsers_ApplyChangeSet_create(t *testing.T) {
+	directory, service := startTestDirectory(t, admin.User{
+		PrimaryEmail: "bob@example.com",
+		Name:         &admin.UserName{GivenName: "Bob", FamilyName: "Smith"},
+	})
+	g := &GoogleUsers{
+		BatchSize:         10,
+		BatchDelaySeconds: 1,
+		UsersConfig:       UsersConfig{NewUsers: NewUsersConfig{OrgUnitPath: "/Staff", ChangePasswordAtNextLogin: true}},
+		AdminService:      service,
+	}
+
+	changes := internal.ChangeSet{
+		Create: []internal.Person{
+			{
+				CompareValue: "ann@example.com",
+				Attributes: map[string]string{
+					"email":                  "ann@example.com",
+					"givenName":              "Ann",
+					"familyName":             "Jones",
+					"phone" + delim + "work": "555-1212",
+					"passwordHash":           "abc123",
+					"hashFunction":           HashFunctionSHA1,
+				},
+			},
+			{
+				CompareValue: "bob@example.com",
+				Attributes:   map[string]string{"email": "bob@example.com", "givenName": "Bob", "familyName": "Smith"},
+			},
+			{
+				CompareValue: "cat@example.com",
+				Attributes:   map[string]string{"email": "cat@example.com", "givenName": "Cat"},
+			},
+		},
+	}
+	results, messages := applyTestUserChanges(t, g, changes)
+
+	require.Equal(t, internal.ChangeResults{Created: 1}, results)
+	require.Len(t, messages, 3)
+	require.ElementsMatch(t, []string{
+		"CreateUser ann@example.com",
+		"unable to create bob@example.com in Users: googleapi: Error 409: Entity already exists.",
+		"unable to prepare cat@example.com for creation in Users: givenName and familyName are required to " +
+			"create a user",
+	}, messages)
+
+	ann, ok := directory.user("ann@example.com")
+	require.True(t, ok)
+	require.Equal(t, "/Staff", ann.OrgUnitPath)
+	require.True(t, ann.ChangePasswordAtNextLogin)
+	require.Equal(t, "abc123", ann.Password)
+	require.Equal(t, HashFunctionSHA1, ann.HashFunction)
+	require.Implements(t, (*internal.CreateOnlyDestination)(nil), g,
+		"the password hash should not be compared, since it is not listed")
+	require.Equal(t, "Jones", ann.Name.FamilyName)
+	require.Equal(t, []any{map[string]any{"type": "work", "value": "555-1212"}}, ann.Phones)
+
+	g.DestinationConfig.DisableAdd = true
+	results, messages = applyTestUserChanges(t, g, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "dan@example.com"}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Empty(t, messages)
+}
+
 func Test_updateIDs(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -837,3 +1052,453 @@ func Test_getPhoneNumbersFromUser(t *testing.T) {
 		})
 	}
 }
+
+func TestDepartedUsersConfig_validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     DepartedUsersConfig
+		wantErrMsg string
+	}{
+		{
+			name:   "no action",
+			config: DepartedUsersConfig{ProtectedUsers: []string{"admin@example.com"}},
+		},
+		{
+			name: "suspend and delete later",
+			config: DepartedUsersConfig{
+				Action:          DepartedActionSuspend,
+				OrgUnitPath:     "/Departed",
+				DeleteAfterDays: 30,
+				DateAttribute:   "Departure.Date",
+			},
+		},
+		{
+			name:   "move",
+			config: DepartedUsersConfig{Action: DepartedActionMove, OrgUnitPath: "/Departed"},
+		},
+		{
+			name:   "delete",
+			config: DepartedUsersConfig{Action: DepartedActionDelete},
+		},
+		{
+			name:       "no action with OrgUnitPath",
+			config:     DepartedUsersConfig{OrgUnitPath: "/Departed"},
+			wantErrMsg: "Action is required with OrgUnitPath, DeleteAfterDays, or DateAttribute",
+		},
+		{
+			name:       "invalid action",
+			config:     DepartedUsersConfig{Action: "Disable"},
+			wantErrMsg: `invalid Action "Disable", must be Suspend, Move, Archive, or Delete`,
+		},
+		{
+			name:       "move without OrgUnitPath",
+			config:     DepartedUsersConfig{Action: DepartedActionMove},
+			wantErrMsg: "OrgUnitPath is required to Move departed users",
+		},
+		{
+			name:       "relative OrgUnitPath",
+			config:     DepartedUsersConfig{Action: DepartedActionMove, OrgUnitPath: "Departed"},
+			wantErrMsg: "OrgUnitPath must start with '/': Departed",
+		},
+		{
+			name:       "delete after days",
+			config:     DepartedUsersConfig{Action: DepartedActionDelete, DeleteAfterDays: 30},
+			wantErrMsg: "OrgUnitPath, DeleteAfterDays, and DateAttribute cannot be used to Delete departed users",
+		},
+		{
+			name:       "negative DeleteAfterDays",
+			config:     DepartedUsersConfig{Action: DepartedActionSuspend, DeleteAfterDays: -1},
+			wantErrMsg: "DeleteAfterDays cannot be negative",
+		},
+		{
+			name:       "no DateAttribute",
+			config:     DepartedUsersConfig{Action: DepartedActionArchive, DeleteAfterDays: 30},
+			wantErrMsg: "DateAttribute is required with DeleteAfterDays",
+		},
+		{
+			name:       "DateAttribute not in a schema",
+			config:     DepartedUsersConfig{Action: DepartedActionSuspend, DateAttribute: "departed"},
+			wantErrMsg: "DateAttribute must be a custom schema field, such as Departure.Date: departed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.wantErrMsg != "" {
+				require.EqualError(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGoogleUsers_ApplyChangeSet_departed(t *testing.T) {
+	date := func(daysAgo int) googleapi.RawMessage {
+		return []byte(`{"Date":"` + time.Now().AddDate(0, 0, -daysAgo).Format(time.DateOnly) + `"}`)
+	}
+	departed := func(email string, daysAgo int) admin.User {
+		u := admin.User{PrimaryEmail: email, Suspended: true, OrgUnitPath: "/Departed"}
+		if daysAgo >= 0 {
+			u.CustomSchemas = map[string]googleapi.RawMessage{"Departure": date(daysAgo)}
+		}
+		return u
+	}
+	directory, service := startTestDirectory(t,
+		admin.User{PrimaryEmail: "admin@example.com", OrgUnitPath: "/"},
+		admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff"},
+		departed("bob@example.com", 31),
+		departed("cat@example.com", 5),
+		departed("dan@example.com", -1),
+		admin.User{PrimaryEmail: "eve@example.com", OrgUnitPath: "/Staff", Suspended: true},
+		admin.User{PrimaryEmail: "fay@example.com", OrgUnitPath: "/Staff"},
+	)
+	g := &GoogleUsers{
+		BatchSize:         10,
+		BatchDelaySeconds: 1,
+		UsersConfig: UsersConfig{DepartedUsers: DepartedUsersConfig{
+			Action:          DepartedActionSuspend,
+			OrgUnitPath:     "/Departed",
+			DeleteAfterDays: 30,
+			DateAttribute:   "Departure.Date",
+			ProtectedUsers:  []string{"admin@example.com", "FAY@example.com"},
+		}},
+		AdminService: service,
+	}
+
+	people, err := g.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Len(t, people, 6, "cat is offboarded and not yet due for deletion, so is not listed")
+
+	results, messages := applyTestUserChanges(t, g, internal.ChangeSet{Delete: people})
+
+	require.Equal(t, internal.ChangeResults{Deleted: 4}, results)
+	require.ElementsMatch(t, []string{
+		"SuspendUser ann@example.com, org unit /Departed",
+		"DeleteUser bob@example.com",
+		"SuspendUser dan@example.com, org unit /Departed",
+		"SuspendUser eve@example.com, org unit /Departed",
+	}, messages)
+
+	for _, email := range []string{"ann@example.com", "dan@example.com", "eve@example.com"} {
+		u, ok := directory.user(email)
+		require.True(t, ok)
+		require.True(t, u.Suspended, email)
+		require.Equal(t, "/Departed", u.OrgUnitPath, email)
+		require.JSONEq(t, string(date(0)), string(u.CustomSchemas["Departure"]), email)
+	}
+	_, ok := directory.user("bob@example.com")
+	require.False(t, ok, "bob departed more than 30 days ago and should be deleted")
+	cat, _ := directory.user("cat@example.com")
+	require.Equal(t, departed("cat@example.com", 5), cat, "cat departed 5 days ago and should not be changed")
+	for _, email := range []string{"admin@example.com", "fay@example.com"} {
+		u, _ := directory.user(email)
+		require.False(t, u.Suspended, "protected users should not be changed")
+	}
+}
+
+func TestGoogleUsers_ApplyChangeSet_departedActions(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      DepartedUsersConfig
+		disable     bool
+		wantMessage string
+		want        *admin.User
+	}{
+		{
+			name:        "move",
+			config:      DepartedUsersConfig{Action: DepartedActionMove, OrgUnitPath: "/Departed"},
+			wantMessage: "MoveUser ann@example.com, org unit /Departed",
+			want:        &admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Departed"},
+		},
+		{
+			name:        "archive",
+			config:      DepartedUsersConfig{Action: DepartedActionArchive},
+			wantMessage: "ArchiveUser ann@example.com",
+			want:        &admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff", Archived: true},
+		},
+		{
+			name:        "delete",
+			config:      DepartedUsersConfig{Action: DepartedActionDelete},
+			wantMessage: "DeleteUser ann@example.com",
+		},
+		{
+			name: "no action",
+			want: &admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff"},
+		},
+		{
+			name:    "DisableDelete",
+			config:  DepartedUsersConfig{Action: DepartedActionDelete},
+			disable: true,
+			want:    &admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory, service := startTestDirectory(t, admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff"})
+			g := &GoogleUsers{
+				DestinationConfig: internal.DestinationConfig{DisableDelete: tt.disable},
+				BatchSize:         10,
+				BatchDelaySeconds: 1,
+				UsersConfig:       UsersConfig{DepartedUsers: tt.config},
+				AdminService:      service,
+			}
+
+			people, err := g.ListUsers(context.Background(), []string{"email"})
+			require.NoError(t, err)
+			results, messages := applyTestUserChanges(t, g, internal.ChangeSet{Delete: people})
+
+			if tt.wantMessage == "" {
+				require.Equal(t, internal.ChangeResults{}, results)
+				require.Empty(t, messages)
+			} else {
+				require.Equal(t, internal.ChangeResults{Deleted: 1}, results)
+				require.Equal(t, []string{tt.wantMessage}, messages)
+			}
+
+			u, ok := directory.user("ann@example.com")
+			if tt.want == nil {
+				require.False(t, ok)
+				return
+			}
+			require.Equal(t, *tt.want, u)
+		})
+	}
+}
+
+func TestGoogleUsers_ForSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		newUsersOU  string
+		syncSetJson string
+		want        UsersSyncSet
+		wantQuery   string
+		wantErrMsg  string
+	}{
+		{
+			name:        "no sync set",
+			syncSetJson: ``,
+		},
+		{
+			name:        "org unit and query",
+			newUsersOU:  "/Staff/New",
+			syncSetJson: `{"OrgUnitPath": "/Staff", "Domain": "example.com", "Query": "isSuspended=false"}`,
+			want:        UsersSyncSet{OrgUnitPath: "/Staff", Domain: "example.com", Query: "isSuspended=false"},
+			wantQuery:   "orgUnitPath='/Staff' isSuspended=false",
+		},
+		{
+			name:        "root org unit",
+			syncSetJson: `{"OrgUnitPath": "/"}`,
+			want:        UsersSyncSet{OrgUnitPath: "/"},
+		},
+		{
+			name:        "relative org unit",
+			syncSetJson: `{"OrgUnitPath": "Staff"}`,
+			wantErrMsg:  "OrgUnitPath must start with '/': Staff",
+		},
+		{
+			name:        "quote in org unit",
+			syncSetJson: `{"OrgUnitPath": "/Staff's"}`,
+			wantErrMsg:  "OrgUnitPath cannot contain a quote: /Staff's",
+		},
+		{
+			name:        "new users outside of org unit",
+			newUsersOU:  "/Staffing",
+			syncSetJson: `{"OrgUnitPath": "/Staff"}`,
+			wantErrMsg:  "NewUsers OrgUnitPath /Staffing is not in the sync set OrgUnitPath /Staff",
+		},
+		{
+			name:        "invalid filter",
+			syncSetJson: `{"Filters": [{"Attribute": "email", "Expression": "("}]}`,
+			wantErrMsg:  "invalid filter expression (",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GoogleUsers{UsersConfig: UsersConfig{NewUsers: NewUsersConfig{OrgUnitPath: tt.newUsersOU}}}
+			err := g.ForSet([]byte(tt.syncSetJson))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, g.UsersSyncSet)
+			require.Equal(t, tt.wantQuery, g.UsersSyncSet.query())
+		})
+	}
+}
+
+func TestGoogleUsers_ListUsers_syncSet(t *testing.T) {
+	directory, service := startTestDirectory(t,
+		admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff"},
+		admin.User{PrimaryEmail: "mailroom@example.com", OrgUnitPath: "/Staff"},
+		admin.User{PrimaryEmail: "bob@example.org", OrgUnitPath: "/Staff"},
+	)
+	g := &GoogleUsers{AdminService: service}
+
+	err := g.ForSet([]byte(`{
+		"OrgUnitPath": "/Staff",
+		"Domain": "example.com",
+		"Query": "isSuspended=false",
+		"Filters": [{"Attribute": "email", "Expression": "^mailroom@", "Exclude": true}]
+	}`))
+	require.NoError(t, err)
+
+	people, err := g.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{{
+		CompareValue: "ann@example.com",
+		Attributes:   map[string]string{"email": "ann@example.com"},
+	}}, people)
+
+	query := directory.listQuery()
+	require.Equal(t, "example.com", query.Get("domain"))
+	require.Empty(t, query.Get("customer"))
+	require.Equal(t, "orgUnitPath='/Staff' isSuspended=false", query.Get("query"))
+
+	require.NoError(t, g.ForSet(nil))
+	people, err = g.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Len(t, people, 3)
+	require.Equal(t, "my_customer", directory.listQuery().Get("customer"))
+}
+
+func TestGoogleUsers_ApplyChangeSet_createInSyncSet(t *testing.T) {
+	directory, service := startTestDirectory(t)
+	g := &GoogleUsers{BatchSize: 10, BatchDelaySeconds: 1, AdminService: service}
+	require.NoError(t, g.ForSet([]byte(`{"OrgUnitPath": "/Staff"}`)))
+
+	results, messages := applyTestUserChanges(t, g, internal.ChangeSet{Create: []internal.Person{{
+		CompareValue: "ann@example.com",
+		Attributes:   map[string]string{"email": "ann@example.com", "givenName": "Ann", "familyName": "Jones"},
+	}}})
+	require.Equal(t, internal.ChangeResults{Created: 1}, results)
+	require.Equal(t, []string{"CreateUser ann@example.com"}, messages)
+
+	ann, _ := directory.user("ann@example.com")
+	require.Equal(t, "/Staff", ann.OrgUnitPath, "new users should be created in the sync set OrgUnitPath")
+
+	require.NoError(t, g.ForSet([]byte(`{"Domain": "Example.com", "Query": "isSuspended=false"}`)))
+	results, messages = applyTestUserChanges(t, g, internal.ChangeSet{Create: []internal.Person{
+		{
+			CompareValue: "bob@example.com",
+			Attributes:   map[string]string{"email": "bob@example.com", "givenName": "Bob", "familyName": "Smith"},
+		},
+		{
+			CompareValue: "cat@example.org",
+			Attributes:   map[string]string{"email": "cat@example.org", "givenName": "Cat", "familyName": "Jones"},
+		},
+	}})
+	require.Equal(t, internal.ChangeResults{Created: 1}, results)
+	require.ElementsMatch(t, []string{
+		`new users are not checked against the sync set Query "isSuspended=false", and are created again on ` +
+			"the next run if they do not match it",
+		"CreateUser bob@example.com",
+		"unable to create cat@example.org in Users: not in the sync set Domain Example.com",
+	}, messages)
+	_, ok := directory.user("cat@example.org")
+	require.False(t, ok, "a user outside of the sync set Domain should not be created")
+}
+
+func TestGoogleUsers_ApplyChangeSet_departedLimits(t *testing.T) {
+	directory, service := startTestDirectory(t,
+		admin.User{PrimaryEmail: "ann@example.com", OrgUnitPath: "/Staff"},
+		admin.User{PrimaryEmail: "bob@example.com", OrgUnitPath: "/Staff"},
+		admin.User{PrimaryEmail: "cat@example.com", OrgUnitPath: "/Staff"},
+		admin.User{PrimaryEmail: "dan@example.com", OrgUnitPath: "/Staff"},
+	)
+	g := &GoogleUsers{
+		BatchSize:         10,
+		BatchDelaySeconds: 1,
+		UsersConfig: UsersConfig{DepartedUsers: DepartedUsersConfig{
+			Action:          DepartedActionSuspend,
+			DeleteAfterDays: 30,
+			DateAttribute:   "Departure.Date",
+		}},
+		AdminService: service,
+	}
+	config := internal.Config{ChangeLimits: internal.ChangeLimits{MaxDelete: 2}}
+	logger := log.New(io.Discard, "", 0)
+
+	run := func(source ...string) internal.ChangeSet {
+		var sourcePeople []internal.Person
+		for _, email := range source {
+			sourcePeople = append(sourcePeople, internal.Person{
+				CompareValue: email,
+				Attributes:   map[string]string{"email": email},
+			})
+		}
+		destinationPeople, err := g.ListUsers(context.Background(), []string{"email"})
+		require.NoError(t, err)
+
+		changes := internal.GenerateChangeSet(logger, sourcePeople, destinationPeople, config)
+		require.NoError(t, config.ChangeLimits.Check(changes, len(destinationPeople)))
+		applyTestUserChanges(t, g, changes)
+		return changes
+	}
+
+	changes := run("ann@example.com", "dan@example.com")
+	require.Len(t, changes.Delete, 2)
+
+	// bob and cat are already suspended, so only dan is planned for offboarding on the next run
+	changes = run("ann@example.com")
+	require.Len(t, changes.Delete, 1)
+	require.Equal(t, "dan@example.com", changes.Delete[0].CompareValue)
+
+	for _, email := range []string{"bob@example.com", "cat@example.com", "dan@example.com"} {
+		u, _ := directory.user(email)
+		require.True(t, u.Suspended, email)
+	}
+}
+
+func TestGoogleUsers_ApplyChangeSet_returningUser(t *testing.T) {
+	today := time.Now().Format(time.DateOnly)
+	directory, service := startTestDirectory(t,
+		admin.User{
+			PrimaryEmail:  "ann@example.com",
+			OrgUnitPath:   "/Departed",
+			Suspended:     true,
+			CustomSchemas: map[string]googleapi.RawMessage{"Departure": []byte(`{"Date":"` + today + `"}`)},
+		},
+		admin.User{PrimaryEmail: "bob@example.com", OrgUnitPath: "/Staff"},
+	)
+	g := &GoogleUsers{
+		BatchSize:         10,
+		BatchDelaySeconds: 1,
+		UsersConfig: UsersConfig{
+			NewUsers: NewUsersConfig{OrgUnitPath: "/Staff"},
+			DepartedUsers: DepartedUsersConfig{
+				Action:          DepartedActionSuspend,
+				OrgUnitPath:     "/Departed",
+				DeleteAfterDays: 30,
+				DateAttribute:   "Departure.Date",
+			},
+		},
+		AdminService: service,
+	}
+	logger := log.New(io.Discard, "", 0)
+	source := []internal.Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "title": "Manager"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}
+
+	destinationPeople, err := g.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	changes := internal.GenerateChangeSet(logger, source, destinationPeople, internal.Config{})
+	require.Len(t, changes.Create, 1, "a suspended user is not listed, so is planned as a create")
+
+	results, messages := applyTestUserChanges(t, g, changes)
+	require.Equal(t, internal.ChangeResults{Created: 1}, results)
+	require.Equal(t, []string{"ReactivateUser ann@example.com"}, messages)
+
+	ann, _ := directory.user("ann@example.com")
+	require.False(t, ann.Suspended)
+	require.Equal(t, "/Staff", ann.OrgUnitPath)
+	require.JSONEq(t, `{"Date":null}`, string(ann.CustomSchemas["Departure"]))
+	require.Equal(t, "Manager", ann.Organizations.([]any)[0].(map[string]any)["title"])
+
+	destinationPeople, err = g.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	changes = internal.GenerateChangeSet(logger, source, destinationPeople, internal.Config{})
+	require.Empty(t, changes.Create, "a reactivated user is listed, and not created again")
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 
@@ -10,12 +11,16 @@ import (
 )
 
 type Config struct {
-	Runtime      RuntimeConfig
-	Source       SourceConfig
-	Destination  DestinationConfig
-	Alert        alert.Config
-	AttributeMap []AttributeMap
-	SyncSets     []SyncSet
+	Runtime           RuntimeConfig
+	Source            SourceConfig
+	Destination       DestinationConfig
+	Alert             alert.Config
+	AttributeMap      []AttributeMap
+	SyncSets          []SyncSet
+	ChangeLimits      ChangeLimits
+	DeleteGracePeriod DeleteGracePeriod
+	State             StateConfig
+	SCIMServer        *SCIMServerConfig // only used in SCIM server mode, where a Destination is not required
 }
 
 func NewConfig() Config {
@@ -74,13 +79,57 @@ func (c *Config) Validate() error {
 		return errors.New("configuration appears to be missing a Source configuration")
 	}
 
-	if c.Destination.Type == "" {
+	if c.Destination.Type == "" && c.SCIMServer == nil {
 		return errors.New("configuration appears to be missing a Destination configuration")
 	}
 
+	if c.SCIMServer != nil {
+		if err := c.SCIMServer.validate(); err != nil {
+			return fmt.Errorf("invalid SCIMServer: %w", err)
+		}
+	}
+
 	if len(c.AttributeMap) == 0 {
 		return errors.New("configuration appears to be missing an AttributeMap")
 	}
+
+	if err := ValidatePlanFormat(c.Runtime.PlanFormat); err != nil {
+		return err
+	}
+
+	if err := c.Runtime.validateDeadline(); err != nil {
+		return err
+	}
+
+	if err := c.ChangeLimits.Validate(); err != nil {
+		return fmt.Errorf("invalid ChangeLimits: %w", err)
+	}
+
+	if err := c.validateDeleteGracePeriod(c.DeleteGracePeriod, "configuration"); err != nil {
+		return err
+	}
+
+	for _, set := range c.SyncSets {
+		if err := c.validateDeleteGracePeriod(set.DeleteGracePeriod, fmt.Sprintf("sync set %q", set.Name)); err != nil {
+			return err
+		}
+		if err := set.ChangeLimits.Validate(); err != nil {
+			return fmt.Errorf("invalid ChangeLimits in sync set %q: %w", set.Name, err)
+		}
+		if set.MinSourceCount < 0 || set.MaxSourceShrinkPercent < 0 {
+			return fmt.Errorf("MinSourceCount and MaxSourceShrinkPercent in sync set %q must not be negative", set.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateDeleteGracePeriod(g DeleteGracePeriod, where string) error {
+	if g.Runs < 0 || g.Hours < 0 {
+		return fmt.Errorf("DeleteGracePeriod in %s must not be negative", where)
+	}
+	if g.IsSet() && c.State.Path == "" {
+		return fmt.Errorf("DeleteGracePeriod in %s requires State to be configured", where)
+	}
 	return nil
 }
 
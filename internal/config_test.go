@@ -84,6 +84,56 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: "missing an AttributeMap",
 		},
+		{
+			name: "negative ChangeLimits",
+			config: Config{
+				Destination:  DestinationConfig{Type: "RestAPI"},
+				Source:       SourceConfig{Type: "RestAPI"},
+				AttributeMap: []AttributeMap{{Required: false}},
+				SyncSets:     []SyncSet{{Name: "set", ChangeLimits: ChangeLimits{MaxDelete: -2}}},
+			},
+			wantErr: "invalid ChangeLimits in sync set",
+		},
+		{
+			name: "DeleteGracePeriod without State",
+			config: Config{
+				Destination:       DestinationConfig{Type: "RestAPI"},
+				Source:            SourceConfig{Type: "RestAPI"},
+				AttributeMap:      []AttributeMap{{Required: false}},
+				DeleteGracePeriod: DeleteGracePeriod{Runs: 3},
+			},
+			wantErr: "requires State",
+		},
+		{
+			name: "SCIMServer without BearerToken",
+			config: Config{
+				Source:       SourceConfig{Type: "RestAPI"},
+				AttributeMap: []AttributeMap{{Required: false}},
+				SCIMServer:   &SCIMServerConfig{},
+			},
+			wantErr: "invalid SCIMServer: BearerToken is required",
+		},
+		{
+			name: "SCIMServer with invalid filter",
+			config: Config{
+				Source:       SourceConfig{Type: "RestAPI"},
+				AttributeMap: []AttributeMap{{Required: false}},
+				SCIMServer: &SCIMServerConfig{
+					BearerToken: "token",
+					Filters:     Filters{{Attribute: "title", Expression: "("}},
+				},
+			},
+			wantErr: "invalid Filters",
+		},
+		{
+			name: "SCIMServer without Destination",
+			config: Config{
+				Source:       SourceConfig{Type: "RestAPI"},
+				AttributeMap: []AttributeMap{{Required: false}},
+				SCIMServer:   &SCIMServerConfig{BearerToken: "token"},
+			},
+			wantErr: "",
+		},
 		{
 			name: "no error",
 			config: Config{
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultStopMarginSeconds is the time before the deadline after which no new work is started, if a deadline is set
+// and RuntimeConfig.StopMarginSeconds is not
+const DefaultStopMarginSeconds = 60
+
+type stopMarginKey struct{}
+
+type stopKey struct{}
+
+// stopRequest is closed by the stop function returned by WithStop
+type stopRequest struct {
+	once sync.Once
+	done chan struct{}
+}
+
+// WithStop returns a copy of ctx and a function that asks the run to stop, such as on an interrupt. Once it is called,
+// Stopping returns true so that no new work is started, but ctx is not cancelled, so that the changes in progress can
+// finish. A context made from it by WithRuntimeDeadline is cancelled when its stop margin has passed.
+func WithStop(ctx context.Context) (context.Context, func()) {
+	r := &stopRequest{done: make(chan struct{})}
+	return context.WithValue(ctx, stopKey{}, r), func() { r.once.Do(func() { close(r.done) }) }
+}
+
+// stopRequested returns a channel that is closed when the stop function from WithStop is called. It is nil, and so
+// never ready, if ctx was not made by WithStop.
+func stopRequested(ctx context.Context) <-chan struct{} {
+	if r, ok := ctx.Value(stopKey{}).(*stopRequest); ok {
+		return r.done
+	}
+	return nil
+}
+
+// WithRuntimeDeadline returns a copy of ctx with the deadline set by runtimeConfig.TimeoutSeconds, if any, and the
+// stop margin used by Stopping. An earlier deadline already set on ctx, such as the Lambda execution limit, is kept.
+// If a stop is requested with the function from WithStop, the returned context is cancelled after the stop margin.
+func WithRuntimeDeadline(ctx context.Context, runtimeConfig RuntimeConfig) (context.Context, context.CancelFunc) {
+	margin := runtimeConfig.stopMargin()
+	ctx = context.WithValue(ctx, stopMarginKey{}, margin)
+
+	var cancel context.CancelFunc
+	if runtimeConfig.TimeoutSeconds <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(runtimeConfig.TimeoutSeconds)*time.Second)
+	}
+
+	if stop := stopRequested(ctx); stop != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+			}
+			_ = Sleep(ctx, margin)
+			cancel()
+		}()
+	}
+	return ctx, cancel
+}
+
+// Stopping returns true if ctx is done, if a stop was requested with the function from WithStop, or if its deadline
+// is within the stop margin set by WithRuntimeDeadline. Adapters check it before starting each change, so that the
+// changes in progress can finish before the deadline.
+func Stopping(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+
+	select {
+	case <-stopRequested(ctx):
+		return true
+	default:
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+
+	margin, _ := ctx.Value(stopMarginKey{}).(time.Duration)
+	return time.Until(deadline) < margin
+}
+
+func (r RuntimeConfig) stopMargin() time.Duration {
+	if r.StopMarginSeconds > 0 {
+		return time.Duration(r.StopMarginSeconds) * time.Second
+	}
+	return DefaultStopMarginSeconds * time.Second
+}
+
+func (r RuntimeConfig) validateDeadline() error {
+	if r.TimeoutSeconds < 0 || r.StopMarginSeconds < 0 {
+		return errors.New("TimeoutSeconds and StopMarginSeconds must not be negative")
+	}
+	if r.TimeoutSeconds > 0 && r.stopMargin() >= time.Duration(r.TimeoutSeconds)*time.Second {
+		return errors.New("StopMarginSeconds must be less than TimeoutSeconds")
+	}
+	return nil
+}
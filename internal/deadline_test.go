@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopping(t *testing.T) {
+	t.Run("no deadline", func(t *testing.T) {
+		ctx, cancel := WithRuntimeDeadline(context.Background(), RuntimeConfig{})
+		defer cancel()
+		require.False(t, Stopping(ctx))
+
+		cancel()
+		require.True(t, Stopping(ctx), "should stop when cancelled")
+	})
+
+	t.Run("deadline outside margin", func(t *testing.T) {
+		ctx, cancel := WithRuntimeDeadline(context.Background(), RuntimeConfig{TimeoutSeconds: 60, StopMarginSeconds: 10})
+		defer cancel()
+		require.False(t, Stopping(ctx))
+	})
+
+	t.Run("deadline within margin", func(t *testing.T) {
+		ctx, cancel := WithRuntimeDeadline(context.Background(), RuntimeConfig{TimeoutSeconds: 60, StopMarginSeconds: 59})
+		defer cancel()
+		time.Sleep(1100 * time.Millisecond)
+		require.True(t, Stopping(ctx))
+	})
+
+	t.Run("earlier deadline kept", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		ctx, cancel := WithRuntimeDeadline(parent, RuntimeConfig{TimeoutSeconds: 600})
+		defer cancel()
+		require.True(t, Stopping(ctx), "default margin is longer than the parent deadline")
+	})
+}
+
+func TestWithStop(t *testing.T) {
+	parent, stop := WithStop(context.Background())
+	ctx, cancel := WithRuntimeDeadline(parent, RuntimeConfig{StopMarginSeconds: 1})
+	defer cancel()
+	require.False(t, Stopping(ctx))
+
+	stop()
+	stop() // may be called more than once
+	require.True(t, Stopping(ctx), "should stop when a stop is requested")
+	require.NoError(t, ctx.Err(), "changes in progress should not be cancelled before the stop margin")
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("ctx should be cancelled after the stop margin")
+	}
+}
+
+func TestBatchTimer_stop(t *testing.T) {
+	ctx, stop := WithStop(context.Background())
+	stop()
+
+	start := time.Now()
+	b := NewBatchTimer(1, 60)
+	b.WaitOnBatch(ctx)
+	require.Less(t, time.Since(start), time.Second, "should not wait for the batch when a stop is requested")
+}
+
+func TestRuntimeConfig_validateDeadline(t *testing.T) {
+	require.NoError(t, RuntimeConfig{}.validateDeadline())
+	require.NoError(t, RuntimeConfig{TimeoutSeconds: 840}.validateDeadline())
+	require.NoError(t, RuntimeConfig{TimeoutSeconds: 30, StopMarginSeconds: 10}.validateDeadline())
+	require.Error(t, RuntimeConfig{TimeoutSeconds: 30}.validateDeadline(), "default margin exceeds timeout")
+	require.Error(t, RuntimeConfig{TimeoutSeconds: -1}.validateDeadline())
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"strings"
+	"time"
+)
+
+// DeleteGracePeriod holds the deletion of a person until they have been missing from the source for the given number
+// of consecutive runs and/or hours. If both are set, both must be satisfied. Zero means no grace period.
+type DeleteGracePeriod struct {
+	Runs  int
+	Hours int
+}
+
+// Absence records how long a person has been missing from the source while still present in the destination
+type Absence struct {
+	FirstMissing time.Time
+	Runs         int
+}
+
+// Merge returns a copy of g with each non-zero value in override replacing the corresponding value in g
+func (g DeleteGracePeriod) Merge(override DeleteGracePeriod) DeleteGracePeriod {
+	if override.Runs != 0 {
+		g.Runs = override.Runs
+	}
+	if override.Hours != 0 {
+		g.Hours = override.Hours
+	}
+	return g
+}
+
+func (g DeleteGracePeriod) IsSet() bool {
+	return g.Runs > 0 || g.Hours > 0
+}
+
+// holdDeletes splits deletes into those that have satisfied the grace period and those that are still held. It returns
+// the people to delete now, along with the updated absence record of every person in deletes, keyed by lowercase
+// CompareValue. People who have returned to the source are not in deletes, so their absence record is dropped.
+func holdDeletes(
+	deletes []Person,
+	previous map[string]Absence,
+	grace DeleteGracePeriod,
+	now time.Time,
+) ([]Person, []Person, map[string]Absence) {
+	var confirmed, held []Person
+	absences := make(map[string]Absence, len(deletes))
+
+	for _, person := range deletes {
+		key := strings.ToLower(person.CompareValue)
+
+		absence, ok := previous[key]
+		if !ok {
+			absence = Absence{FirstMissing: now}
+		}
+		absence.Runs++
+		absences[key] = absence
+
+		if absence.Runs >= grace.Runs && now.Sub(absence.FirstMissing) >= time.Duration(grace.Hours)*time.Hour {
+			confirmed = append(confirmed, person)
+		} else {
+			held = append(held, person)
+		}
+	}
+
+	return confirmed, held, absences
+}
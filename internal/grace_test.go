@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_holdDeletes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	deletes := []Person{{CompareValue: "New@example.com"}, {CompareValue: "old@example.com"}}
+	previous := map[string]Absence{
+		"old@example.com":      {FirstMissing: now.Add(-25 * time.Hour), Runs: 2},
+		"returned@example.com": {FirstMissing: now.Add(-48 * time.Hour), Runs: 5},
+	}
+
+	tests := []struct {
+		name          string
+		grace         DeleteGracePeriod
+		wantConfirmed []string
+		wantHeld      []string
+	}{
+		{
+			name:          "runs satisfied",
+			grace:         DeleteGracePeriod{Runs: 3},
+			wantConfirmed: []string{"old@example.com"},
+			wantHeld:      []string{"New@example.com"},
+		},
+		{
+			name:     "runs not satisfied",
+			grace:    DeleteGracePeriod{Runs: 4},
+			wantHeld: []string{"New@example.com", "old@example.com"},
+		},
+		{
+			name:          "hours satisfied",
+			grace:         DeleteGracePeriod{Hours: 24},
+			wantConfirmed: []string{"old@example.com"},
+			wantHeld:      []string{"New@example.com"},
+		},
+		{
+			name:     "runs satisfied but hours not satisfied",
+			grace:    DeleteGracePeriod{Runs: 3, Hours: 36},
+			wantHeld: []string{"New@example.com", "old@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confirmed, held, absences := holdDeletes(deletes, previous, tt.grace, now)
+
+			require.Equal(t, tt.wantConfirmed, compareValues(confirmed))
+			require.Equal(t, tt.wantHeld, compareValues(held))
+			require.Equal(t, map[string]Absence{
+				"new@example.com": {FirstMissing: now, Runs: 1},
+				"old@example.com": {FirstMissing: now.Add(-25 * time.Hour), Runs: 3},
+			}, absences, "returned person should be dropped and others updated")
+		})
+	}
+}
+
+func compareValues(people []Person) []string {
+	var values []string
+	for _, p := range people {
+		values = append(values, p.CompareValue)
+	}
+	return values
+}
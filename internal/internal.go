@@ -1,12 +1,15 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"log/syslog"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,16 +17,27 @@ import (
 )
 
 const (
-	DefaultConfigFile             = "./config.json"
-	DefaultVerbosity              = 5
-	DestinationTypeGoogleContacts = "GoogleContacts"
-	DestinationTypeGoogleGroups   = "GoogleGroups"
-	DestinationTypeGoogleSheets   = "GoogleSheets"
-	DestinationTypeGoogleUsers    = "GoogleUsers"
-	DestinationTypeRestAPI        = "RestAPI"
-	DestinationTypeWebHelpDesk    = "WebHelpDesk"
-	SourceTypeGoogleSheets        = "GoogleSheets"
-	SourceTypeRestAPI             = "RestAPI"
+	DefaultConfigFile              = "./config.json"
+	DefaultVerbosity               = 5
+	DestinationTypeEntraID         = "EntraID"
+	DestinationTypeFile            = "File"
+	DestinationTypeGoogleContacts  = "GoogleContacts"
+	DestinationTypeGoogleGroups    = "GoogleGroups"
+	DestinationTypeGoogleSheets    = "GoogleSheets"
+	DestinationTypeGoogleUsers     = "GoogleUsers"
+	DestinationTypeLDAP            = "LDAP"
+	DestinationTypeOkta            = "Okta"
+	DestinationTypeRestAPI         = "RestAPI"
+	DestinationTypeSCIM            = "SCIM"
+	DestinationTypeSlackUserGroups = "SlackUserGroups"
+	DestinationTypeSQL             = "SQL"
+	DestinationTypeWebHelpDesk     = "WebHelpDesk"
+	SourceTypeCSV                  = "CSV"
+	SourceTypeGoogleSheets         = "GoogleSheets"
+	SourceTypeLDAP                 = "LDAP"
+	SourceTypeRestAPI              = "RestAPI"
+	SourceTypeSCIM                 = "SCIM"
+	SourceTypeSQL                  = "SQL"
 )
 
 // RemapToDestinationAttributes returns a slice of Person instances that each have
@@ -72,23 +86,41 @@ func getPersonFromList(compareValue string, peopleList []Person) Person {
 	return Person{}
 }
 
-func personAttributesAreEqual(logger *log.Logger, sp, dp Person, config Config) bool {
+func logAttributeChanges(logger *log.Logger, sp Person, changes []AttributeChange, config Config) {
+	if config.Runtime.Verbosity >= VerbosityMedium {
+		caseSensitivityList := getCaseSensitivitySourceAttributeList(config.AttributeMap)
+		for _, change := range changes {
+			logger.Printf(`User: "%s", "%s" not equal, CaseSensitive: "%t", Source: "%s", Dest: "%s"`+"\n",
+				sp.CompareValue, change.Attribute, caseSensitivityList[change.Attribute], change.New, change.Old)
+		}
+	} else {
+		logger.Printf(`User: "%s" not equal`+"\n", changes[0].Attribute)
+	}
+}
+
+// attributeChanges returns each attribute of the source person sp that differs from the destination person dp, in
+// alphabetical order by attribute name
+func attributeChanges(sp, dp Person, config Config) []AttributeChange {
 	caseSensitivityList := getCaseSensitivitySourceAttributeList(config.AttributeMap)
-	equal := true
-	for key, val := range sp.Attributes {
-		if !stringsAreEqual(val, dp.Attributes[key], caseSensitivityList[key]) {
-			if config.Runtime.Verbosity >= VerbosityMedium {
-				logger.Printf(`User: "%s", "%s" not equal, CaseSensitive: "%t", Source: "%s", Dest: "%s"`+"\n",
-					sp.CompareValue, key, caseSensitivityList[key], val, dp.Attributes[key])
-				equal = false
-			} else {
-				logger.Printf(`User: "%s" not equal`+"\n", key)
-				return false
-			}
+
+	keys := make([]string, 0, len(sp.Attributes))
+	for key := range sp.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []AttributeChange
+	for _, key := range keys {
+		if !stringsAreEqual(sp.Attributes[key], dp.Attributes[key], caseSensitivityList[key]) {
+			changes = append(changes, AttributeChange{
+				Attribute: key,
+				Old:       dp.Attributes[key],
+				New:       sp.Attributes[key],
+			})
 		}
 	}
 
-	return equal
+	return changes
 }
 
 func stringsAreEqual(val1, val2 string, caseSensitive bool) bool {
@@ -110,7 +142,7 @@ func getCaseSensitivitySourceAttributeList(attributeMap []AttributeMap) map[stri
 }
 
 // GenerateChangeSet builds the three slice attributes of a ChangeSet (Create, Update and Delete) based on whether they
-// are in the slice of destination Person instances.
+// are in the slice of destination Person instances. Each Person in the Update slice lists its changed attributes.
 //
 // It skips all source Person instances that have DisableChanges set to true
 func GenerateChangeSet(logger *log.Logger, sourcePeople, destinationPeople []Person, config Config) ChangeSet {
@@ -131,11 +163,13 @@ func GenerateChangeSet(logger *log.Logger, sourcePeople, destinationPeople []Per
 			continue
 		}
 
-		if !personAttributesAreEqual(logger, sp, destinationPerson, config) {
+		if changes := attributeChanges(sp, destinationPerson, config); len(changes) > 0 {
+			logAttributeChanges(logger, sp, changes, config)
 			sp.ID = destinationPerson.Attributes["id"]
 			if destinationPerson.ID != "" { // use ID if it is set to something else
 				sp.ID = destinationPerson.ID
 			}
+			sp.Changes = changes
 			changeSet.Update = append(changeSet.Update, sp)
 			continue
 		}
@@ -177,51 +211,232 @@ func processExpressions(logger *log.Logger, config Config, person Person) Person
 	return person
 }
 
-// RunSyncSet calls a number of functions to do the following ...
+// RunSyncSet plans the changes for a sync set with PlanSyncSet. If dryRun is true, it prints those changes, otherwise
+// it makes them, and if a state store is provided, it records the outcome for comparison on the next run.
+//
+// It returns the plan of changes, which may be incomplete if an error is also returned, and the number of changes
+// made.
+func RunSyncSet(
+	ctx context.Context,
+	logger *log.Logger,
+	source Source,
+	destination Destination,
+	config Config,
+	syncSet SyncSet,
+	stateStore StateStore,
+) (SyncSetPlan, ChangeResults, error) {
+	plan, err := PlanSyncSet(ctx, logger, source, destination, config, syncSet, stateStore)
+	if err != nil {
+		return plan, ChangeResults{}, err
+	}
+
+	// If in DryRun mode only print out ChangeSet plans
+	if config.Runtime.DryRunMode {
+		logger.Println("Dry run mode enabled. Change set details follow:")
+		printChangeSet(logger, plan.ChangeSet)
+		return plan, ChangeResults{}, nil
+	}
+
+	results, err := applySyncSetPlan(ctx, logger, destination, config, plan, stateStore)
+	return plan, results, err
+}
+
+// withoutAttributeChanges removes the changes to the given attributes, and the people left without any changes
+func withoutAttributeChanges(people []Person, attributes []string) []Person {
+	var kept []Person
+	for _, p := range people {
+		var changes []AttributeChange
+		for _, change := range p.Changes {
+			if !slices.Contains(attributes, change.Attribute) {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		p.Changes = changes
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// PlanSyncSet calls a number of functions to do the following ...
 //   - it gets the list of people from the source
 //   - it remaps their attributes to match the keys used in the destination
 //   - it gets the list of people from the destination
+//   - it verifies that the number of people in the source has not dropped unexpectedly
 //   - it generates the lists of people to change, update and delete
-//   - if dryRun is true, it prints those lists, otherwise it makes the associated changes
-func RunSyncSet(logger *log.Logger, source Source, destination Destination, config Config) error {
-	sourcePeople, err := source.ListUsers(GetSourceAttributes(config.AttributeMap))
+//   - it holds back deletes until any configured grace period has passed
+//   - it verifies that the planned changes are within the configured change limits
+//
+// If a state store is provided, the plan includes the state to be saved once it has been applied. It returns the plan
+// of changes, which may be incomplete if an error is also returned.
+func PlanSyncSet(
+	ctx context.Context,
+	logger *log.Logger,
+	source Source,
+	destination Destination,
+	config Config,
+	syncSet SyncSet,
+	stateStore StateStore,
+) (SyncSetPlan, error) {
+	plan := SyncSetPlan{Name: syncSet.Name}
+
+	sourcePeople, err := source.ListUsers(ctx, GetSourceAttributes(config.AttributeMap))
 	if err != nil {
-		return err
+		return plan, err
 	}
 	if len(sourcePeople) == 0 {
-		return errors.New("no people found in source")
+		return plan, errors.New("no people found in source")
 	}
 	logger.Printf("    Found %v people in source", len(sourcePeople))
+	plan.SourceCount = len(sourcePeople)
 
 	// remap source people to destination attributes for comparison
 	sourcePeople, err = RemapToDestinationAttributes(logger, sourcePeople, config.AttributeMap)
 	if err != nil {
-		return err
+		return plan, err
 	}
 
-	destinationPeople, err := destination.ListUsers(GetDestinationAttributes(config.AttributeMap))
+	destinationPeople, err := destination.ListUsers(ctx, GetDestinationAttributes(config.AttributeMap))
 	if err != nil {
-		return err
+		return plan, err
 	}
 	logger.Printf("    Found %v people in destination", len(destinationPeople))
+	plan.DestinationCount = len(destinationPeople)
+
+	var previousState SyncSetState
+	if stateStore != nil {
+		if previousState, err = stateStore.Load(ctx, syncSet.Name); err != nil {
+			return plan, err
+		}
+	}
+
+	sourceHashes := hashPeople(sourcePeople)
+	if previousState.PersonHashes != nil {
+		diff := DiffPersonHashes(previousState.PersonHashes, sourceHashes)
+		logger.Printf("    Since last run at %s: %d added, %d removed, %d changed in source",
+			previousState.Timestamp.Format(time.RFC1123Z), diff.Added, diff.Removed, diff.Changed)
+		if !previousState.complete() {
+			logger.Printf("    Last run made only %d of %d planned changes",
+				previousState.Changes.total(), previousState.Planned.total())
+		}
+	}
+
+	if err := checkSourceCount(syncSet, len(sourcePeople), len(destinationPeople), previousState); err != nil {
+		return plan, SyncError{
+			Message:   fmt.Errorf("source count check failed: %w", err),
+			SendAlert: true,
+		}
+	}
 
 	changeSet := GenerateChangeSet(logger, sourcePeople, destinationPeople, config)
+	if d, ok := destination.(UpdateOnlyDestination); ok && d.UpdatesOnly() {
+		logger.Printf("    Destination only updates people, not planning %d creates and %d deletes",
+			len(changeSet.Create), len(changeSet.Delete))
+		changeSet.Create, changeSet.Delete = nil, nil
+	}
+	if d, ok := destination.(MembershipOnlyDestination); ok && d.MembershipOnly() {
+		logger.Printf("    Destination only adds and removes people, not planning %d updates", len(changeSet.Update))
+		changeSet.Update = nil
+	}
+	if d, ok := destination.(CreateOnlyDestination); ok {
+		changeSet.Update = withoutAttributeChanges(changeSet.Update, d.CreateOnlyAttributes())
+	}
+
+	var absences map[string]Absence
+	gracePeriod := config.DeleteGracePeriod.Merge(syncSet.DeleteGracePeriod)
+	if gracePeriod.IsSet() {
+		var held []Person
+		changeSet.Delete, held, absences = holdDeletes(changeSet.Delete, previousState.Absent, gracePeriod, time.Now().UTC())
+		logger.Printf("Holding %d deletes until the grace period has passed", len(held))
+		if config.Runtime.Verbosity >= VerbosityMedium {
+			for i, user := range held {
+				absence := absences[strings.ToLower(user.CompareValue)]
+				logger.Printf("  hold %v) %s, missing for %d run(s) since %s",
+					i+1, user.CompareValue, absence.Runs, absence.FirstMissing.Format(time.RFC1123Z))
+			}
+		}
+	}
+
+	plan = newSyncSetPlan(syncSet.Name, changeSet, len(sourcePeople), len(destinationPeople))
+	plan.DestinationHash = hashPersonList(destinationPeople)
+	if stateStore != nil {
+		plan.State = &SyncSetState{
+			SourceCount:      len(sourcePeople),
+			DestinationCount: len(destinationPeople),
+			PersonHashes:     sourceHashes,
+			Absent:           absences,
+		}
+	}
 
 	logger.Printf("ChangeSet Plans: Create %d, Update %d, Delete %d\n",
 		len(changeSet.Create), len(changeSet.Update), len(changeSet.Delete))
 
-	// If in DryRun mode only print out ChangeSet plans and return mocked change results based on plans
+	limits := config.ChangeLimits.Merge(syncSet.ChangeLimits)
+	if err := limits.Check(changeSet, len(destinationPeople)); err != nil {
+		logger.Println("Change limits exceeded, skipping sync set. Change set details follow:")
+		printChangeSet(logger, changeSet)
+		return plan, SyncError{
+			Message:   fmt.Errorf("change limits exceeded: %w", err),
+			SendAlert: true,
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplySyncSetPlan makes the changes in a plan made earlier by PlanSyncSet. It refuses to make any changes if the
+// people in the destination have changed since the plan was made. If dryRun is true, it prints the changes instead.
+// It returns the number of changes made.
+func ApplySyncSetPlan(
+	ctx context.Context,
+	logger *log.Logger,
+	destination Destination,
+	config Config,
+	plan SyncSetPlan,
+	stateStore StateStore,
+) (ChangeResults, error) {
+	if plan.Error != "" {
+		return ChangeResults{}, fmt.Errorf("plan has an error and cannot be applied: %s", plan.Error)
+	}
+
+	destinationPeople, err := destination.ListUsers(ctx, GetDestinationAttributes(config.AttributeMap))
+	if err != nil {
+		return ChangeResults{}, err
+	}
+	if hashPersonList(destinationPeople) != plan.DestinationHash {
+		return ChangeResults{}, SyncError{
+			Message:   errors.New("destination has changed since the plan was made, plan not applied"),
+			SendAlert: true,
+		}
+	}
+
+	logger.Printf("Applying plan: Create %d, Update %d, Delete %d\n",
+		len(plan.Create), len(plan.Update), len(plan.Delete))
+
 	if config.Runtime.DryRunMode {
 		logger.Println("Dry run mode enabled. Change set details follow:")
-		printChangeSet(logger, changeSet)
-		return nil
+		printChangeSet(logger, plan.ChangeSet)
+		return ChangeResults{}, nil
 	}
 
+	return applySyncSetPlan(ctx, logger, destination, config, plan, stateStore)
+}
+
+func applySyncSetPlan(
+	ctx context.Context,
+	logger *log.Logger,
+	destination Destination,
+	config Config,
+	plan SyncSetPlan,
+	stateStore StateStore,
+) (ChangeResults, error) {
 	// Create a channel to pass activity logs for printing
 	eventLog := make(chan EventLogItem, 50)
 	go processEventLog(logger, config.Alert, eventLog)
 
-	results := destination.ApplyChangeSet(changeSet, eventLog)
+	results := destination.ApplyChangeSet(ctx, plan.ChangeSet, eventLog)
 
 	for range 100 {
 		time.Sleep(time.Millisecond * 10)
@@ -234,7 +449,36 @@ func RunSyncSet(logger *log.Logger, source Source, destination Destination, conf
 	logger.Printf("Sync results: %v users added, %v users updated, %v users removed\n",
 		results.Created, results.Updated, results.Deleted)
 
-	return nil
+	made := results.total()
+	planned := uint64(len(plan.Create) + len(plan.Update) + len(plan.Delete))
+	if Stopping(ctx) && made < planned {
+		// don't save the state, so that the remaining changes are planned again on the next run
+		return results, SyncError{
+			Message:   fmt.Errorf("stopped at the deadline after making %d of %d changes", made, planned),
+			SendAlert: true,
+		}
+	}
+
+	if stateStore == nil || plan.State == nil {
+		return results, nil
+	}
+
+	state := *plan.State
+	state.Timestamp = time.Now().UTC()
+	state.Changes = results
+	state.Planned = ChangeResults{
+		Created: uint64(len(plan.Create)),
+		Updated: uint64(len(plan.Update)),
+		Deleted: uint64(len(plan.Delete)),
+	}
+	if made < planned {
+		// the state is still saved, so that grace periods are tracked, but it records that the run was incomplete
+		logger.Printf("    Made %d of %d planned changes, recording the shortfall in the state", made, planned)
+	}
+	if err := stateStore.Save(ctx, plan.Name, state); err != nil {
+		return results, fmt.Errorf("sync completed but state was not saved: %w", err)
+	}
+	return results, nil
 }
 
 func GetSourceAttributes(attrMap []AttributeMap) []string {
@@ -276,7 +520,8 @@ func printChangeSet(logger *log.Logger, changeSet ChangeSet) {
 
 	logger.Printf("Users to be updated: %d ...", len(changeSet.Update))
 	for i, user := range changeSet.Update {
-		logger.Printf("  update %v) %s", i+1, user.CompareValue)
+		logger.Printf("  update %v) %s, changed: %s", i+1, user.CompareValue,
+			strings.Join(user.ChangedAttributeNames(), ", "))
 	}
 
 	logger.Printf("Users to be deleted: %d ...", len(changeSet.Delete))
@@ -291,11 +536,15 @@ func (e *EmptyDestination) ForSet(syncSetJson json.RawMessage) error {
 	return nil
 }
 
-func (e *EmptyDestination) ListUsers(desiredAttrs []string) ([]Person, error) {
+func (e *EmptyDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]Person, error) {
 	return []Person{}, nil
 }
 
-func (e *EmptyDestination) ApplyChangeSet(changes ChangeSet, eventLog chan<- EventLogItem) ChangeResults {
+func (e *EmptyDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes ChangeSet,
+	eventLog chan<- EventLogItem,
+) ChangeResults {
 	return ChangeResults{}
 }
 
@@ -305,7 +554,7 @@ func (e *EmptySource) ForSet(syncSetJson json.RawMessage) error {
 	return nil
 }
 
-func (e *EmptySource) ListUsers(desiredAttrs []string) ([]Person, error) {
+func (e *EmptySource) ListUsers(ctx context.Context, desiredAttrs []string) ([]Person, error) {
 	return []Person{}, nil
 }
 
@@ -345,20 +594,20 @@ func (b *BatchTimer) setEndTime() {
 }
 
 // WaitOnBatch increments the Counter and then if fewer than BatchSize have been dealt with, just returns without doing
-// anything Otherwise, sleeps until the batch time has expired (i.e. current time is past endTime). If this last process
-// occurs, then it ends by resetting the batch's times and counter.
-func (b *BatchTimer) WaitOnBatch() {
+// anything Otherwise, sleeps until the batch time has expired (i.e. current time is past endTime), ctx is done, or a
+// stop is requested. If this last process occurs, then it ends by resetting the batch's times and counter.
+func (b *BatchTimer) WaitOnBatch(ctx context.Context) {
 	b.Counter++
 	if b.Counter < b.BatchSize {
 		return
 	}
 
-	for {
-		currTime := time.Now()
-		if currTime.After(b.endTime) {
-			break
-		}
-		time.Sleep(time.Second)
+	timer := time.NewTimer(time.Until(b.endTime))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-stopRequested(ctx):
+	case <-timer.C:
 	}
 	b.Init(b.BatchSize, b.SecondsPerBatch)
 }
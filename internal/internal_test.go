@@ -1,11 +1,18 @@
 package internal
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateChangeSet(t *testing.T) {
@@ -40,6 +47,9 @@ func TestGenerateChangeSet(t *testing.T) {
 						Attributes: map[string]string{
 							"name": "case sensitive",
 						},
+						Changes: []AttributeChange{
+							{Attribute: "name", Old: "CASE SENSITIVE", New: "case sensitive"},
+						},
 					},
 				},
 			},
@@ -145,7 +155,7 @@ func TestBatchTimer(t *testing.T) {
 
 		for range testRun.numberOfCalls {
 			DoNothing()
-			bTimer.WaitOnBatch()
+			bTimer.WaitOnBatch(context.Background())
 		}
 
 		elapsedTime := time.Since(startTime)
@@ -327,3 +337,285 @@ func Test_processExpressions(t *testing.T) {
 		})
 	}
 }
+
+type testSource struct {
+	people []Person
+}
+
+func (s *testSource) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (s *testSource) ListUsers(ctx context.Context, desiredAttrs []string) ([]Person, error) {
+	return s.people, nil
+}
+
+type testDestination struct {
+	people  []Person
+	applied []ChangeSet
+
+	// failCreates is the number of creates that fail
+	failCreates uint64
+}
+
+func (d *testDestination) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (d *testDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]Person, error) {
+	return d.people, nil
+}
+
+func (d *testDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes ChangeSet,
+	eventLog chan<- EventLogItem,
+) ChangeResults {
+	if Stopping(ctx) {
+		return ChangeResults{}
+	}
+
+	d.applied = append(d.applied, changes)
+	return ChangeResults{
+		Created: uint64(len(changes.Create)) - d.failCreates,
+		Updated: uint64(len(changes.Update)),
+		Deleted: uint64(len(changes.Delete)),
+	}
+}
+
+// testUpdateOnlyDestination is a testDestination that only updates people
+type testUpdateOnlyDestination struct {
+	testDestination
+}
+
+func (d *testUpdateOnlyDestination) UpdatesOnly() bool {
+	return true
+}
+
+// testMembershipOnlyDestination is a testDestination that only adds and removes people
+type testMembershipOnlyDestination struct {
+	testDestination
+}
+
+func (d *testMembershipOnlyDestination) MembershipOnly() bool {
+	return true
+}
+
+// testCreateOnlyDestination is a testDestination that does not list the "password" attribute
+type testCreateOnlyDestination struct {
+	testDestination
+}
+
+func (d *testCreateOnlyDestination) CreateOnlyAttributes() []string {
+	return []string{"password"}
+}
+
+func testPeople(n int) []Person {
+	people := make([]Person, n)
+	for i := range people {
+		email := fmt.Sprintf("user%d@example.com", i)
+		people[i] = Person{CompareValue: email, Attributes: map[string]string{"email": email}}
+	}
+	return people
+}
+
+func TestRunSyncSet(t *testing.T) {
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+	config := Config{AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}}}
+
+	t.Run("change limit exceeded", func(t *testing.T) {
+		source := &testSource{people: testPeople(2)}
+		destination := &testDestination{people: testPeople(10)}
+		syncSet := SyncSet{Name: "set", ChangeLimits: ChangeLimits{MaxDelete: 5}}
+
+		_, _, err := RunSyncSet(ctx, logger, source, destination, config, syncSet, nil)
+
+		var syncErr SyncError
+		require.ErrorAs(t, err, &syncErr)
+		require.True(t, syncErr.SendAlert)
+		require.Empty(t, destination.applied, "no changes should be applied")
+	})
+
+	t.Run("source shrunk since last run", func(t *testing.T) {
+		store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+		syncSet := SyncSet{Name: "set", MaxSourceShrinkPercent: 25}
+
+		destination := &testDestination{}
+		_, _, err := RunSyncSet(ctx, logger, &testSource{people: testPeople(10)}, destination, config, syncSet, store)
+		require.NoError(t, err)
+		require.Len(t, destination.applied, 1)
+
+		state, err := store.Load(context.Background(), "set")
+		require.NoError(t, err)
+		require.Equal(t, 10, state.SourceCount)
+
+		destination = &testDestination{}
+		_, _, err = RunSyncSet(ctx, logger, &testSource{people: testPeople(7)}, destination, config, syncSet, store)
+		require.ErrorContains(t, err, "source count check failed")
+		require.Empty(t, destination.applied, "no changes should be applied")
+	})
+}
+
+func TestPlanSyncSet_UpdateOnlyDestination(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := Config{
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}, {Source: "name", Destination: "name"}},
+		ChangeLimits: ChangeLimits{MaxDelete: 1},
+	}
+	source := &testSource{people: testPeople(2)}
+	source.people[0].Attributes["name"] = "User Zero"
+
+	destination := &testUpdateOnlyDestination{testDestination{people: append(testPeople(1), testPeople(5)[2:]...)}}
+	plan, err := PlanSyncSet(context.Background(), logger, source, destination, config, SyncSet{Name: "set"}, nil)
+	require.NoError(t, err, "the deletes that cannot be made should not exceed the change limits")
+	require.Len(t, plan.Update, 1)
+	require.Empty(t, plan.Create)
+	require.Empty(t, plan.Delete)
+}
+
+func TestPlanSyncSet_MembershipOnlyDestination(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := Config{
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}, {Source: "name", Destination: "name"}},
+		ChangeLimits: ChangeLimits{MaxUpdate: 1},
+	}
+	source := &testSource{people: testPeople(4)}
+	for _, p := range source.people {
+		p.Attributes["name"] = "New Name"
+	}
+
+	destination := &testMembershipOnlyDestination{testDestination{people: testPeople(3)[1:]}}
+	plan, err := PlanSyncSet(context.Background(), logger, source, destination, config, SyncSet{Name: "set"}, nil)
+	require.NoError(t, err, "the updates that cannot be made should not exceed the change limits")
+	require.Len(t, plan.Create, 2)
+	require.Empty(t, plan.Update)
+	require.Empty(t, plan.Delete)
+}
+
+func TestPlanSyncSet_CreateOnlyDestination(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := Config{
+		AttributeMap: []AttributeMap{
+			{Source: "email", Destination: "email"},
+			{Source: "name", Destination: "name"},
+			{Source: "password", Destination: "password"},
+		},
+	}
+	source := &testSource{people: testPeople(3)}
+	for _, p := range source.people {
+		p.Attributes["password"] = "secret"
+	}
+	source.people[0].Attributes["name"] = "User Zero"
+
+	destination := &testCreateOnlyDestination{testDestination{people: testPeople(2)}}
+	plan, err := PlanSyncSet(context.Background(), logger, source, destination, config, SyncSet{Name: "set"}, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.Create, 1)
+	require.Equal(t, "secret", plan.Create[0].Attributes["password"])
+	require.Len(t, plan.Update, 1, "a create-only attribute should not cause an update")
+	require.Equal(t, []AttributeChange{{Attribute: "name", New: "User Zero"}}, plan.Update[0].Changes)
+}
+
+func TestRunSyncSet_DeleteGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+	config := Config{AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}}}
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+	syncSet := SyncSet{Name: "set", DeleteGracePeriod: DeleteGracePeriod{Runs: 2}}
+
+	source := &testSource{people: testPeople(2)}
+	destination := &testDestination{people: testPeople(3)}
+
+	_, _, err := RunSyncSet(ctx, logger, source, destination, config, syncSet, store)
+	require.NoError(t, err)
+	require.Empty(t, destination.applied[0].Delete, "delete should be held on the first run")
+
+	_, _, err = RunSyncSet(ctx, logger, source, destination, config, syncSet, store)
+	require.NoError(t, err)
+	require.Len(t, destination.applied[1].Delete, 1, "delete should be applied on the second run")
+	require.Equal(t, "user2@example.com", destination.applied[1].Delete[0].CompareValue)
+}
+
+func TestApplySyncSetPlan(t *testing.T) {
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+	config := Config{AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}}}
+	syncSet := SyncSet{Name: "set"}
+
+	t.Run("applies plan and saves state", func(t *testing.T) {
+		store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+		destination := &testDestination{people: testPeople(1)}
+
+		plan, err := PlanSyncSet(ctx, logger, &testSource{people: testPeople(3)}, destination, config, syncSet, store)
+		require.NoError(t, err)
+		require.Empty(t, destination.applied, "planning should not apply changes")
+
+		results, err := ApplySyncSetPlan(ctx, logger, destination, config, plan, store)
+		require.NoError(t, err)
+		require.Equal(t, ChangeResults{Created: 2}, results)
+		require.Len(t, destination.applied, 1)
+		require.Len(t, destination.applied[0].Create, 2)
+
+		state, err := store.Load(context.Background(), "set")
+		require.NoError(t, err)
+		require.Equal(t, 3, state.SourceCount)
+		require.Equal(t, uint64(2), state.Changes.Created)
+		require.Len(t, state.PersonHashes, 3)
+		require.Equal(t, ChangeResults{Created: 2}, state.Planned)
+	})
+
+	t.Run("some changes failed", func(t *testing.T) {
+		store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+		destination := &testDestination{people: testPeople(1), failCreates: 1}
+
+		plan, err := PlanSyncSet(ctx, logger, &testSource{people: testPeople(3)}, destination, config, syncSet, store)
+		require.NoError(t, err)
+
+		results, err := ApplySyncSetPlan(ctx, logger, destination, config, plan, store)
+		require.NoError(t, err)
+		require.Equal(t, ChangeResults{Created: 1}, results)
+
+		state, err := store.Load(context.Background(), "set")
+		require.NoError(t, err)
+		require.Equal(t, ChangeResults{Created: 1}, state.Changes)
+		require.Equal(t, ChangeResults{Created: 2}, state.Planned, "the state should record the shortfall")
+		require.False(t, state.complete())
+	})
+
+	t.Run("destination drifted", func(t *testing.T) {
+		destination := &testDestination{people: testPeople(1)}
+
+		plan, err := PlanSyncSet(ctx, logger, &testSource{people: testPeople(3)}, destination, config, syncSet, nil)
+		require.NoError(t, err)
+
+		destination.people = testPeople(2)
+		_, err = ApplySyncSetPlan(ctx, logger, destination, config, plan, nil)
+		require.ErrorContains(t, err, "destination has changed")
+		require.Empty(t, destination.applied, "no changes should be applied")
+	})
+
+	t.Run("stopped at deadline", func(t *testing.T) {
+		store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+		destination := &testDestination{people: testPeople(1)}
+
+		plan, err := PlanSyncSet(ctx, logger, &testSource{people: testPeople(3)}, destination, config, syncSet, store)
+		require.NoError(t, err)
+
+		stopped, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = ApplySyncSetPlan(stopped, logger, destination, config, plan, store)
+		require.ErrorContains(t, err, "stopped at the deadline after making 0 of 2 changes")
+
+		state, err := store.Load(context.Background(), "set")
+		require.NoError(t, err)
+		require.Zero(t, state.SourceCount, "state should not be saved")
+	})
+
+	t.Run("plan with error", func(t *testing.T) {
+		destination := &testDestination{}
+		_, err := ApplySyncSetPlan(ctx, logger, destination, config, SyncSetPlan{Name: "set", Error: "failed"}, nil)
+		require.ErrorContains(t, err, "cannot be applied")
+		require.Empty(t, destination.applied)
+	})
+}
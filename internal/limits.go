@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NoLimit is the value of a limit in ChangeLimits that turns off the corresponding global limit
+const NoLimit = -1
+
+// Merge returns a copy of c with each non-zero limit in override, including NoLimit, replacing the corresponding limit
+// in c
+func (c ChangeLimits) Merge(override ChangeLimits) ChangeLimits {
+	if override.MaxCreate != 0 {
+		c.MaxCreate = override.MaxCreate
+	}
+	if override.MaxUpdate != 0 {
+		c.MaxUpdate = override.MaxUpdate
+	}
+	if override.MaxDelete != 0 {
+		c.MaxDelete = override.MaxDelete
+	}
+	if override.MaxCreatePercent != 0 {
+		c.MaxCreatePercent = override.MaxCreatePercent
+	}
+	if override.MaxUpdatePercent != 0 {
+		c.MaxUpdatePercent = override.MaxUpdatePercent
+	}
+	if override.MaxDeletePercent != 0 {
+		c.MaxDeletePercent = override.MaxDeletePercent
+	}
+	return c
+}
+
+// Validate returns an error if any of the limits is negative, other than NoLimit
+func (c ChangeLimits) Validate() error {
+	if c.MaxCreate < NoLimit || c.MaxUpdate < NoLimit || c.MaxDelete < NoLimit {
+		return errors.New("limits must not be negative, except -1 for no limit")
+	}
+	for _, percent := range []float64{c.MaxCreatePercent, c.MaxUpdatePercent, c.MaxDeletePercent} {
+		if percent < 0 && percent != NoLimit {
+			return errors.New("percentage limits must not be negative, except -1 for no limit")
+		}
+	}
+	return nil
+}
+
+// Check returns an error describing every limit exceeded by the changeSet. The percentage limits are calculated
+// against destinationCount, and are not enforced when the destination is empty so that it can be populated initially.
+func (c ChangeLimits) Check(changeSet ChangeSet, destinationCount int) error {
+	var exceeded []string
+
+	exceeded = append(exceeded,
+		checkLimit("create", len(changeSet.Create), c.MaxCreate, c.MaxCreatePercent, destinationCount)...)
+	exceeded = append(exceeded,
+		checkLimit("update", len(changeSet.Update), c.MaxUpdate, c.MaxUpdatePercent, destinationCount)...)
+	exceeded = append(exceeded,
+		checkLimit("delete", len(changeSet.Delete), c.MaxDelete, c.MaxDeletePercent, destinationCount)...)
+
+	if len(exceeded) > 0 {
+		return errors.New(strings.Join(exceeded, "; "))
+	}
+	return nil
+}
+
+func checkLimit(action string, count, limit int, percentLimit float64, destinationCount int) []string {
+	var exceeded []string
+
+	if limit > 0 && count > limit {
+		exceeded = append(exceeded, fmt.Sprintf("%d to %s exceeds limit of %d", count, action, limit))
+	}
+
+	if percentLimit > 0 && destinationCount > 0 {
+		percent := float64(count) * 100 / float64(destinationCount)
+		if percent > percentLimit {
+			exceeded = append(exceeded, fmt.Sprintf("%d to %s (%.1f%% of %d in destination) exceeds limit of %.1f%%",
+				count, action, percent, destinationCount, percentLimit))
+		}
+	}
+
+	return exceeded
+}
+
+// checkSourceCount returns an error if the number of people found in the source is below the sync set's
+// MinSourceCount, or if it has shrunk by more than MaxSourceShrinkPercent compared to either the number of people in
+// the destination or the number of people found in the source on the previous successful run.
+func checkSourceCount(syncSet SyncSet, sourceCount, destinationCount int, previous SyncSetState) error {
+	if syncSet.MinSourceCount > 0 && sourceCount < syncSet.MinSourceCount {
+		return fmt.Errorf("found %d people in source, fewer than the minimum of %d",
+			sourceCount, syncSet.MinSourceCount)
+	}
+
+	if syncSet.MaxSourceShrinkPercent <= 0 {
+		return nil
+	}
+
+	if shrink := shrinkPercent(sourceCount, destinationCount); shrink > syncSet.MaxSourceShrinkPercent {
+		return fmt.Errorf("found %d people in source, %.1f%% fewer than the %d in destination, exceeds limit of %.1f%%",
+			sourceCount, shrink, destinationCount, syncSet.MaxSourceShrinkPercent)
+	}
+
+	if shrink := shrinkPercent(sourceCount, previous.SourceCount); shrink > syncSet.MaxSourceShrinkPercent {
+		return fmt.Errorf("found %d people in source, %.1f%% fewer than the %d found on %s, exceeds limit of %.1f%%",
+			sourceCount, shrink, previous.SourceCount, previous.Timestamp.Format(time.RFC3339),
+			syncSet.MaxSourceShrinkPercent)
+	}
+
+	return nil
+}
+
+// shrinkPercent returns the percentage by which count is smaller than reference, or zero if it is not smaller
+func shrinkPercent(count, reference int) float64 {
+	if reference <= 0 || count >= reference {
+		return 0
+	}
+	return float64(reference-count) * 100 / float64(reference)
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeLimits_Merge(t *testing.T) {
+	global := ChangeLimits{MaxCreate: 10, MaxDelete: 5, MaxDeletePercent: 10}
+	set := ChangeLimits{MaxDelete: 50, MaxUpdatePercent: 20}
+
+	got := global.Merge(set)
+	require.Equal(t, ChangeLimits{MaxCreate: 10, MaxDelete: 50, MaxUpdatePercent: 20, MaxDeletePercent: 10}, got)
+
+	got = global.Merge(ChangeLimits{MaxDelete: NoLimit, MaxDeletePercent: NoLimit})
+	require.Equal(t, ChangeLimits{MaxCreate: 10, MaxDelete: NoLimit, MaxDeletePercent: NoLimit}, got)
+	require.NoError(t, got.Check(ChangeSet{Delete: make([]Person, 100)}, 100), "NoLimit should turn off the limits")
+}
+
+func TestChangeLimits_Validate(t *testing.T) {
+	require.NoError(t, ChangeLimits{MaxDelete: NoLimit, MaxDeletePercent: NoLimit}.Validate())
+	require.ErrorContains(t, ChangeLimits{MaxCreate: -2}.Validate(), "limits must not be negative")
+	require.ErrorContains(t, ChangeLimits{MaxUpdatePercent: -0.5}.Validate(), "percentage limits must not be negative")
+}
+
+func TestChangeLimits_Check(t *testing.T) {
+	people := func(n int) []Person {
+		return make([]Person, n)
+	}
+
+	tests := []struct {
+		name             string
+		limits           ChangeLimits
+		changeSet        ChangeSet
+		destinationCount int
+		wantErr          []string
+	}{
+		{
+			name:             "no limits",
+			changeSet:        ChangeSet{Create: people(100), Update: people(100), Delete: people(100)},
+			destinationCount: 100,
+		},
+		{
+			name:             "within limits",
+			limits:           ChangeLimits{MaxCreate: 5, MaxUpdate: 5, MaxDelete: 5, MaxDeletePercent: 10},
+			changeSet:        ChangeSet{Create: people(5), Update: people(5), Delete: people(5)},
+			destinationCount: 50,
+		},
+		{
+			name:             "too many deletes",
+			limits:           ChangeLimits{MaxDelete: 2},
+			changeSet:        ChangeSet{Delete: people(3)},
+			destinationCount: 50,
+			wantErr:          []string{"3 to delete exceeds limit of 2"},
+		},
+		{
+			name:             "delete percentage exceeded",
+			limits:           ChangeLimits{MaxDeletePercent: 10},
+			changeSet:        ChangeSet{Delete: people(11)},
+			destinationCount: 100,
+			wantErr:          []string{"11 to delete (11.0% of 100 in destination) exceeds limit of 10.0%"},
+		},
+		{
+			name:             "percentage not enforced on empty destination",
+			limits:           ChangeLimits{MaxCreatePercent: 10},
+			changeSet:        ChangeSet{Create: people(100)},
+			destinationCount: 0,
+		},
+		{
+			name:             "multiple limits exceeded",
+			limits:           ChangeLimits{MaxCreate: 1, MaxUpdatePercent: 1},
+			changeSet:        ChangeSet{Create: people(2), Update: people(2)},
+			destinationCount: 100,
+			wantErr:          []string{"2 to create exceeds limit of 1", "2 to update (2.0% of 100 in destination)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check(tt.changeSet, tt.destinationCount)
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				require.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func Test_checkSourceCount(t *testing.T) {
+	previous := SyncSetState{Timestamp: time.Now(), SourceCount: 100}
+
+	tests := []struct {
+		name             string
+		syncSet          SyncSet
+		sourceCount      int
+		destinationCount int
+		previous         SyncSetState
+		wantErr          string
+	}{
+		{
+			name:             "no limits",
+			sourceCount:      1,
+			destinationCount: 100,
+			previous:         previous,
+		},
+		{
+			name:        "below minimum",
+			syncSet:     SyncSet{MinSourceCount: 50},
+			sourceCount: 49,
+			wantErr:     "fewer than the minimum of 50",
+		},
+		{
+			name:             "shrunk compared to destination",
+			syncSet:          SyncSet{MaxSourceShrinkPercent: 20},
+			sourceCount:      60,
+			destinationCount: 100,
+			wantErr:          "40.0% fewer than the 100 in destination",
+		},
+		{
+			name:             "shrunk compared to previous run",
+			syncSet:          SyncSet{MaxSourceShrinkPercent: 20},
+			sourceCount:      60,
+			destinationCount: 60,
+			previous:         previous,
+			wantErr:          "40.0% fewer than the 100 found on",
+		},
+		{
+			name:             "within shrink limit",
+			syncSet:          SyncSet{MinSourceCount: 50, MaxSourceShrinkPercent: 20},
+			sourceCount:      80,
+			destinationCount: 100,
+			previous:         previous,
+		},
+		{
+			name:             "growth is not limited",
+			syncSet:          SyncSet{MaxSourceShrinkPercent: 1},
+			sourceCount:      500,
+			destinationCount: 100,
+			previous:         previous,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSourceCount(tt.syncSet, tt.sourceCount, tt.destinationCount, tt.previous)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
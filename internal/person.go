@@ -7,9 +7,35 @@ import (
 
 type Person struct {
 	CompareValue   string
-	ID             string
+	ID             string `json:",omitempty"`
 	Attributes     map[string]string
-	DisableChanges bool
+	DisableChanges bool `json:",omitempty"`
+
+	// Changes lists the attributes that differ from the destination. It is only set on people in ChangeSet.Update.
+	Changes []AttributeChange `json:",omitempty"`
+}
+
+// ChangedAttributes returns the new value of each attribute listed in Changes. If Changes is empty, all attributes
+// are returned.
+func (p *Person) ChangedAttributes() map[string]string {
+	if len(p.Changes) == 0 {
+		return p.Attributes
+	}
+
+	attrs := make(map[string]string, len(p.Changes))
+	for _, change := range p.Changes {
+		attrs[change.Attribute] = change.New
+	}
+	return attrs
+}
+
+// ChangedAttributeNames returns the names of the attributes listed in Changes
+func (p *Person) ChangedAttributeNames() []string {
+	names := make([]string, len(p.Changes))
+	for i, change := range p.Changes {
+		names[i] = change.Attribute
+	}
+	return names
 }
 
 func (p *Person) Matches(filters Filters) (bool, error) {
@@ -30,3 +56,33 @@ func (p *Person) Matches(filters Filters) (bool, error) {
 	}
 	return match, nil
 }
+
+// PeopleFromTable returns a Person for each row after the header row of table, with an attribute for each column
+// whose name in the header row is listed in desiredAttrs. The CompareValue is taken from the column named
+// compareAttr. Rows may be shorter than the header row.
+func PeopleFromTable(table [][]string, desiredAttrs []string, compareAttr string) []Person {
+	if len(table) < 1 {
+		return []Person{}
+	}
+	header := table[0]
+
+	attrMap := make(map[string]bool, len(desiredAttrs))
+	for _, a := range desiredAttrs {
+		attrMap[a] = true
+	}
+
+	people := make([]Person, len(table)-1)
+	for i, row := range table[1:] {
+		people[i].Attributes = map[string]string{}
+		for j, value := range row {
+			if j >= len(header) || !attrMap[header[j]] {
+				continue
+			}
+			people[i].Attributes[header[j]] = value
+			if header[j] == compareAttr {
+				people[i].CompareValue = value
+			}
+		}
+	}
+	return people
+}
@@ -96,3 +96,28 @@ func TestPerson_Matches(t *testing.T) {
 		})
 	}
 }
+
+func TestPerson_ChangedAttributes(t *testing.T) {
+	person := Person{Attributes: map[string]string{"name": "New", "title": "Boss"}}
+	require.Equal(t, person.Attributes, person.ChangedAttributes(), "all attributes if no changes are listed")
+
+	person.Changes = []AttributeChange{{Attribute: "name", Old: "Old", New: "New"}}
+	require.Equal(t, map[string]string{"name": "New"}, person.ChangedAttributes())
+	require.Equal(t, []string{"name"}, person.ChangedAttributeNames())
+}
+
+func TestPeopleFromTable(t *testing.T) {
+	table := [][]string{
+		{"email", "name", "title"},
+		{"ann@example.com", "Ann", "Boss", "extra"},
+		{"bob@example.com"},
+	}
+
+	got := PeopleFromTable(table, []string{"email", "title"}, "email")
+	require.Equal(t, []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "title": "Boss"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}, got)
+
+	require.Equal(t, []Person{}, PeopleFromTable(nil, []string{"email"}, "email"))
+}
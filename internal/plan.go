@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PlanFormatJSON     = "json"
+	PlanFormatMarkdown = "markdown"
+	PlanFileStdout     = "-"
+)
+
+// planFileMode is the permissions of a plan file, which can hold secret attributes of people to be created
+const planFileMode = 0o600
+
+const (
+	checksumPrefixSHA256 = "sha256:"
+	checksumPrefixHMAC   = "hmac-sha256:"
+)
+
+// Plan lists the changes planned for each sync set in a run
+type Plan struct {
+	Created  time.Time
+	SyncSets []SyncSetPlan
+
+	// Checksum is a SHA-256 hash of the rest of the plan, or an HMAC if a PlanSigningKey is configured. It is set
+	// when the plan is written in JSON format, and verified before a saved plan is applied.
+	Checksum string `json:",omitempty"`
+}
+
+// SyncSetPlan lists the changes planned for one sync set. If planning failed, Error holds the reason, and the lists
+// of changes may be incomplete.
+type SyncSetPlan struct {
+	Name             string
+	Error            string `json:",omitempty"`
+	SourceCount      int
+	DestinationCount int
+	ChangeSet
+
+	// DestinationHash is a hash of the people found in the destination, used to detect changes made to the
+	// destination between planning and applying
+	DestinationHash string `json:",omitempty"`
+
+	// State is saved in the StateStore once the plan has been applied. It is only set if a StateStore is configured.
+	State *SyncSetState `json:",omitempty"`
+}
+
+func newSyncSetPlan(name string, changeSet ChangeSet, sourceCount, destinationCount int) SyncSetPlan {
+	return SyncSetPlan{
+		Name:             name,
+		SourceCount:      sourceCount,
+		DestinationCount: destinationCount,
+		ChangeSet:        changeSet,
+	}
+}
+
+// ValidatePlanFormat returns an error if format is not a supported plan format. An empty format is accepted as the
+// default format.
+func ValidatePlanFormat(format string) error {
+	switch format {
+	case "", PlanFormatJSON, PlanFormatMarkdown:
+		return nil
+	default:
+		return fmt.Errorf("invalid plan format %q, must be %s or %s", format, PlanFormatJSON, PlanFormatMarkdown)
+	}
+}
+
+// WritePlan writes the plan to the file named in runtimeConfig.PlanFile, or to stdout if the name is "-". A JSON plan
+// is signed with runtimeConfig.PlanSigningKey so that it can be applied later with ApplySyncSetPlan. The file can only
+// be read by its owner, since people to be created can have secret attributes, such as password hashes.
+func WritePlan(plan Plan, runtimeConfig RuntimeConfig) error {
+	if runtimeConfig.PlanFormat == "" || runtimeConfig.PlanFormat == PlanFormatJSON {
+		if err := plan.Sign(runtimeConfig.PlanSigningKey); err != nil {
+			return err
+		}
+	}
+
+	if runtimeConfig.PlanFile == PlanFileStdout {
+		return plan.Write(os.Stdout, runtimeConfig.PlanFormat)
+	}
+
+	f, err := os.OpenFile(runtimeConfig.PlanFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, planFileMode)
+	if err != nil {
+		return fmt.Errorf("unable to create plan file: %w", err)
+	}
+	// an existing file keeps its mode when it is opened
+	if err := f.Chmod(planFileMode); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to set plan file mode: %w", err)
+	}
+
+	if err := plan.Write(f, runtimeConfig.PlanFormat); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadPlan reads a JSON plan written by WritePlan and verifies its checksum using signingKey
+func ReadPlan(path, signingKey string) (Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Plan{}, fmt.Errorf("unable to read plan file: %w", err)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, fmt.Errorf("unable to parse plan file: %w", err)
+	}
+
+	if err := plan.Verify(signingKey); err != nil {
+		return Plan{}, err
+	}
+	return plan, nil
+}
+
+// Sign sets the plan's Checksum. If signingKey is empty, the checksum is a SHA-256 hash, otherwise it is an HMAC.
+func (p *Plan) Sign(signingKey string) error {
+	checksum, err := p.checksum(signingKey)
+	if err != nil {
+		return err
+	}
+	p.Checksum = checksum
+	return nil
+}
+
+// Verify returns an error if the plan's Checksum does not match its contents. If signingKey is set, the plan must have
+// been signed with the same key.
+func (p Plan) Verify(signingKey string) error {
+	switch {
+	case p.Checksum == "":
+		return errors.New("plan has no checksum")
+	case signingKey == "" && strings.HasPrefix(p.Checksum, checksumPrefixHMAC):
+		return errors.New("plan is signed, but no PlanSigningKey is configured")
+	case signingKey != "" && !strings.HasPrefix(p.Checksum, checksumPrefixHMAC):
+		return errors.New("plan is not signed, but a PlanSigningKey is configured")
+	}
+
+	want, err := p.checksum(signingKey)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(p.Checksum), []byte(want)) {
+		return errors.New("plan checksum does not match, the plan may have been modified")
+	}
+	return nil
+}
+
+func (p Plan) checksum(signingKey string) (string, error) {
+	p.Checksum = ""
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal plan: %w", err)
+	}
+
+	if signingKey == "" {
+		sum := sha256.Sum256(data)
+		return checksumPrefixSHA256 + hex.EncodeToString(sum[:]), nil
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write(data)
+	return checksumPrefixHMAC + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Write renders the plan in the given format, which defaults to JSON
+func (p Plan) Write(w io.Writer, format string) error {
+	switch format {
+	case "", PlanFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case PlanFormatMarkdown:
+		_, err := io.WriteString(w, p.markdown())
+		return err
+	default:
+		return ValidatePlanFormat(format)
+	}
+}
+
+func (p Plan) markdown() string {
+	var b strings.Builder
+
+	b.WriteString("# Sync plan\n\n")
+	fmt.Fprintf(&b, "Created %s\n", p.Created.Format(time.RFC1123Z))
+
+	for _, set := range p.SyncSets {
+		fmt.Fprintf(&b, "\n## %s\n\n", set.Name)
+		if set.Error != "" {
+			fmt.Fprintf(&b, "**Error:** %s\n\n", set.Error)
+		}
+		fmt.Fprintf(&b, "Found %d people in source and %d in destination. Create %d, update %d, delete %d.\n",
+			set.SourceCount, set.DestinationCount, len(set.Create), len(set.Update), len(set.Delete))
+
+		if len(set.Create) > 0 {
+			b.WriteString("\n### Create\n\n")
+			writeMarkdownTable(&b, set.Create)
+		}
+
+		if len(set.Update) > 0 {
+			b.WriteString("\n### Update\n\n")
+			b.WriteString("| CompareValue | Attribute | Old | New |\n|---|---|---|---|\n")
+			for _, update := range set.Update {
+				for _, change := range update.Changes {
+					fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownEscape(update.CompareValue),
+						markdownEscape(change.Attribute), markdownEscape(change.Old), markdownEscape(change.New))
+				}
+			}
+		}
+
+		if len(set.Delete) > 0 {
+			b.WriteString("\n### Delete\n\n")
+			writeMarkdownTable(&b, set.Delete)
+		}
+	}
+
+	return b.String()
+}
+
+// writeMarkdownTable writes a table with a row for each person and a column for each attribute found on any of them
+func writeMarkdownTable(b *strings.Builder, people []Person) {
+	var columns []string
+	for _, person := range people {
+		for key := range person.Attributes {
+			columns = AddStringToSlice(key, columns)
+		}
+	}
+	sort.Strings(columns)
+
+	b.WriteString("| CompareValue |")
+	for _, column := range columns {
+		fmt.Fprintf(b, " %s |", markdownEscape(column))
+	}
+	b.WriteString("\n|---|" + strings.Repeat("---|", len(columns)) + "\n")
+
+	for _, person := range people {
+		fmt.Fprintf(b, "| %s |", markdownEscape(person.CompareValue))
+		for _, column := range columns {
+			fmt.Fprintf(b, " %s |", markdownEscape(person.Attributes[column]))
+		}
+		b.WriteString("\n")
+	}
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
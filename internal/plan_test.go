@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testPlan() Plan {
+	changeSet := ChangeSet{
+		Create: []Person{{CompareValue: "new@example.com", Attributes: map[string]string{"name": "New", "title": "A|B"}}},
+		Update: []Person{{
+			CompareValue: "changed@example.com",
+			ID:           "2",
+			Attributes:   map[string]string{"name": "Changed", "title": "Boss"},
+			Changes:      []AttributeChange{{Attribute: "name", Old: "changed", New: "Changed"}},
+		}},
+		Delete: []Person{{CompareValue: "gone@example.com", Attributes: map[string]string{"name": "Gone"}}},
+	}
+
+	return Plan{
+		Created:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		SyncSets: []SyncSetPlan{newSyncSetPlan("set one", changeSet, 2, 2)},
+	}
+}
+
+func Test_newSyncSetPlan(t *testing.T) {
+	set := testPlan().SyncSets[0]
+
+	require.Equal(t, 2, set.SourceCount)
+	require.Equal(t, 2, set.DestinationCount)
+	require.Len(t, set.Create, 1)
+	require.Len(t, set.Delete, 1)
+	require.Len(t, set.Update, 1)
+	require.Equal(t, "2", set.Update[0].ID)
+	require.Equal(t, []AttributeChange{{Attribute: "name", Old: "changed", New: "Changed"}}, set.Update[0].Changes)
+}
+
+func TestPlan_Write(t *testing.T) {
+	plan := testPlan()
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, plan.Write(&buf, PlanFormatJSON))
+
+		var got Plan
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+		require.Equal(t, plan, got)
+		require.NotContains(t, buf.String(), "DisableChanges")
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, plan.Write(&buf, PlanFormatMarkdown))
+
+		got := buf.String()
+		require.Contains(t, got, "## set one")
+		require.Contains(t, got, "Create 1, update 1, delete 1.")
+		require.Contains(t, got, "| CompareValue | name | title |")
+		require.Contains(t, got, `| new@example.com | New | A\|B |`)
+		require.Contains(t, got, "| changed@example.com | name | changed | Changed |")
+		require.Contains(t, got, "| gone@example.com | Gone |")
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		require.ErrorContains(t, plan.Write(&bytes.Buffer{}, "xml"), "invalid plan format")
+	})
+}
+
+func TestWritePlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, WritePlan(testPlan(), RuntimeConfig{PlanFile: path}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name": "set one"`)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "plans can hold secret attributes")
+
+	require.NoError(t, os.Chmod(path, 0o644))
+	require.NoError(t, WritePlan(testPlan(), RuntimeConfig{PlanFile: path}))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "an existing plan file should be made private")
+}
+
+func TestReadPlan(t *testing.T) {
+	tests := []struct {
+		name       string
+		writeKey   string
+		readKey    string
+		modify     func(data []byte) []byte
+		wantErrMsg string
+	}{
+		{
+			name: "checksum",
+		},
+		{
+			name:     "signed",
+			writeKey: "secret",
+			readKey:  "secret",
+		},
+		{
+			name: "modified",
+			modify: func(data []byte) []byte {
+				return bytes.Replace(data, []byte("changed@example.com"), []byte("other@example.com"), 1)
+			},
+			wantErrMsg: "checksum does not match",
+		},
+		{
+			name:       "wrong key",
+			writeKey:   "secret",
+			readKey:    "other",
+			wantErrMsg: "checksum does not match",
+		},
+		{
+			name:       "signed, no key configured",
+			writeKey:   "secret",
+			wantErrMsg: "no PlanSigningKey is configured",
+		},
+		{
+			name:       "not signed, key configured",
+			readKey:    "secret",
+			wantErrMsg: "plan is not signed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			plan := testPlan()
+			require.NoError(t, WritePlan(plan, RuntimeConfig{PlanFile: path, PlanSigningKey: tt.writeKey}))
+
+			if tt.modify != nil {
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, tt.modify(data), 0o600))
+			}
+
+			got, err := ReadPlan(path, tt.readKey)
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, got.Checksum)
+			got.Checksum = ""
+			require.Equal(t, plan, got)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxRetries is the number of times an API request is retried if the service is rate limiting or unavailable
+	MaxRetries = 3
+
+	// MaxRetryDelay limits the wait requested by a service before a request is retried
+	MaxRetryDelay = time.Minute
+)
+
+// StatusError is implemented by the errors of API clients that include the HTTP status of the response
+type StatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// IsStatus returns true if err is a StatusError with the given status
+func IsStatus(err error, status int) bool {
+	var e StatusError
+	return errors.As(err, &e) && e.HTTPStatus() == status
+}
+
+// RetryDelay returns the delay given in a Retry-After header, in seconds or as a date, or Backoff if there is none
+func RetryDelay(retryAfter string, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, MaxRetryDelay)
+	}
+	if when, err := http.ParseTime(retryAfter); err == nil {
+		return min(max(time.Until(when), 0), MaxRetryDelay)
+	}
+	return Backoff(attempt)
+}
+
+// Backoff returns the delay before retrying a request that has already been retried attempt times
+func Backoff(attempt int) time.Duration {
+	return time.Duration(attempt+1) * time.Second
+}
+
+// Sleep waits for the duration d, or until ctx is done, in which case its error is returned
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
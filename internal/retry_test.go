@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testStatusError int
+
+func (e testStatusError) Error() string {
+	return fmt.Sprintf("error %d", int(e))
+}
+
+func (e testStatusError) HTTPStatus() int {
+	return int(e)
+}
+
+func TestRetryDelay(t *testing.T) {
+	require.Equal(t, 2*time.Second, RetryDelay("", 1))
+	require.Equal(t, 5*time.Second, RetryDelay("5", 0))
+	require.Equal(t, MaxRetryDelay, RetryDelay("3600", 0))
+	require.Equal(t, time.Duration(0), RetryDelay("Wed, 21 Oct 2015 07:28:00 GMT", 0), "a date in the past")
+	require.Equal(t, MaxRetryDelay, RetryDelay(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 0))
+}
+
+func TestIsStatus(t *testing.T) {
+	err := fmt.Errorf("request failed: %w", testStatusError(http.StatusNotFound))
+	require.True(t, IsStatus(err, http.StatusNotFound))
+	require.False(t, IsStatus(err, http.StatusConflict))
+	require.False(t, IsStatus(fmt.Errorf("not found"), http.StatusNotFound))
+}
+
+func TestSleep(t *testing.T) {
+	require.NoError(t, Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, Sleep(ctx, time.Hour), context.Canceled)
+}
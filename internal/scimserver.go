@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultSCIMListenAddress  = ":8080"
+	DefaultSCIMRefreshSeconds = 300
+	DefaultSCIMMaxResults     = 1000
+)
+
+// SCIMServerConfig configures the SCIM server mode, which reads the people from the source on an interval and serves
+// them as a read-only SCIM 2.0 API. The destination attribute names in the AttributeMap are SCIM attribute paths.
+type SCIMServerConfig struct {
+	ListenAddress  string // default ":8080"
+	BasePath       string // prefix of the API's paths, such as "/scim/v2", default none
+	BearerToken    string // required in the Authorization header of every request
+	TLSCertFile    string // serve HTTPS with this certificate and TLSKeyFile, instead of HTTP
+	TLSKeyFile     string
+	RefreshSeconds int     // interval between reads of the source, default 300
+	MaxResults     int     // largest number of resources in one response, default 1000
+	Filters        Filters // applied to the destination attributes of each person
+}
+
+func (s *SCIMServerConfig) validate() error {
+	if s.BearerToken == "" {
+		return errors.New("BearerToken is required")
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		return errors.New("TLSCertFile and TLSKeyFile must be set together")
+	}
+	if s.RefreshSeconds < 0 || s.MaxResults < 0 {
+		return errors.New("RefreshSeconds and MaxResults must not be negative")
+	}
+
+	if s.ListenAddress == "" {
+		s.ListenAddress = DefaultSCIMListenAddress
+	}
+	if s.RefreshSeconds == 0 {
+		s.RefreshSeconds = DefaultSCIMRefreshSeconds
+	}
+	if s.MaxResults == 0 {
+		s.MaxResults = DefaultSCIMMaxResults
+	}
+	if err := s.Filters.Validate(); err != nil {
+		return fmt.Errorf("invalid Filters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	StateTypeFile = "File"
+	StateTypeS3   = "S3"
+)
+
+// StateConfig configures where the results of previous runs are kept. If Path is empty, no state is kept.
+type StateConfig struct {
+	Type               string // "File" (default) or "S3"
+	Path               string // file path for "File", or object key for "S3"
+	Bucket             string
+	AWSRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	Endpoint           string // optional, for S3-compatible services
+}
+
+// StateStore saves a snapshot of each sync set after a successful run, for comparison on later runs
+type StateStore interface {
+	// Load returns the saved state for the named sync set. If no state has been saved, a zero-value SyncSetState is
+	// returned.
+	Load(ctx context.Context, syncSetName string) (SyncSetState, error)
+
+	// Save replaces the saved state for the named sync set
+	Save(ctx context.Context, syncSetName string, state SyncSetState) error
+}
+
+// SyncSetState is the record of the last run of a sync set that was not stopped
+type SyncSetState struct {
+	Timestamp        time.Time
+	SourceCount      int
+	DestinationCount int
+	Changes          ChangeResults // the changes made
+	Planned          ChangeResults // the changes planned, more than those made if some of them failed
+
+	// PersonHashes holds a hash of the attributes of each person found in the source, keyed by lowercase CompareValue
+	PersonHashes map[string]string
+
+	// Absent holds a record of each person missing from the source but still in the destination, keyed by lowercase
+	// CompareValue. It is only kept when a DeleteGracePeriod is configured.
+	Absent map[string]Absence
+}
+
+// complete returns false if some of the changes planned in the run were not made. State saved before Planned was
+// recorded is taken to be complete.
+func (s SyncSetState) complete() bool {
+	return s.Changes.total() >= s.Planned.total()
+}
+
+// NewStateStore returns the StateStore selected by config, or nil if no state is to be kept
+func NewStateStore(config StateConfig) (StateStore, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+
+	switch config.Type {
+	case "", StateTypeFile:
+		return NewFileStateStore(config.Path), nil
+	case StateTypeS3:
+		return NewS3StateStore(config)
+	default:
+		return nil, fmt.Errorf("unrecognized state type %q", config.Type)
+	}
+}
+
+// stateDocument is implemented by the StateStore backends that keep the state of all sync sets in a single JSON
+// document, keyed by sync set name. A document that does not exist is read as nil.
+type stateDocument interface {
+	read(ctx context.Context) ([]byte, error)
+	write(ctx context.Context, data []byte) error
+}
+
+func loadSyncSetState(ctx context.Context, doc stateDocument, syncSetName string) (SyncSetState, error) {
+	states, err := readStates(ctx, doc)
+	if err != nil {
+		return SyncSetState{}, err
+	}
+	return states[syncSetName], nil
+}
+
+func saveSyncSetState(ctx context.Context, doc stateDocument, syncSetName string, state SyncSetState) error {
+	states, err := readStates(ctx, doc)
+	if err != nil {
+		return err
+	}
+	states[syncSetName] = state
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal state: %w", err)
+	}
+	return doc.write(ctx, data)
+}
+
+func readStates(ctx context.Context, doc stateDocument) (map[string]SyncSetState, error) {
+	states := map[string]SyncSetState{}
+
+	data, err := doc.read(ctx)
+	if err != nil || data == nil {
+		return states, err
+	}
+
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("unable to parse state: %w", err)
+	}
+	return states, nil
+}
+
+// FileStateStore keeps the state of all sync sets in a local JSON file
+type FileStateStore struct {
+	Path string
+}
+
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{Path: path}
+}
+
+func (f *FileStateStore) Load(ctx context.Context, syncSetName string) (SyncSetState, error) {
+	return loadSyncSetState(ctx, f, syncSetName)
+}
+
+func (f *FileStateStore) Save(ctx context.Context, syncSetName string, state SyncSetState) error {
+	return saveSyncSetState(ctx, f, syncSetName, state)
+}
+
+func (f *FileStateStore) read(_ context.Context) ([]byte, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file %s: %w", f.Path, err)
+	}
+	return data, nil
+}
+
+func (f *FileStateStore) write(_ context.Context, data []byte) error {
+	if err := os.WriteFile(f.Path, data, 0o600); err != nil {
+		return fmt.Errorf("unable to write state file %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// hashPeople returns a hash of the attributes of each person, keyed by lowercase CompareValue
+func hashPeople(people []Person) map[string]string {
+	hashes := make(map[string]string, len(people))
+	for _, person := range people {
+		hashes[strings.ToLower(person.CompareValue)] = hashAttributes(person.Attributes)
+	}
+	return hashes
+}
+
+// hashPersonList returns a single hash of the attributes of all of the people, regardless of their order
+func hashPersonList(people []Person) string {
+	return hashAttributes(hashPeople(people))
+}
+
+func hashAttributes(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		// separate with NUL characters so that a key/value boundary can't be confused with content
+		fmt.Fprintf(h, "%s\x00%s\x00", key, attributes[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// StateDiff counts the differences between the people found in the source now and on the previous run
+type StateDiff struct {
+	Added     int
+	Removed   int
+	Changed   int
+	Unchanged int
+}
+
+// DiffPersonHashes compares two sets of hashes as produced for SyncSetState.PersonHashes
+func DiffPersonHashes(previous, current map[string]string) StateDiff {
+	var diff StateDiff
+	for key, hash := range current {
+		previousHash, ok := previous[key]
+		switch {
+		case !ok:
+			diff.Added++
+		case previousHash != hash:
+			diff.Changed++
+		default:
+			diff.Unchanged++
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			diff.Removed++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3StateStore keeps the state of all sync sets in a JSON object in an S3 bucket
+type S3StateStore struct {
+	Bucket string
+	Key    string
+	client *s3.Client
+}
+
+func NewS3StateStore(config StateConfig) (*S3StateStore, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("S3 state store requires a Bucket")
+	}
+
+	client, err := NewS3Client(config.AWSRegion, config.AWSAccessKeyID, config.AWSSecretAccessKey, config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3StateStore{Bucket: config.Bucket, Key: config.Path, client: client}, nil
+}
+
+// NewS3Client returns an S3 client using the default AWS configuration, with the region, static credentials and
+// endpoint overridden where given. An endpoint, for S3-compatible services, implies path-style addressing.
+func NewS3Client(region, accessKeyID, secretAccessKey, endpoint string) (*s3.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("AWS SDK LoadDefaultConfig failed: %w", err)
+	}
+
+	if region != "" {
+		cfg.Region = region
+	}
+	if accessKeyID != "" && secretAccessKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+		// checksums are not supported by all S3-compatible services
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	}), nil
+}
+
+func (s *S3StateStore) Load(ctx context.Context, syncSetName string) (SyncSetState, error) {
+	return loadSyncSetState(ctx, s, syncSetName)
+}
+
+func (s *S3StateStore) Save(ctx context.Context, syncSetName string, state SyncSetState) error {
+	return saveSyncSetState(ctx, s, syncSetName, state)
+}
+
+func (s *S3StateStore) read(ctx context.Context) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get state object s3://%s/%s: %w", s.Bucket, s.Key, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state object s3://%s/%s: %w", s.Bucket, s.Key, err)
+	}
+	return data, nil
+}
+
+func (s *S3StateStore) write(ctx context.Context, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.Key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put state object s3://%s/%s: %w", s.Bucket, s.Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testStateStore(t *testing.T, store StateStore) {
+	got, err := store.Load(context.Background(), "set one")
+	require.NoError(t, err, "missing state should not be an error")
+	require.Equal(t, SyncSetState{}, got)
+
+	first := SyncSetState{
+		Timestamp:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		SourceCount:      10,
+		DestinationCount: 9,
+		Changes:          ChangeResults{Created: 1},
+		PersonHashes:     map[string]string{"a@example.com": "abc"},
+	}
+	second := SyncSetState{Timestamp: time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC), SourceCount: 20, DestinationCount: 21}
+	require.NoError(t, store.Save(context.Background(), "set one", first))
+	require.NoError(t, store.Save(context.Background(), "set two", second))
+
+	got, err = store.Load(context.Background(), "set one")
+	require.NoError(t, err)
+	require.Equal(t, first, got)
+
+	got, err = store.Load(context.Background(), "set two")
+	require.NoError(t, err)
+	require.Equal(t, second, got)
+}
+
+func TestFileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewFileStateStore(path)
+
+	testStateStore(t, store)
+
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err := store.Load(context.Background(), "set one")
+	require.ErrorContains(t, err, "unable to parse state")
+}
+
+func TestS3StateStore(t *testing.T) {
+	var mutex sync.Mutex
+	objects := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+					`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+				return
+			}
+			_, _ = w.Write(data)
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewStateStore(StateConfig{
+		Type:               StateTypeS3,
+		Path:               "sync/state.json",
+		Bucket:             "bucket",
+		AWSRegion:          "us-east-1",
+		AWSAccessKeyID:     "key",
+		AWSSecretAccessKey: "secret",
+		Endpoint:           server.URL,
+	})
+	require.NoError(t, err)
+
+	testStateStore(t, store)
+	require.Contains(t, objects, "/bucket/sync/state.json")
+}
+
+func TestNewStateStore(t *testing.T) {
+	store, err := NewStateStore(StateConfig{})
+	require.NoError(t, err)
+	require.Nil(t, store)
+
+	store, err = NewStateStore(StateConfig{Path: "state.json"})
+	require.NoError(t, err)
+	require.IsType(t, &FileStateStore{}, store)
+
+	_, err = NewStateStore(StateConfig{Type: StateTypeS3, Path: "state.json"})
+	require.ErrorContains(t, err, "requires a Bucket")
+
+	_, err = NewStateStore(StateConfig{Type: "Floppy", Path: "state.json"})
+	require.ErrorContains(t, err, "unrecognized state type")
+}
+
+func TestDiffPersonHashes(t *testing.T) {
+	previous := hashPeople([]Person{
+		{CompareValue: "a", Attributes: map[string]string{"name": "A"}},
+		{CompareValue: "b", Attributes: map[string]string{"name": "B"}},
+		{CompareValue: "c", Attributes: map[string]string{"name": "C"}},
+	})
+	current := hashPeople([]Person{
+		{CompareValue: "A", Attributes: map[string]string{"name": "A"}},
+		{CompareValue: "b", Attributes: map[string]string{"name": "Bee"}},
+		{CompareValue: "d", Attributes: map[string]string{"name": "D"}},
+	})
+
+	require.Equal(t, StateDiff{Added: 1, Removed: 1, Changed: 1, Unchanged: 1}, DiffPersonHashes(previous, current))
+}
+
+func Test_hashAttributes(t *testing.T) {
+	a := hashAttributes(map[string]string{"a": "1", "b": "2"})
+	require.Equal(t, a, hashAttributes(map[string]string{"b": "2", "a": "1"}), "hash should not depend on map order")
+	require.NotEqual(t, a, hashAttributes(map[string]string{"a": "12", "b": ""}))
+	require.NotEqual(t, a, hashAttributes(map[string]string{"a": "1"}))
+}
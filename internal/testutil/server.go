@@ -0,0 +1,99 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Request is a request received by a Server, with its body decoded if it is a JSON object
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   map[string]any
+}
+
+// Server is an in-process API for the tests of an adapter. Each request is recorded and then passed to the handler,
+// one at a time, with the Server locked. Lock the Server to read the state of the API from a test.
+type Server struct {
+	sync.Mutex
+
+	URL string
+
+	handler  http.HandlerFunc
+	requests []Request
+	busy     int
+	refuse   http.HandlerFunc
+}
+
+// NewServer starts a Server that is closed when the test is done
+func NewServer(t *testing.T, handler http.HandlerFunc) *Server {
+	s := &Server{handler: handler}
+	server := httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+	return s
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	request := Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery}
+	if r.Body != nil {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &request.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	s.requests = append(s.requests, request)
+
+	if s.busy > 0 {
+		s.busy--
+		s.refuse(w, r)
+		return
+	}
+	s.handler(w, r)
+}
+
+// Busy makes the Server answer the next n requests with refuse rather than the handler
+func (s *Server) Busy(n int, refuse http.HandlerFunc) {
+	s.Lock()
+	defer s.Unlock()
+	s.busy = n
+	s.refuse = refuse
+}
+
+// Requests returns the requests received
+func (s *Server) Requests() []Request {
+	s.Lock()
+	defer s.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Changes returns the requests received, other than GET requests
+func (s *Server) Changes() []Request {
+	s.Lock()
+	defer s.Unlock()
+	var changes []Request
+	for _, request := range s.requests {
+		if request.Method != http.MethodGet {
+			changes = append(changes, request)
+		}
+	}
+	return changes
+}
+
+// WriteJSON writes a response with the status and the body encoded as JSON. The Content-Type is application/json
+// unless it is already set.
+func WriteJSON(w http.ResponseWriter, status int, body any) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log/syslog"
 )
 
@@ -36,13 +38,39 @@ const (
 type RuntimeConfig struct {
 	DryRunMode bool
 	Verbosity  int
+	PlanFile   string // in dry run mode, write the plan to this file, or to stdout if "-"
+	PlanFormat string // "json" (default) or "markdown"
+
+	// PlanSigningKey, if set, is used to sign JSON plans with an HMAC, and is then required to apply a saved plan
+	PlanSigningKey string
+
+	// TimeoutSeconds, if set, limits the time taken by the whole run. No new sync set or batch of changes is started
+	// once less than StopMarginSeconds remain before the deadline.
+	TimeoutSeconds    int
+	StopMarginSeconds int
 }
 
 type SyncSet struct {
-	Name        string
-	Source      json.RawMessage
-	Destination json.RawMessage
-	Disable     bool
+	Name                   string
+	Source                 json.RawMessage
+	Destination            json.RawMessage
+	Disable                bool
+	ChangeLimits           ChangeLimits
+	MinSourceCount         int
+	MaxSourceShrinkPercent float64
+	DeleteGracePeriod      DeleteGracePeriod
+}
+
+// ChangeLimits caps the number of changes a sync set is allowed to make in one run. The Max values are absolute
+// counts and the Percent values are relative to the number of people found in the destination. Zero means no limit,
+// or in a sync set, the global limit. NoLimit means no limit, even in a sync set with a global limit.
+type ChangeLimits struct {
+	MaxCreate        int
+	MaxUpdate        int
+	MaxDelete        int
+	MaxCreatePercent float64
+	MaxUpdatePercent float64
+	MaxDeletePercent float64
 }
 
 type ChangeSet struct {
@@ -51,12 +79,23 @@ type ChangeSet struct {
 	Delete []Person
 }
 
+// AttributeChange is the difference in one attribute between a person in the source and in the destination
+type AttributeChange struct {
+	Attribute string
+	Old       string
+	New       string
+}
+
 type ChangeResults struct {
 	Created uint64
 	Updated uint64
 	Deleted uint64
 }
 
+func (r ChangeResults) total() uint64 {
+	return r.Created + r.Updated + r.Deleted
+}
+
 type EventLogItem struct {
 	Message string
 	Level   syslog.Priority
@@ -66,6 +105,14 @@ func (l EventLogItem) String() string {
 	return LogLevels[l.Level] + ": " + l.Message
 }
 
+// ErrorEvent returns an error event for an action on a person that failed
+func ErrorEvent(action string, person Person, err error) EventLogItem {
+	return EventLogItem{
+		Level:   syslog.LOG_ERR,
+		Message: fmt.Sprintf("%s %s: %s", action, person.CompareValue, err),
+	}
+}
+
 var LogLevels = map[syslog.Priority]string{
 	syslog.LOG_EMERG:   "Emerg",
 	syslog.LOG_ALERT:   "Alert",
@@ -79,13 +126,33 @@ var LogLevels = map[syslog.Priority]string{
 
 type Destination interface {
 	ForSet(syncSetJson json.RawMessage) error
-	ListUsers(desiredAttrs []string) ([]Person, error)
-	ApplyChangeSet(changes ChangeSet, activityLog chan<- EventLogItem) ChangeResults
+	ListUsers(ctx context.Context, desiredAttrs []string) ([]Person, error)
+	ApplyChangeSet(ctx context.Context, changes ChangeSet, activityLog chan<- EventLogItem) ChangeResults
+}
+
+// UpdateOnlyDestination is implemented by a Destination that cannot create or delete people in some configurations.
+// When UpdatesOnly returns true, only updates are planned, so that the change limits and the plan do not include
+// changes that would not be made.
+type UpdateOnlyDestination interface {
+	UpdatesOnly() bool
+}
+
+// MembershipOnlyDestination is implemented by a Destination that, in some configurations, can only add and remove
+// people, not change their attributes. When MembershipOnly returns true, no updates are planned, so that the change
+// limits and the plan do not include changes that would not be made.
+type MembershipOnlyDestination interface {
+	MembershipOnly() bool
+}
+
+// CreateOnlyDestination is implemented by a Destination with attributes that are only set when a person is created,
+// such as an initial password, and that cannot be listed. Changes to these attributes are not planned as updates.
+type CreateOnlyDestination interface {
+	CreateOnlyAttributes() []string
 }
 
 type Source interface {
 	ForSet(syncSetJson json.RawMessage) error
-	ListUsers(desiredAttrs []string) ([]Person, error)
+	ListUsers(ctx context.Context, desiredAttrs []string) ([]Person, error)
 }
 
 type SyncError struct {
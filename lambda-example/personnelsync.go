@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/aws/aws-lambda-go/lambda"
 
 	sync "github.com/silinternational/personnel-sync/v6"
@@ -14,6 +16,6 @@ func main() {
 	lambda.Start(handler)
 }
 
-func handler(lambdaConfig LambdaConfig) error {
-	return sync.RunSync(lambdaConfig.ConfigPath)
+func handler(ctx context.Context, lambdaConfig LambdaConfig) (sync.Results, error) {
+	return sync.RunSync(ctx, lambdaConfig.ConfigPath)
 }
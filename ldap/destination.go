@@ -0,0 +1,601 @@
+package ldap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"slices"
+	"strconv"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	MemberAttributeMember       = "member"
+	MemberAttributeUniqueMember = "uniqueMember"
+
+	DeleteActionDelete  = "Delete"
+	DeleteActionDisable = "Disable"
+
+	DefaultRDNAttribute = "cn"
+)
+
+// DefaultObjectClasses are given to entries created by the LDAP destination if ObjectClasses is not set
+var DefaultObjectClasses = []string{"top", "person", "organizationalPerson", "inetOrgPerson"}
+
+// LDAPDestination manages the members of an LDAP group, and optionally the user entries themselves
+type LDAPDestination struct {
+	Connection
+
+	// DestinationSyncSet holds the defaults for each sync set
+	DestinationSyncSet
+
+	PageSize            uint32 // number of entries requested at a time, default 500, or 0 to use the default
+	MultiValueSeparator string // separates the values of multi-valued attributes, default "|"
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           DestinationSyncSet         `json:"-"`
+}
+
+// DestinationSyncSet configures a sync set. The Search selects the user entries. Any property not set in the sync set
+// is taken from ExtraJSON.
+type DestinationSyncSet struct {
+	Search
+
+	// GroupDN is the group whose members are synced. If empty, the user entries found by the Search are synced, and
+	// ManageUsers must be true.
+	GroupDN         string
+	MemberAttribute string   // "member" (default) or "uniqueMember"
+	ExtraMembers    []string // DNs of group members that are never removed
+
+	// ManageUsers allows user entries to be created and modified, and the entries of deleted people to be removed or
+	// disabled, according to DeleteAction.
+	ManageUsers   bool
+	RDNAttribute  string   // names new entries, as RDNAttribute=value,BaseDN, default "cn"
+	ObjectClasses []string // object classes of new entries, default top, person, organizationalPerson, inetOrgPerson
+
+	// DeleteAction is "Delete" or "Disable", and is required without a GroupDN. With a GroupDN, deleted people are
+	// removed from the group, and their entries are only changed if it is set.
+	DeleteAction     string
+	DisableAttribute string // set to DisableValue to disable an entry
+	DisableValue     string
+	EnableValue      string // set on an entry to enable it again, or empty to remove the DisableAttribute
+}
+
+// NewLDAPDestination unmarshals the destinationConfig's ExtraJSON into an LDAPDestination struct. No connection is
+// made until ListUsers or ApplyChangeSet is called.
+func NewLDAPDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var l LDAPDestination
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &l); err != nil {
+		return nil, fmt.Errorf("error reading LDAP destination config: %w", err)
+	}
+
+	if err := l.Connection.validate(); err != nil {
+		return nil, fmt.Errorf("invalid LDAP destination config: %w", err)
+	}
+	if l.PageSize == 0 {
+		l.PageSize = DefaultPageSize
+	}
+	if l.MultiValueSeparator == "" {
+		l.MultiValueSeparator = DefaultMultiValueSeparator
+	}
+
+	l.DestinationConfig = destinationConfig
+	return &l, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (l *LDAPDestination) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := l.DestinationSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := syncSet.validate(); err != nil {
+		return err
+	}
+
+	l.SyncSet = syncSet
+	return nil
+}
+
+func (s *DestinationSyncSet) validate() error {
+	if err := s.Search.validate(); err != nil {
+		return err
+	}
+
+	if s.GroupDN == "" && !s.ManageUsers {
+		return errors.New("GroupDN is required unless ManageUsers is true")
+	}
+	if s.GroupDN != "" {
+		if _, err := goldap.ParseDN(s.GroupDN); err != nil {
+			return fmt.Errorf("invalid GroupDN: %w", err)
+		}
+	}
+	switch {
+	case s.MemberAttribute == "":
+		s.MemberAttribute = MemberAttributeMember
+	case strings.EqualFold(s.MemberAttribute, MemberAttributeMember),
+		strings.EqualFold(s.MemberAttribute, MemberAttributeUniqueMember):
+	default:
+		return fmt.Errorf("invalid MemberAttribute %q, must be %s or %s", s.MemberAttribute,
+			MemberAttributeMember, MemberAttributeUniqueMember)
+	}
+
+	if s.RDNAttribute == "" {
+		s.RDNAttribute = DefaultRDNAttribute
+	}
+	if len(s.ObjectClasses) == 0 {
+		s.ObjectClasses = DefaultObjectClasses
+	}
+	switch s.DeleteAction {
+	case "":
+		if s.GroupDN == "" {
+			return fmt.Errorf("DeleteAction is required unless GroupDN is set, must be %s or %s",
+				DeleteActionDelete, DeleteActionDisable)
+		}
+	case DeleteActionDelete, DeleteActionDisable:
+		if !s.ManageUsers {
+			return errors.New("DeleteAction requires ManageUsers to be true")
+		}
+	default:
+		return fmt.Errorf("invalid DeleteAction %q, must be %s or %s", s.DeleteAction,
+			DeleteActionDelete, DeleteActionDisable)
+	}
+	if s.DeleteAction == DeleteActionDisable && (s.DisableAttribute == "" || s.DisableValue == "") {
+		return errors.New("DisableAttribute and DisableValue are required if DeleteAction is Disable")
+	}
+	return nil
+}
+
+// ListUsers returns the members of the group that are found by the Search. If there is no GroupDN, it returns all
+// entries found by the Search, except those that are disabled. The ID of each person is the entry's DN.
+func (l *LDAPDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	conn, closeConn, err := l.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	search := l.SyncSet.Search
+	attributes := search.attributes(slices.Concat(desiredAttrs, []string{l.disableAttribute()})...)
+	entries, err := l.search(ctx, conn, search, "", attributes, l.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]bool
+	if l.SyncSet.GroupDN != "" {
+		members, err = l.groupMembers(conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	people := []internal.Person{}
+	for _, entry := range entries {
+		if members != nil && !members[normalizeDN(entry.DN)] {
+			continue
+		}
+		if members == nil && l.isDisabled(entry) {
+			continue
+		}
+
+		person := entryToPerson(entry, desiredAttrs, search.CompareAttribute, l.MultiValueSeparator)
+		person.ID = entry.DN
+		people = append(people, person)
+	}
+	return people, nil
+}
+
+// groupMembers returns the normalized DNs of the group's members, except the ExtraMembers. Active Directory returns
+// large groups in ranges, such as "member;range=0-1499", so each range is requested in turn.
+func (l *LDAPDestination) groupMembers(conn *goldap.Conn) (map[string]bool, error) {
+	members := map[string]bool{}
+	attribute := l.SyncSet.MemberAttribute
+	for {
+		request := goldap.NewSearchRequest(l.SyncSet.GroupDN, goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0,
+			l.TimeoutSeconds, false, "(objectClass=*)", []string{attribute}, nil)
+		result, err := conn.Search(request)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get members of group %s: %w", l.SyncSet.GroupDN, err)
+		}
+		if len(result.Entries) == 0 {
+			return nil, fmt.Errorf("group %s not found", l.SyncSet.GroupDN)
+		}
+
+		next := ""
+		for _, attr := range result.Entries[0].Attributes {
+			name, rangeSpec, _ := strings.Cut(attr.Name, ";range=")
+			if !strings.EqualFold(name, l.SyncSet.MemberAttribute) {
+				continue
+			}
+			for _, dn := range attr.Values {
+				members[normalizeDN(dn)] = true
+			}
+			if _, end, ok := strings.Cut(rangeSpec, "-"); ok && end != "*" {
+				if last, err := strconv.Atoi(end); err == nil {
+					next = fmt.Sprintf("%s;range=%d-*", l.SyncSet.MemberAttribute, last+1)
+				}
+			}
+		}
+		if next == "" {
+			break
+		}
+		attribute = next
+	}
+
+	for _, dn := range l.SyncSet.ExtraMembers {
+		delete(members, normalizeDN(dn))
+	}
+	return members, nil
+}
+
+// ApplyChangeSet adds and removes group members and, if ManageUsers is true, creates, modifies, and removes or
+// disables user entries. All changes are made on a single connection.
+func (l *LDAPDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	var results internal.ChangeResults
+	if internal.Stopping(ctx) {
+		return results
+	}
+
+	conn, closeConn, err := l.connect(ctx)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to apply changes to %s: %s", l.URL, err),
+		}
+		return results
+	}
+	defer closeConn()
+
+	if !l.DestinationConfig.DisableAdd {
+		for _, person := range changes.Create {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if l.addPerson(ctx, conn, person, eventLog) {
+				results.Created++
+			}
+		}
+	}
+
+	if !l.DestinationConfig.DisableUpdate && l.SyncSet.ManageUsers {
+		for _, person := range changes.Update {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if l.updatePerson(ctx, conn, person, eventLog) {
+				results.Updated++
+			}
+		}
+	}
+
+	if !l.DestinationConfig.DisableDelete {
+		for _, person := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if l.deletePerson(ctx, conn, person, eventLog) {
+				results.Deleted++
+			}
+		}
+	}
+
+	return results
+}
+
+// MembershipOnly returns true without ManageUsers, since the group members are then added and removed, but their
+// entries are not modified
+func (l *LDAPDestination) MembershipOnly() bool {
+	return !l.SyncSet.ManageUsers
+}
+
+// addPerson finds or, if ManageUsers is true, creates the person's entry, and adds it to the group
+func (l *LDAPDestination) addPerson(
+	ctx context.Context,
+	conn *goldap.Conn,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	entry, err := l.findEntry(ctx, conn, person.CompareValue)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to find", person, err)
+		return false
+	}
+
+	var dn string
+	switch {
+	case entry != nil:
+		dn = entry.DN
+		if l.SyncSet.ManageUsers && l.isDisabled(entry) {
+			if err := l.enableEntry(conn, entry, person); err != nil {
+				eventLog <- internal.ErrorEvent("unable to enable", person, err)
+				return false
+			}
+			eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "EnablePerson " + person.CompareValue}
+		}
+	case l.SyncSet.ManageUsers:
+		dn, err = l.createEntry(conn, person)
+		if err != nil {
+			eventLog <- internal.ErrorEvent("unable to create", person, err)
+			return false
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddPerson " + person.CompareValue}
+	default:
+		eventLog <- internal.EventLogItem{
+			Level: syslog.LOG_WARNING,
+			Message: fmt.Sprintf("unable to add %s to group %s, not found in %s", person.CompareValue, l.SyncSet.GroupDN,
+				l.SyncSet.BaseDN),
+		}
+		return false
+	}
+
+	if l.SyncSet.GroupDN == "" {
+		return true
+	}
+
+	modify := goldap.NewModifyRequest(l.SyncSet.GroupDN, nil)
+	modify.Add(l.SyncSet.MemberAttribute, []string{dn})
+	if err := conn.Modify(modify); err != nil &&
+		!goldap.IsErrorWithCode(err, goldap.LDAPResultAttributeOrValueExists) {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to add %s to group %s: %s", person.CompareValue, l.SyncSet.GroupDN, err),
+		}
+		return false
+	}
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddMember " + person.CompareValue}
+	return true
+}
+
+// updatePerson modifies the changed attributes of the person's entry. A change to the RDN attribute renames the entry.
+func (l *LDAPDestination) updatePerson(
+	ctx context.Context,
+	conn *goldap.Conn,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	dn, err := l.personDN(ctx, conn, person)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to update", person, err)
+		return false
+	}
+
+	modify := goldap.NewModifyRequest(dn, nil)
+	newRDN := ""
+	for attr, value := range person.ChangedAttributes() {
+		switch {
+		case strings.EqualFold(attr, DNAttribute):
+			continue
+		case isRDNAttribute(dn, attr):
+			if value != "" {
+				newRDN = attr + "=" + goldap.EscapeDN(value)
+			}
+		case value == "":
+			modify.Delete(attr, []string{})
+		default:
+			modify.Replace(attr, []string{value})
+		}
+	}
+
+	if len(modify.Changes) > 0 {
+		if err := conn.Modify(modify); err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchAttribute) {
+			eventLog <- internal.ErrorEvent("unable to update", person, err)
+			return false
+		}
+	}
+	if newRDN != "" {
+		if err := conn.ModifyDN(goldap.NewModifyDNRequest(dn, newRDN, true, "")); err != nil {
+			eventLog <- internal.ErrorEvent("unable to rename", person, err)
+			return false
+		}
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdatePerson %s, changed: %s", person.CompareValue,
+			strings.Join(person.ChangedAttributeNames(), ", ")),
+	}
+	return true
+}
+
+// deletePerson removes the person from the group, if there is a GroupDN, and then removes or disables the person's
+// entry according to the DeleteAction
+func (l *LDAPDestination) deletePerson(
+	ctx context.Context,
+	conn *goldap.Conn,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	dn, err := l.personDN(ctx, conn, person)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to delete", person, err)
+		return false
+	}
+
+	if l.SyncSet.GroupDN != "" {
+		modify := goldap.NewModifyRequest(l.SyncSet.GroupDN, nil)
+		modify.Delete(l.SyncSet.MemberAttribute, []string{dn})
+		err = conn.Modify(modify)
+		if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchAttribute) {
+			eventLog <- internal.ErrorEvent("unable to delete", person, err)
+			return false
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "RemoveMember " + person.CompareValue}
+	}
+
+	var message string
+	switch l.SyncSet.DeleteAction {
+	case DeleteActionDisable:
+		modify := goldap.NewModifyRequest(dn, nil)
+		modify.Replace(l.SyncSet.DisableAttribute, []string{l.SyncSet.DisableValue})
+		err = conn.Modify(modify)
+		message = "DisablePerson "
+	case DeleteActionDelete:
+		err = conn.Del(goldap.NewDelRequest(dn, nil))
+		message = "DeletePerson "
+	default:
+		return true
+	}
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to delete", person, err)
+		return false
+	}
+
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: message + person.CompareValue}
+	return true
+}
+
+// createEntry adds an entry for the person below the BaseDN, and returns its DN
+func (l *LDAPDestination) createEntry(conn *goldap.Conn, person internal.Person) (string, error) {
+	rdnValue := person.Attributes[l.SyncSet.RDNAttribute]
+	if rdnValue == "" {
+		return "", fmt.Errorf("no value for %s, the RDNAttribute", l.SyncSet.RDNAttribute)
+	}
+	dn := l.SyncSet.RDNAttribute + "=" + goldap.EscapeDN(rdnValue) + "," + l.SyncSet.BaseDN
+
+	add := goldap.NewAddRequest(dn, nil)
+	add.Attribute("objectClass", l.SyncSet.ObjectClasses)
+	for _, attr := range sortedAttributes(person.Attributes) {
+		if value := person.Attributes[attr]; value != "" && !strings.EqualFold(attr, DNAttribute) {
+			add.Attribute(attr, []string{value})
+		}
+	}
+	return dn, conn.Add(add)
+}
+
+// enableEntry enables a disabled entry and sets the person's attributes
+func (l *LDAPDestination) enableEntry(conn *goldap.Conn, entry *goldap.Entry, person internal.Person) error {
+	modify := goldap.NewModifyRequest(entry.DN, nil)
+	if l.SyncSet.EnableValue != "" {
+		modify.Replace(l.SyncSet.DisableAttribute, []string{l.SyncSet.EnableValue})
+	} else {
+		modify.Delete(l.SyncSet.DisableAttribute, []string{})
+	}
+	for _, attr := range sortedAttributes(person.Attributes) {
+		value := person.Attributes[attr]
+		if value != "" && !strings.EqualFold(attr, DNAttribute) && !isRDNAttribute(entry.DN, attr) &&
+			!strings.EqualFold(attr, l.SyncSet.DisableAttribute) {
+			modify.Replace(attr, []string{value})
+		}
+	}
+	return conn.Modify(modify)
+}
+
+// findEntry returns the entry found by the Search with the given compare value, or nil if there is none
+func (l *LDAPDestination) findEntry(
+	ctx context.Context,
+	conn *goldap.Conn,
+	compareValue string,
+) (*goldap.Entry, error) {
+	search := l.SyncSet.Search
+	attributes := search.attributes(l.disableAttribute())
+
+	var entries []*goldap.Entry
+	var err error
+	if strings.EqualFold(search.CompareAttribute, DNAttribute) {
+		search.BaseDN = compareValue
+		search.Scope = ScopeBase
+		entries, err = l.search(ctx, conn, search, "", attributes, l.PageSize)
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+	} else {
+		filter := "(" + search.CompareAttribute + "=" + goldap.EscapeFilter(compareValue) + ")"
+		entries, err = l.search(ctx, conn, search, filter, attributes, l.PageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(entries) {
+	case 0:
+		return nil, nil
+	case 1:
+		return entries[0], nil
+	default:
+		return nil, fmt.Errorf("%d entries have %s=%s", len(entries), search.CompareAttribute, compareValue)
+	}
+}
+
+// personDN returns the DN of the person, from the ID set by ListUsers if possible
+func (l *LDAPDestination) personDN(ctx context.Context, conn *goldap.Conn, person internal.Person) (string, error) {
+	if person.ID != "" {
+		return person.ID, nil
+	}
+	entry, err := l.findEntry(ctx, conn, person.CompareValue)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", fmt.Errorf("not found in %s", l.SyncSet.BaseDN)
+	}
+	return entry.DN, nil
+}
+
+func (l *LDAPDestination) disableAttribute() string {
+	if l.SyncSet.DeleteAction != DeleteActionDisable {
+		return ""
+	}
+	return l.SyncSet.DisableAttribute
+}
+
+func (l *LDAPDestination) isDisabled(entry *goldap.Entry) bool {
+	attr := l.disableAttribute()
+	if attr == "" {
+		return false
+	}
+	return slices.ContainsFunc(entry.GetEqualFoldAttributeValues(attr), func(value string) bool {
+		return strings.EqualFold(value, l.SyncSet.DisableValue)
+	})
+}
+
+// isRDNAttribute returns true if attr names the entry, as in the "cn" of "cn=Ann,ou=people,dc=example,dc=org"
+func isRDNAttribute(dn, attr string) bool {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(parsed.RDNs[0].Attributes, func(a *goldap.AttributeTypeAndValue) bool {
+		return strings.EqualFold(a.Type, attr)
+	})
+}
+
+// normalizeDN returns a DN in a form that can be compared with other DNs
+func normalizeDN(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	rdns := make([]string, len(parsed.RDNs))
+	for i, rdn := range parsed.RDNs {
+		attrs := make([]string, len(rdn.Attributes))
+		for j, a := range rdn.Attributes {
+			attrs[j] = strings.ToLower(a.Type) + "=" + strings.ToLower(goldap.EscapeDN(a.Value))
+		}
+		slices.Sort(attrs)
+		rdns[i] = strings.Join(attrs, "+")
+	}
+	return strings.Join(rdns, ",")
+}
+
+func sortedAttributes(attributes map[string]string) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
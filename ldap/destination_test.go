@@ -0,0 +1,343 @@
+package ldap
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	testAnnDN   = "uid=ann,ou=people,dc=example,dc=org"
+	testBobDN   = "uid=bob,ou=people,dc=example,dc=org"
+	testCatDN   = "uid=cat,ou=people,dc=example,dc=org"
+	testGroupDN = "cn=staff,ou=groups,dc=example,dc=org"
+)
+
+func newTestLDAPDestination(t *testing.T, directory *testDirectory, extraJSON, syncSet string) *LDAPDestination {
+	config := `{"URL": "` + directory.URL + `", "BindDN": "` + testBindDN + `", "BindPassword": "` + testBindPassword +
+		`", "BaseDN": "ou=people,dc=example,dc=org", "CompareAttribute": "mail"`
+	if extraJSON != "" {
+		config += ", " + extraJSON
+	}
+	config += "}"
+
+	destination, err := NewLDAPDestination(internal.DestinationConfig{
+		Type:      internal.DestinationTypeLDAP,
+		ExtraJSON: []byte(config),
+	})
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*LDAPDestination)
+}
+
+func applyTestChanges(
+	t *testing.T,
+	l *LDAPDestination,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := l.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+func TestLDAPDestination_group(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	l := newTestLDAPDestination(t, directory, "", `{"GroupDN": "`+testGroupDN+`"}`)
+
+	people, err := l.ListUsers(context.Background(), []string{"mail"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "ann@example.org", ID: testAnnDN, Attributes: map[string]string{"mail": "ann@example.org"}},
+		{CompareValue: "bob@example.org", ID: testBobDN, Attributes: map[string]string{"mail": "bob@example.org"}},
+	}, people)
+
+	results, messages := applyTestChanges(t, l, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "CAT@example.org", Attributes: map[string]string{"mail": "CAT@example.org"}},
+			{CompareValue: "dan@example.org", Attributes: map[string]string{"mail": "dan@example.org"}},
+		},
+		Update: []internal.Person{{
+			CompareValue: "ann@example.org",
+			ID:           testAnnDN,
+			Attributes:   map[string]string{"mail": "ann@example.org", "cn": "Anne"},
+			Changes:      []internal.AttributeChange{{Attribute: "cn", Old: "Ann", New: "Anne"}},
+		}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: testBobDN}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 1, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddMember CAT@example.org",
+		"unable to add dan@example.org to group " + testGroupDN + ", not found in ou=people,dc=example,dc=org",
+		"RemoveMember bob@example.org",
+	}, messages)
+
+	require.Equal(t, []string{testAnnDN, testCatDN}, directory.entry(testGroupDN).Attributes["member"])
+	require.Equal(t, []string{"Ann"}, directory.entry(testAnnDN).Attributes["cn"], "users are not managed")
+}
+
+type testSource struct {
+	people []internal.Person
+}
+
+func (s *testSource) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (s *testSource) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	return s.people, nil
+}
+
+func TestLDAPDestination_group_plan(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	l := newTestLDAPDestination(t, directory, "", `{"GroupDN": "`+testGroupDN+`"}`)
+
+	source := &testSource{people: []internal.Person{
+		{CompareValue: "ann@example.org", Attributes: map[string]string{"mail": "ann@example.org", "cn": "Anne"}},
+		{CompareValue: "cat@example.org", Attributes: map[string]string{"mail": "cat@example.org", "cn": "Cat"}},
+	}}
+	config := internal.NewConfig()
+	config.AttributeMap = []internal.AttributeMap{{Source: "mail", Destination: "mail"}, {Source: "cn", Destination: "cn"}}
+	config.ChangeLimits = internal.ChangeLimits{MaxUpdatePercent: 10}
+
+	plan, err := internal.PlanSyncSet(context.Background(), log.New(io.Discard, "", 0), source, l, config,
+		internal.SyncSet{Name: "group"}, nil)
+	require.NoError(t, err, "updates that cannot be made should not exceed the change limits")
+	require.Equal(t, []string{"cat@example.org"}, compareValues(plan.Create))
+	require.Empty(t, plan.Update, "users are not managed, so no updates should be planned")
+	require.Equal(t, []string{"bob@example.org"}, compareValues(plan.Delete))
+}
+
+func TestLDAPDestination_group_extraMembers(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	directory.rangeSize = 1
+	l := newTestLDAPDestination(t, directory, `"ExtraMembers": ["UID=Ann,OU=People,DC=example,DC=org"]`,
+		`{"GroupDN": "`+testGroupDN+`"}`)
+
+	people, err := l.ListUsers(context.Background(), []string{"mail"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "bob@example.org", ID: testBobDN, Attributes: map[string]string{"mail": "bob@example.org"}},
+	}, people)
+}
+
+func TestLDAPDestination_group_manageUsers(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	l := newTestLDAPDestination(t, directory, `"ManageUsers": true, "RDNAttribute": "uid"`,
+		`{"GroupDN": "`+testGroupDN+`"}`)
+
+	results, messages := applyTestChanges(t, l, internal.ChangeSet{
+		Create: []internal.Person{{
+			CompareValue: "dan@example.org",
+			Attributes:   map[string]string{"mail": "dan@example.org", "uid": "dan", "cn": "Dan", "sn": "Smith", "title": ""},
+		}},
+		Update: []internal.Person{{
+			CompareValue: "ann@example.org",
+			ID:           testAnnDN,
+			Attributes:   map[string]string{"mail": "ann@example.org", "cn": "Anne", "ou": ""},
+			Changes: []internal.AttributeChange{
+				{Attribute: "cn", Old: "Ann", New: "Anne"},
+				{Attribute: "ou", Old: "Finance|IT", New: ""},
+			},
+		}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: testBobDN}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 1, Updated: 1, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddPerson dan@example.org",
+		"AddMember dan@example.org",
+		"UpdatePerson ann@example.org, changed: cn, ou",
+		"RemoveMember bob@example.org",
+	}, messages)
+
+	dan := directory.entry("uid=dan,ou=people,dc=example,dc=org")
+	require.Equal(t, map[string][]string{
+		"objectClass": DefaultObjectClasses,
+		"mail":        {"dan@example.org"},
+		"uid":         {"dan"},
+		"cn":          {"Dan"},
+		"sn":          {"Smith"},
+	}, dan.Attributes)
+
+	ann := directory.entry(testAnnDN).Attributes
+	require.Equal(t, []string{"Anne"}, ann["cn"])
+	require.NotContains(t, ann, "ou")
+	require.Equal(t, []string{"ann@example.org"}, ann["mail"])
+
+	require.NotEmpty(t, directory.entry(testBobDN).DN, "removing a member does not delete the user")
+	require.Equal(t, []string{testAnnDN, dan.DN}, directory.entry(testGroupDN).Attributes["member"])
+}
+
+func TestLDAPDestination_group_disable(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	l := newTestLDAPDestination(t, directory, `"ManageUsers": true, "DeleteAction": "Disable",
+		"DisableAttribute": "employeeType", "DisableValue": "disabled"`, `{"GroupDN": "`+testGroupDN+`"}`)
+
+	results, messages := applyTestChanges(t, l, internal.ChangeSet{
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: testBobDN}},
+	})
+	require.Equal(t, internal.ChangeResults{Deleted: 1}, results)
+	require.Equal(t, []string{"RemoveMember bob@example.org", "DisablePerson bob@example.org"}, messages)
+	require.Equal(t, []string{testAnnDN}, directory.entry(testGroupDN).Attributes["member"])
+	require.Equal(t, []string{"disabled"}, directory.entry(testBobDN).Attributes["employeeType"])
+}
+
+func TestLDAPDestination_users_disable(t *testing.T) {
+	entries := testPeopleEntries()
+	entries[2].Attributes["employeeType"] = []string{"disabled"}
+	directory := startTestDirectory(t, entries)
+	l := newTestLDAPDestination(t, directory, `"ManageUsers": true, "DeleteAction": "Disable",
+		"DisableAttribute": "employeeType", "DisableValue": "disabled"`, `{}`)
+
+	people, err := l.ListUsers(context.Background(), []string{"mail"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ann@example.org", "bob@example.org"}, compareValues(people))
+
+	results, messages := applyTestChanges(t, l, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "cat@example.org", Attributes: map[string]string{"mail": "cat@example.org", "cn": "Kat"}},
+		},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: testBobDN}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 1, Deleted: 1}, results)
+	require.Equal(t, []string{"EnablePerson cat@example.org", "DisablePerson bob@example.org"}, messages)
+
+	cat := directory.entry(testCatDN).Attributes
+	require.NotContains(t, cat, "employeeType")
+	require.Equal(t, []string{"Kat"}, cat["cn"])
+	require.Equal(t, []string{"disabled"}, directory.entry(testBobDN).Attributes["employeeType"])
+
+	people, err = l.ListUsers(context.Background(), []string{"mail"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ann@example.org", "cat@example.org"}, compareValues(people))
+}
+
+func TestLDAPDestination_users_delete(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	l := newTestLDAPDestination(t, directory, `"ManageUsers": true, "DeleteAction": "Delete"`, `{"Filter": "(uid=*)"}`)
+
+	results, messages := applyTestChanges(t, l, internal.ChangeSet{
+		Delete: []internal.Person{{CompareValue: "bob@example.org"}},
+	})
+	require.Equal(t, internal.ChangeResults{Deleted: 1}, results)
+	require.Equal(t, []string{"DeletePerson bob@example.org"}, messages)
+	require.Empty(t, directory.entry(testBobDN).DN)
+}
+
+func TestLDAPDestination_disabled(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+	destination, err := NewLDAPDestination(internal.DestinationConfig{
+		ExtraJSON: []byte(`{"URL": "` + directory.URL + `", "BindDN": "` + testBindDN + `", "BindPassword": "` +
+			testBindPassword + `"}`),
+		DisableAdd:    true,
+		DisableUpdate: true,
+		DisableDelete: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(`{"BaseDN": "ou=people,dc=example,dc=org",
+		"CompareAttribute": "mail", "GroupDN": "`+testGroupDN+`", "ManageUsers": true}`)))
+
+	results, messages := applyTestChanges(t, destination.(*LDAPDestination), internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "cat@example.org"}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: testBobDN}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Empty(t, messages)
+	require.Equal(t, []string{testAnnDN, testBobDN}, directory.entry(testGroupDN).Attributes["member"])
+}
+
+func TestLDAPDestination_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "group",
+			syncSet: `{"GroupDN": "cn=staff,dc=example,dc=org", "MemberAttribute": "uniqueMember"}`,
+		},
+		{
+			name: "users",
+			syncSet: `{"ManageUsers": true, "DeleteAction": "Disable", "DisableAttribute": "userAccountControl",
+				"DisableValue": "514", "EnableValue": "512"}`,
+		},
+		{
+			name:       "no group or users",
+			syncSet:    `{}`,
+			wantErrMsg: "GroupDN is required",
+		},
+		{
+			name:       "invalid group",
+			syncSet:    `{"GroupDN": "staff"}`,
+			wantErrMsg: "invalid GroupDN",
+		},
+		{
+			name:       "invalid member attribute",
+			syncSet:    `{"GroupDN": "cn=staff,dc=example,dc=org", "MemberAttribute": "memberUid"}`,
+			wantErrMsg: "invalid MemberAttribute",
+		},
+		{
+			name:       "invalid delete action",
+			syncSet:    `{"ManageUsers": true, "DeleteAction": "Suspend"}`,
+			wantErrMsg: "invalid DeleteAction",
+		},
+		{
+			name:       "users without delete action",
+			syncSet:    `{"ManageUsers": true}`,
+			wantErrMsg: "DeleteAction is required unless GroupDN is set",
+		},
+		{
+			name:       "delete action without ManageUsers",
+			syncSet:    `{"GroupDN": "cn=staff,dc=example,dc=org", "DeleteAction": "Delete"}`,
+			wantErrMsg: "DeleteAction requires ManageUsers to be true",
+		},
+		{
+			name:       "disable without attribute",
+			syncSet:    `{"ManageUsers": true, "DeleteAction": "Disable"}`,
+			wantErrMsg: "DisableAttribute and DisableValue are required",
+		},
+		{
+			name:       "invalid search",
+			syncSet:    `{"GroupDN": "cn=staff,dc=example,dc=org", "Filter": "uid=*"}`,
+			wantErrMsg: "invalid Filter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewLDAPDestination(internal.DestinationConfig{
+				ExtraJSON: []byte(`{"URL": "ldap://localhost", "BaseDN": "dc=example,dc=org", "CompareAttribute": "mail"}`),
+			})
+			require.NoError(t, err)
+
+			err = destination.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			manageUsers := strings.Contains(tt.syncSet, `"ManageUsers": true`)
+			require.Equal(t, !manageUsers, destination.(internal.MembershipOnlyDestination).MembershipOnly())
+		})
+	}
+}
+
+func compareValues(people []internal.Person) []string {
+	values := make([]string, len(people))
+	for i, person := range people {
+		values[i] = person.CompareValue
+	}
+	return values
+}
@@ -0,0 +1,236 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DefaultTimeoutSeconds = 60
+	DefaultPageSize       = 500
+	DefaultScope          = ScopeSubtree
+
+	ScopeBase    = "base"
+	ScopeOne     = "one"
+	ScopeSubtree = "sub"
+
+	// DNAttribute is the name used in the AttributeMap for the distinguished name of an entry
+	DNAttribute = "dn"
+
+	DefaultFilter              = "(objectClass=person)"
+	DefaultMultiValueSeparator = "|"
+)
+
+// Connection holds the settings for connecting to an LDAP server, such as OpenLDAP or Active Directory
+type Connection struct {
+	URL                string // ldap://host:389, ldaps://host:636 or ldapi:///path
+	BindDN             string // if empty, an anonymous bind is used
+	BindPassword       string
+	StartTLS           bool // upgrade an ldap:// connection to TLS
+	InsecureSkipVerify bool // don't verify the server's certificate, for testing only
+	TimeoutSeconds     int  // time limit for connecting and for each request, default 60
+}
+
+func (c *Connection) validate() error {
+	if c.URL == "" {
+		return errors.New("URL is required")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ldap", "ldaps", "ldapi":
+	default:
+		return fmt.Errorf("invalid URL %q, the scheme must be ldap, ldaps or ldapi", c.URL)
+	}
+	if c.StartTLS && u.Scheme != "ldap" {
+		return errors.New("StartTLS can only be used with an ldap:// URL")
+	}
+	if c.BindDN != "" && c.BindPassword == "" {
+		return errors.New("BindPassword is required if BindDN is set")
+	}
+
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	return nil
+}
+
+// connect opens a connection and binds. The connection is closed if ctx is cancelled. The returned function closes
+// the connection.
+func (c *Connection) connect(ctx context.Context) (*goldap.Conn, func(), error) {
+	timeout := time.Duration(c.TimeoutSeconds) * time.Second
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if u, err := url.Parse(c.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := goldap.DialURL(c.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		goldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to %s: %w", c.URL, err)
+	}
+	conn.SetTimeout(timeout)
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	closeConn := func() {
+		stop()
+		_ = conn.Close()
+	}
+
+	if c.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			closeConn()
+			return nil, nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+
+	if c.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(c.BindDN, c.BindPassword)
+	}
+	if err != nil {
+		closeConn()
+		return nil, nil, fmt.Errorf("unable to bind as %q: %w", c.BindDN, err)
+	}
+
+	return conn, closeConn, nil
+}
+
+// Search selects the entries for a sync set
+type Search struct {
+	BaseDN           string
+	Filter           string // default "(objectClass=person)"
+	Scope            string // "sub" (default), "one" or "base"
+	CompareAttribute string // an LDAP attribute, or "dn"
+}
+
+func (s *Search) validate() error {
+	if s.BaseDN == "" {
+		return errors.New("BaseDN is required")
+	}
+	if _, err := goldap.ParseDN(s.BaseDN); err != nil {
+		return fmt.Errorf("invalid BaseDN: %w", err)
+	}
+	if s.Filter == "" {
+		s.Filter = DefaultFilter
+	}
+	if _, err := goldap.CompileFilter(s.Filter); err != nil {
+		return fmt.Errorf("invalid Filter: %w", err)
+	}
+	if _, err := parseScope(s.Scope); err != nil {
+		return err
+	}
+	if s.CompareAttribute == "" {
+		return errors.New("CompareAttribute is required")
+	}
+	return nil
+}
+
+// attributes returns the LDAP attributes to request for the desired attributes and the compare attribute
+func (s *Search) attributes(desiredAttrs ...string) []string {
+	var attributes []string
+	for _, attr := range slices.Concat(desiredAttrs, []string{s.CompareAttribute}) {
+		if attr != "" && !strings.EqualFold(attr, DNAttribute) {
+			attributes = internal.AddStringToSlice(attr, attributes)
+		}
+	}
+	if len(attributes) == 0 {
+		attributes = []string{"1.1"} // no attributes, per RFC 4511
+	}
+	return attributes
+}
+
+// search runs the search one page at a time, with additional criteria in filter if it is not empty, and returns all
+// of the entries found
+func (c *Connection) search(
+	ctx context.Context,
+	conn *goldap.Conn,
+	s Search,
+	filter string,
+	attributes []string,
+	pageSize uint32,
+) ([]*goldap.Entry, error) {
+	scope, _ := parseScope(s.Scope)
+	if filter != "" {
+		filter = "(&" + s.Filter + filter + ")"
+	} else {
+		filter = s.Filter
+	}
+
+	paging := goldap.NewControlPaging(pageSize)
+	request := goldap.NewSearchRequest(s.BaseDN, scope, goldap.NeverDerefAliases, 0, c.TimeoutSeconds,
+		false, filter, attributes, []goldap.Control{paging})
+
+	var entries []*goldap.Entry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err := conn.Search(request)
+		if err != nil {
+			return nil, fmt.Errorf("search of %s failed: %w", s.BaseDN, err)
+		}
+		entries = append(entries, result.Entries...)
+
+		response, ok := goldap.FindControl(result.Controls, goldap.ControlTypePaging).(*goldap.ControlPaging)
+		if !ok || len(response.Cookie) == 0 {
+			return entries, nil
+		}
+		paging.SetCookie(response.Cookie)
+	}
+}
+
+// entryToPerson returns a person with the desired attributes of the entry, joining multiple values with separator
+func entryToPerson(entry *goldap.Entry, desiredAttrs []string, compareAttr, separator string) internal.Person {
+	person := internal.Person{Attributes: map[string]string{}}
+	for _, attr := range desiredAttrs {
+		if value, ok := attributeValue(entry, attr, separator); ok {
+			person.Attributes[attr] = value
+		}
+	}
+	person.CompareValue, _ = attributeValue(entry, compareAttr, separator)
+	return person
+}
+
+func attributeValue(entry *goldap.Entry, attr, separator string) (string, bool) {
+	if strings.EqualFold(attr, DNAttribute) {
+		return entry.DN, true
+	}
+	values := entry.GetEqualFoldAttributeValues(attr)
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, separator), true
+}
+
+// parseScope returns the go-ldap value of a scope name
+func parseScope(scope string) (int, error) {
+	switch strings.ToLower(scope) {
+	case "", ScopeSubtree:
+		return goldap.ScopeWholeSubtree, nil
+	case ScopeOne:
+		return goldap.ScopeSingleLevel, nil
+	case ScopeBase:
+		return goldap.ScopeBaseObject, nil
+	default:
+		return 0, fmt.Errorf("invalid Scope %q, must be %s, %s or %s", scope, ScopeSubtree, ScopeOne, ScopeBase)
+	}
+}
@@ -0,0 +1,415 @@
+package ldap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBindDN       = "cn=admin,dc=example,dc=org"
+	testBindPassword = "secret"
+)
+
+type testEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// testDirectory is an in-process LDAP server with simple support for search filters, paging, and changes to entries.
+// If rangeSize is set, multi-valued attributes are returned in ranges, as Active Directory does.
+type testDirectory struct {
+	URL string
+
+	mu        sync.Mutex
+	entries   []testEntry
+	searches  []*gldap.SearchMessage
+	rangeSize int
+}
+
+func startTestDirectory(t *testing.T, entries []testEntry) *testDirectory {
+	d := &testDirectory{entries: entries}
+
+	server, err := gldap.NewServer()
+	require.NoError(t, err)
+	mux, err := gldap.NewMux()
+	require.NoError(t, err)
+	require.NoError(t, mux.Bind(d.bind))
+	require.NoError(t, mux.Search(d.search))
+	require.NoError(t, mux.Add(d.add))
+	require.NoError(t, mux.Modify(d.modify))
+	require.NoError(t, mux.Delete(d.delete))
+	require.NoError(t, server.Router(mux))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	go func() { _ = server.Run(addr) }()
+	require.Eventually(t, server.Ready, 5*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	d.URL = "ldap://" + addr
+	return d
+}
+
+func (d *testDirectory) bind(w *gldap.ResponseWriter, r *gldap.Request) {
+	code := gldap.ResultInvalidCredentials
+	m, err := r.GetSimpleBindMessage()
+	if err == nil && m.UserName == testBindDN && string(m.Password) == testBindPassword {
+		code = gldap.ResultSuccess
+	}
+	_ = w.Write(r.NewBindResponse(gldap.WithResponseCode(code)))
+}
+
+func (d *testDirectory) search(w *gldap.ResponseWriter, r *gldap.Request) {
+	done := r.NewSearchDoneResponse(gldap.WithResponseCode(gldap.ResultSuccess))
+	defer func() { _ = w.Write(done) }()
+
+	m, err := r.GetSearchMessage()
+	if err != nil {
+		done.SetResultCode(gldap.ResultOperationsError)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.searches = append(d.searches, m)
+
+	if m.Scope == gldap.BaseObject && d.find(m.BaseDN) < 0 {
+		done.SetResultCode(gldap.ResultNoSuchObject)
+		return
+	}
+
+	var matches []testEntry
+	for _, entry := range d.entries {
+		if !inScope(entry.DN, m.BaseDN, m.Scope) {
+			continue
+		}
+		if ok, err := matchFilter(m.Filter, entry); err != nil {
+			done.SetResultCode(gldap.ResultOperationsError)
+			return
+		} else if ok {
+			matches = append(matches, entry)
+		}
+	}
+
+	var paging *gldap.ControlPaging
+	for _, control := range m.Controls {
+		if c, ok := control.(*gldap.ControlPaging); ok {
+			paging = c
+		}
+	}
+
+	start, end := 0, len(matches)
+	if paging != nil && paging.PagingSize > 0 {
+		start, _ = strconv.Atoi(string(paging.Cookie))
+		end = min(start+int(paging.PagingSize), len(matches))
+
+		response := &gldap.ControlPaging{PagingSize: paging.PagingSize}
+		if end < len(matches) {
+			response.Cookie = []byte(strconv.Itoa(end))
+		}
+		done.SetControls(response)
+	}
+
+	for _, entry := range matches[start:end] {
+		attributes := d.selectAttributes(entry, m.Attributes)
+		_ = w.Write(r.NewSearchResponseEntry(entry.DN, gldap.WithAttributes(attributes)))
+	}
+}
+
+// selectAttributes returns the requested attributes of the entry, in ranges if rangeSize is set
+func (d *testDirectory) selectAttributes(entry testEntry, requested []string) map[string][]string {
+	if len(requested) == 0 || slices.Contains(requested, "*") {
+		return entry.Attributes
+	}
+
+	attributes := map[string][]string{}
+	for _, attr := range requested {
+		name, rangeSpec, _ := strings.Cut(attr, ";range=")
+		for key, values := range entry.Attributes {
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+			if d.rangeSize == 0 || (rangeSpec == "" && len(values) <= d.rangeSize) {
+				attributes[key] = values
+				continue
+			}
+
+			first, _, _ := strings.Cut(rangeSpec, "-")
+			start, _ := strconv.Atoi(first)
+			end := min(start+d.rangeSize, len(values))
+			last := strconv.Itoa(end - 1)
+			if end == len(values) {
+				last = "*"
+			}
+			attributes[fmt.Sprintf("%s;range=%d-%s", key, start, last)] = values[start:end]
+		}
+	}
+	return attributes
+}
+
+func (d *testDirectory) add(w *gldap.ResponseWriter, r *gldap.Request) {
+	code := gldap.ResultSuccess
+	defer func() {
+		_ = w.Write(r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationAddResponse), gldap.WithResponseCode(code)))
+	}()
+
+	m, err := r.GetAddMessage()
+	if err != nil {
+		code = gldap.ResultOperationsError
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.find(m.DN) >= 0 {
+		code = gldap.ResultEntryAlreadyExists
+		return
+	}
+	entry := testEntry{DN: m.DN, Attributes: map[string][]string{}}
+	for _, attr := range m.Attributes {
+		entry.Attributes[attr.Type] = attr.Vals
+	}
+	d.entries = append(d.entries, entry)
+}
+
+func (d *testDirectory) modify(w *gldap.ResponseWriter, r *gldap.Request) {
+	code := gldap.ResultSuccess
+	defer func() { _ = w.Write(r.NewModifyResponse(gldap.WithResponseCode(code))) }()
+
+	m, err := r.GetModifyMessage()
+	if err != nil {
+		code = gldap.ResultOperationsError
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := d.find(m.DN)
+	if i < 0 {
+		code = gldap.ResultNoSuchObject
+		return
+	}
+
+	attributes := d.entries[i].Attributes
+	for _, change := range m.Changes {
+		name := change.Modification.Type
+		for key := range attributes {
+			if strings.EqualFold(key, name) {
+				name = key
+			}
+		}
+		values := decodeModifyValues(change.Modification.Vals)
+
+		switch change.Operation {
+		case gldap.AddAttribute:
+			for _, value := range values {
+				if slices.ContainsFunc(attributes[name], equalFold(value)) {
+					code = gldap.ResultAttributeOrValueExists
+					return
+				}
+				attributes[name] = append(attributes[name], value)
+			}
+		case gldap.DeleteAttribute:
+			if _, ok := attributes[name]; !ok {
+				code = gldap.ResultNoSuchAttribute
+				return
+			}
+			if len(values) == 0 {
+				delete(attributes, name)
+				continue
+			}
+			for _, value := range values {
+				if !slices.ContainsFunc(attributes[name], equalFold(value)) {
+					code = gldap.ResultNoSuchAttribute
+					return
+				}
+				attributes[name] = slices.DeleteFunc(attributes[name], equalFold(value))
+			}
+		case gldap.ReplaceAttribute:
+			if len(values) == 0 {
+				delete(attributes, name)
+			} else {
+				attributes[name] = values
+			}
+		}
+	}
+}
+
+func (d *testDirectory) delete(w *gldap.ResponseWriter, r *gldap.Request) {
+	code := gldap.ResultSuccess
+	defer func() {
+		_ = w.Write(r.NewResponse(gldap.WithApplicationCode(gldap.ApplicationDelResponse), gldap.WithResponseCode(code)))
+	}()
+
+	m, err := r.GetDeleteMessage()
+	if err != nil {
+		code = gldap.ResultOperationsError
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := d.find(m.DN)
+	if i < 0 {
+		code = gldap.ResultNoSuchObject
+		return
+	}
+	d.entries = slices.Delete(d.entries, i, i+1)
+}
+
+// find returns the index of the entry with the given DN, or -1. The caller must hold the lock.
+func (d *testDirectory) find(dn string) int {
+	return slices.IndexFunc(d.entries, func(entry testEntry) bool { return strings.EqualFold(entry.DN, dn) })
+}
+
+func (d *testDirectory) entry(dn string) testEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i := d.find(dn); i >= 0 {
+		return d.entries[i]
+	}
+	return testEntry{}
+}
+
+func (d *testDirectory) searchCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.searches)
+}
+
+func (d *testDirectory) lastSearch() *gldap.SearchMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.searches[len(d.searches)-1]
+}
+
+func inScope(dn, baseDN string, scope gldap.Scope) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+	switch scope {
+	case gldap.BaseObject:
+		return dn == baseDN
+	case gldap.SingleLevel:
+		_, parent, _ := strings.Cut(dn, ",")
+		return parent == baseDN
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// matchFilter supports the &, | and ! operators, presence, and equality without wildcards
+func matchFilter(filter string, entry testEntry) (bool, error) {
+	if len(filter) < 2 || filter[0] != '(' || filter[len(filter)-1] != ')' {
+		return false, fmt.Errorf("invalid filter %q", filter)
+	}
+	inner := filter[1 : len(filter)-1]
+
+	switch inner[0] {
+	case '&', '|':
+		parts, err := splitFilters(inner[1:])
+		if err != nil {
+			return false, err
+		}
+		for _, part := range parts {
+			ok, err := matchFilter(part, entry)
+			if err != nil {
+				return false, err
+			}
+			if ok == (inner[0] == '|') {
+				return ok, nil
+			}
+		}
+		return inner[0] == '&', nil
+	case '!':
+		ok, err := matchFilter(inner[1:], entry)
+		return !ok, err
+	}
+
+	attr, value, ok := strings.Cut(inner, "=")
+	if !ok {
+		return false, fmt.Errorf("invalid filter %q", filter)
+	}
+	for key, values := range entry.Attributes {
+		if !strings.EqualFold(key, attr) {
+			continue
+		}
+		if value == "*" {
+			return len(values) > 0, nil
+		}
+		return slices.ContainsFunc(values, equalFold(unescapeFilterValue(value))), nil
+	}
+	return false, nil
+}
+
+func splitFilters(s string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				parts = append(parts, s[start:i+1])
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced filter %q", s)
+	}
+	return parts, nil
+}
+
+func unescapeFilterValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+2 < len(value) {
+			if decoded, err := hex.DecodeString(value[i+1 : i+3]); err == nil {
+				b.Write(decoded)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// decodeModifyValues works around gldap returning the encoded set of values of a modify request, rather than the
+// values themselves
+func decodeModifyValues(vals []string) []string {
+	var values []string
+	for _, val := range vals {
+		r := bytes.NewReader([]byte(val))
+		for r.Len() > 0 {
+			packet, err := ber.ReadPacket(r)
+			if err != nil {
+				break
+			}
+			values = append(values, packet.Data.String())
+		}
+	}
+	return values
+}
+
+func equalFold(s string) func(string) bool {
+	return func(v string) bool { return strings.EqualFold(s, v) }
+}
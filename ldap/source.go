@@ -0,0 +1,88 @@
+package ldap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// LDAPSource reads people from an LDAP directory
+type LDAPSource struct {
+	Connection
+
+	// SourceSyncSet holds the defaults for each sync set
+	SourceSyncSet
+
+	PageSize            uint32 // number of entries requested at a time, default 500, or 0 to use the default
+	MultiValueSeparator string // separates the values of multi-valued attributes, default "|"
+
+	SourceConfig internal.SourceConfig `json:"-"`
+	SyncSet      SourceSyncSet         `json:"-"`
+}
+
+// SourceSyncSet configures the search for a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type SourceSyncSet struct {
+	Search
+}
+
+// NewLDAPSource unmarshals the sourceConfig's ExtraJSON into an LDAPSource struct. No connection is made until
+// ListUsers is called.
+func NewLDAPSource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var l LDAPSource
+	if err := json.Unmarshal(sourceConfig.ExtraJSON, &l); err != nil {
+		return nil, fmt.Errorf("error reading LDAP source config: %w", err)
+	}
+
+	if err := l.Connection.validate(); err != nil {
+		return nil, fmt.Errorf("invalid LDAP source config: %w", err)
+	}
+	if l.PageSize == 0 {
+		l.PageSize = DefaultPageSize
+	}
+	if l.MultiValueSeparator == "" {
+		l.MultiValueSeparator = DefaultMultiValueSeparator
+	}
+
+	l.SourceConfig = sourceConfig
+	return &l, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (l *LDAPSource) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := l.SourceSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := syncSet.validate(); err != nil {
+		return err
+	}
+
+	l.SyncSet = syncSet
+	return nil
+}
+
+// ListUsers searches the directory, one page at a time, and returns a person for each entry found
+func (l *LDAPSource) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	conn, closeConn, err := l.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	search := l.SyncSet.Search
+	entries, err := l.search(ctx, conn, search, "", search.attributes(desiredAttrs...), l.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	people := make([]internal.Person, 0, len(entries))
+	for _, entry := range entries {
+		people = append(people, entryToPerson(entry, desiredAttrs, search.CompareAttribute, l.MultiValueSeparator))
+	}
+	return people, nil
+}
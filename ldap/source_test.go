@@ -0,0 +1,216 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func testPeopleEntries() []testEntry {
+	return []testEntry{
+		{
+			DN: "uid=ann,ou=people,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass": {"top", "person", "inetOrgPerson"},
+				"uid":         {"ann"},
+				"mail":        {"ann@example.org"},
+				"cn":          {"Ann"},
+				"ou":          {"Finance", "IT"},
+			},
+		},
+		{
+			DN: "uid=bob,ou=people,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass": {"top", "person", "inetOrgPerson"},
+				"uid":         {"bob"},
+				"mail":        {"bob@example.org"},
+			},
+		},
+		{
+			DN: "uid=cat,ou=people,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass": {"top", "person", "inetOrgPerson"},
+				"uid":         {"cat"},
+				"mail":        {"cat@example.org"},
+				"cn":          {"Cat"},
+			},
+		},
+		{
+			DN: "cn=staff,ou=groups,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass": {"top", "groupOfNames"},
+				"cn":          {"staff"},
+				"member":      {"uid=ann,ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org"},
+			},
+		},
+	}
+}
+
+func newTestLDAPSource(t *testing.T, extraJSON string) *LDAPSource {
+	source, err := NewLDAPSource(internal.SourceConfig{Type: internal.SourceTypeLDAP, ExtraJSON: []byte(extraJSON)})
+	require.NoError(t, err)
+	return source.(*LDAPSource)
+}
+
+func TestLDAPSource_ListUsers(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+
+	l := newTestLDAPSource(t, `{"URL": "`+directory.URL+`", "BindDN": "`+testBindDN+`",
+		"BindPassword": "`+testBindPassword+`", "PageSize": 2, "CompareAttribute": "mail"}`)
+	require.NoError(t, l.ForSet([]byte(`{"BaseDN": "ou=people,dc=example,dc=org", "Filter": "(uid=*)"}`)))
+
+	got, err := l.ListUsers(context.Background(), []string{"dn", "mail", "cn", "OU"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{
+			CompareValue: "ann@example.org",
+			Attributes: map[string]string{
+				"dn":   "uid=ann,ou=people,dc=example,dc=org",
+				"mail": "ann@example.org",
+				"cn":   "Ann",
+				"OU":   "Finance|IT",
+			},
+		},
+		{
+			CompareValue: "bob@example.org",
+			Attributes:   map[string]string{"dn": "uid=bob,ou=people,dc=example,dc=org", "mail": "bob@example.org"},
+		},
+		{
+			CompareValue: "cat@example.org",
+			Attributes: map[string]string{
+				"dn":   "uid=cat,ou=people,dc=example,dc=org",
+				"mail": "cat@example.org",
+				"cn":   "Cat",
+			},
+		},
+	}, got)
+
+	require.Equal(t, 2, directory.searchCount(), "expected two pages")
+	search := directory.lastSearch()
+	require.Equal(t, "(uid=*)", search.Filter)
+	require.ElementsMatch(t, []string{"mail", "cn", "OU"}, search.Attributes)
+}
+
+func TestLDAPSource_ListUsers_separator(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+
+	l := newTestLDAPSource(t, `{"URL": "`+directory.URL+`", "BindDN": "`+testBindDN+`",
+		"BindPassword": "`+testBindPassword+`", "MultiValueSeparator": ";", "BaseDN": "dc=example,dc=org",
+		"CompareAttribute": "dn"}`)
+	require.NoError(t, l.ForSet(nil))
+
+	got, err := l.ListUsers(context.Background(), []string{"ou"})
+	require.NoError(t, err)
+	require.Len(t, got, 3, "the group should not match the default filter")
+	require.Equal(t, "uid=ann,ou=people,dc=example,dc=org", got[0].CompareValue)
+	require.Equal(t, map[string]string{"ou": "Finance;IT"}, got[0].Attributes)
+	require.Equal(t, 1, directory.searchCount())
+	require.Equal(t, DefaultFilter, directory.lastSearch().Filter)
+}
+
+func TestLDAPSource_ListUsers_badCredentials(t *testing.T) {
+	directory := startTestDirectory(t, testPeopleEntries())
+
+	l := newTestLDAPSource(t, `{"URL": "`+directory.URL+`", "BindDN": "`+testBindDN+`",
+		"BindPassword": "wrong", "BaseDN": "dc=example,dc=org", "CompareAttribute": "mail"}`)
+	require.NoError(t, l.ForSet(nil))
+
+	_, err := l.ListUsers(context.Background(), []string{"mail"})
+	require.ErrorContains(t, err, "unable to bind")
+	require.Equal(t, 0, directory.searchCount())
+}
+
+func TestLDAPSource_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "valid",
+			syncSet: `{"BaseDN": "ou=people,dc=example,dc=org", "Filter": "(&(objectClass=person)(mail=*))", "Scope": "one"}`,
+		},
+		{
+			name:       "no base DN",
+			syncSet:    `{}`,
+			wantErrMsg: "BaseDN is required",
+		},
+		{
+			name:       "invalid base DN",
+			syncSet:    `{"BaseDN": "example.org"}`,
+			wantErrMsg: "invalid BaseDN",
+		},
+		{
+			name:       "invalid filter",
+			syncSet:    `{"BaseDN": "dc=example,dc=org", "Filter": "mail=*"}`,
+			wantErrMsg: "invalid Filter",
+		},
+		{
+			name:       "invalid scope",
+			syncSet:    `{"BaseDN": "dc=example,dc=org", "Scope": "children"}`,
+			wantErrMsg: "invalid Scope",
+		},
+		{
+			name:       "no compare attribute",
+			syncSet:    `{"BaseDN": "dc=example,dc=org", "CompareAttribute": ""}`,
+			wantErrMsg: "CompareAttribute is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLDAPSource(t, `{"URL": "ldap://localhost", "CompareAttribute": "mail"}`)
+			err := l.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewLDAPSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		wantErrMsg string
+	}{
+		{
+			name:      "valid",
+			extraJSON: `{"URL": "ldaps://ldap.example.org", "BindDN": "cn=admin,dc=example,dc=org", "BindPassword": "x"}`,
+		},
+		{
+			name:       "no URL",
+			extraJSON:  `{}`,
+			wantErrMsg: "URL is required",
+		},
+		{
+			name:       "wrong scheme",
+			extraJSON:  `{"URL": "https://ldap.example.org"}`,
+			wantErrMsg: "the scheme must be",
+		},
+		{
+			name:       "StartTLS with ldaps",
+			extraJSON:  `{"URL": "ldaps://ldap.example.org", "StartTLS": true}`,
+			wantErrMsg: "StartTLS can only be used",
+		},
+		{
+			name:       "no password",
+			extraJSON:  `{"URL": "ldap://ldap.example.org", "BindDN": "cn=admin,dc=example,dc=org"}`,
+			wantErrMsg: "BindPassword is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLDAPSource(internal.SourceConfig{ExtraJSON: []byte(tt.extraJSON)})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package personnel_sync
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	ListFormatJSON = "json"
+	ListFormatCSV  = "csv"
+)
+
+// SyncSetPeople is the list of people found in a source or destination for one sync set
+type SyncSetPeople struct {
+	Name   string
+	People []internal.Person
+}
+
+// ListSource writes the people returned by the source for each enabled sync set, in JSON or CSV format. The
+// attributes are those named in the AttributeMap, before they are mapped to destination attributes.
+func ListSource(ctx context.Context, configFile string, options Options, format string, w io.Writer) error {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	source, err := newSource(config)
+	if err != nil {
+		return fmt.Errorf("%w: unable to initialize %s source: %w", ErrConfig, config.Source.Type, err)
+	}
+
+	return listPeople(config, options, format, w, func(syncSet internal.SyncSet) ([]internal.Person, error) {
+		if err := source.ForSet(syncSet.Source); err != nil {
+			return nil, fmt.Errorf(`error setting source set on syncSet "%s": %w`, syncSet.Name, err)
+		}
+		return source.ListUsers(ctx, internal.GetSourceAttributes(config.AttributeMap))
+	})
+}
+
+// ListDestination writes the people returned by the destination for each enabled sync set, in JSON or CSV format
+func ListDestination(ctx context.Context, configFile string, options Options, format string, w io.Writer) error {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	destination, err := newDestination(config)
+	if err != nil {
+		return fmt.Errorf("%w: unable to initialize %s destination: %w", ErrConfig, config.Destination.Type, err)
+	}
+
+	return listPeople(config, options, format, w, func(syncSet internal.SyncSet) ([]internal.Person, error) {
+		if err := destination.ForSet(syncSet.Destination); err != nil {
+			return nil, fmt.Errorf(`error setting destination set on syncSet "%s": %w`, syncSet.Name, err)
+		}
+		return destination.ListUsers(ctx, internal.GetDestinationAttributes(config.AttributeMap))
+	})
+}
+
+func listPeople(
+	config internal.Config,
+	options Options,
+	format string,
+	w io.Writer,
+	list func(syncSet internal.SyncSet) ([]internal.Person, error),
+) error {
+	if format != "" && format != ListFormatJSON && format != ListFormatCSV {
+		return fmt.Errorf("invalid format %q, must be %s or %s", format, ListFormatJSON, ListFormatCSV)
+	}
+
+	if err := options.applyTo(&config); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+
+	var sets []SyncSetPeople
+	for _, syncSet := range config.SyncSets {
+		if syncSet.Disable {
+			continue
+		}
+
+		people, err := list(syncSet)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, SyncSetPeople{Name: syncSet.Name, People: people})
+	}
+
+	if format == ListFormatCSV {
+		return writePeopleCSV(w, sets)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sets)
+}
+
+// writePeopleCSV writes a row for each person, with a column for each attribute found on any of them
+func writePeopleCSV(w io.Writer, sets []SyncSetPeople) error {
+	var columns []string
+	for _, set := range sets {
+		for _, person := range set.People {
+			for key := range person.Attributes {
+				columns = internal.AddStringToSlice(key, columns)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"SyncSet", "CompareValue", "ID"}, columns...)); err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		for _, person := range set.People {
+			row := []string{set.Name, person.CompareValue, person.ID}
+			for _, column := range columns {
+				row = append(row, person.Attributes[column])
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,205 @@
+package okta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DefaultHttpTimeoutSeconds = 45
+	DefaultPageSize           = 200
+)
+
+// nextLink matches the URL of the next page in a Link header
+var nextLink = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="next"`)
+
+// Client holds the settings for calling the Okta management API
+type Client struct {
+	OrgURL             string // such as https://example.okta.com
+	APIToken           string
+	HttpTimeoutSeconds int // default 45
+	PageSize           int // number of users requested at a time, default 200
+
+	httpClient *http.Client
+}
+
+// Error is an error response from Okta
+type Error struct {
+	Status  int
+	Code    string
+	Summary string
+	Causes  []string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("Okta error %d", e.Status)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Summary != "" {
+		msg += ": " + e.Summary
+	}
+	if len(e.Causes) > 0 {
+		msg += ": " + strings.Join(e.Causes, "; ")
+	}
+	return msg
+}
+
+// HTTPStatus returns the status of the error response
+func (e *Error) HTTPStatus() int {
+	return e.Status
+}
+
+func (c *Client) validate() error {
+	if c.OrgURL == "" {
+		return errors.New("OrgURL is required")
+	}
+	u, err := url.Parse(c.OrgURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid OrgURL %q", c.OrgURL)
+	}
+	c.OrgURL = strings.TrimSuffix(c.OrgURL, "/")
+
+	if c.APIToken == "" {
+		return errors.New("APIToken is required")
+	}
+	if c.HttpTimeoutSeconds <= 0 {
+		c.HttpTimeoutSeconds = DefaultHttpTimeoutSeconds
+	}
+	if c.PageSize <= 0 {
+		c.PageSize = DefaultPageSize
+	}
+	return nil
+}
+
+// list returns all objects at the path, following the next link in the Link header of each page
+func (c *Client) list(ctx context.Context, path string, query url.Values) ([]map[string]any, error) {
+	var objects []map[string]any
+	query.Set("limit", strconv.Itoa(c.PageSize))
+	requestURL := c.OrgURL + path + "?" + query.Encode()
+	for requestURL != "" {
+		var page []map[string]any
+		header, err := c.do(ctx, http.MethodGet, requestURL, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, page...)
+
+		requestURL = ""
+		for _, link := range header.Values("Link") {
+			if match := nextLink.FindStringSubmatch(link); match != nil {
+				requestURL = match[1]
+			}
+		}
+	}
+	return objects, nil
+}
+
+// do sends a request to the path, or to a URL returned by Okta, and decodes the response into out, if it is not nil.
+// A request is retried if Okta responds with 429 Too Many Requests or 503 Service Unavailable, after the time given
+// in any X-Rate-Limit-Reset header.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) (http.Header, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("unable to encode the request to %s: %w", path, err)
+		}
+	}
+
+	requestURL := path
+	if !strings.HasPrefix(path, c.OrgURL+"/") {
+		requestURL = c.OrgURL + path
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "SSWS "+c.APIToken)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.client().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the response to %s %s: %w", method, path, err)
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if retryable && attempt < internal.MaxRetries {
+			if err := internal.Sleep(ctx, retryDelay(resp.Header.Get("X-Rate-Limit-Reset"), attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, newError(resp.StatusCode, responseBody)
+		}
+		if out != nil && len(responseBody) > 0 {
+			if err := json.Unmarshal(responseBody, out); err != nil {
+				return nil, fmt.Errorf("unable to decode the response to %s %s: %w", method, path, err)
+			}
+		}
+		return resp.Header, nil
+	}
+}
+
+func (c *Client) client() *http.Client {
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: time.Duration(c.HttpTimeoutSeconds) * time.Second}
+	}
+	return c.httpClient
+}
+
+func newError(status int, body []byte) *Error {
+	e := &Error{Status: status}
+	var response struct {
+		ErrorCode    string
+		ErrorSummary string
+		ErrorCauses  []struct{ ErrorSummary string }
+	}
+	if json.Unmarshal(body, &response) == nil {
+		e.Code = response.ErrorCode
+		e.Summary = response.ErrorSummary
+		for _, cause := range response.ErrorCauses {
+			e.Causes = append(e.Causes, cause.ErrorSummary)
+		}
+	}
+	if e.Code == "" && e.Summary == "" {
+		e.Summary = strings.TrimSpace(string(body))
+		if len(e.Summary) > 200 {
+			e.Summary = e.Summary[:200]
+		}
+	}
+	return e
+}
+
+// retryDelay returns the time until the rate limit is reset, given in seconds since the epoch in an
+// X-Rate-Limit-Reset header, or internal.Backoff if there is none
+func retryDelay(rateLimitReset string, attempt int) time.Duration {
+	if seconds, err := strconv.ParseInt(rateLimitReset, 10, 64); err == nil {
+		return min(max(time.Until(time.Unix(seconds, 0)), 0), internal.MaxRetryDelay)
+	}
+	return internal.Backoff(attempt)
+}
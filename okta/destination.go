@@ -0,0 +1,520 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	CreateStatusActive = "Active"
+	CreateStatusStaged = "Staged"
+
+	DeleteActionDeactivate = "Deactivate"
+	DeleteActionSuspend    = "Suspend"
+
+	DefaultCompareAttribute = "login"
+
+	// MultiValueSeparator separates the values of an array profile attribute
+	MultiValueSeparator = "|"
+
+	statusDeprovisioned = "DEPROVISIONED"
+	statusSuspended     = "SUSPENDED"
+)
+
+// OktaDestination manages the users of an Okta org, and optionally the members of a group
+type OktaDestination struct {
+	Client
+
+	// DestinationSyncSet holds the defaults for each sync set
+	DestinationSyncSet
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           DestinationSyncSet         `json:"-"`
+
+	groupID string
+}
+
+// DestinationSyncSet configures a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type DestinationSyncSet struct {
+	Search           string // an Okta search expression that selects the users to sync
+	CompareAttribute string // the profile attribute that identifies a user, default "login"
+	CreateStatus     string // "Active" (default) or "Staged"
+	DeleteAction     string // "Deactivate" (default) or "Suspend"
+
+	// GroupID or GroupName identifies a group whose members are synced. Users are created and updated as needed,
+	// but deleted people are only removed from the group.
+	GroupID      string
+	GroupName    string
+	ExtraMembers []string // compare values of group members that are never removed
+}
+
+type user struct {
+	ID      string         `json:"id,omitempty"`
+	Status  string         `json:"status,omitempty"`
+	Profile map[string]any `json:"profile"`
+}
+
+// NewOktaDestination unmarshals the destinationConfig's ExtraJSON into an OktaDestination struct. No requests are
+// made until ListUsers or ApplyChangeSet is called.
+func NewOktaDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var o OktaDestination
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &o); err != nil {
+		return nil, fmt.Errorf("error reading Okta destination config: %w", err)
+	}
+
+	if err := o.Client.validate(); err != nil {
+		return nil, fmt.Errorf("invalid Okta destination config: %w", err)
+	}
+
+	o.DestinationConfig = destinationConfig
+	return &o, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (o *OktaDestination) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := o.DestinationSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := syncSet.validate(); err != nil {
+		return err
+	}
+
+	o.SyncSet = syncSet
+	o.groupID = syncSet.GroupID
+	return nil
+}
+
+func (s *DestinationSyncSet) validate() error {
+	if s.CompareAttribute == "" {
+		s.CompareAttribute = DefaultCompareAttribute
+	}
+	switch s.CreateStatus {
+	case "":
+		s.CreateStatus = CreateStatusActive
+	case CreateStatusActive, CreateStatusStaged:
+	default:
+		return fmt.Errorf("invalid CreateStatus %q, must be %s or %s", s.CreateStatus,
+			CreateStatusActive, CreateStatusStaged)
+	}
+	switch s.DeleteAction {
+	case "":
+		s.DeleteAction = DeleteActionDeactivate
+	case DeleteActionDeactivate, DeleteActionSuspend:
+	default:
+		return fmt.Errorf("invalid DeleteAction %q, must be %s or %s", s.DeleteAction,
+			DeleteActionDeactivate, DeleteActionSuspend)
+	}
+	if s.GroupID != "" && s.GroupName != "" {
+		return errors.New("only one of GroupID and GroupName may be set")
+	}
+	if s.Search != "" && (s.GroupID != "" || s.GroupName != "") {
+		return errors.New("Search may not be used with a group")
+	}
+	return nil
+}
+
+// ListUsers returns the users that match the Search or, if a group is set, the members of the group. Deactivated
+// users are not included, nor are suspended users if the DeleteAction is Suspend and no group is set. The ID of each
+// person is the user's id, and the attributes are profile attributes.
+func (o *OktaDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	path := "/api/v1/users"
+	query := url.Values{}
+	if o.grouped() {
+		groupID, err := o.resolveGroupID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		path = "/api/v1/groups/" + url.PathEscape(groupID) + "/users"
+	} else if o.SyncSet.Search != "" {
+		query.Set("search", o.SyncSet.Search)
+	}
+
+	objects, err := o.list(ctx, path, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+
+	people := []internal.Person{}
+	for _, object := range objects {
+		u := toUser(object)
+		if u.Status == statusDeprovisioned ||
+			(u.Status == statusSuspended && !o.grouped() && o.SyncSet.DeleteAction == DeleteActionSuspend) {
+			continue
+		}
+
+		compareValue := formatValue(u.Profile[o.SyncSet.CompareAttribute])
+		if compareValue == "" || slices.Contains(o.SyncSet.ExtraMembers, compareValue) {
+			continue
+		}
+
+		attributes := map[string]string{}
+		for _, attr := range desiredAttrs {
+			attributes[attr] = formatValue(u.Profile[attr])
+		}
+		people = append(people, internal.Person{CompareValue: compareValue, ID: u.ID, Attributes: attributes})
+	}
+	return people, nil
+}
+
+// ApplyChangeSet creates, updates, and deactivates or suspends users. If a group is set, people are added to and
+// removed from the group rather than deactivated or suspended.
+func (o *OktaDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	var results internal.ChangeResults
+	if internal.Stopping(ctx) {
+		return results
+	}
+
+	if o.grouped() {
+		if _, err := o.resolveGroupID(ctx); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:   syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to apply changes to %s: %s", o.OrgURL, err),
+			}
+			return results
+		}
+	}
+
+	if !o.DestinationConfig.DisableAdd {
+		for _, person := range changes.Create {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if o.addPerson(ctx, person, eventLog) {
+				results.Created++
+			}
+		}
+	}
+
+	if !o.DestinationConfig.DisableUpdate {
+		for _, person := range changes.Update {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if o.updatePerson(ctx, person, eventLog) {
+				results.Updated++
+			}
+		}
+	}
+
+	if !o.DestinationConfig.DisableDelete {
+		for _, person := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if o.deletePerson(ctx, person, eventLog) {
+				results.Deleted++
+			}
+		}
+	}
+
+	return results
+}
+
+// addPerson creates the person's user, or activates it if it is deactivated or suspended, and adds it to the group
+func (o *OktaDestination) addPerson(
+	ctx context.Context,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	u, err := o.findUser(ctx, person.CompareValue)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to find", person, err)
+		return false
+	}
+
+	switch {
+	case u == nil:
+		if u, err = o.createUser(ctx, person); err != nil {
+			eventLog <- internal.ErrorEvent("unable to create", person, err)
+			return false
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddPerson " + person.CompareValue}
+	case u.Status == statusDeprovisioned || u.Status == statusSuspended:
+		if err := o.activateUser(ctx, *u, person); err != nil {
+			eventLog <- internal.ErrorEvent("unable to activate", person, err)
+			return false
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "ActivatePerson " + person.CompareValue}
+	case !o.grouped():
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_WARNING,
+			Message: fmt.Sprintf("unable to add %s, a user already exists that does not match the Search", person.CompareValue),
+		}
+		return false
+	}
+
+	if !o.grouped() {
+		return true
+	}
+
+	_, err = o.do(ctx, http.MethodPut, o.memberPath(u.ID), nil, nil)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to add %s to group %s: %s", person.CompareValue, o.groupName(), err),
+		}
+		return false
+	}
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddMember " + person.CompareValue}
+	return true
+}
+
+// updatePerson sends a partial profile update with the changed attributes. An empty value is set to null.
+func (o *OktaDestination) updatePerson(
+	ctx context.Context,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	id, err := o.personID(ctx, person)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to update", person, err)
+		return false
+	}
+
+	changes := person.Changes
+	if len(changes) == 0 {
+		for attr, value := range person.Attributes {
+			changes = append(changes, internal.AttributeChange{Attribute: attr, New: value})
+		}
+	}
+
+	profile := map[string]any{}
+	for _, change := range changes {
+		profile[change.Attribute] = profileValue(change.New)
+	}
+	if err := o.updateProfile(ctx, id, profile); err != nil {
+		eventLog <- internal.ErrorEvent("unable to update", person, err)
+		return false
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdatePerson %s, changed: %s", person.CompareValue,
+			strings.Join(person.ChangedAttributeNames(), ", ")),
+	}
+	return true
+}
+
+// deletePerson removes the person from the group or, without a group, deactivates or suspends the person's user
+func (o *OktaDestination) deletePerson(
+	ctx context.Context,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	id, err := o.personID(ctx, person)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to delete", person, err)
+		return false
+	}
+
+	var message string
+	switch {
+	case o.grouped():
+		_, err = o.do(ctx, http.MethodDelete, o.memberPath(id), nil, nil)
+		if internal.IsStatus(err, http.StatusNotFound) {
+			err = nil
+		}
+		message = "RemoveMember "
+	case o.SyncSet.DeleteAction == DeleteActionSuspend:
+		_, err = o.do(ctx, http.MethodPost, o.lifecyclePath(id, "suspend", nil), nil, nil)
+		message = "SuspendPerson "
+	default:
+		query := url.Values{"sendEmail": {"false"}}
+		_, err = o.do(ctx, http.MethodPost, o.lifecyclePath(id, "deactivate", query), nil, nil)
+		message = "DeactivatePerson "
+	}
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to delete", person, err)
+		return false
+	}
+
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: message + person.CompareValue}
+	return true
+}
+
+// createUser creates a user with the person's attributes, activated or staged according to the CreateStatus
+func (o *OktaDestination) createUser(ctx context.Context, person internal.Person) (*user, error) {
+	profile := map[string]any{}
+	for attr, value := range person.Attributes {
+		if value != "" {
+			profile[attr] = value
+		}
+	}
+	profile[o.SyncSet.CompareAttribute] = person.CompareValue
+
+	query := url.Values{"activate": {strconv.FormatBool(o.SyncSet.CreateStatus == CreateStatusActive)}}
+	var created user
+	_, err := o.do(ctx, http.MethodPost, "/api/v1/users?"+query.Encode(), user{Profile: profile}, &created)
+	if err != nil {
+		return nil, err
+	}
+	if created.ID == "" {
+		return nil, errors.New("no id in the response")
+	}
+	return &created, nil
+}
+
+// activateUser activates a deactivated user, or unsuspends a suspended user, and updates its profile with the
+// person's attributes
+func (o *OktaDestination) activateUser(ctx context.Context, u user, person internal.Person) error {
+	path := o.lifecyclePath(u.ID, "activate", url.Values{"sendEmail": {"false"}})
+	if u.Status == statusSuspended {
+		path = o.lifecyclePath(u.ID, "unsuspend", nil)
+	}
+	if _, err := o.do(ctx, http.MethodPost, path, nil, nil); err != nil {
+		return err
+	}
+
+	profile := map[string]any{}
+	for attr, value := range person.Attributes {
+		profile[attr] = profileValue(value)
+	}
+	return o.updateProfile(ctx, u.ID, profile)
+}
+
+// updateProfile sends a partial update of the user's profile, which leaves attributes that are not in it unchanged
+func (o *OktaDestination) updateProfile(ctx context.Context, id string, profile map[string]any) error {
+	if len(profile) == 0 {
+		return nil
+	}
+	_, err := o.do(ctx, http.MethodPost, "/api/v1/users/"+url.PathEscape(id), user{Profile: profile}, nil)
+	return err
+}
+
+// findUser returns the user with the given compare value, in any status, or nil if there is none. The Search is not
+// applied, so that an existing user is found even if it no longer matches.
+func (o *OktaDestination) findUser(ctx context.Context, compareValue string) (*user, error) {
+	value, _ := json.Marshal(compareValue)
+	query := url.Values{"search": {fmt.Sprintf("profile.%s eq %s", o.SyncSet.CompareAttribute, value)}}
+	objects, err := o.list(ctx, "/api/v1/users", query)
+	if err != nil {
+		return nil, err
+	}
+	switch len(objects) {
+	case 0:
+		return nil, nil
+	case 1:
+		u := toUser(objects[0])
+		return &u, nil
+	default:
+		return nil, fmt.Errorf("%d users have %s %s", len(objects), o.SyncSet.CompareAttribute, compareValue)
+	}
+}
+
+// personID returns the id of the person's user, from the ID set by ListUsers if possible
+func (o *OktaDestination) personID(ctx context.Context, person internal.Person) (string, error) {
+	if person.ID != "" {
+		return person.ID, nil
+	}
+	u, err := o.findUser(ctx, person.CompareValue)
+	if err != nil {
+		return "", err
+	}
+	if u == nil {
+		return "", errors.New("user not found")
+	}
+	return u.ID, nil
+}
+
+// resolveGroupID finds the id of the group named by GroupName, if the GroupID is not set
+func (o *OktaDestination) resolveGroupID(ctx context.Context) (string, error) {
+	if o.groupID != "" {
+		return o.groupID, nil
+	}
+
+	// q finds groups whose name starts with the query, so the exact name is matched here
+	groups, err := o.list(ctx, "/api/v1/groups", url.Values{"q": {o.SyncSet.GroupName}})
+	if err != nil {
+		return "", fmt.Errorf("unable to find group %s: %w", o.groupName(), err)
+	}
+	var ids []string
+	for _, group := range groups {
+		profile, _ := group["profile"].(map[string]any)
+		if name, _ := profile["name"].(string); strings.EqualFold(name, o.SyncSet.GroupName) {
+			id, _ := group["id"].(string)
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) != 1 || ids[0] == "" {
+		return "", fmt.Errorf("found %d groups named %s", len(ids), o.groupName())
+	}
+	o.groupID = ids[0]
+	return o.groupID, nil
+}
+
+func (o *OktaDestination) memberPath(userID string) string {
+	return "/api/v1/groups/" + url.PathEscape(o.groupID) + "/users/" + url.PathEscape(userID)
+}
+
+func (o *OktaDestination) lifecyclePath(userID, operation string, query url.Values) string {
+	path := "/api/v1/users/" + url.PathEscape(userID) + "/lifecycle/" + operation
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
+func (o *OktaDestination) grouped() bool {
+	return o.SyncSet.GroupID != "" || o.SyncSet.GroupName != ""
+}
+
+func (o *OktaDestination) groupName() string {
+	if o.SyncSet.GroupName != "" {
+		return o.SyncSet.GroupName
+	}
+	return o.SyncSet.GroupID
+}
+
+func toUser(object map[string]any) user {
+	u := user{}
+	u.ID, _ = object["id"].(string)
+	u.Status, _ = object["status"].(string)
+	u.Profile, _ = object["profile"].(map[string]any)
+	return u
+}
+
+// formatValue returns a profile attribute value as a string. The values of an array are joined with the
+// MultiValueSeparator.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = formatValue(item)
+		}
+		return strings.Join(values, MultiValueSeparator)
+	}
+	return ""
+}
+
+// profileValue returns the value of a profile attribute in an update, which is null for an empty value
+func profileValue(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
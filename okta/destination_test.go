@@ -0,0 +1,334 @@
+package okta
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestOktaDestination(t *testing.T, service *testService, extraJSON, syncSet string) *OktaDestination {
+	config := `{"OrgURL": "` + service.URL + `/", "APIToken": "` + testAPIToken + `", "PageSize": 2`
+	if extraJSON != "" {
+		config += ", " + extraJSON
+	}
+	config += "}"
+
+	destination, err := NewOktaDestination(internal.DestinationConfig{
+		Type:      internal.DestinationTypeOkta,
+		ExtraJSON: []byte(config),
+	})
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*OktaDestination)
+}
+
+func applyTestChanges(
+	t *testing.T,
+	o *OktaDestination,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := o.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+func TestNewOktaDestination(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		want       Client
+		wantErrMsg string
+	}{
+		{
+			name:      "defaults",
+			extraJSON: `{"OrgURL": "https://example.okta.com/", "APIToken": "abc"}`,
+			want: Client{
+				OrgURL:             "https://example.okta.com",
+				APIToken:           "abc",
+				HttpTimeoutSeconds: DefaultHttpTimeoutSeconds,
+				PageSize:           DefaultPageSize,
+			},
+		},
+		{
+			name:       "no OrgURL",
+			extraJSON:  `{"APIToken": "abc"}`,
+			wantErrMsg: "OrgURL is required",
+		},
+		{
+			name:       "invalid OrgURL",
+			extraJSON:  `{"OrgURL": "example.okta.com", "APIToken": "abc"}`,
+			wantErrMsg: "invalid OrgURL",
+		},
+		{
+			name:       "no APIToken",
+			extraJSON:  `{"OrgURL": "https://example.okta.com"}`,
+			wantErrMsg: "APIToken is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewOktaDestination(internal.DestinationConfig{ExtraJSON: []byte(tt.extraJSON)})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, destination.(*OktaDestination).Client)
+		})
+	}
+}
+
+func TestOktaDestination_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		want       DestinationSyncSet
+		wantErrMsg string
+	}{
+		{
+			name:    "defaults from ExtraJSON",
+			syncSet: `{"GroupName": "Staff"}`,
+			want: DestinationSyncSet{
+				CompareAttribute: "email",
+				CreateStatus:     CreateStatusStaged,
+				DeleteAction:     DeleteActionDeactivate,
+				GroupName:        "Staff",
+			},
+		},
+		{
+			name:       "invalid CreateStatus",
+			syncSet:    `{"CreateStatus": "Provisioned"}`,
+			wantErrMsg: "invalid CreateStatus",
+		},
+		{
+			name:       "invalid DeleteAction",
+			syncSet:    `{"DeleteAction": "Delete"}`,
+			wantErrMsg: "invalid DeleteAction",
+		},
+		{
+			name:       "two groups",
+			syncSet:    `{"GroupID": "g1", "GroupName": "Staff"}`,
+			wantErrMsg: "only one of GroupID and GroupName",
+		},
+		{
+			name:       "Search with a group",
+			syncSet:    `{"GroupID": "g1", "Search": "status eq \"ACTIVE\""}`,
+			wantErrMsg: "Search may not be used with a group",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewOktaDestination(internal.DestinationConfig{ExtraJSON: []byte(
+				`{"OrgURL": "https://example.okta.com", "APIToken": "abc", "CompareAttribute": "email",
+					"CreateStatus": "Staged"}`,
+			)})
+			require.NoError(t, err)
+			err = destination.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, destination.(*OktaDestination).SyncSet)
+		})
+	}
+}
+
+func TestOktaDestination_ListUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		syncSet string
+		want    []string
+	}{
+		{
+			name:    "active, suspended, and staged users",
+			syncSet: `{}`,
+			want:    []string{"ann@example.org", "bob@example.org", "dan@example.org", "eve@example.org"},
+		},
+		{
+			name:    "suspended users are deleted",
+			syncSet: `{"DeleteAction": "Suspend"}`,
+			want:    []string{"ann@example.org", "bob@example.org", "eve@example.org"},
+		},
+		{
+			name:    "search",
+			syncSet: `{"Search": "profile.department eq \"IT\""}`,
+			want:    []string{"ann@example.org"},
+		},
+		{
+			name:    "group",
+			syncSet: `{"GroupName": "staff"}`,
+			want:    []string{"ann@example.org", "bob@example.org"},
+		},
+		{
+			name:    "group with ExtraMembers",
+			syncSet: `{"GroupID": "g1", "ExtraMembers": ["bob@example.org"]}`,
+			want:    []string{"ann@example.org"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := startTestService(t, testUsers(), testGroups())
+			service.busy(1)
+			o := newTestOktaDestination(t, service, "", tt.syncSet)
+
+			people, err := o.ListUsers(context.Background(), []string{"firstName", "department", "roles", "title"})
+			require.NoError(t, err)
+
+			var compareValues []string
+			for _, person := range people {
+				compareValues = append(compareValues, person.CompareValue)
+			}
+			require.Equal(t, tt.want, compareValues)
+			require.Equal(t, internal.Person{
+				CompareValue: "ann@example.org",
+				ID:           "1",
+				Attributes: map[string]string{
+					"firstName":  "Ann",
+					"department": "IT",
+					"roles":      "admin|staff",
+					"title":      "",
+				},
+			}, people[0])
+		})
+	}
+}
+
+func TestOktaDestination_ApplyChangeSet(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	o := newTestOktaDestination(t, service, "", `{}`)
+
+	results, messages := applyTestChanges(t, o, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "fay@example.org", Attributes: map[string]string{"firstName": "Fay", "title": ""}},
+			{CompareValue: "cat@example.org", Attributes: map[string]string{"firstName": "Catherine"}},
+			{CompareValue: "ann@example.org", Attributes: map[string]string{"firstName": "Ann"}},
+		},
+		Update: []internal.Person{
+			{
+				CompareValue: "bob@example.org",
+				Attributes:   map[string]string{"firstName": "Robert", "department": ""},
+				Changes: []internal.AttributeChange{
+					{Attribute: "firstName", Old: "Bob", New: "Robert"},
+					{Attribute: "department", Old: "Sales", New: ""},
+				},
+			},
+		},
+		Delete: []internal.Person{{CompareValue: "eve@example.org", ID: "5"}},
+	})
+
+	require.Equal(t, internal.ChangeResults{Created: 2, Updated: 1, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddPerson fay@example.org",
+		"ActivatePerson cat@example.org",
+		"unable to add ann@example.org, a user already exists that does not match the Search",
+		"UpdatePerson bob@example.org, changed: firstName, department",
+		"DeactivatePerson eve@example.org",
+	}, messages)
+
+	fay := service.user("101")
+	require.Equal(t, "ACTIVE", fay["status"])
+	require.Equal(t, map[string]any{"login": "fay@example.org", "firstName": "Fay"}, fay["profile"])
+	require.Equal(t, "ACTIVE", service.user("3")["status"])
+	require.Equal(t, "Catherine", service.user("3")["profile"].(map[string]any)["firstName"])
+	require.Equal(t, "Robert", service.user("2")["profile"].(map[string]any)["firstName"])
+	require.Equal(t, "DEPROVISIONED", service.user("5")["status"])
+	require.Equal(t, []string{
+		"POST /api/v1/users",
+		"POST /api/v1/users/3/lifecycle/activate",
+		"POST /api/v1/users/3",
+		"POST /api/v1/users/2",
+		"POST /api/v1/users/5/lifecycle/deactivate",
+	}, service.paths())
+}
+
+func TestOktaDestination_ApplyChangeSet_suspend(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	o := newTestOktaDestination(t, service, `"CreateStatus": "Staged"`, `{"DeleteAction": "Suspend"}`)
+
+	results, messages := applyTestChanges(t, o, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "fay@example.org", Attributes: map[string]string{"firstName": "Fay"}},
+			{CompareValue: "dan@example.org", Attributes: map[string]string{"firstName": "Dan"}},
+		},
+		Delete: []internal.Person{
+			{CompareValue: "ann@example.org", ID: "1"},
+			{CompareValue: "eve@example.org", ID: "5"},
+		},
+	})
+
+	require.Equal(t, internal.ChangeResults{Created: 2, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddPerson fay@example.org",
+		"ActivatePerson dan@example.org",
+		"SuspendPerson ann@example.org",
+		"unable to delete eve@example.org: Okta error 400 (E0000001): Api validation failed: suspend",
+	}, messages)
+	require.Equal(t, "STAGED", service.user("101")["status"])
+	require.Equal(t, "ACTIVE", service.user("4")["status"])
+	require.Equal(t, "SUSPENDED", service.user("1")["status"])
+}
+
+func TestOktaDestination_ApplyChangeSet_group(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	o := newTestOktaDestination(t, service, "", `{"GroupName": "Staff", "ExtraMembers": ["ann@example.org"]}`)
+
+	results, messages := applyTestChanges(t, o, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "fay@example.org", Attributes: map[string]string{"firstName": "Fay"}},
+			{CompareValue: "eve@example.org", Attributes: map[string]string{"firstName": "Eve"}},
+		},
+		Delete: []internal.Person{{CompareValue: "bob@example.org"}},
+	})
+
+	require.Equal(t, internal.ChangeResults{Created: 2, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddPerson fay@example.org",
+		"AddMember fay@example.org",
+		"AddMember eve@example.org",
+		"RemoveMember bob@example.org",
+	}, messages)
+	require.Equal(t, []string{"1", "3", "101", "5"}, service.members("g1"))
+	require.Equal(t, "ACTIVE", service.user("2")["status"], "a person removed from the group is not deactivated")
+	require.Equal(t, "STAGED", service.user("5")["status"], "an existing user's status is not changed")
+}
+
+func TestOktaDestination_ApplyChangeSet_errors(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	o := newTestOktaDestination(t, service, "", `{"CompareAttribute": "email"}`)
+
+	results, messages := applyTestChanges(t, o, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "fay@example.org"}},
+		Update: []internal.Person{{CompareValue: "gus@example.org", Attributes: map[string]string{"firstName": "Gus"}}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Equal(t, []string{
+		"unable to create fay@example.org: Okta error 400 (E0000001): Api validation failed: login: " +
+			"login: The field cannot be left blank",
+		"unable to update gus@example.org: user not found",
+	}, messages)
+
+	o = newTestOktaDestination(t, service, "", `{"GroupName": "Managers"}`)
+	results, messages = applyTestChanges(t, o, internal.ChangeSet{Create: []internal.Person{{CompareValue: "x"}}})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Equal(t, []string{"unable to apply changes to " + service.URL + ": found 0 groups named Managers"}, messages)
+}
+
+func TestRetryDelay(t *testing.T) {
+	require.Equal(t, 2*time.Second, retryDelay("", 1))
+	require.Equal(t, time.Duration(0), retryDelay("1000", 0), "a reset time in the past")
+	require.Equal(t, internal.MaxRetryDelay, retryDelay(strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10), 0))
+	require.True(t, internal.IsStatus(newError(http.StatusNotFound, nil), http.StatusNotFound))
+}
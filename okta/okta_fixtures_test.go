@@ -0,0 +1,275 @@
+package okta
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/internal/testutil"
+)
+
+const testAPIToken = "secret"
+
+// testService is an in-process Okta org with simple support for eq searches, Link-header paging, lifecycle
+// operations, and group members
+type testService struct {
+	*testutil.Server
+
+	users  []map[string]any
+	groups []map[string]any
+	nextID int
+}
+
+var eqSearch = regexp.MustCompile(`^(profile\.\w+|status) eq ("(?:[^"\\]|\\.)*")$`)
+
+// transitions lists the statuses a user must have for each lifecycle operation, and the status it then has
+var transitions = map[string]struct {
+	from []string
+	to   string
+}{
+	"activate":   {from: []string{"STAGED", "DEPROVISIONED"}, to: "ACTIVE"},
+	"deactivate": {from: []string{"STAGED", "ACTIVE", "SUSPENDED"}, to: "DEPROVISIONED"},
+	"suspend":    {from: []string{"ACTIVE"}, to: "SUSPENDED"},
+	"unsuspend":  {from: []string{"SUSPENDED"}, to: "ACTIVE"},
+}
+
+func startTestService(t *testing.T, users, groups []map[string]any) *testService {
+	s := &testService{users: users, groups: groups, nextID: 100}
+	s.Server = testutil.NewServer(t, s.handle)
+	return s
+}
+
+// busy makes the service refuse the next n requests with 429 Too Many Requests
+func (s *testService) busy(n int) {
+	s.Busy(n, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+		writeError(w, http.StatusTooManyRequests, "E0000047", "API call exceeded rate limit due to too many requests.")
+	})
+}
+
+func (s *testService) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "SSWS "+testAPIToken {
+		writeError(w, http.StatusUnauthorized, "E0000011", "Invalid token provided")
+		return
+	}
+
+	var body map[string]any
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "E0000003", "The request body was not well-formed.")
+			return
+		}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/users":
+		s.listUsers(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/groups":
+		var groups []map[string]any
+		for _, group := range s.groups {
+			name := group["profile"].(map[string]any)["name"].(string)
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(r.URL.Query().Get("q"))) {
+				groups = append(groups, group)
+			}
+		}
+		s.page(w, r, groups)
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "groups" && parts[2] == "users":
+		group := find(s.groups, parts[1])
+		if group == nil {
+			writeError(w, http.StatusNotFound, "E0000007", "Not found: Resource not found: "+parts[1]+" (UserGroup)")
+			return
+		}
+		var members []map[string]any
+		for _, id := range group["members"].([]string) {
+			members = append(members, find(s.users, id))
+		}
+		s.page(w, r, members)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/users":
+		s.createUser(w, r, body)
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "users":
+		user := find(s.users, parts[1])
+		if user == nil {
+			writeError(w, http.StatusNotFound, "E0000007", "Not found: Resource not found: "+parts[1]+" (User)")
+			return
+		}
+		profile := user["profile"].(map[string]any)
+		for key, value := range body["profile"].(map[string]any) {
+			if value == nil {
+				delete(profile, key)
+			} else {
+				profile[key] = value
+			}
+		}
+		testutil.WriteJSON(w, http.StatusOK, user)
+	case r.Method == http.MethodPost && len(parts) == 4 && parts[0] == "users" && parts[2] == "lifecycle":
+		user := find(s.users, parts[1])
+		transition, ok := transitions[parts[3]]
+		if user == nil || !ok {
+			writeError(w, http.StatusNotFound, "E0000007", "Not found: Resource not found: "+parts[1]+" (User)")
+			return
+		}
+		if !slices.Contains(transition.from, user["status"].(string)) {
+			writeError(w, http.StatusBadRequest, "E0000001", "Api validation failed: "+parts[3])
+			return
+		}
+		user["status"] = transition.to
+		testutil.WriteJSON(w, http.StatusOK, map[string]any{})
+	case (r.Method == http.MethodPut || r.Method == http.MethodDelete) && len(parts) == 4 && parts[0] == "groups" &&
+		parts[2] == "users":
+		group := find(s.groups, parts[1])
+		if group == nil || find(s.users, parts[3]) == nil {
+			writeError(w, http.StatusNotFound, "E0000007", "Not found: Resource not found")
+			return
+		}
+		members := slices.DeleteFunc(group["members"].([]string), func(id string) bool { return id == parts[3] })
+		if r.Method == http.MethodPut {
+			members = append(members, parts[3])
+		}
+		group["members"] = members
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "E0000022", "The endpoint does not support the provided HTTP method")
+	}
+}
+
+// listUsers writes a page of the users that match the search. As in Okta, deactivated users are only listed by a
+// search.
+func (s *testService) listUsers(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("search")
+	var match []string
+	if search != "" {
+		if match = eqSearch.FindStringSubmatch(search); match == nil {
+			writeError(w, http.StatusBadRequest, "E0000031", "Invalid search.")
+			return
+		}
+	}
+
+	var users []map[string]any
+	for _, user := range s.users {
+		switch {
+		case match == nil:
+			if user["status"] != "DEPROVISIONED" {
+				users = append(users, user)
+			}
+		case match[1] == "status":
+			if fmt.Sprintf("%q", user["status"]) == match[2] {
+				users = append(users, user)
+			}
+		default:
+			var value string
+			_ = json.Unmarshal([]byte(match[2]), &value)
+			if user["profile"].(map[string]any)[strings.TrimPrefix(match[1], "profile.")] == value {
+				users = append(users, user)
+			}
+		}
+	}
+	s.page(w, r, users)
+}
+
+// page writes the page of objects after the "after" cursor, with a Link header to the next page
+func (s *testService) page(w http.ResponseWriter, r *http.Request, objects []map[string]any) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 200
+	}
+	after, _ := strconv.Atoi(query.Get("after"))
+	end := min(after+limit, len(objects))
+
+	w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="self"`, s.URL, r.URL.RequestURI()))
+	if end < len(objects) {
+		query.Set("after", strconv.Itoa(end))
+		w.Header().Add("Link", fmt.Sprintf(`<%s%s?%s>; rel="next"`, s.URL, r.URL.Path, query.Encode()))
+	}
+	testutil.WriteJSON(w, http.StatusOK, append([]map[string]any{}, objects[min(after, end):end]...))
+}
+
+func (s *testService) createUser(w http.ResponseWriter, r *http.Request, body map[string]any) {
+	profile, _ := body["profile"].(map[string]any)
+	if login, _ := profile["login"].(string); login == "" {
+		testutil.WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"errorCode":    "E0000001",
+			"errorSummary": "Api validation failed: login",
+			"errorCauses":  []any{map[string]string{"errorSummary": "login: The field cannot be left blank"}},
+		})
+		return
+	}
+
+	status := "STAGED"
+	if r.URL.Query().Get("activate") != "false" {
+		status = "ACTIVE"
+	}
+	s.nextID++
+	user := map[string]any{"id": strconv.Itoa(s.nextID), "status": status, "profile": profile}
+	s.users = append(s.users, user)
+	testutil.WriteJSON(w, http.StatusOK, user)
+}
+
+func (s *testService) user(id string) map[string]any {
+	s.Lock()
+	defer s.Unlock()
+	return find(s.users, id)
+}
+
+func (s *testService) members(groupID string) []string {
+	s.Lock()
+	defer s.Unlock()
+	return slices.Clone(find(s.groups, groupID)["members"].([]string))
+}
+
+// paths returns the method and path of each request received, other than GET requests
+func (s *testService) paths() []string {
+	var paths []string
+	for _, request := range s.Changes() {
+		paths = append(paths, request.Method+" "+request.Path)
+	}
+	return paths
+}
+
+func find(objects []map[string]any, id string) map[string]any {
+	for _, object := range objects {
+		if object["id"] == id {
+			return object
+		}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, summary string) {
+	testutil.WriteJSON(w, status, map[string]any{"errorCode": code, "errorSummary": summary})
+}
+
+func testUser(id, status, login, firstName string) map[string]any {
+	return map[string]any{
+		"id":      id,
+		"status":  status,
+		"profile": map[string]any{"login": login, "email": login, "firstName": firstName},
+	}
+}
+
+func testUsers() []map[string]any {
+	users := []map[string]any{
+		testUser("1", "ACTIVE", "ann@example.org", "Ann"),
+		testUser("2", "ACTIVE", "bob@example.org", "Bob"),
+		testUser("3", "DEPROVISIONED", "cat@example.org", "Cat"),
+		testUser("4", "SUSPENDED", "dan@example.org", "Dan"),
+		testUser("5", "STAGED", "eve@example.org", "Eve"),
+	}
+	users[0]["profile"].(map[string]any)["department"] = "IT"
+	users[0]["profile"].(map[string]any)["roles"] = []any{"admin", "staff"}
+	return users
+}
+
+func testGroups() []map[string]any {
+	return []map[string]any{
+		{"id": "g1", "profile": map[string]any{"name": "Staff"}, "members": []string{"1", "2", "3"}},
+		{"id": "g2", "profile": map[string]any{"name": "Staff Managers"}, "members": []string{}},
+	}
+}
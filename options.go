@@ -0,0 +1,46 @@
+package personnel_sync
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// Options override parts of the config file for a single run. The zero value makes no changes.
+type Options struct {
+	// DryRun, if not nil, overrides Runtime.DryRunMode
+	DryRun *bool
+
+	// Verbosity, if not nil, overrides Runtime.Verbosity
+	Verbosity *int
+
+	// Only, if not empty, lists the names of the sync sets to run. All other sync sets are disabled.
+	Only []string
+}
+
+// applyTo makes the changes to config selected by the options
+func (o Options) applyTo(config *internal.Config) error {
+	if o.DryRun != nil {
+		config.Runtime.DryRunMode = *o.DryRun
+	}
+	if o.Verbosity != nil {
+		config.Runtime.Verbosity = *o.Verbosity
+	}
+
+	if len(o.Only) == 0 {
+		return nil
+	}
+
+	for _, name := range o.Only {
+		if _, ok := findSyncSet(*config, name); !ok {
+			return fmt.Errorf(`syncSet "%s" is not in the configuration`, name)
+		}
+	}
+	for i := range config.SyncSets {
+		if !slices.Contains(o.Only, config.SyncSets[i].Name) {
+			config.SyncSets[i].Disable = true
+		}
+	}
+	return nil
+}
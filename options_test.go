@@ -0,0 +1,90 @@
+package personnel_sync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func TestOptions_applyTo(t *testing.T) {
+	yes, no, quiet := true, false, internal.VerbosityLow
+
+	tests := []struct {
+		name         string
+		dryRunMode   bool
+		options      Options
+		wantDryRun   bool
+		wantVerbose  int
+		wantDisabled []bool
+		wantErr      string
+	}{
+		{
+			name:         "no options",
+			dryRunMode:   true,
+			wantDryRun:   true,
+			wantVerbose:  internal.DefaultVerbosity,
+			wantDisabled: []bool{false, false, true},
+		},
+		{
+			name:         "dry run on",
+			options:      Options{DryRun: &yes},
+			wantDryRun:   true,
+			wantVerbose:  internal.DefaultVerbosity,
+			wantDisabled: []bool{false, false, true},
+		},
+		{
+			name:         "dry run off",
+			dryRunMode:   true,
+			options:      Options{DryRun: &no},
+			wantVerbose:  internal.DefaultVerbosity,
+			wantDisabled: []bool{false, false, true},
+		},
+		{
+			name:         "verbosity",
+			options:      Options{Verbosity: &quiet},
+			wantVerbose:  internal.VerbosityLow,
+			wantDisabled: []bool{false, false, true},
+		},
+		{
+			name:         "only",
+			options:      Options{Only: []string{"two"}},
+			wantVerbose:  internal.DefaultVerbosity,
+			wantDisabled: []bool{true, false, true},
+		},
+		{
+			name:         "only a disabled set",
+			options:      Options{Only: []string{"one", "three"}},
+			wantVerbose:  internal.DefaultVerbosity,
+			wantDisabled: []bool{false, true, true},
+		},
+		{
+			name:    "only an unknown set",
+			options: Options{Only: []string{"one", "four"}},
+			wantErr: `syncSet "four" is not in the configuration`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := internal.NewConfig()
+			config.Runtime.DryRunMode = tt.dryRunMode
+			config.SyncSets = []internal.SyncSet{{Name: "one"}, {Name: "two"}, {Name: "three", Disable: true}}
+
+			err := tt.options.applyTo(&config)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, tt.wantDryRun, config.Runtime.DryRunMode)
+			require.Equal(t, tt.wantVerbose, config.Runtime.Verbosity)
+			var disabled []bool
+			for _, syncSet := range config.SyncSets {
+				disabled = append(disabled, syncSet.Disable)
+			}
+			require.Equal(t, tt.wantDisabled, disabled)
+		})
+	}
+}
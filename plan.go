@@ -0,0 +1,167 @@
+package personnel_sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/alert"
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// PlanSync plans the changes for all sync sets without applying them, and saves the plan to planFile in JSON format
+// so that it can be reviewed and then applied with ApplyPlan. If planFile is empty, the PlanFile in the config is used.
+func PlanSync(ctx context.Context, configFile, planFile string, options Options) (Results, error) {
+	early := startLog()
+	log.Printf("Personnel sync plan started at %s", time.Now().UTC().Format(time.RFC1123Z))
+
+	config, err := loadConfig(configFile, options)
+	config.Runtime.DryRunMode = true
+	if planFile != "" {
+		config.Runtime.PlanFile = planFile
+		config.Runtime.PlanFormat = internal.PlanFormatJSON
+	}
+	setLogOutput(early, config)
+	if err != nil {
+		return Results{}, err
+	}
+	ctx, cancel := internal.WithRuntimeDeadline(ctx, config.Runtime)
+	defer cancel()
+
+	results, err := runSync(ctx, config)
+
+	log.Printf("Personnel sync plan completed at %s: %s", results.Finished.Format(time.RFC1123Z), results.summary())
+	return results, err
+}
+
+// ApplyPlan applies the changes in a plan saved by PlanSync, without reading the source again. A sync set is not
+// changed if its destination has changed since the plan was made.
+func ApplyPlan(ctx context.Context, configFile, planFile string, options Options) (Results, error) {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(0)
+	log.Printf("Personnel sync apply started at %s", time.Now().UTC().Format(time.RFC1123Z))
+
+	config, err := loadConfig(configFile, options)
+	if err != nil {
+		return Results{}, err
+	}
+
+	destination, err := newDestination(config)
+	if err != nil {
+		return Results{}, initError(config, config.Destination.Type+" destination", err)
+	}
+
+	stateStore, err := internal.NewStateStore(config.State)
+	if err != nil {
+		return Results{}, initError(config, config.State.Type+" state store", err)
+	}
+
+	ctx, cancel := internal.WithRuntimeDeadline(ctx, config.Runtime)
+	defer cancel()
+
+	results, err := applyPlan(ctx, config, planFile, destination, stateStore)
+
+	log.Printf("Personnel sync apply completed at %s: %s", results.Finished.Format(time.RFC1123Z), results.summary())
+	return results, err
+}
+
+// applyPlan reads the plan saved in planFile and applies it to the enabled sync sets, and sends an alert listing any
+// errors
+func applyPlan(
+	ctx context.Context,
+	config internal.Config,
+	planFile string,
+	destination internal.Destination,
+	stateStore internal.StateStore,
+) (Results, error) {
+	results := Results{Started: time.Now().UTC(), DryRun: config.Runtime.DryRunMode}
+
+	plan, err := internal.ReadPlan(planFile, config.Runtime.PlanSigningKey)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to read plan %s, error: %s", planFile, err)
+		log.Println(msg)
+		alert.SendEmail(config.Alert, msg)
+		results.Finished = time.Now().UTC()
+		return results, fmt.Errorf("%w: unable to read plan %s: %w", ErrPlan, planFile, err)
+	}
+	log.Printf("Applying plan created at %s", plan.Created.Format(time.RFC1123Z))
+
+	maxNameLength := config.MaxSyncSetNameLength()
+	var alertList []string
+
+	for i, setPlan := range plan.SyncSets {
+		prefix := fmt.Sprintf("[ %-*s ] ", maxNameLength, setPlan.Name)
+		syncSetLogger := log.New(log.Writer(), prefix, 0)
+		syncSetLogger.Printf("(%v/%v) Beginning sync set", i+1, len(plan.SyncSets))
+
+		if setPlan.Error != "" {
+			syncSetLogger.Printf("Skipping sync set, planning failed with error: %s", setPlan.Error)
+			results.skip(setPlan.Name, "planning failed: "+setPlan.Error)
+			continue
+		}
+
+		syncSet, ok := findSyncSet(config, setPlan.Name)
+		if !ok {
+			err = fmt.Errorf(`syncSet "%s" in plan is not in the configuration`, setPlan.Name)
+			alertList = handleSyncError(syncSetLogger, err, alertList)
+			results.add(setPlan.Name, plannedChanges(setPlan), internal.ChangeResults{}, err)
+			continue
+		}
+		if syncSet.Disable {
+			syncSetLogger.Println("Skipping sync set, it is disabled in the configuration")
+			results.skip(setPlan.Name, "disabled")
+			continue
+		}
+		if internal.Stopping(ctx) {
+			syncSetLogger.Println("Skipping sync set, stopped at the deadline")
+			results.stop(setPlan.Name)
+			continue
+		}
+
+		applied, err := applySyncSetPlan(ctx, syncSetLogger, destination, config, syncSet, setPlan, stateStore)
+		if err != nil {
+			alertList = handleSyncError(syncSetLogger, err, alertList)
+		}
+		results.add(setPlan.Name, plannedChanges(setPlan), applied, err)
+	}
+
+	if len(alertList) > 0 {
+		alert.SendEmail(config.Alert, fmt.Sprintf("Sync error(s):\n%s", strings.Join(alertList, "\n")))
+	}
+
+	results.Finished = time.Now().UTC()
+	return results, results.Err()
+}
+
+func applySyncSetPlan(
+	ctx context.Context,
+	logger *log.Logger,
+	destination internal.Destination,
+	config internal.Config,
+	syncSet internal.SyncSet,
+	plan internal.SyncSetPlan,
+	stateStore internal.StateStore,
+) (internal.ChangeResults, error) {
+	if err := destination.ForSet(syncSet.Destination); err != nil {
+		return internal.ChangeResults{},
+			fmt.Errorf(`Error setting destination set on syncSet "%s": %w`, syncSet.Name, err)
+	}
+
+	applied, err := internal.ApplySyncSetPlan(ctx, logger, destination, config, plan, stateStore)
+	if err != nil {
+		return applied, fmt.Errorf(`Apply failed with error on syncSet "%s": %w`, syncSet.Name, err)
+	}
+	return applied, nil
+}
+
+func findSyncSet(config internal.Config, name string) (internal.SyncSet, bool) {
+	for _, syncSet := range config.SyncSets {
+		if syncSet.Name == name {
+			return syncSet, true
+		}
+	}
+	return internal.SyncSet{}, false
+}
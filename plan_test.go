@@ -0,0 +1,152 @@
+package personnel_sync
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+type testSource struct {
+	people []internal.Person
+}
+
+func (s *testSource) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (s *testSource) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	return s.people, nil
+}
+
+type testDestination struct {
+	people  []internal.Person
+	applied []internal.ChangeSet
+}
+
+func (d *testDestination) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (d *testDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	return d.people, nil
+}
+
+func (d *testDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	d.applied = append(d.applied, changes)
+	return internal.ChangeResults{
+		Created: uint64(len(changes.Create)),
+		Updated: uint64(len(changes.Update)),
+		Deleted: uint64(len(changes.Delete)),
+	}
+}
+
+func testPerson(email string) internal.Person {
+	return internal.Person{CompareValue: email, Attributes: map[string]string{"email": email}}
+}
+
+func testApplyConfig(syncSets ...internal.SyncSet) internal.Config {
+	config := internal.NewConfig()
+	config.AttributeMap = []internal.AttributeMap{{Source: "email", Destination: "email", Required: true}}
+	config.SyncSets = syncSets
+	return config
+}
+
+// writeTestPlan plans a sync set for each name, which adds one person to the destination, and saves the plan
+func writeTestPlan(t *testing.T, destination internal.Destination, names ...string) string {
+	logger := log.New(io.Discard, "", 0)
+	source := &testSource{people: []internal.Person{testPerson("ann@example.com"), testPerson("bob@example.com")}}
+	config := testApplyConfig()
+
+	plan := internal.Plan{Created: time.Now().UTC()}
+	for _, name := range names {
+		setPlan, err := internal.PlanSyncSet(context.Background(), logger, source, destination, config,
+			internal.SyncSet{Name: name}, nil)
+		require.NoError(t, err)
+		plan.SyncSets = append(plan.SyncSets, setPlan)
+	}
+	plan.SyncSets = append(plan.SyncSets, internal.SyncSetPlan{Name: "failed", Error: "source unavailable"})
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, internal.WritePlan(plan, internal.RuntimeConfig{PlanFile: path}))
+	return path
+}
+
+func Test_applyPlan(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	destination := &testDestination{people: []internal.Person{testPerson("ann@example.com")}}
+	planFile := writeTestPlan(t, destination, "ok", "disabled", "missing")
+	config := testApplyConfig(
+		internal.SyncSet{Name: "ok"},
+		internal.SyncSet{Name: "disabled", Disable: true},
+		internal.SyncSet{Name: "failed"},
+	)
+
+	results, err := applyPlan(context.Background(), config, planFile, destination, nil)
+
+	require.ErrorIs(t, err, ErrSyncSetFailed)
+	require.ErrorContains(t, err, `syncSet "missing" in plan is not in the configuration`)
+	require.NotErrorIs(t, err, ErrStopped)
+	require.Equal(t, []SyncSetResult{
+		{
+			Name:    "ok",
+			Status:  StatusSucceeded,
+			Planned: internal.ChangeResults{Created: 1},
+			Applied: internal.ChangeResults{Created: 1},
+		},
+		{Name: "disabled", Status: StatusSkipped, Error: "disabled"},
+		{
+			Name:    "missing",
+			Status:  StatusFailed,
+			Error:   `syncSet "missing" in plan is not in the configuration`,
+			Planned: internal.ChangeResults{Created: 1},
+		},
+		{Name: "failed", Status: StatusSkipped, Error: "planning failed: source unavailable"},
+	}, results.SyncSets)
+
+	require.Len(t, destination.applied, 1, "only the ok sync set should be applied")
+	require.Equal(t, "bob@example.com", destination.applied[0].Create[0].CompareValue)
+}
+
+func Test_applyPlan_deadline(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	destination := &testDestination{people: []internal.Person{testPerson("ann@example.com")}}
+	planFile := writeTestPlan(t, destination, "one", "two")
+	config := testApplyConfig(internal.SyncSet{Name: "one"}, internal.SyncSet{Name: "two"})
+	config.Runtime.TimeoutSeconds = 1
+	config.Runtime.StopMarginSeconds = 5
+
+	ctx, cancel := internal.WithRuntimeDeadline(context.Background(), config.Runtime)
+	defer cancel()
+	results, err := applyPlan(ctx, config, planFile, destination, nil)
+
+	require.ErrorIs(t, err, ErrStopped)
+	require.True(t, results.Stopped)
+	require.Equal(t, 2, results.countSkipped(stoppedReason))
+	require.Empty(t, destination.applied, "no sync set should be started within the stop margin")
+}
+
+func Test_applyPlan_unreadable(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	destination := &testDestination{}
+	_, err := applyPlan(context.Background(), testApplyConfig(), filepath.Join(t.TempDir(), "missing.json"),
+		destination, nil)
+	require.ErrorIs(t, err, ErrPlan)
+}
@@ -2,6 +2,7 @@ package restapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -42,15 +43,6 @@ func NewRestAPISource(sourceConfig internal.SourceConfig) (internal.Source, erro
 		return &RestAPI{}, err
 	}
 
-	if restAPI.AuthType == AuthTypeSalesforceOauth {
-		if token, err := restAPI.getSalesforceOauthToken(); err != nil {
-			log.Println(err)
-			return &RestAPI{}, err
-		} else {
-			restAPI.Password = token
-		}
-	}
-
 	if err := restAPI.validateConfig(); err != nil {
 		return &restAPI, fmt.Errorf("invalid configuration: %w", err)
 	}
@@ -121,7 +113,11 @@ func (r *RestAPI) ForSet(syncSetJson json.RawMessage) error {
 
 // ListUsers makes http requests and uses the responses to populate
 // and return a slice of Person instances
-func (r *RestAPI) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+func (r *RestAPI) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	if err := r.authenticate(ctx); err != nil {
+		return nil, err
+	}
+
 	errLog := make(chan string, 1000)
 	people := make(chan internal.Person, 20000)
 	var wg sync.WaitGroup
@@ -133,7 +129,7 @@ func (r *RestAPI) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
 	}
 	for _, p := range r.setConfig.Paths {
 		wg.Add(1)
-		go r.listUsersForPath(attributesToRead, p, &wg, people, errLog)
+		go r.listUsersForPath(ctx, attributesToRead, p, &wg, people, errLog)
 	}
 
 	wg.Wait()
@@ -151,7 +147,11 @@ func (r *RestAPI) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
 	return r.filterPeople(people)
 }
 
-func (r *RestAPI) ApplyChangeSet(changes internal.ChangeSet, eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+func (r *RestAPI) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
 	var results internal.ChangeResults
 	var wg sync.WaitGroup
 
@@ -161,9 +161,12 @@ func (r *RestAPI) ApplyChangeSet(changes internal.ChangeSet, eventLog chan<- int
 		log.Println("Creation is disabled.")
 	} else {
 		for _, toCreate := range changes.Create {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go r.addPerson(toCreate, &results.Created, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go r.addPerson(ctx, toCreate, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -171,9 +174,12 @@ func (r *RestAPI) ApplyChangeSet(changes internal.ChangeSet, eventLog chan<- int
 		log.Println("Update is disabled.")
 	} else {
 		for _, toUpdate := range changes.Update {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go r.updatePerson(toUpdate, &results.Updated, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go r.updatePerson(ctx, toUpdate, &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -181,9 +187,12 @@ func (r *RestAPI) ApplyChangeSet(changes internal.ChangeSet, eventLog chan<- int
 		log.Println("Deletion is disabled.")
 	} else {
 		for _, toUpdate := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
 			wg.Add(1)
-			go r.deletePerson(toUpdate, &results.Deleted, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			go r.deletePerson(ctx, toUpdate, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch(ctx)
 		}
 	}
 
@@ -193,6 +202,7 @@ func (r *RestAPI) ApplyChangeSet(changes internal.ChangeSet, eventLog chan<- int
 }
 
 func (r *RestAPI) listUsersForPath(
+	ctx context.Context,
 	desiredAttrs []string,
 	path string,
 	wg *sync.WaitGroup,
@@ -205,7 +215,7 @@ func (r *RestAPI) listUsersForPath(
 
 	if scheme == "" {
 		apiURL := r.BaseURL + path
-		p := r.requestPage(desiredAttrs, apiURL, errLog)
+		p := r.requestPage(ctx, desiredAttrs, apiURL, errLog)
 		for _, pp := range p {
 			people <- pp
 		}
@@ -232,7 +242,7 @@ func (r *RestAPI) listUsersForPath(
 			return
 		}
 
-		p := r.requestPage(desiredAttrs, apiURL, errLog)
+		p := r.requestPage(ctx, desiredAttrs, apiURL, errLog)
 		if len(p) == 0 {
 			break
 		}
@@ -243,17 +253,27 @@ func (r *RestAPI) listUsersForPath(
 		batchCounter++
 		if batchCounter >= r.BatchSize {
 			log.Printf("listUsersForPath waiting %d seconds for rate limit", r.BatchDelaySeconds)
-			time.Sleep(time.Second * time.Duration(r.BatchDelaySeconds))
+			select {
+			case <-ctx.Done():
+				errLog <- ctx.Err().Error()
+				return
+			case <-time.After(time.Second * time.Duration(r.BatchDelaySeconds)):
+			}
 			batchCounter = 0
 		}
 	}
 }
 
-func (r *RestAPI) requestPage(desiredAttrs []string, url string, errLog chan<- string) []internal.Person {
+func (r *RestAPI) requestPage(
+	ctx context.Context,
+	desiredAttrs []string,
+	url string,
+	errLog chan<- string,
+) []internal.Person {
 	timeout := r.getTimeout()
 
 	client := &http.Client{Timeout: time.Second * time.Duration(timeout)}
-	req, err := http.NewRequest(r.ListMethod, url, nil)
+	req, err := http.NewRequestWithContext(ctx, r.ListMethod, url, nil)
 	if err != nil {
 		log.Println(err)
 		errLog <- err.Error()
@@ -371,7 +391,24 @@ type SalesforceErrorResponse struct {
 	ErrorDescription string `json:"error_description"`
 }
 
-func (r *RestAPI) getSalesforceOauthToken() (string, error) {
+// authenticate gets a Salesforce OAuth token the first time it is called, so that no network access is needed until
+// the API is used
+func (r *RestAPI) authenticate(ctx context.Context) error {
+	if r.AuthType != AuthTypeSalesforceOauth || r.authenticated {
+		return nil
+	}
+
+	token, err := r.getSalesforceOauthToken(ctx)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	r.Password = token
+	r.authenticated = true
+	return nil
+}
+
+func (r *RestAPI) getSalesforceOauthToken(ctx context.Context) (string, error) {
 	// Body params
 	data := url.Values{}
 	data.Set("grant_type", "password")
@@ -381,7 +418,7 @@ func (r *RestAPI) getSalesforceOauthToken() (string, error) {
 	data.Set("client_secret", r.ClientSecret)
 
 	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodPost, r.BaseURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.BaseURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		log.Println(err)
 		return "", err
@@ -512,13 +549,13 @@ func chooseEventLog(code int, message string, eventLog chan<- internal.EventLogI
 	}
 }
 
-func (r *RestAPI) addPerson(p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
+func (r *RestAPI) addPerson(ctx context.Context, p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
 	defer wg.Done()
 
 	apiURL := fmt.Sprintf("%s%s", r.BaseURL, r.setConfig.CreatePath)
 	headers := map[string]string{"Content-Type": "application/json"}
 	reqBody := attributesToJSON(p.Attributes)
-	reqRes := r.httpRequest(r.CreateMethod, apiURL, reqBody, headers)
+	reqRes := r.httpRequest(ctx, r.CreateMethod, apiURL, reqBody, headers)
 	if reqRes.Err != nil {
 		message := fmt.Sprintf("addPerson '%s' httpRequest error '%s', url: %s, request: %s, response: %s",
 			p.CompareValue, reqRes.Err, apiURL, reqBody, reqRes.RespBody)
@@ -544,14 +581,19 @@ func attributesToJSON(attr map[string]string) string {
 	return jsonObj.String()
 }
 
-func (r *RestAPI) updatePerson(p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
+func (r *RestAPI) updatePerson(ctx context.Context, p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
 	defer wg.Done()
 
 	updatePath := strings.Replace(r.setConfig.UpdatePath, "{id}", p.ID, 1)
 	apiURL := fmt.Sprintf("%s%s", r.BaseURL, updatePath)
 	headers := map[string]string{"Content-Type": "application/json"}
-	reqBody := attributesToJSON(p.Attributes)
-	reqRes := r.httpRequest(r.UpdateMethod, apiURL, reqBody, headers)
+	attributes := p.Attributes
+	if r.UpdateMethod == http.MethodPatch {
+		// PATCH can update just the attributes that have changed
+		attributes = p.ChangedAttributes()
+	}
+	reqBody := attributesToJSON(attributes)
+	reqRes := r.httpRequest(ctx, r.UpdateMethod, apiURL, reqBody, headers)
 	if reqRes.Err != nil {
 		message := fmt.Sprintf("updatePerson '%s' httpRequest error '%s', url: %s, request: %s, response: %s",
 			p.CompareValue, reqRes.Err, apiURL, reqBody, reqRes.RespBody)
@@ -560,20 +602,21 @@ func (r *RestAPI) updatePerson(p internal.Person, n *uint64, wg *sync.WaitGroup,
 	}
 
 	eventLog <- internal.EventLogItem{
-		Level:   syslog.LOG_INFO,
-		Message: "UpdateContact " + p.CompareValue,
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdateContact %s, changed: %s", p.CompareValue,
+			strings.Join(p.ChangedAttributeNames(), ", ")),
 	}
 
 	atomic.AddUint64(n, 1)
 }
 
-func (r *RestAPI) deletePerson(p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
+func (r *RestAPI) deletePerson(ctx context.Context, p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
 	defer wg.Done()
 
 	deletePath := strings.Replace(r.setConfig.DeletePath, "{id}", p.ID, 1)
 	apiURL := fmt.Sprintf("%s%s", r.BaseURL, deletePath)
 	headers := map[string]string{"Content-Type": "application/json"}
-	reqRes := r.httpRequest(r.DeleteMethod, apiURL, "", headers)
+	reqRes := r.httpRequest(ctx, r.DeleteMethod, apiURL, "", headers)
 	if reqRes.Err != nil {
 		message := fmt.Sprintf("deletePerson '%s' httpRequest error '%s', url: %s,  response: %s",
 			p.CompareValue, reqRes.Err, apiURL, reqRes.RespBody)
@@ -595,13 +638,13 @@ type requestResults struct {
 	Err      error
 }
 
-func (r *RestAPI) httpRequest(verb, url, body string, headers map[string]string) requestResults {
+func (r *RestAPI) httpRequest(ctx context.Context, verb, url, body string, headers map[string]string) requestResults {
 	var req *http.Request
 	var err error
 	if body == "" {
-		req, err = http.NewRequest(verb, url, nil)
+		req, err = http.NewRequestWithContext(ctx, verb, url, nil)
 	} else {
-		req, err = http.NewRequest(verb, url, strings.NewReader(body))
+		req, err = http.NewRequestWithContext(ctx, verb, url, strings.NewReader(body))
 	}
 	if err != nil {
 		return requestResults{Err: err}
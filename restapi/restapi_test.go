@@ -1,8 +1,12 @@
 package restapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"sync"
@@ -14,6 +18,41 @@ import (
 	"github.com/silinternational/personnel-sync/v6/internal"
 )
 
+func TestRestAPI_SalesforceOauth(t *testing.T) {
+	var tokenRequests int
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		tokenRequests++
+		_, _ = io.WriteString(w, `{"access_token":"sf_token","instance_url":"`+server.URL+`/"}`)
+	})
+	mux.HandleFunc("/sfdc", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer sf_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, salesforceUsersJSON)
+	})
+
+	source, err := NewRestAPISource(internal.SourceConfig{
+		Type: internal.SourceTypeRestAPI,
+		ExtraJSON: []byte(`{"BaseURL":"` + server.URL + `/token","AuthType":"SalesforceOauth",
+			"ResultsJSONContainer":"records","CompareAttribute":"fHCM2__User__r.Email"}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, tokenRequests, "token should not be requested until the API is used")
+
+	require.NoError(t, source.ForSet([]byte(`{"Paths":["/sfdc"]}`)))
+	for range 2 {
+		people, err := source.ListUsers(context.Background(), []string{"fHCM2__User__r.Email"})
+		require.NoError(t, err)
+		require.Len(t, people, 2)
+	}
+	require.Equal(t, 1, tokenRequests, "token should be requested only once")
+}
+
 func TestRestAPI_ForSet(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -302,7 +341,7 @@ func TestRestAPI_ListUsers(t *testing.T) {
 			if err != nil {
 				t.Fatalf("ForSet error: %s", err)
 			}
-			got, err := r.ListUsers(tt.desiredAttrs)
+			got, err := r.ListUsers(context.Background(), tt.desiredAttrs)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("RestAPI.ListUsers() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -440,7 +479,7 @@ func TestRestAPI_listUsersForPath(t *testing.T) {
 			var wg sync.WaitGroup
 
 			wg.Add(1)
-			go tt.r.listUsersForPath(tt.args.desiredAttrs, tt.args.path, &wg, people, errLog)
+			go tt.r.listUsersForPath(context.Background(), tt.args.desiredAttrs, tt.args.path, &wg, people, errLog)
 
 			wg.Wait()
 			close(people)
@@ -540,6 +579,59 @@ func Test_getPersonsFromResults(t *testing.T) {
 	}
 }
 
+func TestRestAPI_updatePerson(t *testing.T) {
+	person := internal.Person{
+		CompareValue: "fred@example.com",
+		ID:           "7",
+		Attributes:   map[string]string{"email": "fred@example.com", "title": "CEO"},
+		Changes:      []internal.AttributeChange{{Attribute: "title", Old: "VP", New: "CEO"}},
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		wantBody string
+	}{
+		{
+			name:     "PUT sends all attributes",
+			method:   http.MethodPut,
+			wantBody: `{"email":"fred@example.com","title":"CEO"}`,
+		},
+		{
+			name:     "PATCH sends changed attributes",
+			method:   http.MethodPatch,
+			wantBody: `{"title":"CEO"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotMethod, gotBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				gotMethod = req.Method
+				gotBody = string(body)
+			}))
+			defer server.Close()
+
+			r := New()
+			r.BaseURL = server.URL
+			r.UpdateMethod = tt.method
+			r.setConfig.UpdatePath = "/users/{id}"
+
+			var n uint64
+			var wg sync.WaitGroup
+			eventLog := make(chan internal.EventLogItem, 1)
+			wg.Add(1)
+			r.updatePerson(context.Background(), person, &n, &wg, eventLog)
+
+			require.Equal(t, uint64(1), n)
+			require.Equal(t, tt.method, gotMethod)
+			require.JSONEq(t, tt.wantBody, gotBody)
+			require.Equal(t, "UpdateContact fred@example.com, changed: title", (<-eventLog).Message)
+		})
+	}
+}
+
 func Test_attributesToJSON(t *testing.T) {
 	tests := []struct {
 		name string
@@ -654,7 +746,7 @@ func TestRestAPI_httpRequest(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			reqRes := tt.restAPI.httpRequest(tt.verb, tt.url, tt.body, tt.headers)
+			reqRes := tt.restAPI.httpRequest(context.Background(), tt.verb, tt.url, tt.body, tt.headers)
 			if (reqRes.Err != nil) != tt.wantErr {
 				t.Errorf("httpRequest() error = %v, wantErr %v", reqRes.Err, tt.wantErr)
 				return
@@ -860,7 +952,7 @@ func TestRestAPI_listUsersForPathWithPagination(t *testing.T) {
 			var wg sync.WaitGroup
 
 			wg.Add(1)
-			go tt.r.listUsersForPath([]string{"Name"}, tt.path, &wg, people, errLog)
+			go tt.r.listUsersForPath(context.Background(), []string{"Name"}, tt.path, &wg, people, errLog)
 
 			wg.Wait()
 			close(people)
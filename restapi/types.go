@@ -27,6 +27,7 @@ type RestAPI struct {
 	Pagination           Pagination
 	Filters              internal.Filters
 	HttpTimeoutSeconds   int
+	authenticated        bool
 }
 
 type SetConfig struct {
@@ -0,0 +1,134 @@
+package personnel_sync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+var (
+	// ErrConfig is wrapped by the error returned when the config file cannot be loaded, or the source, destination
+	// or state store cannot be initialized. No sync sets are run.
+	ErrConfig = errors.New("configuration error")
+
+	// ErrPlan is wrapped by the error returned when a plan cannot be written, or a saved plan cannot be read
+	ErrPlan = errors.New("plan error")
+
+	// ErrSyncSetFailed is wrapped by the error returned when one or more sync sets failed
+	ErrSyncSetFailed = errors.New("sync set failed")
+
+	// ErrStopped is wrapped by the error returned when the context was cancelled, or its deadline was near, before
+	// all sync sets were run
+	ErrStopped = errors.New("stopped at the deadline")
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+const stoppedReason = "stopped at the deadline"
+
+// Results summarizes a run of all sync sets
+type Results struct {
+	Started  time.Time
+	Finished time.Time
+	DryRun   bool
+	Stopped  bool // true if some sync sets were skipped because the run was stopped
+	SyncSets []SyncSetResult
+}
+
+// SyncSetResult is the outcome of one sync set
+type SyncSetResult struct {
+	Name    string
+	Status  string
+	Error   string                 `json:",omitempty"`
+	Planned internal.ChangeResults // the number of changes planned
+	Applied internal.ChangeResults // the number of changes made, always zero in dry run mode
+}
+
+// Count returns the number of sync sets with the given status
+func (r Results) Count(status string) int {
+	n := 0
+	for _, set := range r.SyncSets {
+		if set.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// AllFailed returns true if at least one sync set failed and none succeeded
+func (r Results) AllFailed() bool {
+	return r.Count(StatusFailed) > 0 && r.Count(StatusSucceeded) == 0
+}
+
+// Err returns an error listing the error of each sync set that failed, or nil if none failed and the run was not
+// stopped. The error wraps ErrSyncSetFailed if any sync set failed, and ErrStopped if the run was stopped.
+func (r Results) Err() error {
+	var stopErr error
+	if r.Stopped {
+		stopErr = fmt.Errorf("%w: %d sync sets were not run", ErrStopped, r.countSkipped(stoppedReason))
+	}
+
+	var errs []error
+	for _, set := range r.SyncSets {
+		if set.Status == StatusFailed {
+			errs = append(errs, errors.New(set.Error))
+		}
+	}
+	if len(errs) == 0 {
+		return stopErr
+	}
+
+	attempted := len(r.SyncSets) - r.Count(StatusSkipped)
+	failErr := fmt.Errorf("%w: %d of %d sync sets failed\n%w",
+		ErrSyncSetFailed, len(errs), attempted, errors.Join(errs...))
+	return errors.Join(failErr, stopErr)
+}
+
+func (r *Results) add(name string, planned, applied internal.ChangeResults, err error) {
+	result := SyncSetResult{Name: name, Status: StatusSucceeded, Planned: planned, Applied: applied}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	r.SyncSets = append(r.SyncSets, result)
+}
+
+func (r *Results) skip(name, reason string) {
+	r.SyncSets = append(r.SyncSets, SyncSetResult{Name: name, Status: StatusSkipped, Error: reason})
+}
+
+// stop records a sync set that was not run because the run was stopped
+func (r *Results) stop(name string) {
+	r.Stopped = true
+	r.skip(name, stoppedReason)
+}
+
+func (r Results) countSkipped(reason string) int {
+	n := 0
+	for _, set := range r.SyncSets {
+		if set.Status == StatusSkipped && set.Error == reason {
+			n++
+		}
+	}
+	return n
+}
+
+func (r Results) summary() string {
+	return fmt.Sprintf("%d sync sets succeeded, %d failed, %d skipped",
+		r.Count(StatusSucceeded), r.Count(StatusFailed), r.Count(StatusSkipped))
+}
+
+// plannedChanges returns the number of changes in a plan
+func plannedChanges(plan internal.SyncSetPlan) internal.ChangeResults {
+	return internal.ChangeResults{
+		Created: uint64(len(plan.Create)),
+		Updated: uint64(len(plan.Update)),
+		Deleted: uint64(len(plan.Delete)),
+	}
+}
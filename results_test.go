@@ -0,0 +1,110 @@
+package personnel_sync
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func testResults(statuses ...string) Results {
+	var r Results
+	for i, status := range statuses {
+		name := string(rune('a' + i))
+		switch status {
+		case StatusSucceeded:
+			r.add(name, internal.ChangeResults{Created: 1}, internal.ChangeResults{Created: 1}, nil)
+		case StatusFailed:
+			r.add(name, internal.ChangeResults{}, internal.ChangeResults{}, errors.New(name+" failed"))
+		case stoppedReason:
+			r.stop(name)
+		default:
+			r.skip(name, status)
+		}
+	}
+	return r
+}
+
+func TestResults_Err(t *testing.T) {
+	tests := []struct {
+		name        string
+		results     Results
+		wantErrs    []error
+		wantNotErrs []error
+		wantMsg     string
+	}{
+		{
+			name:    "all succeeded",
+			results: testResults(StatusSucceeded, StatusSucceeded, "disabled"),
+		},
+		{
+			name:        "some failed",
+			results:     testResults(StatusSucceeded, StatusFailed, "disabled"),
+			wantErrs:    []error{ErrSyncSetFailed},
+			wantNotErrs: []error{ErrStopped},
+			wantMsg:     "sync set failed: 1 of 2 sync sets failed\nb failed",
+		},
+		{
+			name:        "stopped",
+			results:     testResults(StatusSucceeded, stoppedReason, stoppedReason, "disabled"),
+			wantErrs:    []error{ErrStopped},
+			wantNotErrs: []error{ErrSyncSetFailed},
+			wantMsg:     "stopped at the deadline: 2 sync sets were not run",
+		},
+		{
+			name:     "failed and stopped",
+			results:  testResults(StatusFailed, StatusFailed, stoppedReason),
+			wantErrs: []error{ErrSyncSetFailed, ErrStopped},
+			wantMsg: "sync set failed: 2 of 2 sync sets failed\na failed\nb failed\n" +
+				"stopped at the deadline: 1 sync sets were not run",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.results.Err()
+			if tt.wantMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantMsg)
+			for _, want := range tt.wantErrs {
+				require.ErrorIs(t, err, want)
+			}
+			for _, notWant := range tt.wantNotErrs {
+				require.NotErrorIs(t, err, notWant)
+			}
+		})
+	}
+}
+
+func TestResults_AllFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     bool
+	}{
+		{name: "none run", statuses: []string{"disabled"}},
+		{name: "all succeeded", statuses: []string{StatusSucceeded}},
+		{name: "some failed", statuses: []string{StatusFailed, StatusSucceeded}},
+		{name: "all failed", statuses: []string{StatusFailed, StatusFailed}, want: true},
+		{name: "all run failed", statuses: []string{StatusFailed, "disabled", stoppedReason}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, testResults(tt.statuses...).AllFailed())
+		})
+	}
+}
+
+func TestResults_summary(t *testing.T) {
+	r := testResults(StatusSucceeded, StatusFailed, "disabled", stoppedReason, stoppedReason, StatusSucceeded)
+
+	require.Equal(t, 2, r.Count(StatusSucceeded))
+	require.Equal(t, 3, r.Count(StatusSkipped))
+	require.Equal(t, 2, r.countSkipped(stoppedReason))
+	require.Equal(t, 1, r.countSkipped("disabled"))
+	require.True(t, r.Stopped)
+	require.Equal(t, "2 sync sets succeeded, 1 failed, 3 skipped", r.summary())
+}
@@ -0,0 +1,201 @@
+package scim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DefaultHttpTimeoutSeconds = 45
+	DefaultPageSize           = 100
+
+	contentType = "application/scim+json"
+)
+
+// Client holds the settings for calling a SCIM 2.0 service provider
+type Client struct {
+	BaseURL            string // the URL that /Users and /Groups are relative to, such as https://example.com/scim/v2
+	BearerToken        string
+	HttpTimeoutSeconds int // default 45
+	PageSize           int // number of resources requested at a time, default 100
+
+	httpClient *http.Client
+}
+
+// Error is an error response from a SCIM service provider
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("SCIM error %d", e.Status)
+	if e.ScimType != "" {
+		msg += " (" + e.ScimType + ")"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// HTTPStatus returns the status of the error response
+func (e *Error) HTTPStatus() int {
+	return e.Status
+}
+
+type listResponse struct {
+	TotalResults int
+	StartIndex   int
+	ItemsPerPage int
+	Resources    []map[string]any
+}
+
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+func (c *Client) validate() error {
+	if c.BaseURL == "" {
+		return errors.New("BaseURL is required")
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid BaseURL %q", c.BaseURL)
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+
+	if c.BearerToken == "" {
+		return errors.New("BearerToken is required")
+	}
+	if c.HttpTimeoutSeconds <= 0 {
+		c.HttpTimeoutSeconds = DefaultHttpTimeoutSeconds
+	}
+	if c.PageSize <= 0 {
+		c.PageSize = DefaultPageSize
+	}
+	return nil
+}
+
+// list returns all resources at the path that match the filter, one page at a time
+func (c *Client) list(ctx context.Context, path, filter string) ([]map[string]any, error) {
+	var resources []map[string]any
+	startIndex := 1
+	for {
+		query := url.Values{}
+		query.Set("startIndex", strconv.Itoa(startIndex))
+		query.Set("count", strconv.Itoa(c.PageSize))
+		if filter != "" {
+			query.Set("filter", filter)
+		}
+
+		var page listResponse
+		if err := c.do(ctx, http.MethodGet, path, query, nil, &page); err != nil {
+			return nil, err
+		}
+		resources = append(resources, page.Resources...)
+
+		if len(page.Resources) == 0 || startIndex-1+len(page.Resources) >= page.TotalResults {
+			return resources, nil
+		}
+		startIndex += len(page.Resources)
+	}
+}
+
+// do sends a request and decodes the response into out, if it is not nil. A request is retried if the server
+// responds with 429 Too Many Requests or 503 Service Unavailable, after the delay given in any Retry-After header.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("unable to encode the request to %s: %w", path, err)
+		}
+	}
+
+	requestURL := c.BaseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+		req.Header.Set("Accept", contentType+", application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := c.client().Do(req)
+		if err != nil {
+			return fmt.Errorf("%s %s failed: %w", method, path, err)
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read the response to %s %s: %w", method, path, err)
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if retryable && attempt < internal.MaxRetries {
+			if err := internal.Sleep(ctx, internal.RetryDelay(resp.Header.Get("Retry-After"), attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return newError(resp.StatusCode, responseBody)
+		}
+		if out == nil || len(responseBody) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(responseBody, out); err != nil {
+			return fmt.Errorf("unable to decode the response to %s %s: %w", method, path, err)
+		}
+		return nil
+	}
+}
+
+func (c *Client) client() *http.Client {
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: time.Duration(c.HttpTimeoutSeconds) * time.Second}
+	}
+	return c.httpClient
+}
+
+func newError(status int, body []byte) *Error {
+	e := &Error{Status: status}
+	var response struct {
+		ScimType string
+		Detail   string
+	}
+	if json.Unmarshal(body, &response) == nil {
+		e.ScimType = response.ScimType
+		e.Detail = response.Detail
+	}
+	if e.Detail == "" && e.ScimType == "" {
+		e.Detail = strings.TrimSpace(string(body))
+		if len(e.Detail) > 200 {
+			e.Detail = e.Detail[:200]
+		}
+	}
+	return e
+}
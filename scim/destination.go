@@ -0,0 +1,529 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DeleteActionDeactivate = "Deactivate"
+	DeleteActionDelete     = "Delete"
+
+	DefaultCompareAttribute = "userName"
+)
+
+// SCIMDestination manages the users of a SCIM 2.0 service provider, and optionally the members of a group
+type SCIMDestination struct {
+	Client
+
+	// DestinationSyncSet holds the defaults for each sync set
+	DestinationSyncSet
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           DestinationSyncSet         `json:"-"`
+
+	compareAttribute attributePath
+	groupID          string
+}
+
+// DestinationSyncSet configures a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type DestinationSyncSet struct {
+	Filter           string // a SCIM filter that selects the users to sync, such as `title eq "Staff"`
+	CompareAttribute string // the attribute path that identifies a user, default "userName"
+	DeleteAction     string // "Deactivate" (default) or "Delete"
+
+	// GroupID or GroupDisplayName identifies a group whose members are synced. Users are created and updated as
+	// needed, but deleted people are only removed from the group.
+	GroupID          string
+	GroupDisplayName string
+	ExtraMembers     []string // compare values of group members that are never removed
+}
+
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+// NewSCIMDestination unmarshals the destinationConfig's ExtraJSON into a SCIMDestination struct. No requests are made
+// until ListUsers or ApplyChangeSet is called.
+func NewSCIMDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var s SCIMDestination
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &s); err != nil {
+		return nil, fmt.Errorf("error reading SCIM destination config: %w", err)
+	}
+
+	if err := s.Client.validate(); err != nil {
+		return nil, fmt.Errorf("invalid SCIM destination config: %w", err)
+	}
+
+	s.DestinationConfig = destinationConfig
+	return &s, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (s *SCIMDestination) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := s.DestinationSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if err := syncSet.validate(); err != nil {
+		return err
+	}
+	compareAttribute, err := parsePath(syncSet.CompareAttribute)
+	if err != nil {
+		return fmt.Errorf("invalid CompareAttribute: %w", err)
+	}
+
+	s.SyncSet = syncSet
+	s.compareAttribute = compareAttribute
+	s.groupID = syncSet.GroupID
+	return nil
+}
+
+func (s *DestinationSyncSet) validate() error {
+	if s.CompareAttribute == "" {
+		s.CompareAttribute = DefaultCompareAttribute
+	}
+	switch s.DeleteAction {
+	case "":
+		s.DeleteAction = DeleteActionDeactivate
+	case DeleteActionDeactivate, DeleteActionDelete:
+	default:
+		return fmt.Errorf("invalid DeleteAction %q, must be %s or %s", s.DeleteAction,
+			DeleteActionDeactivate, DeleteActionDelete)
+	}
+	if s.GroupID != "" && s.GroupDisplayName != "" {
+		return errors.New("only one of GroupID and GroupDisplayName may be set")
+	}
+	return nil
+}
+
+// ListUsers returns the users that match the Filter and, if a group is set, are members of the group. Without a
+// group, inactive users are not included unless the DeleteAction is Delete. The ID of each person is the user's id.
+func (s *SCIMDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	paths, err := parsePaths(desiredAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.list(ctx, "/Users", s.SyncSet.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+
+	var members map[string]bool
+	if s.grouped() {
+		if members, err = s.groupMembers(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	people := []internal.Person{}
+	for _, user := range users {
+		id, _ := formatValue(lookup(user, "id"))
+		if members != nil && !members[id] {
+			continue
+		}
+		if members == nil && s.SyncSet.DeleteAction == DeleteActionDeactivate && lookup(user, "active") == false {
+			continue
+		}
+
+		compareValue, _ := s.compareAttribute.get(user)
+		if compareValue == "" || slices.Contains(s.SyncSet.ExtraMembers, compareValue) {
+			continue
+		}
+
+		people = append(people, internal.Person{CompareValue: compareValue, ID: id, Attributes: flatten(user, paths)})
+	}
+	return people, nil
+}
+
+// groupMembers returns the ids of the group's members
+func (s *SCIMDestination) groupMembers(ctx context.Context) (map[string]bool, error) {
+	groupID, err := s.resolveGroupID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var group struct {
+		Members []struct{ Value string }
+	}
+	query := url.Values{"attributes": {"members"}}
+	if err := s.do(ctx, http.MethodGet, "/Groups/"+url.PathEscape(groupID), query, nil, &group); err != nil {
+		return nil, fmt.Errorf("unable to get members of group %s: %w", s.groupName(), err)
+	}
+
+	members := map[string]bool{}
+	for _, member := range group.Members {
+		members[member.Value] = true
+	}
+	return members, nil
+}
+
+// ApplyChangeSet creates, updates, and deactivates or deletes users. If a group is set, people are added to and
+// removed from the group rather than deactivated or deleted.
+func (s *SCIMDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	var results internal.ChangeResults
+	if internal.Stopping(ctx) {
+		return results
+	}
+
+	if s.grouped() {
+		if _, err := s.resolveGroupID(ctx); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:   syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to apply changes to %s: %s", s.BaseURL, err),
+			}
+			return results
+		}
+	}
+
+	if !s.DestinationConfig.DisableAdd {
+		for _, person := range changes.Create {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if s.addPerson(ctx, person, eventLog) {
+				results.Created++
+			}
+		}
+	}
+
+	if !s.DestinationConfig.DisableUpdate {
+		for _, person := range changes.Update {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if s.updatePerson(ctx, person, eventLog) {
+				results.Updated++
+			}
+		}
+	}
+
+	if !s.DestinationConfig.DisableDelete {
+		for _, person := range changes.Delete {
+			if internal.Stopping(ctx) {
+				break
+			}
+			if s.deletePerson(ctx, person, eventLog) {
+				results.Deleted++
+			}
+		}
+	}
+
+	return results
+}
+
+// addPerson creates the person's user, or activates it if it is inactive, and adds it to the group
+func (s *SCIMDestination) addPerson(
+	ctx context.Context,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	user, err := s.findUser(ctx, person.CompareValue)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to find", person, err)
+		return false
+	}
+
+	var id string
+	switch {
+	case user == nil:
+		if id, err = s.createUser(ctx, person); err != nil {
+			eventLog <- internal.ErrorEvent("unable to create", person, err)
+			return false
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddPerson " + person.CompareValue}
+	case lookup(user, "active") == false:
+		id, _ = formatValue(lookup(user, "id"))
+		if err := s.activateUser(ctx, id, person); err != nil {
+			eventLog <- internal.ErrorEvent("unable to activate", person, err)
+			return false
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "ActivatePerson " + person.CompareValue}
+	case !s.grouped():
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_WARNING,
+			Message: fmt.Sprintf("unable to add %s, a user already exists that does not match the Filter", person.CompareValue),
+		}
+		return false
+	default:
+		id, _ = formatValue(lookup(user, "id"))
+	}
+
+	if !s.grouped() {
+		return true
+	}
+
+	add := patchOperation{Op: "add", Path: "members", Value: []map[string]string{{"value": id}}}
+	if err := s.patch(ctx, "/Groups/"+url.PathEscape(s.groupID), add); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to add %s to group %s: %s", person.CompareValue, s.groupName(), err),
+		}
+		return false
+	}
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddMember " + person.CompareValue}
+	return true
+}
+
+// updatePerson sends a PATCH request with an operation for each changed attribute
+func (s *SCIMDestination) updatePerson(
+	ctx context.Context,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	id, err := s.personID(ctx, person)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to update", person, err)
+		return false
+	}
+
+	changes := person.Changes
+	if len(changes) == 0 {
+		for _, attr := range sortedAttributes(person.Attributes) {
+			changes = append(changes, internal.AttributeChange{Attribute: attr, New: person.Attributes[attr]})
+		}
+	}
+
+	var operations []patchOperation
+	for _, change := range changes {
+		path, err := parsePath(change.Attribute)
+		if err != nil {
+			eventLog <- internal.ErrorEvent("unable to update", person, err)
+			return false
+		}
+		if strings.EqualFold(path.Attribute, "id") && path.Schema == "" {
+			continue
+		}
+		operations = append(operations, changeOperation(path, change))
+	}
+
+	if len(operations) > 0 {
+		if err := s.patch(ctx, "/Users/"+url.PathEscape(id), operations...); err != nil {
+			eventLog <- internal.ErrorEvent("unable to update", person, err)
+			return false
+		}
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdatePerson %s, changed: %s", person.CompareValue,
+			strings.Join(person.ChangedAttributeNames(), ", ")),
+	}
+	return true
+}
+
+// deletePerson removes the person from the group or, without a group, deactivates or deletes the person's user
+func (s *SCIMDestination) deletePerson(
+	ctx context.Context,
+	person internal.Person,
+	eventLog chan<- internal.EventLogItem,
+) bool {
+	id, err := s.personID(ctx, person)
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to delete", person, err)
+		return false
+	}
+
+	var message string
+	switch {
+	case s.grouped():
+		filter, _ := json.Marshal(id)
+		err = s.patch(ctx, "/Groups/"+url.PathEscape(s.groupID),
+			patchOperation{Op: "remove", Path: fmt.Sprintf("members[value eq %s]", filter)})
+		message = "RemoveMember "
+	case s.SyncSet.DeleteAction == DeleteActionDeactivate:
+		err = s.patch(ctx, "/Users/"+url.PathEscape(id), patchOperation{Op: "replace", Path: "active", Value: false})
+		message = "DeactivatePerson "
+	default:
+		err = s.do(ctx, http.MethodDelete, "/Users/"+url.PathEscape(id), nil, nil, nil)
+		if internal.IsStatus(err, http.StatusNotFound) {
+			err = nil
+		}
+		message = "DeletePerson "
+	}
+	if err != nil {
+		eventLog <- internal.ErrorEvent("unable to delete", person, err)
+		return false
+	}
+
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: message + person.CompareValue}
+	return true
+}
+
+// createUser POSTs a new, active user with the person's attributes, and returns its id
+func (s *SCIMDestination) createUser(ctx context.Context, person internal.Person) (string, error) {
+	user := map[string]any{"active": true}
+	schemas := []string{SchemaUser}
+	for _, attr := range sortedAttributes(person.Attributes) {
+		value := person.Attributes[attr]
+		path, err := parsePath(attr)
+		if err != nil {
+			return "", err
+		}
+		if value == "" || (strings.EqualFold(path.Attribute, "id") && path.Schema == "") {
+			continue
+		}
+		path.set(user, value)
+		if path.Schema != "" && !slices.Contains(schemas, path.Schema) {
+			schemas = append(schemas, path.Schema)
+		}
+	}
+	s.compareAttribute.set(user, person.CompareValue)
+	user["schemas"] = schemas
+
+	var created map[string]any
+	if err := s.do(ctx, http.MethodPost, "/Users", nil, user, &created); err != nil {
+		return "", err
+	}
+	id, _ := formatValue(lookup(created, "id"))
+	if id == "" {
+		return "", errors.New("no id in the response")
+	}
+	return id, nil
+}
+
+// activateUser sets an inactive user to active and replaces its attributes with the person's
+func (s *SCIMDestination) activateUser(ctx context.Context, id string, person internal.Person) error {
+	operations := []patchOperation{{Op: "replace", Path: "active", Value: true}}
+	for _, attr := range sortedAttributes(person.Attributes) {
+		value := person.Attributes[attr]
+		path, err := parsePath(attr)
+		if err != nil {
+			return err
+		}
+		if value == "" || (path.Schema == "" && (strings.EqualFold(path.Attribute, "id") ||
+			strings.EqualFold(path.Attribute, "active"))) {
+			continue
+		}
+		operations = append(operations, changeOperation(path, internal.AttributeChange{Attribute: attr, New: value}))
+	}
+	return s.patch(ctx, "/Users/"+url.PathEscape(id), operations...)
+}
+
+// findUser returns the user with the given compare value, or nil if there is none. The Filter is not applied, so
+// that an existing user is found even if it no longer matches.
+func (s *SCIMDestination) findUser(ctx context.Context, compareValue string) (map[string]any, error) {
+	users, err := s.list(ctx, "/Users", s.compareAttribute.equalityFilter(compareValue))
+	if err != nil {
+		return nil, err
+	}
+	switch len(users) {
+	case 0:
+		return nil, nil
+	case 1:
+		return users[0], nil
+	default:
+		return nil, fmt.Errorf("%d users have %s %s", len(users), s.compareAttribute, compareValue)
+	}
+}
+
+// personID returns the id of the person's user, from the ID set by ListUsers if possible
+func (s *SCIMDestination) personID(ctx context.Context, person internal.Person) (string, error) {
+	if person.ID != "" {
+		return person.ID, nil
+	}
+	user, err := s.findUser(ctx, person.CompareValue)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("user not found")
+	}
+	id, _ := formatValue(lookup(user, "id"))
+	return id, nil
+}
+
+// resolveGroupID finds the id of the group named by GroupDisplayName, if the GroupID is not set
+func (s *SCIMDestination) resolveGroupID(ctx context.Context) (string, error) {
+	if s.groupID != "" {
+		return s.groupID, nil
+	}
+
+	displayName, _ := json.Marshal(s.SyncSet.GroupDisplayName)
+	groups, err := s.list(ctx, "/Groups", fmt.Sprintf("displayName eq %s", displayName))
+	if err != nil {
+		return "", fmt.Errorf("unable to find group %s: %w", s.groupName(), err)
+	}
+	if len(groups) != 1 {
+		return "", fmt.Errorf("found %d groups with displayName %s", len(groups), s.groupName())
+	}
+	id, _ := formatValue(lookup(groups[0], "id"))
+	if id == "" {
+		return "", fmt.Errorf("group %s has no id", s.groupName())
+	}
+	s.groupID = id
+	return id, nil
+}
+
+func (s *SCIMDestination) patch(ctx context.Context, path string, operations ...patchOperation) error {
+	request := patchRequest{Schemas: []string{SchemaPatchOp}, Operations: operations}
+	return s.do(ctx, http.MethodPatch, path, nil, request, nil)
+}
+
+func (s *SCIMDestination) grouped() bool {
+	return s.SyncSet.GroupID != "" || s.SyncSet.GroupDisplayName != ""
+}
+
+func (s *SCIMDestination) groupName() string {
+	if s.SyncSet.GroupDisplayName != "" {
+		return s.SyncSet.GroupDisplayName
+	}
+	return s.SyncSet.GroupID
+}
+
+// changeOperation returns the PATCH operation for a changed attribute. An empty value is removed. A value selected by
+// a filter, such as `emails[type eq "work"].value`, is added with its filter attribute if it had no old value, since
+// a replace operation fails if no value matches the filter.
+func changeOperation(path attributePath, change internal.AttributeChange) patchOperation {
+	switch {
+	case change.New == "":
+		return patchOperation{Op: "remove", Path: path.String()}
+	case path.FilterAttribute != "" && change.Old == "":
+		subAttribute := path.SubAttribute
+		if subAttribute == "" {
+			subAttribute = "value"
+		}
+		value := map[string]any{
+			path.FilterAttribute: path.FilterValue,
+			subAttribute:         typedValue(subAttribute, change.New),
+		}
+		attribute := path.Attribute
+		if path.Schema != "" {
+			attribute = path.Schema + ":" + attribute
+		}
+		return patchOperation{Op: "add", Path: attribute, Value: []any{value}}
+	}
+
+	attribute := path.SubAttribute
+	if attribute == "" {
+		attribute = path.Attribute
+	}
+	return patchOperation{Op: "replace", Path: path.String(), Value: typedValue(attribute, change.New)}
+}
+
+func sortedAttributes(attributes map[string]string) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,308 @@
+package scim
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestSCIMDestination(t *testing.T, service *testService, extraJSON, syncSet string) *SCIMDestination {
+	config := `{"BaseURL": "` + service.URL + `", "BearerToken": "` + testBearerToken + `", "PageSize": 2`
+	if extraJSON != "" {
+		config += ", " + extraJSON
+	}
+	config += "}"
+
+	destination, err := NewSCIMDestination(internal.DestinationConfig{
+		Type:      internal.DestinationTypeSCIM,
+		ExtraJSON: []byte(config),
+	})
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*SCIMDestination)
+}
+
+func applyTestChanges(
+	t *testing.T,
+	s *SCIMDestination,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := s.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+func TestSCIMDestination_ListUsers(t *testing.T) {
+	service := startTestService(t, testUsers(), nil)
+	service.busy(1)
+	s := newTestSCIMDestination(t, service, "", `{}`)
+
+	people, err := s.ListUsers(context.Background(), []string{
+		"name.givenName",
+		`emails[type eq "work"].value`,
+		SchemaEnterpriseUser + ":employeeNumber",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{
+			CompareValue: "ann@example.org",
+			ID:           "1",
+			Attributes: map[string]string{
+				"name.givenName":                         "Ann",
+				`emails[type eq "work"].value`:           "ann@example.org",
+				SchemaEnterpriseUser + ":employeeNumber": "101",
+			},
+		},
+		{CompareValue: "bob@example.org", ID: "2", Attributes: map[string]string{"name.givenName": "Bob"}},
+	}, people, "the inactive user is not included")
+	require.Equal(t, 3, len(service.Requests()), "one retry and two pages")
+}
+
+func TestSCIMDestination_users(t *testing.T) {
+	service := startTestService(t, testUsers(), nil)
+	s := newTestSCIMDestination(t, service, "", `{}`)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{
+			{
+				CompareValue: "dan@example.org",
+				Attributes: map[string]string{
+					"userName":                               "dan@example.org",
+					"name.givenName":                         "Dan",
+					`emails[type eq "work"].value`:           "dan@example.org",
+					SchemaEnterpriseUser + ":employeeNumber": "104",
+					"title":                                  "",
+				},
+			},
+			{CompareValue: "cat@example.org", Attributes: map[string]string{"name.givenName": "Kat"}},
+		},
+		Update: []internal.Person{{
+			CompareValue: "ann@example.org",
+			ID:           "1",
+			Attributes:   map[string]string{"name.givenName": "Anne"},
+			Changes: []internal.AttributeChange{
+				{Attribute: "name.givenName", Old: "Ann", New: "Anne"},
+				{Attribute: `emails[type eq "work"].value`, Old: "ann@example.org", New: ""},
+				{Attribute: `emails[type eq "home"].value`, Old: "", New: "ann@home.example"},
+			},
+		}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: "2"}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 2, Updated: 1, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddPerson dan@example.org",
+		"ActivatePerson cat@example.org",
+		`UpdatePerson ann@example.org, changed: name.givenName, emails[type eq "work"].value, ` +
+			`emails[type eq "home"].value`,
+		"DeactivatePerson bob@example.org",
+	}, messages)
+
+	dan := service.user("100")
+	require.Equal(t, map[string]any{
+		"id":                 "100",
+		"schemas":            []any{SchemaUser, SchemaEnterpriseUser},
+		"active":             true,
+		"userName":           "dan@example.org",
+		"name":               map[string]any{"givenName": "Dan"},
+		"emails":             []any{map[string]any{"type": "work", "value": "dan@example.org"}},
+		SchemaEnterpriseUser: map[string]any{"employeeNumber": "104"},
+	}, dan)
+
+	cat := service.user("3")
+	require.Equal(t, true, cat["active"])
+	require.Equal(t, map[string]any{"givenName": "Kat", "familyName": "Brown"}, cat["name"])
+
+	ann := service.user("1")
+	require.Equal(t, map[string]any{"givenName": "Anne", "familyName": "Smith"}, ann["name"])
+	require.Equal(t, []any{map[string]any{"type": "home", "value": "ann@home.example"}}, ann["emails"])
+
+	require.Equal(t, false, service.user("2")["active"])
+}
+
+func TestSCIMDestination_users_delete(t *testing.T) {
+	service := startTestService(t, testUsers(), nil)
+	s := newTestSCIMDestination(t, service, `"DeleteAction": "Delete"`, `{"Filter": "name.familyName eq \"Jones\""}`)
+
+	people, err := s.ListUsers(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{{CompareValue: "bob@example.org", ID: "2", Attributes: map[string]string{}}},
+		people)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "ann@example.org"}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: "2"}},
+	})
+	require.Equal(t, internal.ChangeResults{Deleted: 1}, results)
+	require.Equal(t, []string{
+		"unable to add ann@example.org, a user already exists that does not match the Filter",
+		"DeletePerson bob@example.org",
+	}, messages)
+	require.Nil(t, service.user("2"))
+}
+
+func TestSCIMDestination_group(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	s := newTestSCIMDestination(t, service, `"ExtraMembers": ["ann@example.org"]`, `{"GroupDisplayName": "Staff"}`)
+
+	people, err := s.ListUsers(context.Background(), []string{"name.givenName"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{CompareValue: "bob@example.org", ID: "2", Attributes: map[string]string{"name.givenName": "Bob"}},
+	}, people)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "cat@example.org", Attributes: map[string]string{"name.givenName": "Cat"}},
+			{CompareValue: "dan@example.org", Attributes: map[string]string{"name.givenName": "Dan"}},
+		},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: "2"}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 2, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"ActivatePerson cat@example.org",
+		"AddMember cat@example.org",
+		"AddPerson dan@example.org",
+		"AddMember dan@example.org",
+		"RemoveMember bob@example.org",
+	}, messages)
+
+	require.Equal(t, []any{
+		map[string]any{"value": "1"},
+		map[string]any{"value": "3"},
+		map[string]any{"value": "100"},
+	}, service.group("g1")["members"])
+	require.Equal(t, true, service.user("2")["active"], "removing a member does not deactivate the user")
+}
+
+func TestSCIMDestination_disabled(t *testing.T) {
+	service := startTestService(t, testUsers(), testGroups())
+	destination, err := NewSCIMDestination(internal.DestinationConfig{
+		ExtraJSON:     []byte(`{"BaseURL": "` + service.URL + `", "BearerToken": "` + testBearerToken + `"}`),
+		DisableAdd:    true,
+		DisableUpdate: true,
+		DisableDelete: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(`{"GroupID": "g1"}`)))
+
+	results, messages := applyTestChanges(t, destination.(*SCIMDestination), internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "dan@example.org"}},
+		Update: []internal.Person{{CompareValue: "ann@example.org", ID: "1", Attributes: map[string]string{"title": "x"}}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: "2"}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Empty(t, messages)
+	require.Empty(t, service.Changes())
+}
+
+func TestSCIMDestination_errors(t *testing.T) {
+	service := startTestService(t, testUsers(), nil)
+	s := newTestSCIMDestination(t, service, "", `{"GroupID": "missing"}`)
+
+	_, err := s.ListUsers(context.Background(), nil)
+	require.ErrorContains(t, err, "unable to get members of group missing: SCIM error 404: not found")
+
+	s = newTestSCIMDestination(t, service, `"BearerToken": "wrong"`, `{}`)
+	_, err = s.ListUsers(context.Background(), nil)
+	require.ErrorContains(t, err, "SCIM error 401: invalid token")
+	require.True(t, internal.IsStatus(err, http.StatusUnauthorized))
+}
+
+func TestSCIMDestination_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "users",
+			syncSet: `{"Filter": "title eq \"Staff\"", "DeleteAction": "Delete"}`,
+		},
+		{
+			name:    "group",
+			syncSet: `{"GroupDisplayName": "Staff", "CompareAttribute": "emails[type eq \"work\"].value"}`,
+		},
+		{
+			name:       "invalid delete action",
+			syncSet:    `{"DeleteAction": "Suspend"}`,
+			wantErrMsg: "invalid DeleteAction",
+		},
+		{
+			name:       "two groups",
+			syncSet:    `{"GroupID": "g1", "GroupDisplayName": "Staff"}`,
+			wantErrMsg: "only one of GroupID and GroupDisplayName",
+		},
+		{
+			name:       "invalid compare attribute",
+			syncSet:    `{"CompareAttribute": "emails[type ne \"work\"]"}`,
+			wantErrMsg: "invalid CompareAttribute",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewSCIMDestination(internal.DestinationConfig{
+				ExtraJSON: []byte(`{"BaseURL": "https://example.com/scim/v2", "BearerToken": "token"}`),
+			})
+			require.NoError(t, err)
+
+			err = destination.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewSCIMDestination(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		wantErrMsg string
+	}{
+		{
+			name:      "valid",
+			extraJSON: `{"BaseURL": "https://example.com/scim/v2/", "BearerToken": "token"}`,
+		},
+		{
+			name:       "no url",
+			extraJSON:  `{"BearerToken": "token"}`,
+			wantErrMsg: "BaseURL is required",
+		},
+		{
+			name:       "invalid url",
+			extraJSON:  `{"BaseURL": "example.com/scim", "BearerToken": "token"}`,
+			wantErrMsg: "invalid BaseURL",
+		},
+		{
+			name:       "no token",
+			extraJSON:  `{"BaseURL": "https://example.com/scim/v2"}`,
+			wantErrMsg: "BearerToken is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewSCIMDestination(internal.DestinationConfig{ExtraJSON: []byte(tt.extraJSON)})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			s := destination.(*SCIMDestination)
+			require.Equal(t, "https://example.com/scim/v2", s.BaseURL)
+			require.Equal(t, DefaultHttpTimeoutSeconds, s.HttpTimeoutSeconds)
+			require.Equal(t, DefaultPageSize, s.PageSize)
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// filter is a parsed SCIM filter, as in the filter query parameter of a list request
+type filter interface {
+	matches(resource map[string]any) bool
+}
+
+type andFilter []filter
+
+type orFilter []filter
+
+type notFilter struct {
+	filter filter
+}
+
+// comparison is an attribute expression, such as `userName eq "ann"` or `title pr`
+type comparison struct {
+	path     attributePath
+	operator string
+	value    string
+}
+
+var operators = []string{"eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le", "pr"}
+
+// parseFilter parses a SCIM filter with the operators of RFC 7644 section 3.4.2.2. A value path in an attribute,
+// such as `emails[type eq "work"].value`, may only have a single eq condition. String comparisons ignore case.
+func parseFilter(s string) (filter, error) {
+	p := &filterParser{tokens: tokenizeFilter(s)}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+func (f andFilter) matches(resource map[string]any) bool {
+	for _, part := range f {
+		if !part.matches(resource) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f orFilter) matches(resource map[string]any) bool {
+	for _, part := range f {
+		if part.matches(resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f notFilter) matches(resource map[string]any) bool {
+	return !f.filter.matches(resource)
+}
+
+func (c comparison) matches(resource map[string]any) bool {
+	values := c.path.values(resource)
+	if c.operator == "pr" {
+		return slices.ContainsFunc(values, func(v string) bool { return v != "" })
+	}
+	if c.operator == "ne" {
+		return !slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, c.value) })
+	}
+	return slices.ContainsFunc(values, func(v string) bool { return compare(v, c.operator, c.value) })
+}
+
+// compare applies an operator other than pr or ne, comparing numbers numerically and other values as strings
+func compare(value, operator, operand string) bool {
+	a, b := strings.ToLower(value), strings.ToLower(operand)
+	order := strings.Compare(a, b)
+	if x, err := strconv.ParseFloat(value, 64); err == nil {
+		if y, err := strconv.ParseFloat(operand, 64); err == nil {
+			order = compareFloats(x, y)
+		}
+	}
+
+	switch operator {
+	case "eq":
+		return order == 0
+	case "co":
+		return strings.Contains(a, b)
+	case "sw":
+		return strings.HasPrefix(a, b)
+	case "ew":
+		return strings.HasSuffix(a, b)
+	case "gt":
+		return order > 0
+	case "ge":
+		return order >= 0
+	case "lt":
+		return order < 0
+	case "le":
+		return order <= 0
+	}
+	return false
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	var parts orFilter
+	for {
+		part, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		if !p.accept("or") {
+			break
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return parts, nil
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	var parts andFilter
+	for {
+		part, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		if !p.accept("and") {
+			break
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return parts, nil
+}
+
+func (p *filterParser) parseFactor() (filter, error) {
+	if p.accept("not") {
+		if !p.accept("(") {
+			return nil, fmt.Errorf("expected ( after not in filter")
+		}
+		f, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{filter: f}, nil
+	}
+	if p.accept("(") {
+		return p.parseGroup()
+	}
+	return p.parseComparison()
+}
+
+// parseGroup parses a filter in parentheses, after the opening parenthesis
+func (p *filterParser) parseGroup() (filter, error) {
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(")") {
+		return nil, fmt.Errorf("expected ) in filter")
+	}
+	return f, nil
+}
+
+func (p *filterParser) parseComparison() (filter, error) {
+	attribute, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	path, err := parsePath(attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	operator, ok := p.next()
+	operator = strings.ToLower(operator)
+	if !ok || !slices.Contains(operators, operator) {
+		return nil, fmt.Errorf("expected an operator after %s in filter", attribute)
+	}
+	if operator == "pr" {
+		return comparison{path: path, operator: operator}, nil
+	}
+
+	token, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("expected a value after %s %s in filter", attribute, operator)
+	}
+	var value any
+	if err := json.Unmarshal([]byte(token), &value); err != nil {
+		return nil, fmt.Errorf("invalid value %s in filter", token)
+	}
+	formatted, _ := formatValue(value)
+	return comparison{path: path, operator: operator, value: formatted}, nil
+}
+
+func (p *filterParser) next() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	p.pos++
+	return p.tokens[p.pos-1], true
+}
+
+// accept moves past the next token if it is the given keyword or parenthesis
+func (p *filterParser) accept(token string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], token) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// tokenizeFilter splits a filter into parentheses, quoted strings, and words. A value path in brackets, such as
+// emails[type eq "work"], is kept in the word it belongs to.
+func tokenizeFilter(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(s))
+			tokens = append(tokens, s[i:end])
+			i = end
+		default:
+			end, depth := i, 0
+			for end < len(s) {
+				c := s[end]
+				if depth == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '(' || c == ')') {
+					break
+				}
+				switch c {
+				case '[':
+					depth++
+				case ']':
+					depth--
+				case '"':
+					for end++; end < len(s) && s[end] != '"'; end++ {
+						if s[end] == '\\' {
+							end++
+						}
+					}
+				}
+				end++
+			}
+			tokens = append(tokens, s[i:min(end, len(s))])
+			i = end
+		}
+	}
+	return tokens
+}
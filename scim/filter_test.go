@@ -0,0 +1,64 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	user := map[string]any{
+		"userName": "ann@example.org",
+		"active":   true,
+		"title":    "Engineer",
+		"name":     map[string]any{"givenName": "Ann", "familyName": "Smith"},
+		"emails": []any{
+			map[string]any{"type": "work", "value": "ann@example.org", "primary": true},
+			map[string]any{"type": "home", "value": "ann@home.example"},
+		},
+		SchemaEnterpriseUser: map[string]any{"employeeNumber": "101"},
+		"meta":               map[string]any{"lastModified": "2026-03-01T10:00:00Z"},
+	}
+
+	tests := []struct {
+		filter     string
+		want       bool
+		wantErrMsg string
+	}{
+		{filter: `userName eq "ANN@example.org"`, want: true},
+		{filter: `userName ne "ann@example.org"`, want: false},
+		{filter: `department ne "IT"`, want: true},
+		{filter: `title co "gin"`, want: true},
+		{filter: `title sw "Eng" and name.familyName ew "ith"`, want: true},
+		{filter: `title sw "Man" or name.givenName eq "Ann"`, want: true},
+		{filter: `not (title sw "Eng")`, want: false},
+		{filter: `title pr and department pr`, want: false},
+		{filter: `active eq true`, want: true},
+		{filter: `emails.value eq "ann@home.example"`, want: true},
+		{filter: `emails[type eq "work"].value eq "ann@home.example"`, want: false},
+		{filter: `emails[type eq "home"].value co "home"`, want: true},
+		{filter: SchemaEnterpriseUser + `:employeeNumber gt "99"`, want: true},
+		{filter: SchemaEnterpriseUser + `:employeeNumber le 100`, want: false},
+		{filter: `meta.lastModified ge "2026-01-01T00:00:00Z"`, want: true},
+		{filter: `(title eq "Manager" or title eq "Engineer") and (active eq true)`, want: true},
+		{filter: `userName EQ "ann@example.org" AND NOT (title eq "x")`, want: true},
+		{filter: `userName`, wantErrMsg: "expected an operator"},
+		{filter: `userName xx "a"`, wantErrMsg: "expected an operator"},
+		{filter: `userName eq`, wantErrMsg: "expected a value"},
+		{filter: `userName eq ann`, wantErrMsg: "invalid value"},
+		{filter: `(userName eq "a"`, wantErrMsg: "expected )"},
+		{filter: `userName eq "a" title eq "b"`, wantErrMsg: "unexpected"},
+		{filter: `emails[type ne "work"].value pr`, wantErrMsg: "only filters like"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := parseFilter(tt.filter)
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, f.matches(user))
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SchemaUser           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaEnterpriseUser = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SchemaListResponse   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError          = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	// MultiValueSeparator joins the values of a multi-valued attribute, such as a list of roles
+	MultiValueSeparator = "|"
+)
+
+// valueFilter matches the filter of a value path, as in emails[type eq "work"]
+var valueFilter = regexp.MustCompile(`^\s*([A-Za-z][\w$-]*)\s+eq\s+("(?:[^"\\]|\\.)*"|true|false|[-\d.]+)\s*$`)
+
+// attributePath is an attribute name used in the AttributeMap, which is a SCIM attribute path such as "userName",
+// "name.givenName", `emails[type eq "work"].value`, or an extension attribute such as
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber".
+type attributePath struct {
+	raw             string
+	Schema          string // the URN of an extension schema, or empty for the core schema
+	Attribute       string
+	FilterAttribute string // with FilterValue, selects one value of a multi-valued attribute
+	FilterValue     any
+	SubAttribute    string
+}
+
+func parsePath(path string) (attributePath, error) {
+	p := attributePath{raw: path}
+	rest := path
+
+	if strings.HasPrefix(strings.ToLower(rest), "urn:") {
+		// the URN itself contains dots, as in "2.0", so the attribute name follows the last colon before any filter
+		end := strings.Index(rest, "[")
+		if end < 0 {
+			end = len(rest)
+		}
+		i := strings.LastIndex(rest[:end], ":")
+		p.Schema, rest = rest[:i], rest[i+1:]
+		if strings.EqualFold(p.Schema, SchemaUser) || strings.EqualFold(p.Schema, SchemaGroup) {
+			p.Schema = ""
+		}
+	}
+
+	if open := strings.Index(rest, "["); open >= 0 {
+		closing := strings.LastIndex(rest, "]")
+		if closing < open {
+			return p, fmt.Errorf("invalid attribute path %q, missing ]", path)
+		}
+		m := valueFilter.FindStringSubmatch(rest[open+1 : closing])
+		if m == nil {
+			return p, fmt.Errorf(`invalid attribute path %q, only filters like [type eq "work"] are supported`, path)
+		}
+		p.FilterAttribute = m[1]
+		if err := json.Unmarshal([]byte(m[2]), &p.FilterValue); err != nil {
+			return p, fmt.Errorf("invalid filter value in attribute path %q: %w", path, err)
+		}
+		after := rest[closing+1:]
+		rest = rest[:open]
+		if after != "" {
+			if !strings.HasPrefix(after, ".") {
+				return p, fmt.Errorf("invalid attribute path %q", path)
+			}
+			p.SubAttribute = after[1:]
+		}
+	} else if attr, sub, ok := strings.Cut(rest, "."); ok {
+		rest, p.SubAttribute = attr, sub
+	}
+
+	p.Attribute = rest
+	if p.Attribute == "" || strings.ContainsAny(p.Attribute, " .[]\"") || strings.ContainsAny(p.SubAttribute, " .[]\"") {
+		return p, fmt.Errorf("invalid attribute path %q", path)
+	}
+	return p, nil
+}
+
+// parsePaths parses each of the attribute paths
+func parsePaths(paths []string) ([]attributePath, error) {
+	parsed := make([]attributePath, len(paths))
+	for i, path := range paths {
+		p, err := parsePath(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = p
+	}
+	return parsed, nil
+}
+
+// flatten returns the value at each path in a resource, keyed by the path as written. Paths with no value are not
+// included.
+func flatten(resource map[string]any, paths []attributePath) map[string]string {
+	attributes := map[string]string{}
+	for _, path := range paths {
+		if value, ok := path.get(resource); ok {
+			attributes[path.raw] = value
+		}
+	}
+	return attributes
+}
+
+func (p attributePath) String() string {
+	return p.raw
+}
+
+// get returns the value at the path in a resource, formatted as a string, and false if there is none
+func (p attributePath) get(resource map[string]any) (string, bool) {
+	container := resource
+	if p.Schema != "" {
+		extension, ok := lookup(resource, p.Schema).(map[string]any)
+		if !ok {
+			return "", false
+		}
+		container = extension
+	}
+
+	value := lookup(container, p.Attribute)
+	if values, ok := value.([]any); ok && (p.FilterAttribute != "" || p.SubAttribute != "") {
+		value = p.selectValue(values)
+	}
+	if p.SubAttribute != "" {
+		complexValue, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		value = lookup(complexValue, p.SubAttribute)
+	}
+	return formatValue(value)
+}
+
+// values returns every value at the path in a resource, formatted as strings. Unlike get, a path such as
+// "emails.value" gives the value of each email, rather than just the primary email.
+func (p attributePath) values(resource map[string]any) []string {
+	container := resource
+	if p.Schema != "" {
+		extension, ok := lookup(resource, p.Schema).(map[string]any)
+		if !ok {
+			return nil
+		}
+		container = extension
+	}
+
+	items, ok := lookup(container, p.Attribute).([]any)
+	if !ok {
+		items = []any{lookup(container, p.Attribute)}
+	}
+
+	var values []string
+	for _, item := range items {
+		if complexValue, ok := item.(map[string]any); ok {
+			if p.FilterAttribute != "" && !equalValues(lookup(complexValue, p.FilterAttribute), p.FilterValue) {
+				continue
+			}
+			if p.SubAttribute != "" {
+				item = lookup(complexValue, p.SubAttribute)
+			}
+		} else if p.SubAttribute != "" || p.FilterAttribute != "" {
+			continue
+		}
+		if value, ok := formatValue(item); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// selectValue returns the value of a multi-valued attribute that matches the filter or, without a filter, the
+// primary value or the first value
+func (p attributePath) selectValue(values []any) any {
+	for _, value := range values {
+		complexValue, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		if p.FilterAttribute != "" && equalValues(lookup(complexValue, p.FilterAttribute), p.FilterValue) {
+			return complexValue
+		}
+		if p.FilterAttribute == "" && lookup(complexValue, "primary") == true {
+			return complexValue
+		}
+	}
+	if p.FilterAttribute == "" && len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// set sets the value at the path in a resource, adding any complex or multi-valued attributes needed
+func (p attributePath) set(resource map[string]any, value string) {
+	container := resource
+	if p.Schema != "" {
+		extension, ok := lookup(resource, p.Schema).(map[string]any)
+		if !ok {
+			extension = map[string]any{}
+			resource[p.Schema] = extension
+		}
+		container = extension
+	}
+
+	if p.FilterAttribute == "" && p.SubAttribute == "" {
+		container[p.Attribute] = typedValue(p.Attribute, value)
+		return
+	}
+
+	var complexValue map[string]any
+	if p.FilterAttribute != "" {
+		values, _ := lookup(container, p.Attribute).([]any)
+		for _, v := range values {
+			if m, ok := v.(map[string]any); ok && equalValues(lookup(m, p.FilterAttribute), p.FilterValue) {
+				complexValue = m
+			}
+		}
+		if complexValue == nil {
+			complexValue = map[string]any{p.FilterAttribute: p.FilterValue}
+			container[p.Attribute] = append(values, complexValue)
+		}
+	} else {
+		var ok bool
+		if complexValue, ok = lookup(container, p.Attribute).(map[string]any); !ok {
+			complexValue = map[string]any{}
+			container[p.Attribute] = complexValue
+		}
+	}
+
+	subAttribute := p.SubAttribute
+	if subAttribute == "" {
+		subAttribute = "value"
+	}
+	complexValue[subAttribute] = typedValue(subAttribute, value)
+}
+
+// equalityFilter returns a SCIM filter that matches resources with the value at the path
+func (p attributePath) equalityFilter(value string) string {
+	quoted, _ := json.Marshal(value)
+	if p.FilterAttribute == "" {
+		return fmt.Sprintf("%s eq %s", p.raw, quoted)
+	}
+
+	attribute := p.Attribute
+	if p.Schema != "" {
+		attribute = p.Schema + ":" + attribute
+	}
+	filterValue, _ := json.Marshal(p.FilterValue)
+	subAttribute := p.SubAttribute
+	if subAttribute == "" {
+		subAttribute = "value"
+	}
+	return fmt.Sprintf("%s[%s eq %s and %s eq %s]", attribute, p.FilterAttribute, filterValue, subAttribute, quoted)
+}
+
+// lookup returns the value of an attribute, ignoring the case of its name as SCIM requires
+func lookup(m map[string]any, name string) any {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// formatValue returns a value as a string, with the values of a multi-valued attribute joined by the
+// MultiValueSeparator, and false if there is no value
+func formatValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	case map[string]any:
+		// a complex value, such as one of a user's roles, is represented by its "value" sub-attribute
+		return formatValue(lookup(v, "value"))
+	case []any:
+		var values []string
+		for _, item := range v {
+			if s, ok := formatValue(item); ok {
+				values = append(values, s)
+			}
+		}
+		if len(values) == 0 {
+			return "", false
+		}
+		return strings.Join(values, MultiValueSeparator), true
+	default:
+		return "", false
+	}
+}
+
+// typedValue returns the value to send for an attribute, which is a boolean for the attributes known to be boolean
+func typedValue(attribute, value string) any {
+	switch strings.ToLower(attribute) {
+	case "active", "primary":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func equalValues(a, b any) bool {
+	as, aok := formatValue(a)
+	bs, bok := formatValue(b)
+	return aok && bok && strings.EqualFold(as, bs)
+}
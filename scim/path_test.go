@@ -0,0 +1,184 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		want       attributePath
+		wantErrMsg string
+	}{
+		{
+			name: "simple",
+			path: "userName",
+			want: attributePath{raw: "userName", Attribute: "userName"},
+		},
+		{
+			name: "sub-attribute",
+			path: "name.givenName",
+			want: attributePath{raw: "name.givenName", Attribute: "name", SubAttribute: "givenName"},
+		},
+		{
+			name: "filter",
+			path: `emails[type eq "work"].value`,
+			want: attributePath{
+				raw:             `emails[type eq "work"].value`,
+				Attribute:       "emails",
+				FilterAttribute: "type",
+				FilterValue:     "work",
+				SubAttribute:    "value",
+			},
+		},
+		{
+			name: "boolean filter",
+			path: "phoneNumbers[primary eq true]",
+			want: attributePath{
+				raw:             "phoneNumbers[primary eq true]",
+				Attribute:       "phoneNumbers",
+				FilterAttribute: "primary",
+				FilterValue:     true,
+			},
+		},
+		{
+			name: "extension",
+			path: SchemaEnterpriseUser + ":manager.value",
+			want: attributePath{
+				raw:          SchemaEnterpriseUser + ":manager.value",
+				Schema:       SchemaEnterpriseUser,
+				Attribute:    "manager",
+				SubAttribute: "value",
+			},
+		},
+		{
+			name: "core schema",
+			path: SchemaUser + ":userName",
+			want: attributePath{raw: SchemaUser + ":userName", Attribute: "userName"},
+		},
+		{
+			name:       "complex filter",
+			path:       `emails[type eq "work" or primary eq true].value`,
+			wantErrMsg: "only filters like",
+		},
+		{
+			name:       "unclosed filter",
+			path:       `emails[type eq "work"`,
+			wantErrMsg: "missing ]",
+		},
+		{
+			name:       "too deep",
+			path:       "name.givenName.first",
+			wantErrMsg: "invalid attribute path",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePath(tt.path)
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAttributePath_get(t *testing.T) {
+	user := map[string]any{
+		"userName": "ann@example.org",
+		"active":   true,
+		"name":     map[string]any{"givenName": "Ann"},
+		"emails": []any{
+			map[string]any{"type": "home", "value": "ann@home.example"},
+			map[string]any{"type": "work", "value": "ann@example.org", "primary": true},
+		},
+		"roles": []any{map[string]any{"value": "admin"}, map[string]any{"value": "user"}},
+		"tags":  []any{"a", "b"},
+		SchemaEnterpriseUser: map[string]any{
+			"employeeNumber": "101",
+			"manager":        map[string]any{"value": "2"},
+		},
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "UserName", want: "ann@example.org", wantOK: true},
+		{path: "active", want: "true", wantOK: true},
+		{path: "name.givenName", want: "Ann", wantOK: true},
+		{path: "name.familyName"},
+		{path: `emails[type eq "home"].value`, want: "ann@home.example", wantOK: true},
+		{path: `emails[type eq "other"].value`},
+		{path: "emails.value", want: "ann@example.org", wantOK: true},
+		{path: "roles.value", want: "admin", wantOK: true},
+		{path: "tags", want: "a|b", wantOK: true},
+		{path: SchemaEnterpriseUser + ":employeeNumber", want: "101", wantOK: true},
+		{path: SchemaEnterpriseUser + ":manager.value", want: "2", wantOK: true},
+		{path: SchemaEnterpriseUser + ":department"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := parsePath(tt.path)
+			require.NoError(t, err)
+			got, ok := path.get(user)
+			require.Equal(t, tt.wantOK, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAttributePath_set(t *testing.T) {
+	user := map[string]any{"emails": []any{map[string]any{"type": "home", "value": "ann@home.example"}}}
+	for path, value := range map[string]string{
+		"userName":                               "ann@example.org",
+		"active":                                 "false",
+		"name.givenName":                         "Ann",
+		`emails[type eq "work"].value`:           "ann@example.org",
+		`emails[type eq "home"].value`:           "ann@new.example",
+		SchemaEnterpriseUser + ":employeeNumber": "101",
+	} {
+		p, err := parsePath(path)
+		require.NoError(t, err)
+		p.set(user, value)
+	}
+
+	require.Equal(t, map[string]any{
+		"userName": "ann@example.org",
+		"active":   false,
+		"name":     map[string]any{"givenName": "Ann"},
+		"emails": []any{
+			map[string]any{"type": "home", "value": "ann@new.example"},
+			map[string]any{"type": "work", "value": "ann@example.org"},
+		},
+		SchemaEnterpriseUser: map[string]any{"employeeNumber": "101"},
+	}, user)
+}
+
+func TestAttributePath_equalityFilter(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "userName", want: `userName eq "ann@example.org"`},
+		{path: "name.givenName", want: `name.givenName eq "ann@example.org"`},
+		{path: `emails[type eq "work"].value`, want: `emails[type eq "work" and value eq "ann@example.org"]`},
+		{
+			path: SchemaEnterpriseUser + ":employeeNumber",
+			want: SchemaEnterpriseUser + `:employeeNumber eq "ann@example.org"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := parsePath(tt.path)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, path.equalityFilter("ann@example.org"))
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v6/internal/testutil"
+)
+
+const testBearerToken = "secret"
+
+// testService is an in-process SCIM service provider with simple support for eq filters, paging, and PATCH
+// operations
+type testService struct {
+	*testutil.Server
+	URL string
+
+	users  []map[string]any
+	groups []map[string]any
+	nextID int
+}
+
+// complexFilter matches a filter on a value of a multi-valued attribute, as in
+// emails[type eq "work" and value eq "ann@example.org"]
+var complexFilter = regexp.MustCompile(`^(.+)\[(\w+) eq ("[^"]*") and (\w+) eq ("[^"]*")\]$`)
+
+func startTestService(t *testing.T, users, groups []map[string]any) *testService {
+	s := &testService{users: users, groups: groups, nextID: 100}
+	s.Server = testutil.NewServer(t, s.handle)
+	s.URL = s.Server.URL + "/scim/v2"
+	return s
+}
+
+// busy makes the service refuse the next n requests with 429 Too Many Requests
+func (s *testService) busy(n int) {
+	s.Busy(n, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		writeError(w, http.StatusTooManyRequests, "", "slow down")
+	})
+}
+
+func (s *testService) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testBearerToken {
+		writeError(w, http.StatusUnauthorized, "", "invalid token")
+		return
+	}
+
+	var body map[string]any
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+			return
+		}
+	}
+
+	collection, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/scim/v2/"), "/")
+	resources := &s.users
+	if collection == "Groups" {
+		resources = &s.groups
+	}
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		s.list(w, r, *resources)
+	case r.Method == http.MethodGet:
+		if resource := find(*resources, id); resource != nil {
+			writeJSON(w, http.StatusOK, resource)
+			return
+		}
+		writeError(w, http.StatusNotFound, "", "not found")
+	case r.Method == http.MethodPost && id == "":
+		resource := body
+		resource["id"] = strconv.Itoa(s.nextID)
+		s.nextID++
+		*resources = append(*resources, resource)
+		writeJSON(w, http.StatusCreated, resource)
+	case r.Method == http.MethodPatch:
+		resource := find(*resources, id)
+		if resource == nil {
+			writeError(w, http.StatusNotFound, "", "not found")
+			return
+		}
+		if err := applyPatch(resource, body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalidPath", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		i := slices.IndexFunc(*resources, func(resource map[string]any) bool { return resource["id"] == id })
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "", "not found")
+			return
+		}
+		*resources = slices.Delete(*resources, i, i+1)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "", "not allowed")
+	}
+}
+
+func (s *testService) list(w http.ResponseWriter, r *http.Request, resources []map[string]any) {
+	var matches []map[string]any
+	for _, resource := range resources {
+		ok, err := matchFilter(r.URL.Query().Get("filter"), resource)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		if ok {
+			matches = append(matches, resource)
+		}
+	}
+
+	startIndex, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	start := min(max(startIndex, 1)-1, len(matches))
+	end := len(matches)
+	if count > 0 {
+		end = min(start+count, len(matches))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": len(matches),
+		"startIndex":   start + 1,
+		"itemsPerPage": end - start,
+		"Resources":    append([]map[string]any{}, matches[start:end]...),
+	})
+}
+
+func (s *testService) user(id string) map[string]any {
+	s.Lock()
+	defer s.Unlock()
+	return find(s.users, id)
+}
+
+func (s *testService) group(id string) map[string]any {
+	s.Lock()
+	defer s.Unlock()
+	return find(s.groups, id)
+}
+
+// matchFilter supports `path eq "value"` and the complexFilter form
+func matchFilter(filter string, resource map[string]any) (bool, error) {
+	if filter == "" {
+		return true, nil
+	}
+
+	var attr, quoted string
+	if m := complexFilter.FindStringSubmatch(filter); m != nil {
+		attr = fmt.Sprintf("%s[%s eq %s].%s", m[1], m[2], m[3], m[4])
+		quoted = m[5]
+	} else {
+		var ok bool
+		if attr, quoted, ok = strings.Cut(filter, " eq "); !ok {
+			return false, fmt.Errorf("unsupported filter %q", filter)
+		}
+	}
+
+	path, err := parsePath(attr)
+	if err != nil {
+		return false, err
+	}
+	var want any
+	if err := json.Unmarshal([]byte(quoted), &want); err != nil {
+		return false, err
+	}
+	value, ok := path.get(resource)
+	return ok && equalValues(value, want), nil
+}
+
+// applyPatch supports add, replace, and remove operations with simple paths, and the removal of one member of a group
+func applyPatch(resource, body map[string]any) error {
+	operations, _ := body["Operations"].([]any)
+	for _, o := range operations {
+		operation, _ := o.(map[string]any)
+		op, _ := operation["op"].(string)
+		pathString, _ := operation["path"].(string)
+		value := operation["value"]
+
+		if op == "remove" && strings.HasPrefix(pathString, "members[") {
+			memberID := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(pathString, "members[value eq "), "]"), `"`)
+			members, _ := resource["members"].([]any)
+			resource["members"] = slices.DeleteFunc(members, func(member any) bool {
+				return member.(map[string]any)["value"] == memberID
+			})
+			continue
+		}
+
+		path, err := parsePath(pathString)
+		if err != nil {
+			return err
+		}
+		container := resource
+		if path.Schema != "" {
+			container, _ = resource[path.Schema].(map[string]any)
+			if container == nil {
+				container = map[string]any{}
+				resource[path.Schema] = container
+			}
+		}
+
+		switch op {
+		case "add":
+			if values, ok := value.([]any); ok {
+				existing, _ := container[path.Attribute].([]any)
+				container[path.Attribute] = append(existing, values...)
+				continue
+			}
+			container[path.Attribute] = value
+		case "replace":
+			if path.FilterAttribute != "" || path.SubAttribute != "" {
+				if _, ok := path.get(resource); !ok && path.FilterAttribute != "" {
+					return fmt.Errorf("no value matches %s", pathString)
+				}
+				formatted, _ := formatValue(value)
+				path.set(resource, formatted)
+				continue
+			}
+			container[path.Attribute] = value
+		case "remove":
+			if path.FilterAttribute != "" {
+				values, _ := container[path.Attribute].([]any)
+				container[path.Attribute] = slices.DeleteFunc(values, func(v any) bool {
+					m, ok := v.(map[string]any)
+					return ok && equalValues(lookup(m, path.FilterAttribute), path.FilterValue)
+				})
+				continue
+			}
+			if complexValue, ok := container[path.Attribute].(map[string]any); ok && path.SubAttribute != "" {
+				delete(complexValue, path.SubAttribute)
+				continue
+			}
+			delete(container, path.Attribute)
+		default:
+			return fmt.Errorf("unsupported op %q", op)
+		}
+	}
+	return nil
+}
+
+func find(resources []map[string]any, id string) map[string]any {
+	for _, resource := range resources {
+		if resource["id"] == id {
+			return resource
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", contentType)
+	testutil.WriteJSON(w, status, body)
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeJSON(w, status, map[string]any{
+		"schemas":  []string{SchemaError},
+		"status":   strconv.Itoa(status),
+		"scimType": scimType,
+		"detail":   detail,
+	})
+}
+
+// testUsers returns ann, bob, and an inactive cat, with ids 1, 2, and 3
+func testUsers() []map[string]any {
+	return []map[string]any{
+		{
+			"id": "1", "userName": "ann@example.org", "active": true,
+			"name":               map[string]any{"givenName": "Ann", "familyName": "Smith"},
+			"emails":             []any{map[string]any{"type": "work", "value": "ann@example.org", "primary": true}},
+			SchemaEnterpriseUser: map[string]any{"employeeNumber": "101"},
+		},
+		{
+			"id": "2", "userName": "bob@example.org", "active": true,
+			"name": map[string]any{"givenName": "Bob", "familyName": "Jones"},
+		},
+		{
+			"id": "3", "userName": "cat@example.org", "active": false,
+			"name": map[string]any{"givenName": "Cat", "familyName": "Brown"},
+		},
+	}
+}
+
+func testGroups() []map[string]any {
+	return []map[string]any{
+		{
+			"id": "g1", "displayName": "Staff",
+			"members": []any{map[string]any{"value": "1"}, map[string]any{"value": "2"}},
+		},
+	}
+}
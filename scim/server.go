@@ -0,0 +1,369 @@
+package scim
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// shutdownTimeout limits the time given to requests in progress when the server is stopped
+const shutdownTimeout = 10 * time.Second
+
+// ServerGroup is a group served by a Server, with the people of one sync set
+type ServerGroup struct {
+	DisplayName string
+	People      []internal.Person // with destination attributes, which are SCIM attribute paths
+}
+
+// Server serves people as a read-only SCIM 2.0 API, with /Users, /Groups, and /ServiceProviderConfig endpoints. The
+// people are replaced by each call to Update.
+type Server struct {
+	config internal.SCIMServerConfig
+	paths  map[string]attributePath
+
+	mu       sync.RWMutex
+	ready    bool
+	users    []map[string]any // sorted by userName
+	groups   []map[string]any // sorted by displayName
+	previous map[string]serverUser
+}
+
+// serverUser is a user as of the last Update, used to keep the meta attributes of users that have not changed
+type serverUser struct {
+	person   internal.Person
+	resource map[string]any
+}
+
+// NewServer returns a Server with the validated config. It has no users until Update is called, and responds with
+// 503 Service Unavailable until then.
+func NewServer(config internal.SCIMServerConfig) *Server {
+	config.BasePath = "/" + strings.Trim(config.BasePath, "/")
+	return &Server{config: config, paths: map[string]attributePath{}, previous: map[string]serverUser{}}
+}
+
+// Update replaces the users and groups. A person may be in more than one group, and the first group's attributes are
+// used. A person with DisableChanges set, because a required attribute is missing, keeps the attributes served
+// before, or is left out if they were not served before.
+func (s *Server) Update(groups []ServerGroup) error {
+	now := time.Now().UTC()
+	users := map[string]serverUser{}
+	var userIDs []string
+	var groupResources []map[string]any
+
+	for _, group := range groups {
+		var members []any
+		for _, person := range group.People {
+			id := resourceID("User", person.CompareValue)
+			user, ok := users[id]
+			if !ok {
+				var err error
+				if user, ok, err = s.user(id, person, now); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+				users[id] = user
+				userIDs = append(userIDs, id)
+			}
+			members = append(members, map[string]any{
+				"value":   id,
+				"display": user.resource["userName"],
+				"$ref":    s.location("Users", id),
+			})
+		}
+
+		id := resourceID("Group", group.DisplayName)
+		groupResources = append(groupResources, map[string]any{
+			"schemas":     []string{SchemaGroup},
+			"id":          id,
+			"displayName": group.DisplayName,
+			"members":     members,
+			"meta": map[string]any{
+				"resourceType": "Group",
+				"location":     s.location("Groups", id),
+				"lastModified": now.Format(time.RFC3339),
+			},
+		})
+	}
+
+	userResources := make([]map[string]any, len(userIDs))
+	for i, id := range userIDs {
+		userResources[i] = users[id].resource
+	}
+	slices.SortStableFunc(userResources, func(a, b map[string]any) int {
+		return strings.Compare(strings.ToLower(a["userName"].(string)), strings.ToLower(b["userName"].(string)))
+	})
+	slices.SortStableFunc(groupResources, func(a, b map[string]any) int {
+		return strings.Compare(a["displayName"].(string), b["displayName"].(string))
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users, s.groups, s.previous, s.ready = userResources, groupResources, users, true
+	return nil
+}
+
+// user returns the resource for a person, reusing the previous resource if the person has not changed
+func (s *Server) user(id string, person internal.Person, now time.Time) (serverUser, bool, error) {
+	s.mu.RLock()
+	previous, existed := s.previous[id]
+	s.mu.RUnlock()
+
+	if person.DisableChanges || (existed && maps.Equal(previous.person.Attributes, person.Attributes)) {
+		return previous, existed, nil
+	}
+
+	resource := map[string]any{"active": true}
+	schemas := []string{SchemaUser}
+	for _, attr := range sortedAttributes(person.Attributes) {
+		path, err := s.path(attr)
+		if err != nil {
+			return serverUser{}, false, err
+		}
+		if path.Schema == "" && (strings.EqualFold(path.Attribute, "id") || strings.EqualFold(path.Attribute, "meta")) {
+			continue
+		}
+		if value := person.Attributes[attr]; value != "" {
+			path.set(resource, value)
+		}
+		if path.Schema != "" && !slices.Contains(schemas, path.Schema) {
+			schemas = append(schemas, path.Schema)
+		}
+	}
+	if userName, _ := resource["userName"].(string); userName == "" {
+		resource["userName"] = person.CompareValue
+	}
+
+	created := now.Format(time.RFC3339)
+	if existed {
+		created, _ = lookup(previous.resource, "meta").(map[string]any)["created"].(string)
+	}
+	resource["schemas"] = schemas
+	resource["id"] = id
+	resource["meta"] = map[string]any{
+		"resourceType": "User",
+		"location":     s.location("Users", id),
+		"created":      created,
+		"lastModified": now.Format(time.RFC3339),
+	}
+	return serverUser{person: person, resource: resource}, true, nil
+}
+
+func (s *Server) path(attribute string) (attributePath, error) {
+	if path, ok := s.paths[attribute]; ok {
+		return path, nil
+	}
+	path, err := parsePath(attribute)
+	if err != nil {
+		return path, fmt.Errorf("invalid destination attribute in the AttributeMap: %w", err)
+	}
+	s.paths[attribute] = path
+	return path, nil
+}
+
+// ListenAndServe serves the API until ctx is cancelled, and then waits for requests in progress to finish
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.config.ListenAddress,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		if s.config.TLSCertFile != "" {
+			errs <- server.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP handles a request to the API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const bearer = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(bearer) || !strings.EqualFold(auth[:len(bearer)], bearer) ||
+		subtle.ConstantTimeCompare([]byte(auth[len(bearer):]), []byte(s.config.BearerToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="SCIM"`)
+		writeServerError(w, http.StatusUnauthorized, "", "a valid bearer token is required")
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, strings.TrimSuffix(s.config.BasePath, "/"))
+	if !ok {
+		writeServerError(w, http.StatusNotFound, "", "not found")
+		return
+	}
+	endpoint, id, _ := strings.Cut(strings.Trim(path, "/"), "/")
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeServerError(w, http.StatusNotImplemented, "", "this SCIM API is read-only")
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.ready {
+		w.Header().Set("Retry-After", "30")
+		writeServerError(w, http.StatusServiceUnavailable, "", "the users have not been loaded yet")
+		return
+	}
+
+	switch {
+	case endpoint == "Users" && id == "":
+		s.list(w, r, s.users)
+	case endpoint == "Users":
+		s.get(w, s.users, id)
+	case endpoint == "Groups" && id == "":
+		s.list(w, r, s.groups)
+	case endpoint == "Groups":
+		s.get(w, s.groups, id)
+	case endpoint == "ServiceProviderConfig" && id == "":
+		writeServerJSON(w, http.StatusOK, s.serviceProviderConfig())
+	default:
+		writeServerError(w, http.StatusNotFound, "", "not found")
+	}
+}
+
+// list writes a page of the resources that match the filter. The caller must hold the read lock.
+func (s *Server) list(w http.ResponseWriter, r *http.Request, resources []map[string]any) {
+	query := r.URL.Query()
+
+	if filterString := query.Get("filter"); filterString != "" {
+		f, err := parseFilter(filterString)
+		if err != nil {
+			writeServerError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		var matches []map[string]any
+		for _, resource := range resources {
+			if f.matches(resource) {
+				matches = append(matches, resource)
+			}
+		}
+		resources = matches
+	}
+
+	startIndex, count := 1, s.config.MaxResults
+	for name, value := range map[string]*int{"startIndex": &startIndex, "count": &count} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeServerError(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("invalid %s %q", name, v))
+				return
+			}
+			*value = n
+		}
+	}
+	// as RFC 7644 requires, a startIndex less than 1 is treated as 1, and a negative count as 0
+	startIndex = max(startIndex, 1)
+	count = min(max(count, 0), s.config.MaxResults)
+
+	start := min(startIndex-1, len(resources))
+	end := min(start+count, len(resources))
+	writeServerJSON(w, http.StatusOK, map[string]any{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": len(resources),
+		"startIndex":   startIndex,
+		"itemsPerPage": end - start,
+		"Resources":    append([]map[string]any{}, resources[start:end]...),
+	})
+}
+
+// get writes the resource with the given id. The caller must hold the read lock.
+func (s *Server) get(w http.ResponseWriter, resources []map[string]any, id string) {
+	for _, resource := range resources {
+		if resource["id"] == id {
+			writeServerJSON(w, http.StatusOK, resource)
+			return
+		}
+	}
+	writeServerError(w, http.StatusNotFound, "", "resource "+id+" not found")
+}
+
+func (s *Server) serviceProviderConfig() map[string]any {
+	return map[string]any{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          map[string]any{"supported": false},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": s.config.MaxResults},
+		"changePassword": map[string]any{"supported": false},
+		"sort":           map[string]any{"supported": false},
+		"etag":           map[string]any{"supported": false},
+		"authenticationSchemes": []any{map[string]any{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authentication with a bearer token in the Authorization header",
+		}},
+		"meta": map[string]any{
+			"resourceType": "ServiceProviderConfig",
+			"location":     s.location("ServiceProviderConfig", ""),
+		},
+	}
+}
+
+func (s *Server) location(endpoint, id string) string {
+	location := strings.TrimSuffix(s.config.BasePath, "/") + "/" + endpoint
+	if id != "" {
+		location += "/" + id
+	}
+	return location
+}
+
+// resourceID returns a stable id for a resource, derived from its type and its name, ignoring case
+func resourceID(resourceType, name string) string {
+	sum := sha256.Sum256([]byte(resourceType + "\x00" + strings.ToLower(name)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func writeServerJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("unable to write SCIM response: %s", err)
+	}
+}
+
+func writeServerError(w http.ResponseWriter, status int, scimType, detail string) {
+	body := map[string]any{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	writeServerJSON(w, status, body)
+}
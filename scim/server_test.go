@@ -0,0 +1,240 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestServer(t *testing.T) *Server {
+	server := NewServer(internal.SCIMServerConfig{
+		BasePath:    "/scim/v2/",
+		BearerToken: testBearerToken,
+		MaxResults:  2,
+	})
+
+	ann := internal.Person{
+		CompareValue: "ann@example.org",
+		Attributes: map[string]string{
+			"userName":                               "ann@example.org",
+			"name.givenName":                         "Ann",
+			`emails[type eq "work"].value`:           "ann@example.org",
+			SchemaEnterpriseUser + ":employeeNumber": "101",
+			"title":                                  "",
+		},
+	}
+	bob := internal.Person{CompareValue: "bob@example.org", Attributes: map[string]string{"name.givenName": "Bob"}}
+	cat := internal.Person{CompareValue: "cat@example.org", Attributes: map[string]string{"title": "Manager"}}
+	require.NoError(t, server.Update([]ServerGroup{
+		{DisplayName: "Staff", People: []internal.Person{cat, ann, bob}},
+		{DisplayName: "Managers", People: []internal.Person{cat}},
+	}))
+	return server
+}
+
+func serveTestRequest(t *testing.T, server *Server, method, path string, query url.Values) (int, map[string]any) {
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testBearerToken)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	require.Equal(t, contentType, w.Header().Get("Content-Type"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func resourceValues(body map[string]any, attribute string) []any {
+	var values []any
+	for _, resource := range body["Resources"].([]any) {
+		values = append(values, resource.(map[string]any)[attribute])
+	}
+	return values
+}
+
+func TestServer_users(t *testing.T) {
+	server := newTestServer(t)
+
+	status, body := serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users", nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, float64(3), body["totalResults"])
+	require.Equal(t, float64(2), body["itemsPerPage"], "limited by MaxResults")
+	require.Equal(t, []any{"ann@example.org", "bob@example.org"}, resourceValues(body, "userName"))
+
+	ann := body["Resources"].([]any)[0].(map[string]any)
+	annID := resourceID("User", "ann@example.org")
+	require.Equal(t, annID, ann["id"])
+	require.Equal(t, []any{SchemaUser, SchemaEnterpriseUser}, ann["schemas"])
+	require.Equal(t, true, ann["active"])
+	require.Equal(t, map[string]any{"givenName": "Ann"}, ann["name"])
+	require.Equal(t, []any{map[string]any{"type": "work", "value": "ann@example.org"}}, ann["emails"])
+	require.Equal(t, map[string]any{"employeeNumber": "101"}, ann[SchemaEnterpriseUser])
+	require.NotContains(t, ann, "title")
+	require.Equal(t, "/scim/v2/Users/"+annID, ann["meta"].(map[string]any)["location"])
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users",
+		url.Values{"startIndex": {"3"}, "count": {"5"}})
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, float64(3), body["startIndex"])
+	require.Equal(t, []any{"cat@example.org"}, resourceValues(body, "userName"))
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users",
+		url.Values{"filter": {`name.givenName eq "bob" or title pr`}})
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []any{"bob@example.org", "cat@example.org"}, resourceValues(body, "userName"))
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users", url.Values{"count": {"0"}})
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, float64(3), body["totalResults"])
+	require.Empty(t, body["Resources"])
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users/"+annID, nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "ann@example.org", body["userName"])
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users/missing", nil)
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, "404", body["status"])
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users", url.Values{"filter": {"title xx 1"}})
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "invalidFilter", body["scimType"])
+}
+
+func TestServer_groups(t *testing.T) {
+	server := newTestServer(t)
+
+	status, body := serveTestRequest(t, server, http.MethodGet, "/scim/v2/Groups",
+		url.Values{"filter": {`displayName eq "Staff"`}})
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, float64(1), body["totalResults"])
+
+	staff := body["Resources"].([]any)[0].(map[string]any)
+	var members []any
+	for _, member := range staff["members"].([]any) {
+		members = append(members, member.(map[string]any)["display"])
+	}
+	require.Equal(t, []any{"cat@example.org", "ann@example.org", "bob@example.org"}, members)
+
+	catID := resourceID("User", "cat@example.org")
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Groups",
+		url.Values{"filter": {`members.value eq "` + catID + `"`}})
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []any{"Managers", "Staff"}, resourceValues(body, "displayName"))
+
+	status, body = serveTestRequest(t, server, http.MethodGet, "/scim/v2/Groups/"+resourceID("Group", "managers"), nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "Managers", body["displayName"])
+}
+
+func TestServer_Update(t *testing.T) {
+	server := newTestServer(t)
+	annID := resourceID("User", "ann@example.org")
+	_, before := serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users/"+annID, nil)
+
+	require.NoError(t, server.Update([]ServerGroup{{
+		DisplayName: "Staff",
+		People: []internal.Person{
+			{
+				CompareValue:   "ANN@example.org",
+				Attributes:     map[string]string{"userName": "ann@example.org"},
+				DisableChanges: true,
+			},
+			{CompareValue: "dan@example.org", Attributes: map[string]string{"title": "New"}, DisableChanges: true},
+			{CompareValue: "bob@example.org", Attributes: map[string]string{"name.givenName": "Robert"}},
+		},
+	}}))
+
+	_, body := serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users", nil)
+	require.Equal(t, []any{"ann@example.org", "bob@example.org"}, resourceValues(body, "userName"),
+		"a person with DisableChanges is kept only if they were served before")
+
+	_, after := serveTestRequest(t, server, http.MethodGet, "/scim/v2/Users/"+annID, nil)
+	require.Equal(t, before, after, "the previous attributes are kept")
+
+	bob := body["Resources"].([]any)[1].(map[string]any)
+	require.Equal(t, map[string]any{"givenName": "Robert"}, bob["name"])
+
+	require.Error(t, server.Update([]ServerGroup{{
+		DisplayName: "Staff",
+		People:      []internal.Person{{CompareValue: "eve@example.org", Attributes: map[string]string{"a[b]c": "x"}}},
+	}}))
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		loaded     bool
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "no token", loaded: true, method: http.MethodGet, path: "/Users", wantStatus: http.StatusUnauthorized},
+		{
+			name:       "wrong token",
+			loaded:     true,
+			method:     http.MethodGet,
+			path:       "/Users",
+			token:      "wrong",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not loaded",
+			method:     http.MethodGet,
+			path:       "/Users",
+			token:      testBearerToken,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "read-only",
+			loaded:     true,
+			method:     http.MethodPost,
+			path:       "/Users",
+			token:      testBearerToken,
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "service provider config",
+			loaded:     true,
+			method:     http.MethodGet,
+			path:       "/ServiceProviderConfig",
+			token:      testBearerToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown endpoint",
+			loaded:     true,
+			method:     http.MethodGet,
+			path:       "/Schemas",
+			token:      testBearerToken,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(internal.SCIMServerConfig{BearerToken: testBearerToken, MaxResults: 10})
+			if tt.loaded {
+				require.NoError(t, server.Update(nil))
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			require.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
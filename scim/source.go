@@ -0,0 +1,95 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// SCIMSource reads people from the users of a SCIM 2.0 service provider
+type SCIMSource struct {
+	Client
+
+	// SourceSyncSet holds the defaults for each sync set
+	SourceSyncSet
+
+	SourceConfig internal.SourceConfig `json:"-"`
+	SyncSet      SourceSyncSet         `json:"-"`
+
+	compareAttribute attributePath
+}
+
+// SourceSyncSet configures a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type SourceSyncSet struct {
+	Filter           string // a SCIM filter that selects the users to read, such as `title eq "Staff"`
+	CompareAttribute string // the attribute path that identifies a user, default "userName"
+	IncludeInactive  bool   // include users that are not active
+}
+
+// NewSCIMSource unmarshals the sourceConfig's ExtraJSON into a SCIMSource struct. No requests are made until
+// ListUsers is called.
+func NewSCIMSource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var s SCIMSource
+	if err := json.Unmarshal(sourceConfig.ExtraJSON, &s); err != nil {
+		return nil, fmt.Errorf("error reading SCIM source config: %w", err)
+	}
+
+	if err := s.Client.validate(); err != nil {
+		return nil, fmt.Errorf("invalid SCIM source config: %w", err)
+	}
+
+	s.SourceConfig = sourceConfig
+	return &s, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (s *SCIMSource) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := s.SourceSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if syncSet.CompareAttribute == "" {
+		syncSet.CompareAttribute = DefaultCompareAttribute
+	}
+	compareAttribute, err := parsePath(syncSet.CompareAttribute)
+	if err != nil {
+		return fmt.Errorf("invalid CompareAttribute: %w", err)
+	}
+
+	s.SyncSet = syncSet
+	s.compareAttribute = compareAttribute
+	return nil
+}
+
+// ListUsers pages through the users that match the Filter and returns a person for each active user. Each of the
+// desiredAttrs is a SCIM attribute path, such as `emails[type eq "work"].value`, and is used as the attribute name.
+// Users with no value for the CompareAttribute are skipped.
+func (s *SCIMSource) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	paths, err := parsePaths(desiredAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.list(ctx, "/Users", s.SyncSet.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+
+	people := make([]internal.Person, 0, len(users))
+	for _, user := range users {
+		if !s.SyncSet.IncludeInactive && lookup(user, "active") == false {
+			continue
+		}
+		compareValue, _ := s.compareAttribute.get(user)
+		if compareValue == "" {
+			continue
+		}
+		people = append(people, internal.Person{CompareValue: compareValue, Attributes: flatten(user, paths)})
+	}
+	return people, nil
+}
@@ -0,0 +1,124 @@
+package scim
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestSCIMSource(t *testing.T, service *testService, syncSet string) *SCIMSource {
+	source, err := NewSCIMSource(internal.SourceConfig{
+		Type: internal.SourceTypeSCIM,
+		ExtraJSON: []byte(`{"BaseURL": "` + service.URL + `", "BearerToken": "` + testBearerToken +
+			`", "PageSize": 2}`),
+	})
+	require.NoError(t, err)
+	require.NoError(t, source.ForSet([]byte(syncSet)))
+	return source.(*SCIMSource)
+}
+
+func TestSCIMSource_ListUsers(t *testing.T) {
+	users := testUsers()
+	users[0]["roles"] = []any{map[string]any{"value": "admin"}, map[string]any{"value": "user"}}
+	users[0]["emails"] = append(users[0]["emails"].([]any), map[string]any{"type": "home", "value": "ann@home.example"})
+	service := startTestService(t, users, nil)
+
+	tests := []struct {
+		name         string
+		syncSet      string
+		desiredAttrs []string
+		want         []internal.Person
+	}{
+		{
+			name:         "active",
+			syncSet:      `{}`,
+			desiredAttrs: []string{"name.givenName", `emails[type eq "home"].value`, "emails.value", "roles"},
+			want: []internal.Person{
+				{
+					CompareValue: "ann@example.org",
+					Attributes: map[string]string{
+						"name.givenName":               "Ann",
+						`emails[type eq "home"].value`: "ann@home.example",
+						"emails.value":                 "ann@example.org",
+						"roles":                        "admin|user",
+					},
+				},
+				{CompareValue: "bob@example.org", Attributes: map[string]string{"name.givenName": "Bob"}},
+			},
+		},
+		{
+			name:         "inactive",
+			syncSet:      `{"IncludeInactive": true, "Filter": "name.familyName eq \"Brown\""}`,
+			desiredAttrs: []string{"active"},
+			want: []internal.Person{
+				{CompareValue: "cat@example.org", Attributes: map[string]string{"active": "false"}},
+			},
+		},
+		{
+			name:         "compare attribute",
+			syncSet:      `{"CompareAttribute": "` + SchemaEnterpriseUser + `:employeeNumber"}`,
+			desiredAttrs: []string{SchemaEnterpriseUser + ":employeeNumber"},
+			want: []internal.Person{
+				{CompareValue: "101", Attributes: map[string]string{SchemaEnterpriseUser + ":employeeNumber": "101"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSCIMSource(t, service, tt.syncSet)
+			people, err := s.ListUsers(context.Background(), tt.desiredAttrs)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, people)
+		})
+	}
+}
+
+func TestSCIMSource_remap(t *testing.T) {
+	service := startTestService(t, testUsers(), nil)
+	s := newTestSCIMSource(t, service, `{}`)
+
+	attributeMap := []internal.AttributeMap{
+		{Source: "userName", Destination: "email", Required: true},
+		{Source: `emails[type eq "work"].value`, Destination: "work_email"},
+		{Source: SchemaEnterpriseUser + ":employeeNumber", Destination: "staff_id", Required: true},
+	}
+	people, err := s.ListUsers(context.Background(), internal.GetSourceAttributes(attributeMap))
+	require.NoError(t, err)
+
+	remapped, err := internal.RemapToDestinationAttributes(log.New(io.Discard, "", 0), people, attributeMap)
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{
+			CompareValue: "ann@example.org",
+			Attributes: map[string]string{
+				"email": "ann@example.org", "work_email": "ann@example.org", "staff_id": "101",
+			},
+		},
+		{
+			CompareValue:   "bob@example.org",
+			Attributes:     map[string]string{"email": "bob@example.org"},
+			DisableChanges: true,
+		},
+	}, remapped)
+}
+
+func TestSCIMSource_ForSet(t *testing.T) {
+	source, err := NewSCIMSource(internal.SourceConfig{
+		ExtraJSON: []byte(`{"BaseURL": "https://example.com/scim/v2", "BearerToken": "token", "Filter": "x eq \"y\""}`),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, source.ForSet([]byte(`{"IncludeInactive": true}`)))
+	s := source.(*SCIMSource)
+	require.Equal(t, SourceSyncSet{Filter: `x eq "y"`, CompareAttribute: "userName", IncludeInactive: true}, s.SyncSet)
+
+	require.ErrorContains(t, source.ForSet([]byte(`{"CompareAttribute": "emails[type"}`)), "invalid CompareAttribute")
+
+	_, err = NewSCIMSource(internal.SourceConfig{ExtraJSON: []byte(`{"BaseURL": "https://example.com"}`)})
+	require.ErrorContains(t, err, "BearerToken is required")
+}
@@ -0,0 +1,111 @@
+package personnel_sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/alert"
+	"github.com/silinternational/personnel-sync/v6/internal"
+	"github.com/silinternational/personnel-sync/v6/scim"
+)
+
+// ServeSCIM runs the SCIM server mode until ctx is cancelled. The people from the source for each enabled sync set
+// are mapped with the AttributeMap, filtered with the SCIMServer Filters, and served as the members of a group named
+// after the sync set. The source is read again every RefreshSeconds. If a refresh fails, an alert is sent and the
+// people from the last successful refresh are served. The first refresh must succeed before the server is started.
+func ServeSCIM(ctx context.Context, configFile string, options Options) error {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.LstdFlags | log.LUTC)
+
+	config, err := loadConfig(configFile, options)
+	if err != nil {
+		return err
+	}
+	if config.SCIMServer == nil {
+		err := errors.New("the configuration has no SCIMServer section")
+		log.Println(err)
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+
+	source, err := newSource(config)
+	if err != nil {
+		return initError(config, config.Source.Type+" source", err)
+	}
+
+	server := scim.NewServer(*config.SCIMServer)
+	if err := refreshSCIMServer(ctx, config, source, server); err != nil {
+		log.Printf("Unable to read the source, error: %s", err)
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.SCIMServer.RefreshSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := refreshSCIMServer(ctx, config, source, server); err != nil && ctx.Err() == nil {
+				msg := fmt.Sprintf("Unable to refresh the SCIM server, error: %s", err)
+				log.Println(msg)
+				alert.SendEmail(config.Alert, msg)
+			}
+		}
+	}()
+
+	log.Printf("SCIM server listening on %s", config.SCIMServer.ListenAddress)
+	if err := server.ListenAndServe(ctx); err != nil {
+		log.Printf("SCIM server stopped with error: %s", err)
+		return err
+	}
+	log.Println("SCIM server stopped")
+	return nil
+}
+
+// refreshSCIMServer reads the people for each enabled sync set from the source, and updates the server with them
+func refreshSCIMServer(ctx context.Context, config internal.Config, source internal.Source, server *scim.Server) error {
+	var groups []scim.ServerGroup
+	for _, syncSet := range config.SyncSets {
+		if syncSet.Disable {
+			continue
+		}
+
+		if err := source.ForSet(syncSet.Source); err != nil {
+			return fmt.Errorf(`error setting source set on syncSet "%s": %w`, syncSet.Name, err)
+		}
+		sourcePeople, err := source.ListUsers(ctx, internal.GetSourceAttributes(config.AttributeMap))
+		if err != nil {
+			return fmt.Errorf(`unable to list people for syncSet "%s": %w`, syncSet.Name, err)
+		}
+		if len(sourcePeople) == 0 {
+			return fmt.Errorf(`no people found in source for syncSet "%s"`, syncSet.Name)
+		}
+
+		logger := log.New(os.Stdout, fmt.Sprintf("[ %s ] ", syncSet.Name), log.LstdFlags|log.LUTC)
+		people, err := internal.RemapToDestinationAttributes(logger, sourcePeople, config.AttributeMap)
+		if err != nil {
+			return fmt.Errorf(`unable to map attributes for syncSet "%s": %w`, syncSet.Name, err)
+		}
+
+		group := scim.ServerGroup{DisplayName: syncSet.Name}
+		for _, person := range people {
+			if match, err := person.Matches(config.SCIMServer.Filters); err != nil {
+				return fmt.Errorf(`filter failure for syncSet "%s": %w`, syncSet.Name, err)
+			} else if match {
+				group.People = append(group.People, person)
+			}
+		}
+		logger.Printf("Serving %d of %d people found in source", len(group.People), len(people))
+		groups = append(groups, group)
+	}
+
+	return server.Update(groups)
+}
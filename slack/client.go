@@ -0,0 +1,162 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const (
+	DefaultBaseURL            = "https://slack.com/api"
+	DefaultHttpTimeoutSeconds = 45
+	DefaultPageSize           = 200
+)
+
+// Client holds the settings for calling the Slack Web API
+type Client struct {
+	BaseURL            string // default https://slack.com/api
+	Token              string // a user token with the usergroups:read, usergroups:write, and users:read.email scopes
+	HttpTimeoutSeconds int    // default 45
+	PageSize           int    // number of users requested at a time, default 200
+
+	httpClient *http.Client
+}
+
+// Error is an error response from the Slack Web API, which has the status 200 but is not "ok"
+type Error struct {
+	Method string
+	Code   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Slack error from %s: %s", e.Method, e.Code)
+}
+
+// response holds the properties common to all responses
+type response struct {
+	OK               bool   `json:"ok"`
+	Error            string `json:"error"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+type user struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	IsBot   bool   `json:"is_bot"`
+	Profile struct {
+		Email string `json:"email"`
+	} `json:"profile"`
+}
+
+func (c *Client) validate() error {
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid BaseURL %q", c.BaseURL)
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+
+	if c.Token == "" {
+		return errors.New("Token is required")
+	}
+	if c.HttpTimeoutSeconds <= 0 {
+		c.HttpTimeoutSeconds = DefaultHttpTimeoutSeconds
+	}
+	if c.PageSize <= 0 {
+		c.PageSize = DefaultPageSize
+	}
+	return nil
+}
+
+// listUsers returns all users of the workspace, one page at a time
+func (c *Client) listUsers(ctx context.Context) ([]user, error) {
+	var users []user
+	params := url.Values{"limit": {strconv.Itoa(c.PageSize)}}
+	for {
+		var page struct {
+			response
+			Members []user `json:"members"`
+		}
+		if err := c.call(ctx, "users.list", params, &page); err != nil {
+			return nil, err
+		}
+		users = append(users, page.Members...)
+
+		if page.ResponseMetadata.NextCursor == "" {
+			return users, nil
+		}
+		params.Set("cursor", page.ResponseMetadata.NextCursor)
+	}
+}
+
+// call POSTs the params to a Web API method, and decodes the response into out, which must embed a response. A
+// request is retried if Slack responds with 429 Too Many Requests, after the delay given in the Retry-After header.
+func (c *Client) call(ctx context.Context, method string, params url.Values, out any) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/"+method,
+			strings.NewReader(params.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := c.client().Do(req)
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", method, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read the response from %s: %w", method, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < internal.MaxRetries {
+			if err := internal.Sleep(ctx, internal.RetryDelay(resp.Header.Get("Retry-After"), attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s failed with status %d", method, resp.StatusCode)
+		}
+
+		var r response
+		if err := json.Unmarshal(body, &r); err != nil {
+			return fmt.Errorf("unable to decode the response from %s: %w", method, err)
+		}
+		if !r.OK {
+			return &Error{Method: method, Code: r.Error}
+		}
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("unable to decode the response from %s: %w", method, err)
+		}
+		return nil
+	}
+}
+
+func (c *Client) client() *http.Client {
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: time.Duration(c.HttpTimeoutSeconds) * time.Second}
+	}
+	return c.httpClient
+}
+
+// isError returns true if err is a Slack error with the given code
+func isError(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
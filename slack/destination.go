@@ -0,0 +1,291 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// SlackUserGroups sets the members of a Slack user group, matching people to Slack users by email address
+type SlackUserGroups struct {
+	Client
+
+	// DestinationSyncSet holds the defaults for each sync set
+	DestinationSyncSet
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           DestinationSyncSet         `json:"-"`
+
+	userGroupID string
+
+	// userIDs holds the Slack user ID for each email address, in lower case, as found by ListUsers or by a lookup
+	userIDs map[string]string
+}
+
+// DestinationSyncSet configures a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type DestinationSyncSet struct {
+	UserGroup    string   // the handle, such as "finance-team", the name, or the ID of the user group
+	ExtraMembers []string // email addresses of users that are always members of the user group
+}
+
+type userGroup struct {
+	ID         string `json:"id"`
+	Handle     string `json:"handle"`
+	Name       string `json:"name"`
+	DateDelete int64  `json:"date_delete"`
+}
+
+// NewSlackUserGroupsDestination unmarshals the destinationConfig's ExtraJSON into a SlackUserGroups struct. No
+// requests are made until ListUsers or ApplyChangeSet is called.
+func NewSlackUserGroupsDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var s SlackUserGroups
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &s); err != nil {
+		return nil, fmt.Errorf("error reading SlackUserGroups destination config: %w", err)
+	}
+
+	if err := s.Client.validate(); err != nil {
+		return nil, fmt.Errorf("invalid SlackUserGroups destination config: %w", err)
+	}
+
+	s.DestinationConfig = destinationConfig
+	s.userIDs = map[string]string{}
+	return &s, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (s *SlackUserGroups) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := s.DestinationSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	syncSet.UserGroup = strings.TrimPrefix(syncSet.UserGroup, "@")
+	if syncSet.UserGroup == "" {
+		return errors.New("UserGroup missing from sync set json")
+	}
+
+	s.SyncSet = syncSet
+	s.userGroupID = ""
+	return nil
+}
+
+// ListUsers returns the members of the user group, other than the ExtraMembers. The ID of each person is the Slack
+// user ID, and the email attribute is the user's email address in lower case. Users without an email address, such
+// as bots, are not included.
+func (s *SlackUserGroups) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	members, err := s.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.listUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+	emails := map[string]string{}
+	for _, u := range users {
+		if email := strings.ToLower(u.Profile.Email); email != "" && !u.Deleted {
+			emails[u.ID] = email
+			s.userIDs[email] = u.ID
+		}
+	}
+
+	people := []internal.Person{}
+	for _, id := range members {
+		email := emails[id]
+		// Do not include ExtraMembers in list to prevent inclusion in delete list
+		if email == "" || s.isExtraMember(email) {
+			continue
+		}
+		people = append(people, internal.Person{
+			CompareValue: email,
+			ID:           id,
+			Attributes:   map[string]string{"email": email},
+		})
+	}
+	return people, nil
+}
+
+// ApplyChangeSet adds people and the ExtraMembers to the user group, and removes people from it, by setting all of
+// its members in one request
+func (s *SlackUserGroups) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	var results internal.ChangeResults
+	if internal.Stopping(ctx) {
+		return results
+	}
+
+	members, err := s.members(ctx)
+	if err != nil {
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_ERR, Message: err.Error()}
+		return results
+	}
+	current := slices.Clone(members)
+
+	var added, removed []string
+	if !s.DestinationConfig.DisableAdd {
+		toAdd := changes.Create
+		// Add any ExtraMembers to Create list since they are not in the source people
+		for _, email := range s.SyncSet.ExtraMembers {
+			if !slices.ContainsFunc(toAdd, func(p internal.Person) bool { return strings.EqualFold(p.CompareValue, email) }) {
+				toAdd = append(toAdd, internal.Person{CompareValue: email})
+			}
+		}
+
+		for _, person := range toAdd {
+			id, err := s.userID(ctx, person)
+			if err != nil {
+				eventLog <- internal.EventLogItem{
+					Level:   syslog.LOG_ERR,
+					Message: fmt.Sprintf("unable to add %s to user group %s: %s", person.CompareValue, s.SyncSet.UserGroup, err),
+				}
+				continue
+			}
+			if slices.Contains(members, id) {
+				continue
+			}
+			members = append(members, id)
+			added = append(added, person.CompareValue)
+		}
+	}
+
+	if !s.DestinationConfig.DisableDelete {
+		for _, person := range changes.Delete {
+			// Do not remove ExtraMembers
+			if s.isExtraMember(person.CompareValue) {
+				continue
+			}
+			id, err := s.userID(ctx, person)
+			if err != nil {
+				eventLog <- internal.EventLogItem{
+					Level: syslog.LOG_ERR,
+					Message: fmt.Sprintf("unable to remove %s from user group %s: %s", person.CompareValue,
+						s.SyncSet.UserGroup, err),
+				}
+				continue
+			}
+			if !slices.Contains(members, id) {
+				continue
+			}
+			members = slices.DeleteFunc(members, func(member string) bool { return member == id })
+			removed = append(removed, person.CompareValue)
+		}
+	}
+
+	if slices.Equal(members, current) || internal.Stopping(ctx) {
+		return results
+	}
+
+	params := url.Values{"usergroup": {s.userGroupID}, "users": {strings.Join(members, ",")}}
+	var r response
+	if err := s.call(ctx, "usergroups.users.update", params, &r); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to set the members of user group %s: %s", s.SyncSet.UserGroup, err),
+		}
+		return results
+	}
+
+	for _, email := range added {
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "AddMember " + email}
+		results.Created++
+	}
+	for _, email := range removed {
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "RemoveMember " + email}
+		results.Deleted++
+	}
+	return results
+}
+
+// members returns the user IDs of the members of the user group
+func (s *SlackUserGroups) members(ctx context.Context) ([]string, error) {
+	id, err := s.resolveUserGroupID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		response
+		Users []string `json:"users"`
+	}
+	params := url.Values{"usergroup": {id}, "include_disabled": {"true"}}
+	if err := s.call(ctx, "usergroups.users.list", params, &r); err != nil {
+		return nil, fmt.Errorf("unable to get members of user group %s: %w", s.SyncSet.UserGroup, err)
+	}
+	return r.Users, nil
+}
+
+// resolveUserGroupID finds the ID of the user group with the UserGroup as its handle, name, or ID
+func (s *SlackUserGroups) resolveUserGroupID(ctx context.Context) (string, error) {
+	if s.userGroupID != "" {
+		return s.userGroupID, nil
+	}
+
+	var r struct {
+		response
+		UserGroups []userGroup `json:"usergroups"`
+	}
+	if err := s.call(ctx, "usergroups.list", url.Values{"include_disabled": {"true"}}, &r); err != nil {
+		return "", fmt.Errorf("unable to find user group %s: %w", s.SyncSet.UserGroup, err)
+	}
+
+	name := s.SyncSet.UserGroup
+	i := slices.IndexFunc(r.UserGroups, func(g userGroup) bool { return g.ID == name })
+	if i < 0 {
+		i = slices.IndexFunc(r.UserGroups, func(g userGroup) bool { return strings.EqualFold(g.Handle, name) })
+	}
+	if i < 0 {
+		i = slices.IndexFunc(r.UserGroups, func(g userGroup) bool { return strings.EqualFold(g.Name, name) })
+	}
+	if i < 0 {
+		return "", fmt.Errorf("user group %s not found", name)
+	}
+	if r.UserGroups[i].DateDelete != 0 {
+		return "", fmt.Errorf("user group %s is disabled", name)
+	}
+	s.userGroupID = r.UserGroups[i].ID
+	return s.userGroupID, nil
+}
+
+// userID returns the person's Slack user ID, from the ID set by ListUsers if possible, or else by looking up the
+// user with the person's email address
+func (s *SlackUserGroups) userID(ctx context.Context, person internal.Person) (string, error) {
+	if person.ID != "" {
+		return person.ID, nil
+	}
+	email := strings.ToLower(person.CompareValue)
+	if id, ok := s.userIDs[email]; ok {
+		return id, nil
+	}
+
+	var r struct {
+		response
+		User user `json:"user"`
+	}
+	err := s.call(ctx, "users.lookupByEmail", url.Values{"email": {email}}, &r)
+	if isError(err, "users_not_found") {
+		return "", errors.New("no Slack user has this email address")
+	} else if err != nil {
+		return "", err
+	}
+	s.userIDs[email] = r.User.ID
+	return r.User.ID, nil
+}
+
+func (s *SlackUserGroups) isExtraMember(email string) bool {
+	return slices.ContainsFunc(s.SyncSet.ExtraMembers, func(member string) bool {
+		return strings.EqualFold(member, email)
+	})
+}
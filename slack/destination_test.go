@@ -0,0 +1,220 @@
+package slack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func newTestSlackUserGroups(
+	t *testing.T,
+	service *testService,
+	config internal.DestinationConfig,
+	extraJSON, syncSet string,
+) *SlackUserGroups {
+	extra := `{"BaseURL": "` + service.URL + `/", "Token": "` + testToken + `", "PageSize": 2`
+	if extraJSON != "" {
+		extra += ", " + extraJSON
+	}
+	config.ExtraJSON = []byte(extra + "}")
+
+	destination, err := NewSlackUserGroupsDestination(config)
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*SlackUserGroups)
+}
+
+func applyTestChanges(
+	t *testing.T,
+	s *SlackUserGroups,
+	changes internal.ChangeSet,
+) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := s.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+func TestNewSlackUserGroupsDestination(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		want       Client
+		wantErrMsg string
+	}{
+		{
+			name:      "defaults",
+			extraJSON: `{"Token": "xoxp-1"}`,
+			want: Client{
+				BaseURL:            DefaultBaseURL,
+				Token:              "xoxp-1",
+				HttpTimeoutSeconds: DefaultHttpTimeoutSeconds,
+				PageSize:           DefaultPageSize,
+			},
+		},
+		{
+			name:       "no token",
+			extraJSON:  `{}`,
+			wantErrMsg: "Token is required",
+		},
+		{
+			name:       "invalid BaseURL",
+			extraJSON:  `{"Token": "xoxp-1", "BaseURL": "slack.com"}`,
+			wantErrMsg: "invalid BaseURL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewSlackUserGroupsDestination(internal.DestinationConfig{
+				ExtraJSON: []byte(tt.extraJSON),
+			})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, destination.(*SlackUserGroups).Client)
+		})
+	}
+}
+
+func TestSlackUserGroups_ForSet(t *testing.T) {
+	destination, err := NewSlackUserGroupsDestination(internal.DestinationConfig{
+		ExtraJSON: []byte(`{"Token": "xoxp-1", "ExtraMembers": ["admin@example.org"]}`),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, destination.ForSet([]byte(`{"UserGroup": "@finance-team"}`)))
+	require.Equal(t, DestinationSyncSet{
+		UserGroup:    "finance-team",
+		ExtraMembers: []string{"admin@example.org"},
+	}, destination.(*SlackUserGroups).SyncSet)
+
+	require.EqualError(t, destination.ForSet([]byte(`{}`)), "UserGroup missing from sync set json")
+}
+
+func TestSlackUserGroups_ListUsers(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		want       []internal.Person
+		wantErrMsg string
+	}{
+		{
+			name:    "handle",
+			syncSet: `{"UserGroup": "@finance-team"}`,
+			want: []internal.Person{
+				{CompareValue: "ann@example.org", ID: "U1", Attributes: map[string]string{"email": "ann@example.org"}},
+				{CompareValue: "bob@example.org", ID: "U2", Attributes: map[string]string{"email": "bob@example.org"}},
+			},
+		},
+		{
+			name:    "name with ExtraMembers",
+			syncSet: `{"UserGroup": "finance team", "ExtraMembers": ["BOB@example.org"]}`,
+			want: []internal.Person{
+				{CompareValue: "ann@example.org", ID: "U1", Attributes: map[string]string{"email": "ann@example.org"}},
+			},
+		},
+		{
+			name:       "disabled",
+			syncSet:    `{"UserGroup": "S2"}`,
+			wantErrMsg: "user group S2 is disabled",
+		},
+		{
+			name:       "not found",
+			syncSet:    `{"UserGroup": "it-team"}`,
+			wantErrMsg: "user group it-team not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := startTestService(t)
+			service.busy(1)
+			s := newTestSlackUserGroups(t, service, internal.DestinationConfig{}, "", tt.syncSet)
+
+			people, err := s.ListUsers(context.Background(), []string{"email"})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, people)
+		})
+	}
+}
+
+func TestSlackUserGroups_ApplyChangeSet(t *testing.T) {
+	service := startTestService(t)
+	s := newTestSlackUserGroups(t, service, internal.DestinationConfig{}, `"ExtraMembers": ["dan@example.org"]`,
+		`{"UserGroup": "finance-team"}`)
+
+	_, err := s.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+
+	changes := internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "cat@example.org"}, {CompareValue: "eve@example.org"}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org", ID: "U2"}},
+	}
+	results, messages := applyTestChanges(t, s, changes)
+
+	require.Equal(t, internal.ChangeResults{Created: 2, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"unable to add eve@example.org to user group finance-team: no Slack user has this email address",
+		"AddMember cat@example.org",
+		"AddMember dan@example.org",
+		"RemoveMember bob@example.org",
+	}, messages)
+	require.Equal(t, []string{"U1", "U5", "U3", "U4"}, service.groupMembers("S1"))
+
+	// the next run has nothing to change, so the members are not set again
+	results, _ = applyTestChanges(t, s, internal.ChangeSet{Delete: []internal.Person{{CompareValue: "dan@example.org"}}})
+	require.Equal(t, internal.ChangeResults{}, results, "ExtraMembers are not removed")
+	require.Equal(t, 1, countMethod(service.methods(), "usergroups.users.update"))
+}
+
+func TestSlackUserGroups_ApplyChangeSet_disabled(t *testing.T) {
+	service := startTestService(t)
+	s := newTestSlackUserGroups(t, service, internal.DestinationConfig{DisableDelete: true}, "",
+		`{"UserGroup": "S1"}`)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "CAT@example.org"}},
+		Delete: []internal.Person{{CompareValue: "ann@example.org", ID: "U1"}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 1}, results)
+	require.Equal(t, []string{"AddMember CAT@example.org"}, messages)
+	require.Equal(t, []string{"U1", "U2", "U5", "U3"}, service.groupMembers("S1"))
+	require.Contains(t, service.methods(), "users.lookupByEmail")
+}
+
+func TestSlackUserGroups_ApplyChangeSet_error(t *testing.T) {
+	service := startTestService(t)
+	s := newTestSlackUserGroups(t, service, internal.DestinationConfig{}, `"Token": "wrong"`,
+		`{"UserGroup": "finance-team"}`)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "cat@example.org"}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Equal(t, []string{
+		"unable to find user group finance-team: Slack error from usergroups.list: invalid_auth",
+	}, messages)
+}
+
+func countMethod(methods []string, method string) int {
+	n := 0
+	for _, m := range methods {
+		if m == method {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package slack
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v6/internal/testutil"
+)
+
+const testToken = "xoxp-secret"
+
+// testService is an in-process Slack Web API with the methods used for user groups
+type testService struct {
+	*testutil.Server
+	URL string
+
+	users      []map[string]any
+	userGroups []map[string]any
+	members    map[string][]string
+}
+
+func startTestService(t *testing.T) *testService {
+	s := &testService{
+		users: []map[string]any{
+			testUser("U1", "ann@example.org"),
+			testUser("U2", "Bob@example.org"),
+			testUser("U3", "cat@example.org"),
+			testUser("U4", "dan@example.org"),
+			testUser("U5", ""),
+		},
+		userGroups: []map[string]any{
+			{"id": "S1", "handle": "finance-team", "name": "Finance Team", "date_delete": 0},
+			{"id": "S2", "handle": "old-team", "name": "Old Team", "date_delete": 1700000000},
+		},
+		members: map[string][]string{"S1": {"U1", "U2", "U5"}, "S2": {}},
+	}
+	s.Server = testutil.NewServer(t, s.handle)
+	s.URL = s.Server.URL + "/api"
+	return s
+}
+
+// busy makes the service refuse the next n requests with 429 Too Many Requests
+func (s *testService) busy(n int) {
+	s.Busy(n, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+}
+
+func (s *testService) handle(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		writeResponse(w, map[string]any{"ok": false, "error": "invalid_auth"})
+		return
+	}
+
+	switch method {
+	case "usergroups.list":
+		writeResponse(w, map[string]any{"ok": true, "usergroups": s.userGroups})
+	case "usergroups.users.list":
+		members, ok := s.members[r.Form.Get("usergroup")]
+		if !ok {
+			writeResponse(w, map[string]any{"ok": false, "error": "no_such_subteam"})
+			return
+		}
+		writeResponse(w, map[string]any{"ok": true, "users": members})
+	case "usergroups.users.update":
+		users := strings.Split(r.Form.Get("users"), ",")
+		for _, id := range users {
+			if !slices.ContainsFunc(s.users, func(u map[string]any) bool { return u["id"] == id }) {
+				writeResponse(w, map[string]any{"ok": false, "error": "invalid_users"})
+				return
+			}
+		}
+		s.members[r.Form.Get("usergroup")] = users
+		writeResponse(w, map[string]any{"ok": true})
+	case "users.list":
+		limit, _ := strconv.Atoi(r.Form.Get("limit"))
+		start, _ := strconv.Atoi(r.Form.Get("cursor"))
+		end := min(start+limit, len(s.users))
+		cursor := ""
+		if end < len(s.users) {
+			cursor = strconv.Itoa(end)
+		}
+		writeResponse(w, map[string]any{
+			"ok":                true,
+			"members":           s.users[start:end],
+			"response_metadata": map[string]string{"next_cursor": cursor},
+		})
+	case "users.lookupByEmail":
+		for _, u := range s.users {
+			profile := u["profile"].(map[string]any)
+			if strings.EqualFold(profile["email"].(string), r.Form.Get("email")) {
+				writeResponse(w, map[string]any{"ok": true, "user": u})
+				return
+			}
+		}
+		writeResponse(w, map[string]any{"ok": false, "error": "users_not_found"})
+	default:
+		writeResponse(w, map[string]any{"ok": false, "error": "unknown_method"})
+	}
+}
+
+func (s *testService) groupMembers(id string) []string {
+	s.Lock()
+	defer s.Unlock()
+	return slices.Clone(s.members[id])
+}
+
+// methods returns the Web API method of each request received
+func (s *testService) methods() []string {
+	var methods []string
+	for _, request := range s.Requests() {
+		methods = append(methods, strings.TrimPrefix(request.Path, "/api/"))
+	}
+	return methods
+}
+
+func writeResponse(w http.ResponseWriter, body map[string]any) {
+	testutil.WriteJSON(w, http.StatusOK, body)
+}
+
+func testUser(id, email string) map[string]any {
+	return map[string]any{"id": id, "profile": map[string]any{"email": email}, "is_bot": email == ""}
+}
@@ -0,0 +1,398 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"slices"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+const DefaultBatchSize = 100
+
+const (
+	opCreate = iota
+	opUpdate
+	opDelete
+)
+
+// SQLDestination keeps people in a database table, with a row for each person and a column for each attribute
+type SQLDestination struct {
+	Connection
+
+	// DestinationSyncSet holds the defaults for each sync set
+	DestinationSyncSet
+
+	BatchSize int // number of changes made in each transaction, default 100
+
+	DestinationConfig internal.DestinationConfig `json:"-"`
+	SyncSet           DestinationSyncSet         `json:"-"`
+}
+
+// DestinationSyncSet configures the table for a sync set. Any property not set in the sync set is taken from
+// ExtraJSON.
+type DestinationSyncSet struct {
+	Table            string // may include a schema, as in reporting.staff
+	CompareAttribute string // the column that identifies a person
+	Where            string // an optional SQL condition that limits the rows in the sync set
+
+	// SoftDeleteColumn is a boolean column that is set to true instead of deleting the row, if it is not empty
+	SoftDeleteColumn string
+}
+
+// NewSQLDestination unmarshals the destinationConfig's ExtraJSON into a SQLDestination struct. No connection is made
+// until ListUsers or ApplyChangeSet is called.
+func NewSQLDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var s SQLDestination
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &s); err != nil {
+		return nil, fmt.Errorf("error reading SQL destination config: %w", err)
+	}
+
+	if err := s.Connection.validate(); err != nil {
+		return nil, fmt.Errorf("invalid SQL destination config: %w", err)
+	}
+	if s.BatchSize <= 0 {
+		s.BatchSize = DefaultBatchSize
+	}
+
+	s.DestinationConfig = destinationConfig
+	return &s, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (s *SQLDestination) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := s.DestinationSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if syncSet.Table == "" {
+		return errors.New("Table is required")
+	}
+	if syncSet.CompareAttribute == "" {
+		return errors.New("CompareAttribute is required")
+	}
+
+	s.SyncSet = syncSet
+	return nil
+}
+
+// ListUsers selects the desired columns of the rows in the sync set, except those that are soft-deleted. The ID of
+// each person is the value of the CompareAttribute column.
+func (s *SQLDestination) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	columns := []string{s.SyncSet.CompareAttribute}
+	for _, attr := range desiredAttrs {
+		columns = internal.AddStringToSlice(attr, columns)
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = s.quote(column)
+	}
+
+	query := "SELECT " + strings.Join(quoted, ", ") + " FROM " + s.quote(s.SyncSet.Table) + s.where()
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", s.SyncSet.Table, err)
+	}
+	defer rows.Close()
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	people := []internal.Person{}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("unable to read row %d of %s: %w", len(people)+1, s.SyncSet.Table, err)
+		}
+
+		person := internal.Person{Attributes: map[string]string{}}
+		person.CompareValue, _ = formatValue(values[0])
+		person.ID = person.CompareValue
+		for i, column := range columns {
+			if value, ok := formatValue(values[i]); ok && slices.Contains(desiredAttrs, column) {
+				person.Attributes[column] = value
+			}
+		}
+		people = append(people, person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", s.SyncSet.Table, err)
+	}
+	return people, nil
+}
+
+type operation struct {
+	kind   int
+	person internal.Person
+}
+
+// ApplyChangeSet makes the changes in batches, each in its own transaction. If a change in a batch fails, none of the
+// changes in that batch are made. A created person's row is updated if it already exists, such as after a soft
+// delete, and inserted otherwise.
+func (s *SQLDestination) ApplyChangeSet(
+	ctx context.Context,
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem,
+) internal.ChangeResults {
+	var results internal.ChangeResults
+
+	var operations []operation
+	if !s.DestinationConfig.DisableAdd {
+		for _, person := range changes.Create {
+			operations = append(operations, operation{kind: opCreate, person: person})
+		}
+	}
+	if !s.DestinationConfig.DisableUpdate {
+		for _, person := range changes.Update {
+			operations = append(operations, operation{kind: opUpdate, person: person})
+		}
+	}
+	if !s.DestinationConfig.DisableDelete {
+		for _, person := range changes.Delete {
+			operations = append(operations, operation{kind: opDelete, person: person})
+		}
+	}
+	if len(operations) == 0 || internal.Stopping(ctx) {
+		return results
+	}
+
+	db, err := s.open(ctx)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to apply changes to %s: %s", s.SyncSet.Table, err),
+		}
+		return results
+	}
+	defer db.Close()
+
+	for batch := range slices.Chunk(operations, s.BatchSize) {
+		if internal.Stopping(ctx) {
+			break
+		}
+		s.applyBatch(ctx, db, batch, &results, eventLog)
+	}
+	return results
+}
+
+func (s *SQLDestination) applyBatch(
+	ctx context.Context,
+	db *dbsql.DB,
+	batch []operation,
+	results *internal.ChangeResults,
+	eventLog chan<- internal.EventLogItem,
+) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to start a transaction on %s: %s", s.SyncSet.Table, err),
+		}
+		return
+	}
+
+	messages := make([]string, 0, len(batch))
+	for _, op := range batch {
+		var err error
+		var message string
+		switch op.kind {
+		case opCreate:
+			err = s.upsert(ctx, tx, op.person)
+			message = "AddPerson " + op.person.CompareValue
+		case opUpdate:
+			err = s.update(ctx, tx, op.person)
+			message = fmt.Sprintf("UpdatePerson %s, changed: %s", op.person.CompareValue,
+				strings.Join(op.person.ChangedAttributeNames(), ", "))
+		case opDelete:
+			err = s.delete(ctx, tx, op.person)
+			message = "DeletePerson " + op.person.CompareValue
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			eventLog <- internal.EventLogItem{
+				Level: syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to change %s in %s, %d changes rolled back: %s", op.person.CompareValue,
+					s.SyncSet.Table, len(batch), err),
+			}
+			return
+		}
+		messages = append(messages, message)
+	}
+
+	if err := tx.Commit(); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to commit %d changes to %s: %s", len(batch), s.SyncSet.Table, err),
+		}
+		return
+	}
+
+	for i, op := range batch {
+		switch op.kind {
+		case opCreate:
+			results.Created++
+		case opUpdate:
+			results.Updated++
+		case opDelete:
+			results.Deleted++
+		}
+		eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: messages[i]}
+	}
+}
+
+// upsert updates the person's row in the sync set, even if it was soft deleted, or inserts a row if there is none
+func (s *SQLDestination) upsert(ctx context.Context, tx *dbsql.Tx, person internal.Person) error {
+	attributes := s.attributesToWrite(person.Attributes)
+	if s.SyncSet.SoftDeleteColumn != "" {
+		attributes[s.SyncSet.SoftDeleteColumn] = false
+	}
+
+	var count int
+	query := "SELECT COUNT(*) FROM " + s.quote(s.SyncSet.Table) + " WHERE " + s.rowCondition(s.placeholder(1), true)
+	if err := tx.QueryRowContext(ctx, query, person.CompareValue).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return s.updateRow(ctx, tx, attributes, person.CompareValue, true)
+	}
+
+	attributes[s.SyncSet.CompareAttribute] = person.CompareValue
+	columns := sortedColumns(attributes)
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		quoted[i] = s.quote(column)
+		placeholders[i] = s.placeholder(i + 1)
+		args[i] = attributes[column]
+	}
+
+	statement := "INSERT INTO " + s.quote(s.SyncSet.Table) + " (" + strings.Join(quoted, ", ") + ") VALUES (" +
+		strings.Join(placeholders, ", ") + ")"
+	_, err := tx.ExecContext(ctx, statement, args...)
+	return err
+}
+
+// update sets the changed columns of the person's row
+func (s *SQLDestination) update(ctx context.Context, tx *dbsql.Tx, person internal.Person) error {
+	attributes := s.attributesToWrite(person.ChangedAttributes())
+	return s.updateRow(ctx, tx, attributes, personKey(person), false)
+}
+
+// delete deletes the person's row, or sets its SoftDeleteColumn to true
+func (s *SQLDestination) delete(ctx context.Context, tx *dbsql.Tx, person internal.Person) error {
+	if s.SyncSet.SoftDeleteColumn != "" {
+		attributes := map[string]any{s.SyncSet.SoftDeleteColumn: true}
+		return s.updateRow(ctx, tx, attributes, personKey(person), false)
+	}
+
+	statement := "DELETE FROM " + s.quote(s.SyncSet.Table) + " WHERE " + s.rowCondition(s.placeholder(1), false)
+	_, err := tx.ExecContext(ctx, statement, personKey(person))
+	return err
+}
+
+// updateRow sets the columns of the row in the sync set with the given key, including soft deleted rows if
+// includeDeleted is true
+func (s *SQLDestination) updateRow(
+	ctx context.Context,
+	tx *dbsql.Tx,
+	attributes map[string]any,
+	key string,
+	includeDeleted bool,
+) error {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	columns := sortedColumns(attributes)
+	set := make([]string, len(columns))
+	args := make([]any, 0, len(columns)+1)
+	for i, column := range columns {
+		set[i] = s.quote(column) + " = " + s.placeholder(i+1)
+		args = append(args, attributes[column])
+	}
+	args = append(args, key)
+
+	statement := "UPDATE " + s.quote(s.SyncSet.Table) + " SET " + strings.Join(set, ", ") + " WHERE " +
+		s.rowCondition(s.placeholder(len(args)), includeDeleted)
+	_, err := tx.ExecContext(ctx, statement, args...)
+	return err
+}
+
+// where returns a WHERE clause with the sync set's Where condition and the soft delete condition, if either is set
+func (s *SQLDestination) where() string {
+	conditions := s.conditions(false)
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// rowCondition returns the condition for a person's row in the sync set, matching the key's placeholder to the
+// CompareAttribute column without regard to case, as people are matched when changes are planned
+func (s *SQLDestination) rowCondition(placeholder string, includeDeleted bool) string {
+	key := "LOWER(" + s.quote(s.SyncSet.CompareAttribute) + ") = LOWER(" + placeholder + ")"
+	return strings.Join(append([]string{key}, s.conditions(includeDeleted)...), " AND ")
+}
+
+// conditions returns the sync set's Where condition and, unless includeDeleted is true, the soft delete condition
+func (s *SQLDestination) conditions(includeDeleted bool) []string {
+	var conditions []string
+	if s.SyncSet.Where != "" {
+		conditions = append(conditions, "("+s.SyncSet.Where+")")
+	}
+	if s.SyncSet.SoftDeleteColumn != "" && !includeDeleted {
+		conditions = append(conditions, "NOT COALESCE("+s.quote(s.SyncSet.SoftDeleteColumn)+", FALSE)")
+	}
+	return conditions
+}
+
+// attributesToWrite returns the values to write for the attributes, with NULL for an empty value. The compare
+// attribute and soft delete column are left out.
+func (s *SQLDestination) attributesToWrite(attributes map[string]string) map[string]any {
+	values := make(map[string]any, len(attributes))
+	for attr, value := range attributes {
+		if attr == s.SyncSet.CompareAttribute || attr == s.SyncSet.SoftDeleteColumn {
+			continue
+		}
+		if value == "" {
+			values[attr] = nil
+		} else {
+			values[attr] = value
+		}
+	}
+	return values
+}
+
+// personKey returns the value of the person's CompareAttribute column, as read by ListUsers if possible
+func personKey(person internal.Person) string {
+	if person.ID != "" {
+		return person.ID
+	}
+	return person.CompareValue
+}
+
+func sortedColumns(attributes map[string]any) []string {
+	columns := make([]string, 0, len(attributes))
+	for column := range attributes {
+		columns = append(columns, column)
+	}
+	slices.Sort(columns)
+	return columns
+}
@@ -0,0 +1,273 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+func testRosterStatements() []string {
+	return []string{
+		`CREATE TABLE roster (email TEXT PRIMARY KEY, name TEXT, dept TEXT, title TEXT NOT NULL DEFAULT '',
+			deleted BOOLEAN NOT NULL DEFAULT FALSE)`,
+		`INSERT INTO roster VALUES ('ann@example.com', 'Ann', 'IT', 'Boss', FALSE)`,
+		`INSERT INTO roster VALUES ('bob@example.com', 'Bob', 'IT', '', FALSE)`,
+		`INSERT INTO roster VALUES ('cat@example.com', 'Cat', 'IT', '', TRUE)`,
+		`INSERT INTO roster VALUES ('dan@example.com', 'Dan', 'Finance', '', FALSE)`,
+	}
+}
+
+func newTestSQLDestination(t *testing.T, config internal.DestinationConfig, syncSet string) *SQLDestination {
+	config.Type = internal.DestinationTypeSQL
+	destination, err := NewSQLDestination(config)
+	require.NoError(t, err)
+	require.NoError(t, destination.ForSet([]byte(syncSet)))
+	return destination.(*SQLDestination)
+}
+
+func applyTestChanges(t *testing.T, s *SQLDestination, changes internal.ChangeSet) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := s.ApplyChangeSet(context.Background(), changes, eventLog)
+	close(eventLog)
+
+	var messages []string
+	for event := range eventLog {
+		messages = append(messages, event.Message)
+	}
+	return results, messages
+}
+
+// readTable returns each row of the table as a map, ordered by the first column
+func readTable(t *testing.T, dsn, query string) []map[string]string {
+	db, err := dbsql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	require.NoError(t, err)
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var table []map[string]string
+	for rows.Next() {
+		require.NoError(t, rows.Scan(pointers...))
+		row := map[string]string{}
+		for i, column := range columns {
+			value, ok := formatValue(values[i])
+			if !ok {
+				value = "NULL"
+			}
+			row[column] = value
+		}
+		table = append(table, row)
+	}
+	require.NoError(t, rows.Err())
+	return table
+}
+
+func TestSQLDestination_softDelete(t *testing.T) {
+	dsn := newTestDatabase(t, testRosterStatements()...)
+	s := newTestSQLDestination(t,
+		internal.DestinationConfig{ExtraJSON: []byte(`{"Driver": "sqlite", "DSN": "` + dsn + `", "Table": "roster",
+			"CompareAttribute": "email", "SoftDeleteColumn": "deleted", "BatchSize": 2}`)},
+		`{"Where": "dept = 'IT'"}`)
+
+	people, err := s.ListUsers(context.Background(), []string{"email", "name"})
+	require.NoError(t, err)
+	require.Equal(t, []internal.Person{
+		{
+			CompareValue: "ann@example.com",
+			ID:           "ann@example.com",
+			Attributes:   map[string]string{"email": "ann@example.com", "name": "Ann"},
+		},
+		{
+			CompareValue: "bob@example.com",
+			ID:           "bob@example.com",
+			Attributes:   map[string]string{"email": "bob@example.com", "name": "Bob"},
+		},
+	}, people)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "CAT@example.com", Attributes: map[string]string{"email": "CAT@example.com", "name": "Kat"}},
+			{CompareValue: "eve@example.com", Attributes: map[string]string{"email": "eve@example.com", "dept": "IT"}},
+		},
+		Update: []internal.Person{{
+			CompareValue: "ANN@example.com",
+			ID:           "ann@example.com",
+			Attributes:   map[string]string{"email": "ANN@example.com", "name": "Anne", "dept": "IT"},
+			Changes:      []internal.AttributeChange{{Attribute: "name", Old: "Ann", New: "Anne"}},
+		}},
+		Delete: []internal.Person{{CompareValue: "bob@example.com", ID: "bob@example.com"}},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 2, Updated: 1, Deleted: 1}, results)
+	require.Equal(t, []string{
+		"AddPerson CAT@example.com",
+		"AddPerson eve@example.com",
+		"UpdatePerson ANN@example.com, changed: name",
+		"DeletePerson bob@example.com",
+	}, messages)
+
+	require.Equal(t, []map[string]string{
+		{"email": "ann@example.com", "name": "Anne", "dept": "IT", "title": "Boss", "deleted": "0"},
+		{"email": "bob@example.com", "name": "Bob", "dept": "IT", "title": "", "deleted": "1"},
+		{"email": "cat@example.com", "name": "Kat", "dept": "IT", "title": "", "deleted": "0"},
+		{"email": "dan@example.com", "name": "Dan", "dept": "Finance", "title": "", "deleted": "0"},
+		{"email": "eve@example.com", "name": "NULL", "dept": "IT", "title": "", "deleted": "0"},
+	}, readTable(t, dsn, "SELECT * FROM roster ORDER BY email"))
+}
+
+func TestSQLDestination_delete(t *testing.T) {
+	dsn := newTestDatabase(t, testRosterStatements()...)
+	s := newTestSQLDestination(t,
+		internal.DestinationConfig{ExtraJSON: []byte(`{"Driver": "sqlite", "DSN": "` + dsn + `"}`)},
+		`{"Table": "roster", "CompareAttribute": "email"}`)
+
+	people, err := s.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Len(t, people, 4)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Update: []internal.Person{{
+			CompareValue: "bob@example.com",
+			ID:           "bob@example.com",
+			Attributes:   map[string]string{"email": "bob@example.com", "name": ""},
+			Changes:      []internal.AttributeChange{{Attribute: "name", Old: "Bob", New: ""}},
+		}},
+		Delete: []internal.Person{{CompareValue: "cat@example.com"}, {CompareValue: "dan@example.com"}},
+	})
+	require.Equal(t, internal.ChangeResults{Updated: 1, Deleted: 2}, results)
+	require.Len(t, messages, 3)
+
+	require.Equal(t, []map[string]string{
+		{"email": "ann@example.com", "name": "Ann"},
+		{"email": "bob@example.com", "name": "NULL"},
+	}, readTable(t, dsn, "SELECT email, name FROM roster ORDER BY email"))
+}
+
+func TestSQLDestination_where(t *testing.T) {
+	dsn := newTestDatabase(t, testRosterStatements()...)
+	s := newTestSQLDestination(t,
+		internal.DestinationConfig{ExtraJSON: []byte(`{"Driver": "sqlite", "DSN": "` + dsn + `"}`)},
+		`{"Table": "roster", "CompareAttribute": "email", "Where": "dept LIKE 'I%'"}`)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Update: []internal.Person{{
+			CompareValue: "BOB@example.com",
+			ID:           "BOB@example.com",
+			Attributes:   map[string]string{"email": "BOB@example.com", "name": "Robert"},
+			Changes:      []internal.AttributeChange{{Attribute: "name", Old: "Bob", New: "Robert"}},
+		}},
+		Delete: []internal.Person{{CompareValue: "ann@example.com"}, {CompareValue: "dan@example.com"}},
+	})
+	require.Equal(t, internal.ChangeResults{Updated: 1, Deleted: 2}, results)
+	require.Len(t, messages, 3)
+
+	require.Equal(t, []map[string]string{
+		{"email": "bob@example.com", "name": "Robert"},
+		{"email": "cat@example.com", "name": "Cat"},
+		{"email": "dan@example.com", "name": "Dan"},
+	}, readTable(t, dsn, "SELECT email, name FROM roster ORDER BY email"), "rows outside the sync set should not change")
+}
+
+func TestSQLDestination_rollback(t *testing.T) {
+	dsn := newTestDatabase(t, testRosterStatements()...)
+	s := newTestSQLDestination(t,
+		internal.DestinationConfig{ExtraJSON: []byte(`{"Driver": "sqlite", "DSN": "` + dsn + `", "BatchSize": 2}`)},
+		`{"Table": "roster", "CompareAttribute": "email"}`)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "eve@example.com", Attributes: map[string]string{"email": "eve@example.com"}},
+			{CompareValue: "fay@example.com", Attributes: map[string]string{"email": "fay@example.com", "title": ""}},
+			{CompareValue: "gus@example.com", Attributes: map[string]string{"email": "gus@example.com"}},
+		},
+	})
+	require.Equal(t, internal.ChangeResults{Created: 1}, results)
+	require.Len(t, messages, 2)
+	require.Contains(t, messages[0], "unable to change fay@example.com in roster, 2 changes rolled back")
+	require.Equal(t, "AddPerson gus@example.com", messages[1])
+
+	require.Equal(t, []map[string]string{
+		{"email": "ann@example.com"},
+		{"email": "bob@example.com"},
+		{"email": "cat@example.com"},
+		{"email": "dan@example.com"},
+		{"email": "gus@example.com"},
+	}, readTable(t, dsn, "SELECT email FROM roster ORDER BY email"))
+}
+
+func TestSQLDestination_disabled(t *testing.T) {
+	dsn := newTestDatabase(t, testRosterStatements()...)
+	s := newTestSQLDestination(t, internal.DestinationConfig{
+		ExtraJSON:     []byte(`{"Driver": "sqlite", "DSN": "` + dsn + `"}`),
+		DisableAdd:    true,
+		DisableUpdate: true,
+		DisableDelete: true,
+	}, `{"Table": "roster", "CompareAttribute": "email"}`)
+
+	results, messages := applyTestChanges(t, s, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "eve@example.com"}},
+		Delete: []internal.Person{{CompareValue: "ann@example.com"}},
+	})
+	require.Equal(t, internal.ChangeResults{}, results)
+	require.Empty(t, messages)
+	require.Len(t, readTable(t, dsn, "SELECT email FROM roster"), 4)
+}
+
+func TestSQLDestination_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "valid",
+			syncSet: `{"Table": "reporting.roster", "CompareAttribute": "email", "SoftDeleteColumn": "deleted"}`,
+		},
+		{
+			name:       "no table",
+			syncSet:    `{"CompareAttribute": "email"}`,
+			wantErrMsg: "Table is required",
+		},
+		{
+			name:       "no compare attribute",
+			syncSet:    `{"Table": "roster"}`,
+			wantErrMsg: "CompareAttribute is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := NewSQLDestination(internal.DestinationConfig{
+				ExtraJSON: []byte(`{"Driver": "postgres", "DSN": "postgres://localhost/hr"}`),
+			})
+			require.NoError(t, err)
+
+			err = destination.ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConnection_quote(t *testing.T) {
+	require.Equal(t, `"reporting"."roster"`, (&Connection{Driver: DriverPostgres}).quote("reporting.roster"))
+	require.Equal(t, "`my``table`", (&Connection{Driver: DriverMySQL}).quote("my`table"))
+	require.Equal(t, `"first ""name"""`, (&Connection{Driver: DriverSQLite}).quote(`first "name"`))
+	require.Equal(t, "$2", (&Connection{Driver: DriverPostgres}).placeholder(2))
+	require.Equal(t, "?", (&Connection{Driver: DriverMySQL}).placeholder(2))
+}
@@ -0,0 +1,127 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// SQLSource reads people from a database, using a query for each sync set
+type SQLSource struct {
+	Connection
+
+	// SourceSyncSet holds the defaults for each sync set
+	SourceSyncSet
+
+	SourceConfig internal.SourceConfig `json:"-"`
+	SyncSet      SourceSyncSet         `json:"-"`
+}
+
+// SourceSyncSet configures the query for a sync set. Any property not set in the sync set is taken from ExtraJSON.
+type SourceSyncSet struct {
+	Query            string
+	Args             []any // values for the query's placeholders, such as $1 for Postgres or ? for MySQL and SQLite
+	CompareAttribute string
+}
+
+// NewSQLSource unmarshals the sourceConfig's ExtraJSON into a SQLSource struct. No connection is made until
+// ListUsers is called.
+func NewSQLSource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var s SQLSource
+	if err := json.Unmarshal(sourceConfig.ExtraJSON, &s); err != nil {
+		return nil, fmt.Errorf("error reading SQL source config: %w", err)
+	}
+
+	if err := s.Connection.validate(); err != nil {
+		return nil, fmt.Errorf("invalid SQL source config: %w", err)
+	}
+
+	s.SourceConfig = sourceConfig
+	return &s, nil
+}
+
+// ForSet reads the sync set config, with defaults taken from ExtraJSON
+func (s *SQLSource) ForSet(syncSetJson json.RawMessage) error {
+	syncSet := s.SourceSyncSet
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &syncSet); err != nil {
+			return fmt.Errorf("json unmarshal error on set config: %w", err)
+		}
+	}
+
+	if syncSet.Query == "" {
+		return errors.New("Query is required")
+	}
+	if syncSet.CompareAttribute == "" {
+		return errors.New("CompareAttribute is required")
+	}
+
+	s.SyncSet = syncSet
+	return nil
+}
+
+// ListUsers runs the query in a read-only transaction and returns a person for each row, leaving out NULL values
+func (s *SQLSource) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, &dbsql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to start a transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, s.SyncSet.Query, s.SyncSet.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the query's columns: %w", err)
+	}
+	if !slices.Contains(columns, s.SyncSet.CompareAttribute) {
+		return nil, fmt.Errorf("CompareAttribute %q is not a column of the query result", s.SyncSet.CompareAttribute)
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	people := []internal.Person{}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("unable to read row %d: %w", len(people)+1, err)
+		}
+
+		person := internal.Person{Attributes: map[string]string{}}
+		for i, column := range columns {
+			value, ok := formatValue(values[i])
+			if !ok {
+				continue
+			}
+			if column == s.SyncSet.CompareAttribute {
+				person.CompareValue = value
+			}
+			if slices.Contains(desiredAttrs, column) {
+				person.Attributes[column] = value
+			}
+		}
+		people = append(people, person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return people, nil
+}
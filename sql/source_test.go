@@ -0,0 +1,204 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/silinternational/personnel-sync/v6/internal"
+)
+
+// newTestDatabase creates a SQLite database from the statements given, and returns its DSN
+func newTestDatabase(t *testing.T, statements ...string) string {
+	dsn := filepath.Join(t.TempDir(), "people.db")
+	db, err := dbsql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		require.NoError(t, err, statement)
+	}
+	return dsn
+}
+
+func testPeopleStatements() []string {
+	return []string{
+		`CREATE TABLE people (id INTEGER PRIMARY KEY, email TEXT NOT NULL, name TEXT, dept TEXT, salary REAL,
+			active BOOLEAN, hired DATETIME)`,
+		`INSERT INTO people VALUES (1, 'ann@example.com', 'Ann', 'IT', 1000.5, 1, '2020-01-02 03:04:05')`,
+		`INSERT INTO people VALUES (2, 'bob@example.com', NULL, 'IT', NULL, 0, NULL)`,
+		`INSERT INTO people VALUES (3, 'cat@example.com', 'Cat', 'Finance', 2000, 1, NULL)`,
+	}
+}
+
+func newTestSQLSource(t *testing.T, extraJSON string) *SQLSource {
+	source, err := NewSQLSource(internal.SourceConfig{Type: internal.SourceTypeSQL, ExtraJSON: []byte(extraJSON)})
+	require.NoError(t, err)
+	return source.(*SQLSource)
+}
+
+func TestSQLSource_ListUsers(t *testing.T) {
+	dsn := newTestDatabase(t, testPeopleStatements()...)
+
+	tests := []struct {
+		name         string
+		syncSet      string
+		desiredAttrs []string
+		want         []internal.Person
+		wantErrMsg   string
+	}{
+		{
+			name:         "all columns",
+			syncSet:      `{"Query": "SELECT id, email, name, salary, active, hired FROM people WHERE dept = 'IT' ORDER BY id"}`,
+			desiredAttrs: []string{"id", "email", "name", "salary", "active", "hired"},
+			want: []internal.Person{
+				{
+					CompareValue: "ann@example.com",
+					Attributes: map[string]string{
+						"id":     "1",
+						"email":  "ann@example.com",
+						"name":   "Ann",
+						"salary": "1000.5",
+						"active": "1",
+						"hired":  "2020-01-02T03:04:05Z",
+					},
+				},
+				{
+					CompareValue: "bob@example.com",
+					Attributes:   map[string]string{"id": "2", "email": "bob@example.com", "active": "0"},
+				},
+			},
+		},
+		{
+			name: "args and aliases",
+			syncSet: `{"Query": "SELECT email AS Email, name AS FullName FROM people WHERE dept = ?",
+				"Args": ["Finance"], "CompareAttribute": "Email"}`,
+			desiredAttrs: []string{"FullName"},
+			want: []internal.Person{
+				{CompareValue: "cat@example.com", Attributes: map[string]string{"FullName": "Cat"}},
+			},
+		},
+		{
+			name:         "no rows",
+			syncSet:      `{"Query": "SELECT email FROM people WHERE dept = 'HR'"}`,
+			desiredAttrs: []string{"email"},
+			want:         []internal.Person{},
+		},
+		{
+			name:         "compare attribute not in result",
+			syncSet:      `{"Query": "SELECT name FROM people"}`,
+			desiredAttrs: []string{"name"},
+			wantErrMsg:   `CompareAttribute "email" is not a column`,
+		},
+		{
+			name:         "invalid query",
+			syncSet:      `{"Query": "SELECT email FROM staff"}`,
+			desiredAttrs: []string{"email"},
+			wantErrMsg:   "query failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSQLSource(t, `{"Driver": "sqlite", "DSN": "`+dsn+`", "CompareAttribute": "email"}`)
+			require.NoError(t, s.ForSet([]byte(tt.syncSet)))
+
+			got, err := s.ListUsers(context.Background(), tt.desiredAttrs)
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSQLSource_ListUsers_rollback(t *testing.T) {
+	dsn := newTestDatabase(t, testPeopleStatements()...)
+	s := newTestSQLSource(t, `{"Driver": "sqlite", "DSN": "`+dsn+`", "CompareAttribute": "email"}`)
+
+	require.NoError(t, s.ForSet([]byte(`{"Query": "DELETE FROM people WHERE dept = 'IT' RETURNING email"}`)))
+	got, err := s.ListUsers(context.Background(), []string{"email"})
+	if err == nil {
+		require.Len(t, got, 2)
+	}
+
+	require.NoError(t, s.ForSet([]byte(`{"Query": "SELECT email FROM people"}`)))
+	got, err = s.ListUsers(context.Background(), []string{"email"})
+	require.NoError(t, err)
+	require.Len(t, got, 3, "no changes should be committed")
+}
+
+func TestSQLSource_ForSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncSet    string
+		wantErrMsg string
+	}{
+		{
+			name:    "valid",
+			syncSet: `{"Query": "SELECT * FROM people", "CompareAttribute": "email"}`,
+		},
+		{
+			name:       "no query",
+			syncSet:    `{"CompareAttribute": "email"}`,
+			wantErrMsg: "Query is required",
+		},
+		{
+			name:       "no compare attribute",
+			syncSet:    `{"Query": "SELECT * FROM people"}`,
+			wantErrMsg: "CompareAttribute is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestSQLSource(t, `{"Driver": "sqlite", "DSN": ":memory:"}`).ForSet([]byte(tt.syncSet))
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewSQLSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraJSON  string
+		wantErrMsg string
+	}{
+		{
+			name:      "postgres",
+			extraJSON: `{"Driver": "postgres", "DSN": "postgres://sync@db.example.com/hr"}`,
+		},
+		{
+			name:      "mysql",
+			extraJSON: `{"Driver": "MySQL", "DSN": "sync@tcp(db.example.com)/hr"}`,
+		},
+		{
+			name:       "unknown driver",
+			extraJSON:  `{"Driver": "oracle", "DSN": "hr"}`,
+			wantErrMsg: "invalid Driver",
+		},
+		{
+			name:       "no DSN",
+			extraJSON:  `{"Driver": "sqlite"}`,
+			wantErrMsg: "DSN is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSQLSource(internal.SourceConfig{ExtraJSON: []byte(tt.extraJSON)})
+			if tt.wantErrMsg != "" {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// database drivers
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Connection holds the settings for connecting to a database
+type Connection struct {
+	Driver string // "postgres", "mysql" or "sqlite"
+	DSN    string // the data source name, in the form used by the driver
+}
+
+func (c *Connection) validate() error {
+	if _, err := c.driverName(); err != nil {
+		return err
+	}
+	if c.DSN == "" {
+		return errors.New("DSN is required")
+	}
+	return nil
+}
+
+// driverName returns the name the driver is registered under
+func (c *Connection) driverName() (string, error) {
+	switch strings.ToLower(c.Driver) {
+	case DriverPostgres, "postgresql", "pgx":
+		return "pgx", nil
+	case DriverMySQL:
+		return "mysql", nil
+	case DriverSQLite, "sqlite3":
+		return "sqlite", nil
+	default:
+		return "", fmt.Errorf("invalid Driver %q, must be %s, %s or %s", c.Driver,
+			DriverPostgres, DriverMySQL, DriverSQLite)
+	}
+}
+
+// open opens the database and checks that it can be reached. The caller must close it.
+func (c *Connection) open(ctx context.Context) (*dbsql.DB, error) {
+	driver, err := c.driverName()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbsql.Open(driver, c.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s database: %w", c.Driver, err)
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxIdleTime(time.Minute)
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to connect to %s database: %w", c.Driver, err)
+	}
+	return db, nil
+}
+
+// quote returns a table or column name quoted for the driver. The parts of a name such as schema.table are quoted
+// separately.
+func (c *Connection) quote(name string) string {
+	quote := `"`
+	if strings.EqualFold(c.Driver, DriverMySQL) {
+		quote = "`"
+	}
+
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// placeholder returns the placeholder for the nth argument of a statement, counting from 1
+func (c *Connection) placeholder(n int) string {
+	if driver, _ := c.driverName(); driver == "pgx" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// formatValue returns a column value as a string, and false if it is NULL
+func formatValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case time.Time:
+		return v.Format(time.RFC3339), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
@@ -1,90 +1,105 @@
 package personnel_sync
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/silinternational/personnel-sync/v6/alert"
-	"github.com/silinternational/personnel-sync/v6/google"
 	"github.com/silinternational/personnel-sync/v6/internal"
-	"github.com/silinternational/personnel-sync/v6/restapi"
-	"github.com/silinternational/personnel-sync/v6/webhelpdesk"
 )
 
-func RunSync(configFile string) error {
-	log.SetOutput(os.Stdout)
-	log.SetFlags(0)
+// RunSync runs all enabled sync sets as configured in configFile. It returns a summary of the results, and an error
+// if the configuration could not be loaded or if any sync set failed. No new sync set or batch of changes is started
+// once ctx is cancelled or its deadline is near, and the sync sets that were not run are reported as skipped.
+func RunSync(ctx context.Context, configFile string) (Results, error) {
+	return RunSyncWithOptions(ctx, configFile, Options{})
+}
+
+// WithStop returns a copy of ctx and a function that asks a run using it to stop, such as on an interrupt. No new sync
+// set or batch of changes is started after that, and the changes in progress are given the stop margin to finish.
+func WithStop(ctx context.Context) (context.Context, func()) {
+	return internal.WithStop(ctx)
+}
+
+// RunSyncWithOptions runs all sync sets, with options overriding parts of the config file
+func RunSyncWithOptions(ctx context.Context, configFile string, options Options) (Results, error) {
+	early := startLog()
 	log.Printf("Personnel sync started at %s", time.Now().UTC().Format(time.RFC1123Z))
 
-	rawConfig, err := internal.LoadConfig(configFile)
+	config, err := loadConfig(configFile, options)
+	setLogOutput(early, config)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to load config, error: %s", err)
-		log.Println(msg)
-		return nil
+		return Results{}, err
 	}
 
-	config, err := internal.ReadConfig(rawConfig)
-	if err != nil {
-		msg := fmt.Sprintf("Unable to read config, error: %s", err)
-		log.Println(msg)
-		alert.SendEmail(config.Alert, msg)
-		return nil
-	}
+	ctx, cancel := internal.WithRuntimeDeadline(ctx, config.Runtime)
+	defer cancel()
+
+	results, err := runSync(ctx, config)
 
-	// Instantiate Source
-	var source internal.Source
-	switch config.Source.Type {
-	case internal.SourceTypeRestAPI:
-		source, err = restapi.NewRestAPISource(config.Source)
-	case internal.SourceTypeGoogleSheets:
-		source, err = google.NewGoogleSheetsSource(config.Source)
-	default:
-		err = errors.New("unrecognized source type")
+	log.Printf("Personnel sync completed at %s: %s", results.Finished.Format(time.RFC1123Z), results.summary())
+	return results, err
+}
+
+// startLog sends the log to a buffer until the config is loaded, since the config decides where the log is written
+func startLog() *bytes.Buffer {
+	early := &bytes.Buffer{}
+	log.SetOutput(early)
+	log.SetFlags(0)
+	return early
+}
+
+// setLogOutput sends the log, starting with the lines in early, to stdout or, if the plan is written to stdout, to
+// stderr so that the plan can be parsed
+func setLogOutput(early *bytes.Buffer, config internal.Config) {
+	var w io.Writer = os.Stdout
+	if config.Runtime.DryRunMode && config.Runtime.PlanFile == internal.PlanFileStdout {
+		w = os.Stderr
 	}
+	_, _ = early.WriteTo(w)
+	log.SetOutput(w)
+}
 
+// runSync runs all enabled sync sets, and sends an alert listing any errors. If the config is in dry run mode and
+// a PlanFile is set, the plan is written to it.
+func runSync(ctx context.Context, config internal.Config) (Results, error) {
+	results := Results{Started: time.Now().UTC(), DryRun: config.Runtime.DryRunMode}
+
+	source, err := newSource(config)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to initialize %s source, error: %s", config.Source.Type, err)
-		log.Println(msg)
-		alert.SendEmail(config.Alert, msg)
-		return nil
+		return results, initError(config, config.Source.Type+" source", err)
 	}
 
-	// Instantiate Destination
-	var destination internal.Destination
-	switch config.Destination.Type {
-	case internal.DestinationTypeGoogleContacts:
-		destination, err = google.NewGoogleContactsDestination(config.Destination)
-	case internal.DestinationTypeGoogleGroups:
-		destination, err = google.NewGoogleGroupsDestination(config.Destination)
-	case internal.DestinationTypeGoogleSheets:
-		destination, err = google.NewGoogleSheetsDestination(config.Destination)
-	case internal.DestinationTypeGoogleUsers:
-		destination, err = google.NewGoogleUsersDestination(config.Destination)
-	case internal.DestinationTypeRestAPI:
-		destination, err = restapi.NewRestAPIDestination(config.Destination)
-	case internal.DestinationTypeWebHelpDesk:
-		destination, err = webhelpdesk.NewWebHelpDeskDestination(config.Destination)
-	default:
-		err = errors.New("unrecognized destination type")
+	destination, err := newDestination(config)
+	if err != nil {
+		return results, initError(config, config.Destination.Type+" destination", err)
 	}
 
+	stateStore, err := internal.NewStateStore(config.State)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to initialize %s destination, error: %s", config.Destination.Type, err)
-		log.Println(msg)
-		alert.SendEmail(config.Alert, msg)
-		return nil
+		return results, initError(config, config.State.Type+" state store", err)
 	}
 
 	maxNameLength := config.MaxSyncSetNameLength()
 	var alertList []string
+	plan := internal.Plan{Created: time.Now().UTC()}
 
 	// Iterate through SyncSets and process changes
 	for i, syncSet := range config.SyncSets {
 		if syncSet.Disable {
+			results.skip(syncSet.Name, "disabled")
+			continue
+		}
+		if internal.Stopping(ctx) {
+			log.Printf("Skipping sync set %q, stopped at the deadline", syncSet.Name)
+			results.stop(syncSet.Name)
 			continue
 		}
 
@@ -93,23 +108,25 @@ func RunSync(configFile string) error {
 			alertList = append(alertList, msg)
 		}
 		prefix := fmt.Sprintf("[ %-*s ] ", maxNameLength, syncSet.Name)
-		syncSetLogger := log.New(os.Stdout, prefix, 0)
+		syncSetLogger := log.New(log.Writer(), prefix, 0)
 		syncSetLogger.Printf("(%v/%v) Beginning sync set", i+1, len(config.SyncSets))
 
-		// Apply SyncSet configs (excluding source/destination as appropriate)
-		if err = source.ForSet(syncSet.Source); err != nil {
-			err = fmt.Errorf(`Error setting source set on syncSet "%s": %w`, syncSet.Name, err)
-			alertList = handleSyncError(syncSetLogger, err, alertList)
-		}
-
-		if err = destination.ForSet(syncSet.Destination); err != nil {
-			err = fmt.Errorf(`Error setting destination set on syncSet "%s": %w`, syncSet.Name, err)
+		setPlan, applied, err := runSyncSet(ctx, syncSetLogger, source, destination, config, syncSet, stateStore)
+		if err != nil {
+			setPlan.Error = err.Error()
 			alertList = handleSyncError(syncSetLogger, err, alertList)
 		}
+		plan.SyncSets = append(plan.SyncSets, setPlan)
+		results.add(syncSet.Name, plannedChanges(setPlan), applied, err)
+	}
 
-		if err = internal.RunSyncSet(syncSetLogger, source, destination, config); err != nil {
-			err = fmt.Errorf(`Sync failed with error on syncSet "%s": %w`, syncSet.Name, err)
-			alertList = handleSyncError(syncSetLogger, err, alertList)
+	var planErr error
+	if config.Runtime.DryRunMode && config.Runtime.PlanFile != "" {
+		if err := internal.WritePlan(plan, config.Runtime); err != nil {
+			msg := fmt.Sprintf("Unable to write plan, error: %s", err)
+			log.Println(msg)
+			alertList = append(alertList, msg)
+			planErr = fmt.Errorf("%w: unable to write plan: %w", ErrPlan, err)
 		}
 	}
 
@@ -117,8 +134,37 @@ func RunSync(configFile string) error {
 		alert.SendEmail(config.Alert, fmt.Sprintf("Sync error(s):\n%s", strings.Join(alertList, "\n")))
 	}
 
-	log.Printf("Personnel sync completed at %s", time.Now().UTC().Format(time.RFC1123Z))
-	return nil
+	results.Finished = time.Now().UTC()
+	return results, errors.Join(results.Err(), planErr)
+}
+
+// runSyncSet applies the sync set's source and destination configs and runs it. A sync set is not run if either of
+// its configs cannot be applied.
+func runSyncSet(
+	ctx context.Context,
+	logger *log.Logger,
+	source internal.Source,
+	destination internal.Destination,
+	config internal.Config,
+	syncSet internal.SyncSet,
+	stateStore internal.StateStore,
+) (internal.SyncSetPlan, internal.ChangeResults, error) {
+	plan := internal.SyncSetPlan{Name: syncSet.Name}
+
+	if err := source.ForSet(syncSet.Source); err != nil {
+		return plan, internal.ChangeResults{}, fmt.Errorf(`Error setting source set on syncSet "%s": %w`, syncSet.Name, err)
+	}
+
+	if err := destination.ForSet(syncSet.Destination); err != nil {
+		return plan, internal.ChangeResults{},
+			fmt.Errorf(`Error setting destination set on syncSet "%s": %w`, syncSet.Name, err)
+	}
+
+	plan, applied, err := internal.RunSyncSet(ctx, logger, source, destination, config, syncSet, stateStore)
+	if err != nil {
+		return plan, applied, fmt.Errorf(`Sync failed with error on syncSet "%s": %w`, syncSet.Name, err)
+	}
+	return plan, applied, nil
 }
 
 func handleSyncError(logger *log.Logger, err error, alertList []string) []string {
@@ -1,6 +1,7 @@
 package webhelpdesk
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -66,7 +67,7 @@ func (w *WebHelpDesk) ForSet(syncSetJson json.RawMessage) error {
 	return nil
 }
 
-func (w *WebHelpDesk) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+func (w *WebHelpDesk) ListUsers(ctx context.Context, desiredAttrs []string) ([]internal.Person, error) {
 	var allClients []User
 	page := 1
 
@@ -76,7 +77,7 @@ func (w *WebHelpDesk) ListUsers(desiredAttrs []string) ([]internal.Person, error
 			"page":  fmt.Sprintf("%v", page),
 		}
 
-		listUsersResp, err := w.makeHttpRequest(ClientsAPIPath, http.MethodGet, "", additionalParams)
+		listUsersResp, err := w.makeHttpRequest(ctx, ClientsAPIPath, http.MethodGet, "", additionalParams)
 		if err != nil {
 			return []internal.Person{}, err
 		}
@@ -116,6 +117,7 @@ func (w *WebHelpDesk) ListUsers(desiredAttrs []string) ([]internal.Person, error
 }
 
 func (w *WebHelpDesk) ApplyChangeSet(
+	ctx context.Context,
 	changes internal.ChangeSet,
 	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
 
@@ -126,15 +128,21 @@ func (w *WebHelpDesk) ApplyChangeSet(
 	batchTimer := internal.NewBatchTimer(w.BatchSize, w.BatchDelaySeconds)
 
 	for _, cp := range changes.Create {
+		if internal.Stopping(ctx) {
+			break
+		}
 		wg.Add(1)
-		go w.CreateUser(cp, &results.Created, &wg, eventLog)
-		batchTimer.WaitOnBatch()
+		go w.CreateUser(ctx, cp, &results.Created, &wg, eventLog)
+		batchTimer.WaitOnBatch(ctx)
 	}
 
 	for _, dp := range changes.Update {
+		if internal.Stopping(ctx) {
+			break
+		}
 		wg.Add(1)
-		go w.UpdateUser(dp, &results.Updated, &wg, eventLog)
-		batchTimer.WaitOnBatch()
+		go w.UpdateUser(ctx, dp, &results.Updated, &wg, eventLog)
+		batchTimer.WaitOnBatch(ctx)
 	}
 
 	// WHD API does not support deactivating or deleting users
@@ -145,6 +153,7 @@ func (w *WebHelpDesk) ApplyChangeSet(
 }
 
 func (w *WebHelpDesk) CreateUser(
+	ctx context.Context,
 	person internal.Person,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -168,7 +177,7 @@ func (w *WebHelpDesk) CreateUser(
 		return
 	}
 
-	_, err = w.makeHttpRequest(ClientsAPIPath, http.MethodPost, string(jsonBody), map[string]string{})
+	_, err = w.makeHttpRequest(ctx, ClientsAPIPath, http.MethodPost, string(jsonBody), map[string]string{})
 	if err != nil {
 		// Since WebHelpDesk APIs are garbage, just ignore errors, but don't count as a newly created user
 		eventLog <- internal.EventLogItem{
@@ -187,6 +196,7 @@ func (w *WebHelpDesk) CreateUser(
 }
 
 func (w *WebHelpDesk) UpdateUser(
+	ctx context.Context,
 	person internal.Person,
 	counter *uint64,
 	wg *sync.WaitGroup,
@@ -211,7 +221,7 @@ func (w *WebHelpDesk) UpdateUser(
 	}
 
 	updatePath := fmt.Sprintf("%s/%v", ClientsAPIPath, newClient.ID)
-	_, err = w.makeHttpRequest(updatePath, http.MethodPut, string(jsonBody), map[string]string{})
+	_, err = w.makeHttpRequest(ctx, updatePath, http.MethodPut, string(jsonBody), map[string]string{})
 	if err != nil {
 		// Since WebHelpDesk APIs are garbage, just ignore errors, but don't count as a newly created user
 		eventLog <- internal.EventLogItem{
@@ -229,13 +239,13 @@ func (w *WebHelpDesk) UpdateUser(
 	atomic.AddUint64(counter, 1)
 }
 
-func (w *WebHelpDesk) makeHttpRequest(path, method, body string, additionalQueryParams map[string]string) ([]byte, error) {
+func (w *WebHelpDesk) makeHttpRequest(ctx context.Context, path, method, body string, additionalQueryParams map[string]string) ([]byte, error) {
 	// Create client and request
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 	client := http.Client{Transport: tr}
-	req, err := http.NewRequest(method, w.URL+path, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, method, w.URL+path, strings.NewReader(body))
 	if err != nil {
 		return []byte{}, err
 	}
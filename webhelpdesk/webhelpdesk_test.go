@@ -1,6 +1,7 @@
 package webhelpdesk
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -234,7 +235,7 @@ func TestWebHelpDesk_ListUsers(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			got, err := w.ListUsers([]string{})
+			got, err := w.ListUsers(context.Background(), []string{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WebHelpDesk.ListUsers() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -265,7 +266,7 @@ func TestCreateChangeSet(t *testing.T) {
 		t.Fatalf("Failed to get new whd client, error: %s", err.Error())
 	}
 
-	users, err := whd.ListUsers([]string{})
+	users, err := whd.ListUsers(context.Background(), []string{})
 	if err != nil {
 		t.Fatalf("Failed to list whd users, error: %s", err.Error())
 	}
@@ -275,7 +276,7 @@ func TestCreateChangeSet(t *testing.T) {
 		t.Error(err)
 	}
 
-	sourcePeople, _ := source.ListUsers([]string{"email"})
+	sourcePeople, _ := source.ListUsers(context.Background(), []string{"email"})
 	log.Printf("found %v people in source", len(sourcePeople))
 
 	logger := log.New(os.Stdout, "", 0)
@@ -319,7 +320,7 @@ func TestWebHelpDesk_CreateUser(t *testing.T) {
 	}
 
 	eventLog := make(chan internal.EventLogItem, 50)
-	changeResults := whd.ApplyChangeSet(changeSet, eventLog)
+	changeResults := whd.ApplyChangeSet(context.Background(), changeSet, eventLog)
 	close(eventLog)
 	log.Println(changeResults)
 